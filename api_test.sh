@@ -39,10 +39,10 @@ test_api() {
 }
 
 # === CART ===
-test_api POST "/cart/add" '{"productId":"'"$PRODUCT_ID"'", "quantity": 2}'
-test_api GET "/cart"
-test_api POST "/cart/update" '{"productId":"'"$PRODUCT_ID"'", "quantity": 3}'
-test_api DELETE "/cart/remove" '{"productId":"'"$PRODUCT_ID"'"}'
+test_api POST "/api/cart/" '{"product_id":"'"$PRODUCT_ID"'", "quantity": 2}'
+test_api GET "/api/cart/"
+test_api PUT "/api/cart/update-qty" '{"product_id":"'"$PRODUCT_ID"'", "quantity": 3}'
+test_api DELETE "/api/cart/" '{"product_id":"'"$PRODUCT_ID"'"}'
 
 # === ORDER ===
 test_api POST "/order/create" '{"items":[{"productId":"'"$PRODUCT_ID"'", "quantity": 1}]}'
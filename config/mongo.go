@@ -3,6 +3,7 @@ package config
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,7 +13,12 @@ import (
 var DB *mongo.Database
 
 func ConnectMongoDB() {
-	uri := "mongodb://localhost:27017" // Adjust if needed
+	// Checkout runs in multi-document transactions, which need a replica set
+	// (see docker-compose.yml); a standalone server still works without them.
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
 
 	clientOptions := options.Client().ApplyURI(uri)
 	client, err := mongo.NewClient(clientOptions)
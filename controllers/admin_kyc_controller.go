@@ -2,9 +2,11 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"time"
 
+	"github.com/ashishnagargoje0/backend/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -23,11 +25,23 @@ func ApproveKYC(c *gin.Context) {
 	defer cancel()
 
 	update := bson.M{"$set": bson.M{"kyc_status": "approved"}}
-	_, err := kycCollection.UpdateOne(ctx, bson.M{"email": body.Email}, update)
+	res, err := kycCollection.UpdateOne(ctx, bson.M{"email": body.Email}, update)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve KYC"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "KYC submission not found"})
+		return
+	}
+
+	// KYC earns coins once per farmer, even if approved again
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"email": body.Email}).Decode(&user); err != nil {
+		log.Printf("⚠️ No user for approved KYC %s: %v", body.Email, err)
+	} else if _, err := earnCoins(ctx, user.ID, models.CoinEventKYCApproved, "kyc", 0); err != nil {
+		log.Printf("⚠️ Failed to give coins for KYC of user %s: %v", user.ID.Hex(), err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "KYC approved"})
 }
@@ -3,7 +3,6 @@ package controllers
 import (
 	"context"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ashishnagargoje0/backend/models"
@@ -39,6 +38,7 @@ func InitiateRefund(c *gin.Context) {
 		OrderID string  `json:"order_id" binding:"required"`
 		Reason  string  `json:"reason" binding:"required"`
 		Amount  float64 `json:"amount" binding:"required"`
+		Method  string  `json:"method"` // original (default) or wallet
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -46,22 +46,32 @@ func InitiateRefund(c *gin.Context) {
 		return
 	}
 
-	refund := models.Refund{
-		ID:        primitive.NewObjectID(),
-		OrderID:   input.OrderID,
-		Reason:    input.Reason,
-		Amount:    input.Amount,
-		Status:    "Initiated",
-		CreatedAt: time.Now(),
+	orderObjectID, err := primitive.ObjectIDFromHex(input.OrderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var order models.Order
+	err = database.OrderCollection.FindOne(context.TODO(), bson.M{"_id": orderObjectID}).Decode(&order)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
 	}
 
-	_, err := database.RefundCollection.InsertOne(context.TODO(), refund)
+	// Refunds are bounded by what the farmer was charged at checkout
+	if input.Amount <= 0 || input.Amount > order.TotalAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount must be between 0 and the order total"})
+		return
+	}
+
+	refund, err := issueRefund(context.TODO(), order, models.Refund{Reason: input.Reason, Amount: input.Amount, Method: input.Method})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate refund"})
+		respondRefundError(c, err, refund)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Refund initiated", "refund_id": refund.ID.Hex()})
+	c.JSON(http.StatusOK, gin.H{"message": "Refund initiated", "refund_id": refund.ID.Hex(), "status": refund.Status})
 }
 
 // POST /admin/commission/calculate
@@ -121,32 +131,28 @@ func GetAdminPaymentHistory(c *gin.Context) {
 
 // POST /admin/credit/manual-add
 func ManualCredit(c *gin.Context) {
-	var input struct {
-		UserID string  `json:"user_id" binding:"required"`
-		Amount float64 `json:"amount" binding:"required"`
-		Reason string  `json:"reason"`
-	}
-
+	var input models.ManualCreditInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	credit := models.WalletTransaction{
-		ID:        primitive.NewObjectID(),
-		UserID:    input.UserID,
-		Amount:    input.Amount,
-		Type:      "Credit",
-		Reason:    input.Reason,
-		CreatedAt: time.Now(),
+	userID, err := primitive.ObjectIDFromHex(input.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
 	}
 
-	_, err := database.WalletTransactionCollection.InsertOne(context.TODO(), credit)
+	reason := input.Reason
+	if reason == "" {
+		reason = "Credited by " + c.GetString("email")
+	}
+
+	credit, err := creditWallet(context.TODO(), userID, input.Amount, models.WalletSourceManual, "", reason)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add credit"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Manual credit added", "transaction_id": credit.ID.Hex()})
+	c.JSON(http.StatusOK, gin.H{"message": "Manual credit added", "transaction_id": credit.ID.Hex(), "balance": credit.BalanceAfter})
 }
-
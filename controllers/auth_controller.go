@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/ashishnagargoje0/backend/utils"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -55,6 +57,7 @@ func Signup(c *gin.Context) {
 	}
 
 	user := models.User{
+		ID:        primitive.NewObjectID(),
 		Name:      input.Name,
 		Email:     input.Email,
 		Password:  string(hashedPassword),
@@ -69,6 +72,12 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	// GET /referral/code creates the code later if this fails
+	code, err := referralCodeFor(ctx, user.ID)
+	if err != nil {
+		log.Printf("⚠️ Referral code not created for user %s: %v", user.ID.Hex(), err)
+	}
+
 	token, err := utils.GenerateToken(user.Email, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -76,8 +85,9 @@ func Signup(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Signup successful",
-		"token":   token,
+		"message":       "Signup successful",
+		"token":         token,
+		"referral_code": code.Code,
 	})
 }
 
@@ -119,6 +129,7 @@ func Login(c *gin.Context) {
 			"email": user.Email,
 			"role":  user.Role,
 		},
+		"cartMerged": mergeGuestCartOnLogin(ctx, c, user.ID), // lines moved over from the guest cart
 	})
 }
 
@@ -225,6 +236,7 @@ func RegisterPhone(c *gin.Context) {
 
 	if err == mongo.ErrNoDocuments {
 		newUser := models.User{
+			ID:         primitive.NewObjectID(),
 			Phone:      input.Phone,
 			Name:       input.Name,
 			OTP:        otp,
@@ -237,6 +249,9 @@ func RegisterPhone(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 			return
 		}
+		if _, err := referralCodeFor(ctx, newUser.ID); err != nil {
+			log.Printf("⚠️ Referral code not created for user %s: %v", newUser.ID.Hex(), err)
+		}
 	} else {
 		_, err := userCollection.UpdateOne(ctx,
 			bson.M{"phone": input.Phone},
@@ -309,5 +324,6 @@ func VerifyOTP(c *gin.Context) {
 			"name":  user.Name,
 			"phone": user.Phone,
 		},
+		"cartMerged": mergeGuestCartOnLogin(ctx, c, user.ID),
 	})
 }
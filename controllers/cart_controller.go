@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -11,7 +12,6 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var cartCollection *mongo.Collection
@@ -26,6 +26,13 @@ func InitCartCollection() {
 
 // Internal helper: Get logged-in user's ObjectID from context
 func getUserObjectID(c *gin.Context) (primitive.ObjectID, bool) {
+	// AuthMiddleware already resolved the user from the token
+	if val, ok := c.Get("user_id"); ok {
+		if userID, ok := val.(primitive.ObjectID); ok && !userID.IsZero() {
+			return userID, true
+		}
+	}
+
 	val, ok := c.Get("email")
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
@@ -53,36 +60,30 @@ func getUserObjectID(c *gin.Context) (primitive.ObjectID, bool) {
 
 // ✅ Add item to cart or increment quantity if already present
 func AddToCart(c *gin.Context) {
-	var item models.CartItem
-	if err := c.ShouldBindJSON(&item); err != nil {
+	var input models.CartQuantityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	productID, err := primitive.ObjectIDFromHex(input.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
 
 	userID, ok := getUserObjectID(c)
 	if !ok {
 		return
 	}
 
-	item.UserID = userID
-	item.ID = primitive.NewObjectID()
-	item.CreatedAt = time.Now()
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"user_id": item.UserID, "product_id": item.ProductID}
-	update := bson.M{
-		"$inc": bson.M{"quantity": item.Quantity},
-		"$setOnInsert": bson.M{
-			"_id":        item.ID,
-			"created_at": item.CreatedAt,
-		},
-	}
-	opts := options.Update().SetUpsert(true)
-
-	_, err := cartCollection.UpdateOne(ctx, filter, update, opts)
-	if err != nil {
+	if err := addCartItem(ctx, userID, productID, input.Quantity); err != nil {
+		if errors.Is(err, errProductUnavailable) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to cart"})
 		return
 	}
@@ -90,7 +91,7 @@ func AddToCart(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Added to cart"})
 }
 
-// ✅ View all items in user's cart
+// ✅ View the user's cart priced against live product data
 func ViewCart(c *gin.Context) {
 	userID, ok := getUserObjectID(c)
 	if !ok {
@@ -100,44 +101,39 @@ func ViewCart(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"user_id": userID}
-	cursor, err := cartCollection.Find(ctx, filter)
+	items, err := userCartItems(ctx, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading cart items"})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var items []models.CartItem
-	if err := cursor.All(ctx, &items); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading cart items"})
+	summary, err := buildCartSummary(ctx, userID, items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price cart"})
 		return
 	}
 
+	message := "Cart fetched successfully"
 	if len(items) == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Cart is empty",
-			"cart":    []models.CartItem{},
-		})
-		return
+		message = "Cart is empty"
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Cart fetched successfully",
-		"cart":    items,
-	})
+	c.JSON(http.StatusOK, gin.H{"message": message, "cart": summary})
 }
 
-
 // ✅ Remove item by product_id
 func RemoveFromCart(c *gin.Context) {
 	var input struct {
-		ProductID string `json:"product_id"`
+		ProductID string `json:"product_id" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	productID, err := primitive.ObjectIDFromHex(input.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
 
 	userID, ok := getUserObjectID(c)
 	if !ok {
@@ -147,23 +143,43 @@ func RemoveFromCart(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"user_id": userID, "product_id": input.ProductID}
-	_, err := cartCollection.DeleteOne(ctx, filter)
+	respondCartRemoval(c, removeCartItem(ctx, userID, bson.M{"product_id": productID}))
+}
+
+// ✅ Remove one of the user's cart lines by its _id
+func RemoveCartItemByID(c *gin.Context) {
+	itemID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove item"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart"})
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	respondCartRemoval(c, removeCartItem(ctx, userID, bson.M{"_id": itemID}))
+}
+
+func respondCartRemoval(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errCartItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found in cart"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove item"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart"})
+	}
 }
 
 // ✅ Update cart item quantity
 func UpdateCartQuantity(c *gin.Context) {
-	var input struct {
-		ProductID string `json:"product_id"`
-		Quantity  int    `json:"quantity"`
-	}
-	if err := c.ShouldBindJSON(&input); err != nil || input.Quantity < 1 {
+	var input models.CartQuantityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
@@ -183,11 +199,7 @@ func UpdateCartQuantity(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"user_id": userID, "product_id": productObjID}
-	update := bson.M{"$set": bson.M{"quantity": input.Quantity}}
-
-	result, err := cartCollection.UpdateOne(ctx, filter, update)
-	if err != nil || result.MatchedCount == 0 {
+	if err := setCartItemQuantity(ctx, userID, productObjID, input.Quantity); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found or update failed"})
 		return
 	}
@@ -195,105 +207,31 @@ func UpdateCartQuantity(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Cart quantity updated"})
 }
 
-
-// ✅ Checkout: creates order & clears cart
+// ✅ Checkout: creates order & clears cart, optionally redeeming coins.
+// Served at both POST /api/checkout and POST /api/orders/.
 func Checkout(c *gin.Context) {
 	userID, ok := getUserObjectID(c)
 	if !ok {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	filter := bson.M{"user_id": userID}
-	cursor, err := cartCollection.Find(ctx, filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
-		return
-	}
-	defer cursor.Close(ctx)
-
-	var cartItems []models.CartItem
-	if err := cursor.All(ctx, &cartItems); err != nil || len(cartItems) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty or unreadable"})
-		return
-	}
-
-	order := bson.M{
-		"user_id":    userID,
-		"items":      cartItems,
-		"status":     "pending",
-		"created_at": time.Now(),
-	}
-
-	orderCollection := config.DB.Collection("orders")
-	_, err = orderCollection.InsertOne(ctx, order)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
-		return
-	}
-
-	_, err = cartCollection.DeleteMany(ctx, filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order placed but failed to clear cart"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Order placed successfully", "order": order})
-}
-
-// ✅ View cart using query param for admin or external cases
-func ViewCartByQueryParam(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	if userIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
-	}
-
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
-		return
+	// The body is optional: coins to redeem and where to deliver
+	var input models.CheckoutInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checkout request"})
+			return
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"user_id": userID}
-	cursor, err := cartCollection.Find(ctx, filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-	defer cursor.Close(ctx)
-
-	var items []models.CartItem
-	if err := cursor.All(ctx, &items); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading data"})
-		return
-	}
-
-	c.JSON(http.StatusOK, items)
-}
-
-// ✅ Remove cart item by MongoDB _id
-func RemoveCartItemByID(c *gin.Context) {
-	itemID := c.Param("id")
-	objID, err := primitive.ObjectIDFromHex(itemID)
+	order, err := placeOrderFromCart(ctx, userID, input)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		respondCheckoutError(c, err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	res, err := cartCollection.DeleteOne(ctx, bson.M{"_id": objID})
-	if err != nil || res.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found or delete failed"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Item removed successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Order placed successfully", "order": order})
 }
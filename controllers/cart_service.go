@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/internal/invoice"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The cart service: every cart route and checkout goes through these
+// functions. Each one takes the signed-in user's ID and only ever touches
+// that user's lines, so no route can read or change someone else's cart.
+
+// Orders that discounts and coins pay for in full are paid at checkout
+const (
+	paymentCovered   = "covered" // payment_status of such an order
+	coveredOrderNote = "Covered by discounts and coins"
+)
+
+var (
+	errCartEmpty        = errors.New("cart is empty")
+	errCartItemNotFound = errors.New("item not found in cart")
+	errUnknownState     = errors.New("unknown state in shipping address")
+)
+
+// userCartItems returns the user's cart lines, oldest first
+func userCartItems(ctx context.Context, userID primitive.ObjectID) ([]models.CartItem, error) {
+	cursor, err := cartCollection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []models.CartItem{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// addCartItem adds quantity of a product to the cart, remembering the price
+// the farmer saw when it was first added
+func addCartItem(ctx context.Context, userID, productID primitive.ObjectID, quantity int) error {
+	var product models.Product
+	if err := database.GetCollection("products").FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		return fmt.Errorf("%w: %s", errProductUnavailable, productID.Hex())
+	}
+
+	_, err := cartCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "product_id": productID},
+		bson.M{
+			"$inc": bson.M{"quantity": quantity},
+			"$setOnInsert": bson.M{
+				"_id":          primitive.NewObjectID(),
+				"price_at_add": product.Price,
+				"created_at":   time.Now(),
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// setCartItemQuantity replaces the quantity of a product already in the cart
+func setCartItemQuantity(ctx context.Context, userID, productID primitive.ObjectID, quantity int) error {
+	res, err := cartCollection.UpdateOne(ctx,
+		bson.M{"user_id": userID, "product_id": productID},
+		bson.M{"$set": bson.M{"quantity": quantity}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errCartItemNotFound
+	}
+	return nil
+}
+
+// removeCartItem deletes one of the user's lines matching filter, e.g. by
+// product_id or by the line's own _id
+func removeCartItem(ctx context.Context, userID primitive.ObjectID, filter bson.M) error {
+	filter["user_id"] = userID
+	res, err := cartCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errCartItemNotFound
+	}
+	return nil
+}
+
+// clearCart empties the user's cart and drops the applied coupon
+func clearCart(ctx context.Context, userID primitive.ObjectID) error {
+	if _, err := cartCollection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	_, err := cartCouponCollection.DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+// buildCartSummary joins cart items with live products and stock and prices
+// them the way checkout will: promotions, the applied coupon and GST. Lines
+// whose product was removed are listed but left out of the totals.
+func buildCartSummary(ctx context.Context, userID primitive.ObjectID, items []models.CartItem) (models.CartSummary, error) {
+	summary := models.CartSummary{Items: []models.CartLine{}, Discounts: []models.AppliedDiscount{}, CheckoutReady: len(items) > 0}
+	if len(items) == 0 {
+		return summary, nil
+	}
+
+	products, err := cartProducts(ctx, items)
+	if err != nil {
+		return summary, err
+	}
+	productIDs := make([]primitive.ObjectID, 0, len(products))
+	for id := range products {
+		productIDs = append(productIDs, id)
+	}
+	available, err := availableQuantities(ctx, productIDs)
+	if err != nil {
+		return summary, err
+	}
+
+	preview := models.Order{UserID: userID, PlaceOfSupply: placeOfSupply(ctx, userID)}
+	for _, item := range items {
+		var line models.CartLine
+		if product, ok := products[item.ProductID]; ok {
+			stock, tracked := available[item.ProductID]
+			if !tracked && product.InStock {
+				stock = item.Quantity // not stocked in any warehouse yet
+			}
+			line = models.NewCartLine(item, &product, stock)
+			preview.Items = append(preview.Items, orderItemFromProduct(product, item.Quantity))
+		} else {
+			line = models.NewCartLine(item, nil, 0)
+		}
+		summary.Items = append(summary.Items, line)
+		summary.ItemCount += item.Quantity
+		summary.PriceChanged = summary.PriceChanged || line.PriceChanged
+		summary.CheckoutReady = summary.CheckoutReady && line.InStock && !line.Unavailable
+	}
+
+	summary.Coupon = cartCouponCode(ctx, userID)
+	if err := applyOrderDiscounts(ctx, &preview, summary.Coupon); err != nil {
+		if !models.IsCouponRejection(err) {
+			return summary, err
+		}
+		summary.CouponError = err.Error()
+	}
+	preview.CalculateTotals(invoice.SellerFromEnv().StateCode)
+
+	summary.Subtotal = preview.Subtotal
+	summary.Discounts = preview.Discounts
+	summary.Discount = preview.Discount
+	summary.Tax = preview.TaxBreakdown
+	summary.Total = preview.TotalAmount
+	return summary, nil
+}
+
+// placeOrderFromCart turns the user's cart into a pending order: prices are
+// snapshotted, discounts locked in, stock reserved, the coupon use claimed,
+// coins redeemed and the cart cleared. All of it commits in one transaction
+// or none of it does; without transactions, anything taken is given back by
+// hand if a later step fails.
+func placeOrderFromCart(ctx context.Context, userID primitive.ObjectID, input models.CheckoutInput) (models.Order, error) {
+	var order models.Order
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = buildCheckoutOrder(ctx, userID, input)
+		return err
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	if order.Status == models.OrderStatusPaid {
+		confirmCoveredOrder(ctx, order.ID)
+	}
+	return order, nil
+}
+
+// confirmCoveredOrder does what a payment would for an order that needed
+// none. Nothing was paid, so no coins are earned and no referral rewarded.
+func confirmCoveredOrder(ctx context.Context, orderID primitive.ObjectID) {
+	// The invoice can be issued again on download, so a failure here is not fatal
+	if err := issueInvoiceForOrder(ctx, orderID); err != nil {
+		log.Printf("⚠️ Failed to issue invoice for order %s: %v", orderID.Hex(), err)
+	}
+}
+
+// buildCheckoutOrder does the checkout writes. It starts from the cart every
+// time so the transaction can safely run it again after a write conflict.
+func buildCheckoutOrder(ctx context.Context, userID primitive.ObjectID, input models.CheckoutInput) (models.Order, error) {
+	cartItems, err := userCartItems(ctx, userID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if len(cartItems) == 0 {
+		return models.Order{}, errCartEmpty
+	}
+
+	items, err := snapshotOrderItems(ctx, cartItems)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	now := time.Now()
+	order := models.Order{
+		ID:            primitive.NewObjectID(),
+		UserID:        userID,
+		Items:         items,
+		Status:        models.OrderStatusPending,
+		PlaceOfSupply: placeOfSupply(ctx, userID),
+		StatusHistory: newOrderHistory(now),
+		CreatedAt:     now,
+	}
+	if address := input.ShippingAddress; address != nil {
+		address.StateCode = models.GSTStateCode(address.State)
+		if address.StateCode == "" {
+			return models.Order{}, fmt.Errorf("%w: %q", errUnknownState, address.State)
+		}
+		order.ShippingAddress = address
+		order.PlaceOfSupply = address.StateCode
+	}
+	if err := applyOrderDiscounts(ctx, &order, cartCouponCode(ctx, userID)); err != nil {
+		return models.Order{}, err
+	}
+	sellerState := invoice.SellerFromEnv().StateCode
+	order.CalculateTotals(sellerState)
+	order.RedeemCoins(input.Coins, sellerState)
+
+	// Nothing is left to collect when discounts and coins cover the order
+	if order.TotalAmount <= 0 {
+		order.Status = models.OrderStatusPaid
+		order.PaymentStatus = paymentCovered
+		order.StatusHistory = append(order.StatusHistory, models.OrderStatusEvent{
+			Status:    models.OrderStatusPaid,
+			Note:      coveredOrderNote,
+			ChangedAt: now,
+		})
+	}
+
+	if err := reserveStock(ctx, order.ID, cartItems); err != nil {
+		return models.Order{}, err
+	}
+
+	compensate := !database.InTransaction(ctx)
+	undo := func(coupon, coins bool) {
+		if !compensate {
+			return // aborting the transaction undoes everything
+		}
+		if relErr := releaseStock(ctx, order.ID); relErr != nil {
+			log.Printf("⚠️ Failed to release stock for order %s: %v", order.ID.Hex(), relErr)
+		}
+		if coupon {
+			if relErr := releaseCoupon(ctx, order.ID); relErr != nil {
+				log.Printf("⚠️ Failed to release coupon for order %s: %v", order.ID.Hex(), relErr)
+			}
+		}
+		if coins {
+			if relErr := returnCoins(ctx, userID, order.CoinsUsed, "order:"+order.ID.Hex(), "Checkout failed"); relErr != nil {
+				log.Printf("⚠️ Failed to return %d coins for order %s: %v", order.CoinsUsed, order.ID.Hex(), relErr)
+			}
+		}
+	}
+
+	if err := claimCoupon(ctx, order); err != nil {
+		undo(false, false)
+		return models.Order{}, err
+	}
+
+	if err := deductCoins(ctx, userID, order.CoinsUsed, "order:"+order.ID.Hex(), "Redeemed at checkout"); err != nil {
+		undo(true, false)
+		return models.Order{}, err
+	}
+
+	if _, err := orderCollection.InsertOne(ctx, order); err != nil {
+		undo(true, true)
+		return models.Order{}, err
+	}
+
+	if err := clearCart(ctx, userID); err != nil {
+		if compensate {
+			// The order stands even if the cart cannot be cleared right now
+			log.Printf("⚠️ Order %s placed but cart of user %s not cleared: %v", order.ID.Hex(), userID.Hex(), err)
+			return order, nil
+		}
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+// respondCheckoutError maps placeOrderFromCart errors to HTTP responses
+func respondCheckoutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errCartEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+	case errors.Is(err, errUnknownState):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errProductUnavailable), errors.Is(err, errInsufficientStock), errors.Is(err, errInsufficientCoins):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case models.IsCouponRejection(err):
+		respondDiscountError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
+	}
+}
@@ -0,0 +1,413 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The coin service: balances in "coins" only change through creditCoins
+// and deductCoins, which post each movement to the ledger. Coins are earned
+// by the events admins set rules for (see models.CoinRule); each earning is
+// kept as a batch so it can expire or be taken back.
+
+var errInsufficientCoins = errors.New("insufficient coins")
+
+// deductCoins takes n coins from the user's balance, failing rather than
+// going negative when two spends race. The reference (e.g. order:<id>)
+// names what the coins paid for; each is charged once. Earned batches are
+// used up soonest-expiring first.
+func deductCoins(ctx context.Context, userID primitive.ObjectID, n int, reference, reason string) error {
+	if n <= 0 {
+		return nil
+	}
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := debitCoins(ctx, userID, n, reference, reason); err != nil {
+			return err
+		}
+		return useCoinEarnings(ctx, userID, n, reference)
+	})
+}
+
+// debitCoins takes coins off the balance without touching earned batches
+func debitCoins(ctx context.Context, userID primitive.ObjectID, n int, reference, reason string) error {
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		res, err := config.DB.Collection("coins").UpdateOne(ctx,
+			bson.M{"user_id": userID, "coins": bson.M{"$gte": n}},
+			bson.M{"$inc": bson.M{"coins": -n}},
+		)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errInsufficientCoins
+		}
+		return postCoins(ctx, userID, n, models.LedgerKindCoinsDebit, reference, reason)
+	})
+}
+
+// creditCoins gives n coins to the user, creating the balance if needed.
+// The reference (e.g. order:<id> when an order's coins are returned) is
+// credited once; a repeat returns errLedgerEntryExists.
+func creditCoins(ctx context.Context, userID primitive.ObjectID, n int, reference, reason string) error {
+	if n <= 0 {
+		return nil
+	}
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := config.DB.Collection("coins").UpdateOne(ctx,
+			bson.M{"user_id": userID},
+			bson.M{"$inc": bson.M{"coins": n}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+		return postCoins(ctx, userID, n, models.LedgerKindCoinsCredit, reference, reason)
+	})
+}
+
+// returnCoins gives back the n coins spent under reference, e.g. when the
+// order they paid for is cancelled. They return to the batches they were
+// taken from: whatever those batches have since expired or lost is taken
+// back again at once. Like creditCoins, a repeat returns errLedgerEntryExists.
+func returnCoins(ctx context.Context, userID primitive.ObjectID, n int, reference, reason string) error {
+	if n <= 0 {
+		return nil
+	}
+	var restored []models.CoinEarning
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := creditCoins(ctx, userID, n, reference, reason); err != nil {
+			return err
+		}
+		var err error
+		restored, err = restoreCoinEarnings(ctx, userID, reference)
+		if err != nil && !database.InTransaction(ctx) {
+			// The coins are back; they just will not expire
+			log.Printf("⚠️ Coins returned to user %s for %s not tracked for expiry: %v", userID.Hex(), reference, err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, batch := range restored {
+		if err := takeBackCoins(ctx, batch, batch.Status); err != nil {
+			log.Printf("⚠️ Failed to take back returned coins %s of user %s: %v", batch.ID.Hex(), userID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// restoreCoinEarnings puts what reference spent back into each batch it was
+// taken from, and returns the batches already expired or revoked, with the
+// coins put back as what remains of them and their status as it was
+func restoreCoinEarnings(ctx context.Context, userID primitive.ObjectID, reference string) ([]models.CoinEarning, error) {
+	earnings := config.DB.Collection("coin_earnings")
+	cursor, err := earnings.Find(ctx, bson.M{"user_id": userID, "uses.reference": reference})
+	if err != nil {
+		return nil, err
+	}
+	var batches []models.CoinEarning
+	if err := cursor.All(ctx, &batches); err != nil {
+		return nil, err
+	}
+
+	var closed []models.CoinEarning
+	for _, batch := range batches {
+		coins := 0
+		for _, use := range batch.Uses {
+			if use.Reference == reference {
+				coins += use.Coins
+			}
+		}
+		res, err := earnings.UpdateOne(ctx,
+			bson.M{"_id": batch.ID, "uses.reference": reference},
+			bson.M{
+				"$inc":  bson.M{"remaining": coins},
+				"$set":  bson.M{"status": models.CoinEarningActive},
+				"$pull": bson.M{"uses": bson.M{"reference": reference}},
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if res.ModifiedCount == 0 {
+			continue // restored meanwhile
+		}
+		expired := batch.ExpiresAt != nil && !batch.ExpiresAt.After(time.Now())
+		switch {
+		case batch.Status == models.CoinEarningRevoked:
+		case batch.Status == models.CoinEarningExpired || expired:
+			batch.Status = models.CoinEarningExpired
+		default:
+			continue
+		}
+		batch.Remaining += coins
+		closed = append(closed, batch)
+	}
+	return closed, nil
+}
+
+// postCoins records a coin movement that was just applied to the balance,
+// undoing it by hand if the posting fails outside a transaction
+func postCoins(ctx context.Context, userID primitive.ObjectID, n int, kind, reference, reason string) error {
+	err := postLedger(ctx, coinsLedgerEntry(userID, n, kind, reference, reason))
+	if err == nil || database.InTransaction(ctx) {
+		return err
+	}
+	delta := n
+	if kind == models.LedgerKindCoinsCredit {
+		delta = -n
+	}
+	if _, rerr := config.DB.Collection("coins").UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{"$inc": bson.M{"coins": delta}}); rerr != nil {
+		log.Printf("⚠️ Coins of user %s are off by %d: %v", userID.Hex(), -delta, rerr)
+	}
+	return err
+}
+
+// coinBalance returns the user's coins; no balance yet means zero
+func coinBalance(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	var coins models.CoinsBalance
+	err := config.DB.Collection("coins").FindOne(ctx, bson.M{"user_id": userID}).Decode(&coins)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return coins.Coins, err
+}
+
+// ======================= EARNING =======================
+
+// coinRule returns the rule for event, and false if none is set
+func coinRule(ctx context.Context, event string) (models.CoinRule, bool, error) {
+	var rule models.CoinRule
+	err := config.DB.Collection("coin_rules").FindOne(ctx, bson.M{"_id": event}).Decode(&rule)
+	if err == mongo.ErrNoDocuments {
+		return models.CoinRule{Event: event}, false, nil
+	}
+	return rule, err == nil, err
+}
+
+// earnCoins gives the farmer what the event's rule says for subject (e.g.
+// the order ID), given amount for per-rupee rules. Each subject earns once;
+// the number of coins given is returned.
+func earnCoins(ctx context.Context, userID primitive.ObjectID, event, subject string, amount float64) (int, error) {
+	rule, ok, err := coinRule(ctx, event)
+	if err != nil || !ok || !rule.Active {
+		return 0, err
+	}
+	coins, err := grantCoins(ctx, userID, rule, subject, rule.CoinsFor(amount))
+	if errors.Is(err, errLedgerEntryExists) {
+		return 0, nil
+	}
+	return coins, err
+}
+
+// grantCoins credits coins earned from rule.Event, trimmed to the rule's
+// caps, as a batch that expires by the rule. A subject already rewarded
+// returns errLedgerEntryExists.
+func grantCoins(ctx context.Context, userID primitive.ObjectID, rule models.CoinRule, subject string, coins int) (int, error) {
+	now := time.Now()
+	earned, err := coinsEarnedSince(ctx, userID, rule.Event, rule.CapWindowStart(now))
+	if err != nil {
+		return 0, err
+	}
+	coins = rule.Grantable(coins, earned)
+	if coins <= 0 {
+		return 0, nil
+	}
+
+	earning := models.CoinEarning{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Event:     rule.Event,
+		Subject:   subject,
+		Coins:     coins,
+		Remaining: coins,
+		Status:    models.CoinEarningActive,
+		ExpiresAt: rule.ExpiresAt(now),
+		CreatedAt: now,
+	}
+	err = database.WithTransaction(ctx, func(ctx context.Context) error {
+		reference := fmt.Sprintf("earn:%s:%s:%s", rule.Event, userID.Hex(), subject)
+		if err := creditCoins(ctx, userID, coins, reference, "Earned: "+rule.Event); err != nil {
+			return err
+		}
+		_, err := config.DB.Collection("coin_earnings").InsertOne(ctx, earning)
+		if err != nil && !database.InTransaction(ctx) {
+			// The coins stand; they just will not expire
+			log.Printf("⚠️ Coins earned by user %s for %s %s not tracked for expiry: %v", userID.Hex(), rule.Event, subject, err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return coins, nil
+}
+
+// coinsEarnedSince adds up what the farmer earned from event since `since`
+func coinsEarnedSince(ctx context.Context, userID primitive.ObjectID, event string, since time.Time) (int, error) {
+	cursor, err := config.DB.Collection("coin_earnings").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID, "event": event, "created_at": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "coins": bson.M{"$sum": "$coins"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var rows []struct {
+		Coins int `bson:"coins"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	return rows[0].Coins, nil
+}
+
+// useCoinEarnings marks n coins spent under reference against the farmer's
+// earned batches, the ones expiring soonest first, then those that never
+// expire
+func useCoinEarnings(ctx context.Context, userID primitive.ObjectID, n int, reference string) error {
+	earnings := config.DB.Collection("coin_earnings")
+	for _, expiring := range []bool{true, false} {
+		cursor, err := earnings.Find(ctx,
+			bson.M{"user_id": userID, "status": models.CoinEarningActive, "expires_at": bson.M{"$exists": expiring}},
+			options.Find().SetSort(bson.D{{Key: "expires_at", Value: 1}, {Key: "created_at", Value: 1}}),
+		)
+		if err != nil {
+			return err
+		}
+		var batches []models.CoinEarning
+		if err := cursor.All(ctx, &batches); err != nil {
+			return err
+		}
+
+		for _, batch := range batches {
+			if n <= 0 {
+				return nil
+			}
+			used := min(batch.Remaining, n)
+			status := models.CoinEarningActive
+			if used == batch.Remaining {
+				status = models.CoinEarningUsed
+			}
+			res, err := earnings.UpdateOne(ctx,
+				bson.M{"_id": batch.ID, "remaining": batch.Remaining},
+				bson.M{
+					"$set":  bson.M{"remaining": batch.Remaining - used, "status": status},
+					"$push": bson.M{"uses": models.CoinUse{Reference: reference, Coins: used}},
+				},
+			)
+			if err != nil {
+				return err
+			}
+			if res.ModifiedCount > 0 {
+				n -= used
+			}
+		}
+	}
+	return nil
+}
+
+// takeBackCoins closes an earned batch with status (expired or revoked) and
+// removes what is left of it from the balance
+func takeBackCoins(ctx context.Context, batch models.CoinEarning, status string) error {
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		res, err := config.DB.Collection("coin_earnings").UpdateOne(ctx,
+			bson.M{"_id": batch.ID, "status": models.CoinEarningActive, "remaining": batch.Remaining},
+			bson.M{"$set": bson.M{"status": status, "remaining": 0}},
+		)
+		if err != nil || res.ModifiedCount == 0 {
+			return err // spent or closed meanwhile
+		}
+
+		balance, err := coinBalance(ctx, batch.UserID)
+		if err != nil {
+			return err
+		}
+		n := min(batch.Remaining, balance)
+		if n <= 0 {
+			return nil
+		}
+		err = debitCoins(ctx, batch.UserID, n, status+":"+batch.ID.Hex(), fmt.Sprintf("Coins %s: %s", status, batch.Event))
+		if err != nil && !database.InTransaction(ctx) {
+			config.DB.Collection("coin_earnings").UpdateOne(ctx, bson.M{"_id": batch.ID}, bson.M{"$set": bson.M{
+				"status":    models.CoinEarningActive,
+				"remaining": batch.Remaining,
+			}})
+		}
+		return err
+	})
+}
+
+// revokeEarnedCoins takes back what is left of the coins subject earned,
+// e.g. when the paid order that earned them is cancelled
+func revokeEarnedCoins(ctx context.Context, userID primitive.ObjectID, event, subject string) error {
+	var batch models.CoinEarning
+	err := config.DB.Collection("coin_earnings").FindOne(ctx, bson.M{
+		"user_id": userID,
+		"event":   event,
+		"subject": subject,
+		"status":  models.CoinEarningActive,
+	}).Decode(&batch)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return takeBackCoins(ctx, batch, models.CoinEarningRevoked)
+}
+
+// expireCoins takes back the unspent part of every batch past its expiry
+func expireCoins(ctx context.Context) error {
+	cursor, err := config.DB.Collection("coin_earnings").Find(ctx, bson.M{
+		"status":     models.CoinEarningActive,
+		"remaining":  bson.M{"$gt": 0},
+		"expires_at": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	var batches []models.CoinEarning
+	if err := cursor.All(ctx, &batches); err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err := takeBackCoins(ctx, batch, models.CoinEarningExpired); err != nil {
+			log.Printf("⚠️ Failed to expire coins %s of user %s: %v", batch.ID.Hex(), batch.UserID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// RunCoinExpiryJob expires earned coins every interval until ctx is done
+func RunCoinExpiryJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := expireCoins(runCtx); err != nil {
+			log.Printf("⚠️ Coin expiry run failed: %v", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
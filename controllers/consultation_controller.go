@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"time"
 
@@ -38,24 +39,48 @@ func BookConsultation(c *gin.Context) {
 	userIDRaw, _ := c.Get("user_id")
 	userID := userIDRaw.(primitive.ObjectID)
 
-	consultation := bson.M{
-		"user_id":   userID,
-		"expert_id": input.ExpertID,
-		"topic":     input.Topic,
-		"status":    "booked",
-		"timestamp": time.Now(),
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Free if the farmer's plan still has consultations left this period.
+	// When the plan cannot be checked nothing is booked, rather than
+	// charging a farmer who may be entitled.
+	grant, err := useEntitlement(ctx, userID, models.EntitlementConsultations, 1)
+	if err != nil {
+		log.Printf("⚠️ Consultation entitlement not checked for user %s: %v", userID.Hex(), err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Could not check your plan; please try again"})
+		return
+	}
+	booked := false
+	defer func() {
+		if booked {
+			return
+		}
+		if rerr := releaseEntitlement(ctx, grant); rerr != nil {
+			log.Printf("⚠️ Failed to give back consultation entitlement to user %s: %v", userID.Hex(), rerr)
+		}
+	}()
+
+	consultation := bson.M{
+		"user_id":                 userID,
+		"expert_id":               input.ExpertID,
+		"topic":                   input.Topic,
+		"status":                  models.ConsultationBooked,
+		"covered_by_subscription": grant != nil,
+		"timestamp":               time.Now(),
+	}
+	if grant != nil {
+		consultation["entitlement"] = grant
+	}
+
 	res, err := ConsultationCollection.InsertOne(ctx, consultation)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to book consultation"})
 		return
 	}
+	booked = true
 
-	c.JSON(http.StatusOK, gin.H{"message": "Consultation booked", "consultation_id": res.InsertedID})
+	c.JSON(http.StatusOK, gin.H{"message": "Consultation booked", "consultation_id": res.InsertedID, "covered_by_subscription": grant != nil})
 }
 
 // ====== GET /consultation/status/:id ======
@@ -82,6 +107,8 @@ func GetConsultationStatus(c *gin.Context) {
 }
 
 // ====== POST /consultation/feedback ======
+// Feedback is given on one of the farmer's own consultations once it has
+// been held, and earns coins once per consultation.
 
 func SubmitConsultationFeedback(c *gin.Context) {
 	var input models.ConsultationFeedback
@@ -97,13 +124,69 @@ func SubmitConsultationFeedback(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := config.DB.Collection("consultation_feedback").InsertOne(ctx, input)
+	var consultation struct {
+		Status string `bson:"status"`
+	}
+	err := ConsultationCollection.FindOne(ctx, bson.M{"_id": input.ConsultationID, "user_id": input.UserID}).Decode(&consultation)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consultation not found"})
+		return
+	}
+	if consultation.Status != models.ConsultationCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Feedback can be given once the consultation is completed"})
+		return
+	}
+
+	feedback := config.DB.Collection("consultation_feedback")
+	given, err := feedback.CountDocuments(ctx, bson.M{"consultation_id": input.ConsultationID})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit feedback"})
 		return
 	}
+	if given > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Feedback already submitted for this consultation"})
+		return
+	}
+
+	if _, err := feedback.InsertOne(ctx, input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit feedback"})
+		return
+	}
+
+	coins, err := earnCoins(ctx, input.UserID, models.CoinEventConsultationFeedback, input.ConsultationID.Hex(), 0)
+	if err != nil {
+		log.Printf("⚠️ Failed to give coins for feedback by user %s: %v", input.UserID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feedback submitted successfully", "coins_earned": coins})
+}
+
+// PUT /admin/consultation/complete/:id
+// Marks a booked consultation as held, which opens it for feedback
+func AdminCompleteConsultation(c *gin.Context) {
+	consultationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid consultation ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := ConsultationCollection.UpdateOne(ctx,
+		bson.M{"_id": consultationID, "status": models.ConsultationBooked},
+		bson.M{"$set": bson.M{"status": models.ConsultationCompleted, "completed_at": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete consultation"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only a booked consultation can be completed"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Feedback submitted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Consultation completed"})
 }
 
 // ====== POST /drone/book ======
@@ -118,26 +201,58 @@ func BookDrone(c *gin.Context) {
 	userIDRaw, _ := c.Get("user_id")
 	userID := userIDRaw.(primitive.ObjectID)
 
-	drone := bson.M{
-		"user_id":    userID,
-		"field_area": input.FieldArea,
-		"location":   input.Location,
-		"purpose":    input.Purpose,
-		"date":       input.Date,
-		"status":     "pending",
-		"timestamp":  time.Now(),
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// The plan's free acres cover as much of the field as they can; the rest
+	// is charged as usual
+	grant, err := useEntitlement(ctx, userID, models.EntitlementDroneAcres, input.FieldArea)
+	if err != nil {
+		log.Printf("⚠️ Drone entitlement not checked for user %s: %v", userID.Hex(), err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Could not check your plan; please try again"})
+		return
+	}
+	booked := false
+	defer func() {
+		if booked {
+			return
+		}
+		if rerr := releaseEntitlement(ctx, grant); rerr != nil {
+			log.Printf("⚠️ Failed to give back drone entitlement to user %s: %v", userID.Hex(), rerr)
+		}
+	}()
+	coveredAcres := 0.0
+	if grant != nil {
+		coveredAcres = grant.Amount
+	}
+
+	drone := bson.M{
+		"user_id":       userID,
+		"field_area":    input.FieldArea,
+		"covered_acres": coveredAcres,
+		"location":      input.Location,
+		"purpose":       input.Purpose,
+		"date":          input.Date,
+		"status":        "pending",
+		"timestamp":     time.Now(),
+	}
+	if grant != nil {
+		drone["entitlement"] = grant
+	}
+
 	res, err := DroneBookingCollection.InsertOne(ctx, drone)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Drone booking failed"})
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Drone booking submitted", "booking_id": res.InsertedID})
+	booked = true
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Drone booking submitted",
+		"booking_id":       res.InsertedID,
+		"covered_acres":    coveredAcres,
+		"chargeable_acres": max(input.FieldArea-coveredAcres, 0),
+	})
 }
 
 // ====== GET /drone/availability ======
@@ -181,12 +296,20 @@ func CancelDroneBooking(c *gin.Context) {
 	filter := bson.M{"user_id": userID, "status": bson.M{"$in": []string{"pending", "booked"}}}
 	update := bson.M{"$set": bson.M{"status": "cancelled"}}
 
-	result, err := DroneBookingCollection.UpdateOne(ctx, filter, update)
-	if err != nil || result.ModifiedCount == 0 {
+	var booking struct {
+		Entitlement *models.EntitlementGrant `bson:"entitlement"`
+	}
+	err := DroneBookingCollection.FindOneAndUpdate(ctx, filter, update).Decode(&booking)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel drone booking"})
 		return
 	}
 
+	// Free acres used by the booking can be booked again this period
+	if err := releaseEntitlement(ctx, booking.Entitlement); err != nil {
+		log.Printf("⚠️ Failed to give back drone entitlement to user %s: %v", userID.Hex(), err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Drone booking cancelled"})
 }
 
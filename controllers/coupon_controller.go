@@ -0,0 +1,572 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/internal/invoice"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	couponCollection           *mongo.Collection
+	promotionCollection        *mongo.Collection
+	couponRedemptionCollection *mongo.Collection
+	cartCouponCollection       *mongo.Collection
+)
+
+// InitCouponCollections initializes coupon and promotion collections; call once after DB connection is ready
+func InitCouponCollections() {
+	couponCollection = config.DB.Collection("coupons")
+	promotionCollection = config.DB.Collection("promotions")
+	couponRedemptionCollection = config.DB.Collection("coupon_redemptions")
+	cartCouponCollection = config.DB.Collection("cart_coupons")
+}
+
+// cartCouponCode is the coupon the farmer applied to their cart, if any
+func cartCouponCode(ctx context.Context, userID primitive.ObjectID) string {
+	var applied struct {
+		Code string `bson:"code"`
+	}
+	if err := cartCouponCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&applied); err != nil {
+		return ""
+	}
+	return applied.Code
+}
+
+// runningPromotions loads the promotions that apply right now
+func runningPromotions(ctx context.Context, now time.Time) ([]models.Promotion, error) {
+	cursor, err := promotionCollection.Find(ctx, bson.M{"active": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var all []models.Promotion
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	running := make([]models.Promotion, 0, len(all))
+	for _, p := range all {
+		if p.RunningAt(now) {
+			running = append(running, p)
+		}
+	}
+	return running, nil
+}
+
+// applyOrderDiscounts evaluates the running promotions and the given coupon
+// code against the order's lines and sets Discount, Discounts and CouponCode.
+// Call it before CalculateTotals. If the coupon is rejected the promotions
+// are still applied and the reason is returned (see models.IsCouponRejection).
+func applyOrderDiscounts(ctx context.Context, order *models.Order, code string) error {
+	now := time.Now()
+	promotions, err := runningPromotions(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	var coupon *models.Coupon
+	var couponErr error
+	if code != "" {
+		var found models.Coupon
+		err := couponCollection.FindOne(ctx, bson.M{"code": models.NormalizeCouponCode(code)}).Decode(&found)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			couponErr = models.ErrCouponNotFound
+		case err != nil:
+			return err
+		case found.PerUserLimit > 0:
+			used, err := couponRedemptionCollection.CountDocuments(ctx, bson.M{"coupon_id": found.ID, "user_id": order.UserID})
+			if err != nil {
+				return err
+			}
+			if used >= int64(found.PerUserLimit) {
+				couponErr = models.ErrCouponUserLimit
+			} else {
+				coupon = &found
+			}
+		default:
+			coupon = &found
+		}
+	}
+
+	discounts, err := models.EvaluateDiscounts(order.Items, promotions, coupon, now)
+	order.Discounts = discounts
+	order.Discount = models.TotalDiscount(discounts)
+	order.CouponCode = ""
+	for _, d := range discounts {
+		if d.Kind == models.DiscountCoupon {
+			order.CouponCode = d.Code
+		}
+	}
+	if couponErr != nil {
+		return couponErr
+	}
+	return err
+}
+
+// respondDiscountError maps applyOrderDiscounts and claimCoupon errors at checkout
+func respondDiscountError(c *gin.Context, err error) {
+	if models.IsCouponRejection(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "hint": "Remove the coupon to check out without it"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply discounts"})
+}
+
+// claimCoupon counts a placed order against its coupon's usage limits. The
+// global count is taken atomically so the last redemption cannot be claimed
+// twice; the per-user count is checked after recording and undone if over.
+func claimCoupon(ctx context.Context, order models.Order) error {
+	var applied *models.AppliedDiscount
+	for i := range order.Discounts {
+		if order.Discounts[i].Kind == models.DiscountCoupon {
+			applied = &order.Discounts[i]
+		}
+	}
+	if applied == nil {
+		return nil
+	}
+
+	var coupon models.Coupon
+	err := couponCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":    applied.ID,
+			"active": true,
+			"$or": bson.A{
+				bson.M{"usage_limit": 0},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$used_count", "$usage_limit"}}},
+			},
+		},
+		bson.M{"$inc": bson.M{"used_count": 1}},
+	).Decode(&coupon)
+	if err == mongo.ErrNoDocuments {
+		return models.ErrCouponUsageLimit
+	}
+	if err != nil {
+		return err
+	}
+
+	redemption := models.CouponRedemption{
+		ID:        primitive.NewObjectID(),
+		CouponID:  coupon.ID,
+		Code:      coupon.Code,
+		UserID:    order.UserID,
+		OrderID:   order.ID,
+		Amount:    applied.Amount,
+		CreatedAt: time.Now(),
+	}
+	if _, err := couponRedemptionCollection.InsertOne(ctx, redemption); err != nil {
+		couponCollection.UpdateOne(ctx, bson.M{"_id": coupon.ID}, bson.M{"$inc": bson.M{"used_count": -1}})
+		return err
+	}
+
+	if coupon.PerUserLimit > 0 {
+		used, err := couponRedemptionCollection.CountDocuments(ctx, bson.M{"coupon_id": coupon.ID, "user_id": order.UserID})
+		if err == nil && used > int64(coupon.PerUserLimit) {
+			err = models.ErrCouponUserLimit
+		}
+		if err != nil {
+			if relErr := releaseCoupon(ctx, order.ID); relErr != nil {
+				log.Printf("⚠️ Failed to release coupon for order %s: %v", order.ID.Hex(), relErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseCoupon gives back the coupon use of an order that did not go
+// through, so the farmer and the global limit get it back
+func releaseCoupon(ctx context.Context, orderID primitive.ObjectID) error {
+	var redemption models.CouponRedemption
+	err := couponRedemptionCollection.FindOneAndDelete(ctx, bson.M{"order_id": orderID}).Decode(&redemption)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = couponCollection.UpdateOne(ctx, bson.M{"_id": redemption.CouponID}, bson.M{"$inc": bson.M{"used_count": -1}})
+	return err
+}
+
+// ======================= CART =======================
+
+// POST /api/cart/coupon
+// Checks a coupon against the current cart and keeps it applied until checkout.
+func ApplyCartCoupon(c *gin.Context) {
+	var input models.ApplyCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	code := models.NormalizeCouponCode(input.Code)
+
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cartItems, err := userCartItems(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading cart items"})
+		return
+	}
+	if len(cartItems) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+
+	items, err := snapshotOrderItems(ctx, cartItems)
+	if err != nil {
+		if errors.Is(err, errProductUnavailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price cart items"})
+		return
+	}
+
+	preview := models.Order{UserID: userID, Items: items, PlaceOfSupply: placeOfSupply(ctx, userID)}
+	if err := applyOrderDiscounts(ctx, &preview, code); err != nil {
+		if models.IsCouponRejection(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+		return
+	}
+	preview.CalculateTotals(invoice.SellerFromEnv().StateCode)
+
+	_, err = cartCouponCollection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"code": code, "applied_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Coupon applied",
+		"coupon":    code,
+		"discounts": preview.Discounts,
+		"discount":  preview.Discount,
+		"total":     preview.TotalAmount,
+	})
+}
+
+// DELETE /api/cart/coupon
+func RemoveCartCoupon(c *gin.Context) {
+	userID, ok := getUserObjectID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := cartCouponCollection.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon removed"})
+}
+
+// ======================= ADMIN =======================
+
+// parseObjectIDs converts hex IDs from an admin form
+func parseObjectIDs(hexIDs []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(hexIDs))
+	for _, h := range hexIDs {
+		id, err := primitive.ObjectIDFromHex(h)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// couponFromInput validates admin input and converts it to a coupon
+func couponFromInput(c *gin.Context) (models.Coupon, bool) {
+	var input models.CouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Coupon{}, false
+	}
+	if input.Type == models.CouponPercentage && input.Value > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Percentage cannot exceed 100"})
+		return models.Coupon{}, false
+	}
+	if input.ValidFrom != nil && input.ValidUntil != nil && !input.ValidUntil.After(*input.ValidFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "valid_until must be after valid_from"})
+		return models.Coupon{}, false
+	}
+	productIDs, err := parseObjectIDs(input.ProductIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return models.Coupon{}, false
+	}
+	categoryIDs, err := parseObjectIDs(input.CategoryIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return models.Coupon{}, false
+	}
+
+	active := true
+	if input.Active != nil {
+		active = *input.Active
+	}
+	return models.Coupon{
+		Code:         models.NormalizeCouponCode(input.Code),
+		Description:  input.Description,
+		Type:         input.Type,
+		Value:        input.Value,
+		MaxDiscount:  input.MaxDiscount,
+		MinCartValue: input.MinCartValue,
+		UsageLimit:   input.UsageLimit,
+		PerUserLimit: input.PerUserLimit,
+		ProductIDs:   productIDs,
+		CategoryIDs:  categoryIDs,
+		ValidFrom:    input.ValidFrom,
+		ValidUntil:   input.ValidUntil,
+		Active:       active,
+	}, true
+}
+
+// POST /admin/coupons
+func CreateCoupon(c *gin.Context) {
+	coupon, ok := couponFromInput(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	coupon.ID = primitive.NewObjectID()
+	coupon.CreatedAt = now
+	coupon.UpdatedAt = now
+	if _, err := couponCollection.InsertOne(ctx, coupon); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon created", "coupon": coupon})
+}
+
+// PUT /admin/coupons/:id
+// Replaces the coupon's terms; the usage count is kept.
+func UpdateCoupon(c *gin.Context) {
+	couponID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+	coupon, ok := couponFromInput(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var updated models.Coupon
+	err = couponCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": couponID},
+		bson.M{"$set": bson.M{
+			"code":           coupon.Code,
+			"description":    coupon.Description,
+			"type":           coupon.Type,
+			"value":          coupon.Value,
+			"max_discount":   coupon.MaxDiscount,
+			"min_cart_value": coupon.MinCartValue,
+			"usage_limit":    coupon.UsageLimit,
+			"per_user_limit": coupon.PerUserLimit,
+			"product_ids":    coupon.ProductIDs,
+			"category_ids":   coupon.CategoryIDs,
+			"valid_from":     coupon.ValidFrom,
+			"valid_until":    coupon.ValidUntil,
+			"active":         coupon.Active,
+			"updated_at":     time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	case mongo.IsDuplicateKeyError(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon updated", "coupon": updated})
+}
+
+// DELETE /admin/coupons/:id
+// Deactivates the coupon; redemptions on past orders are kept.
+func DeactivateCoupon(c *gin.Context) {
+	couponID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := couponCollection.UpdateOne(ctx, bson.M{"_id": couponID},
+		bson.M{"$set": bson.M{"active": false, "updated_at": time.Now()}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate coupon"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon deactivated"})
+}
+
+// GET /admin/coupons
+func GetCoupons(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := couponCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	coupons := []models.Coupon{}
+	if err := cursor.All(ctx, &coupons); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupons)
+}
+
+// POST /admin/promotions
+func CreatePromotion(c *gin.Context) {
+	var input models.PromotionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ValidFrom != nil && input.ValidUntil != nil && !input.ValidUntil.After(*input.ValidFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "valid_until must be after valid_from"})
+		return
+	}
+	productIDs, err := parseObjectIDs(input.ProductIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	categoryIDs, err := parseObjectIDs(input.CategoryIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+	if len(productIDs) == 0 && len(categoryIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Promotion needs at least one product or category"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	promo := models.Promotion{
+		ID:           primitive.NewObjectID(),
+		Name:         input.Name,
+		ProductIDs:   productIDs,
+		CategoryIDs:  categoryIDs,
+		BuyQuantity:  input.BuyQuantity,
+		FreeQuantity: input.FreeQuantity,
+		ValidFrom:    input.ValidFrom,
+		ValidUntil:   input.ValidUntil,
+		Active:       true,
+		CreatedAt:    time.Now(),
+	}
+	if _, err := promotionCollection.InsertOne(ctx, promo); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promotion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion created", "promotion": promo})
+}
+
+// GET /admin/promotions
+func GetPromotions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := promotionCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promotions"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	promotions := []models.Promotion{}
+	if err := cursor.All(ctx, &promotions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse promotions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, promotions)
+}
+
+// DELETE /admin/promotions/:id
+// Ends the promotion early.
+func EndPromotion(c *gin.Context) {
+	promoID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := promotionCollection.UpdateOne(ctx, bson.M{"_id": promoID}, bson.M{"$set": bson.M{"active": false}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end promotion"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion ended"})
+}
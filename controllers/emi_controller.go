@@ -0,0 +1,609 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	emiPlanCollection   *mongo.Collection
+	emiConfigCollection *mongo.Collection
+)
+
+// emiAwaitingApproval is the payment_status of an order whose EMI
+// application the dealer has not decided on yet
+const emiAwaitingApproval = "emi_pending"
+
+// errEMINotAvailable is returned when no EMI terms cover an order
+var errEMINotAvailable = errors.New("EMI not available for this order")
+
+// InitEMICollections initializes EMI collections; call once after DB connection is ready
+func InitEMICollections() {
+	emiPlanCollection = config.DB.Collection("emi_plans")
+	emiConfigCollection = config.DB.Collection("emi_configs")
+}
+
+// emiConfigForOrder picks the EMI terms of the order's most expensive line,
+// which is what is actually being financed (the tractor, not the spare
+// filters bought with it). Categories without terms use the default config.
+func emiConfigForOrder(ctx context.Context, order models.Order) (models.EMIConfig, error) {
+	var cfg models.EMIConfig
+	if len(order.Items) == 0 {
+		return cfg, errEMINotAvailable
+	}
+
+	main := order.Items[0]
+	for _, item := range order.Items[1:] {
+		if item.LineTotal > main.LineTotal {
+			main = item
+		}
+	}
+
+	var product models.Product
+	err := database.GetCollection("products").FindOne(ctx, bson.M{"_id": main.ProductID}).Decode(&product)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return cfg, err
+	}
+
+	if !product.CategoryID.IsZero() {
+		err = emiConfigCollection.FindOne(ctx, bson.M{"category_id": product.CategoryID}).Decode(&cfg)
+		if err == nil {
+			return cfg, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return cfg, err
+		}
+	}
+
+	err = emiConfigCollection.FindOne(ctx, bson.M{"category_id": bson.M{"$exists": false}}).Decode(&cfg)
+	if err == mongo.ErrNoDocuments {
+		return cfg, errEMINotAvailable
+	}
+	return cfg, err
+}
+
+// findUserEMIPlan loads the EMI plan of an order owned by the given user
+func findUserEMIPlan(ctx context.Context, orderID, userID primitive.ObjectID) (models.EMIPlan, error) {
+	var plan models.EMIPlan
+	err := emiPlanCollection.FindOne(ctx, bson.M{"order_id": orderID, "user_id": userID}).Decode(&plan)
+	return plan, err
+}
+
+// GET /api/orders/emiplan/options?orderId=
+func GetEMIOptions(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Query("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := findUserOrder(ctx, orderID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	cfg, err := emiConfigForOrder(ctx, order)
+	if err != nil || order.TotalAmount < cfg.MinOrderAmount {
+		c.JSON(http.StatusOK, gin.H{"orderId": order.ID, "available": false, "options": []models.EMIQuote{}})
+		return
+	}
+
+	quotes := make([]models.EMIQuote, 0, len(cfg.Tenures))
+	for _, months := range cfg.Tenures {
+		plan := models.NewEMIPlan(order.ID, userID, order.TotalAmount, cfg.InterestRate, months, time.Now())
+		quotes = append(quotes, models.EMIQuote{
+			Months:             months,
+			InterestRate:       plan.InterestRate,
+			MonthlyInstallment: plan.MonthlyInstallment,
+			TotalInterest:      plan.TotalInterest,
+			TotalPayable:       plan.TotalPayable,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orderId": order.ID, "available": true, "options": quotes})
+}
+
+// POST /api/orders/emiplan/apply
+// Applies to finance a pending order. The order stays pending until the
+// dealer approves the plan, and only then moves to paid.
+func ApplyEMIPlan(c *gin.Context) {
+	var input models.EMIApplyInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Months <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(input.OrderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := findUserOrder(ctx, orderID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != models.OrderStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is not awaiting payment"})
+		return
+	}
+
+	cfg, err := emiConfigForOrder(ctx, order)
+	if errors.Is(err, errEMINotAvailable) || (err == nil && order.TotalAmount < cfg.MinOrderAmount) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "EMI is not available for this order"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load EMI terms"})
+		return
+	}
+	if !cfg.AllowsTenure(input.Months) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tenure not offered", "tenures": cfg.Tenures})
+		return
+	}
+
+	plan := models.NewEMIPlan(order.ID, userID, order.TotalAmount, cfg.InterestRate, input.Months, time.Now())
+	plan.ID = primitive.NewObjectID()
+	if _, err := emiPlanCollection.InsertOne(ctx, plan); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "EMI plan already exists for this order"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create EMI plan"})
+		return
+	}
+
+	res, err := orderCollection.UpdateOne(ctx,
+		bson.M{"_id": order.ID, "status": models.OrderStatusPending},
+		bson.M{"$set": bson.M{"payment_status": emiAwaitingApproval, "updated_at": time.Now()}},
+	)
+	if err != nil || res.ModifiedCount == 0 {
+		// The order was paid or cancelled meanwhile; drop the plan we just made
+		if _, derr := emiPlanCollection.DeleteOne(ctx, bson.M{"_id": plan.ID}); derr != nil {
+			log.Printf("⚠️ Failed to remove EMI plan %s: %v", plan.ID.Hex(), derr)
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is not awaiting payment"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "EMI application submitted for approval", "plan": plan})
+}
+
+// closeEMIPlan cancels the EMI plan of a cancelled order, if it has one
+// still open, so no more installments fall due
+func closeEMIPlan(ctx context.Context, orderID primitive.ObjectID) error {
+	_, err := emiPlanCollection.UpdateOne(ctx,
+		bson.M{"order_id": orderID, "status": bson.M{"$in": []string{models.EMIPlanPendingApproval, models.EMIPlanActive}}},
+		bson.M{"$set": bson.M{"status": models.EMIPlanCancelled, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// GET /api/orders/emiplan/status?orderId=
+func GetEMIStatus(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Query("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	plan, err := findUserEMIPlan(ctx, orderID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "EMI plan not found"})
+		return
+	}
+
+	now := time.Now()
+	overdue := 0
+	for _, inst := range plan.Installments {
+		if inst.IsOverdue(now) {
+			overdue++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan":             plan,
+		"next_installment": plan.NextInstallment(),
+		"overdue_count":    overdue,
+		"outstanding":      models.RoundAmount(plan.TotalPayable - plan.AmountPaid),
+	})
+}
+
+// GET /api/orders/emiplan/next?orderId=
+func GetNextEMIInstallment(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Query("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	plan, err := findUserEMIPlan(ctx, orderID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "EMI plan not found"})
+		return
+	}
+
+	next := plan.NextInstallment()
+	if next == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "EMI plan fully repaid", "status": plan.Status})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"installment": next, "overdue": next.IsOverdue(time.Now())})
+}
+
+// ======================= ADMIN =======================
+
+// POST /admin/emi/plans/:orderId/approve
+// Approves an EMI application once the dealer has checked the farmer and
+// collected any down payment. The schedule starts from today and the order
+// moves to paid so it can be packed and shipped.
+func ApproveEMIPlan(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input models.EMIReviewInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var plan models.EMIPlan
+	err = emiPlanCollection.FindOne(ctx, bson.M{"order_id": orderID, "status": models.EMIPlanPendingApproval}).Decode(&plan)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No EMI application awaiting approval"})
+		return
+	}
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if input.DownPayment >= order.TotalAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Down payment must be less than the order total"})
+		return
+	}
+
+	now := time.Now()
+	approved := models.NewEMIPlan(order.ID, plan.UserID, order.TotalAmount-input.DownPayment, plan.InterestRate, plan.TenureMonths, now)
+	res, err := emiPlanCollection.UpdateOne(ctx,
+		bson.M{"_id": plan.ID, "status": models.EMIPlanPendingApproval},
+		bson.M{"$set": bson.M{
+			"principal":           approved.Principal,
+			"monthly_installment": approved.MonthlyInstallment,
+			"total_interest":      approved.TotalInterest,
+			"total_payable":       approved.TotalPayable,
+			"installments":        approved.Installments,
+			"down_payment":        models.RoundAmount(input.DownPayment),
+			"status":              models.EMIPlanActive,
+			"reviewed_by":         c.GetString("email"),
+			"review_note":         input.Note,
+			"approved_at":         now,
+			"updated_at":          now,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve EMI plan"})
+		return
+	}
+	if res.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "EMI application already reviewed"})
+		return
+	}
+
+	err = transitionOrderFrom(ctx, order.ID, []string{models.OrderStatusPending}, models.OrderStatusPaid,
+		"Financed on EMI", c.GetString("email"), bson.M{"payment_status": "emi"})
+	if err != nil {
+		// The order was cancelled meanwhile
+		if cerr := closeEMIPlan(ctx, order.ID); cerr != nil {
+			log.Printf("⚠️ Failed to close EMI plan %s: %v", plan.ID.Hex(), cerr)
+		}
+		respondTransitionError(c, err)
+		return
+	}
+
+	if err := issueInvoiceForOrder(ctx, order.ID); err != nil {
+		log.Printf("⚠️ Failed to issue invoice for order %s: %v", order.ID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "EMI plan approved", "order_id": order.ID})
+}
+
+// POST /admin/emi/plans/:orderId/reject
+// Turns down an EMI application. The order stays pending, to be paid some
+// other way or expire.
+func RejectEMIPlan(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input models.EMIReviewInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	res, err := emiPlanCollection.UpdateOne(ctx,
+		bson.M{"order_id": orderID, "status": models.EMIPlanPendingApproval},
+		bson.M{"$set": bson.M{
+			"status":      models.EMIPlanRejected,
+			"reviewed_by": c.GetString("email"),
+			"review_note": input.Note,
+			"updated_at":  now,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject EMI plan"})
+		return
+	}
+	if res.ModifiedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No EMI application awaiting approval"})
+		return
+	}
+
+	if _, err := orderCollection.UpdateOne(ctx,
+		bson.M{"_id": orderID, "status": models.OrderStatusPending},
+		bson.M{"$set": bson.M{"payment_status": "emi_rejected", "updated_at": now}},
+	); err != nil {
+		log.Printf("⚠️ Failed to update payment status of order %s: %v", orderID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "EMI application rejected"})
+}
+
+// POST /admin/emi/plans/:orderId/pay
+// Records the next installment as collected by the dealer.
+func PayEMIInstallment(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input models.EMIPaymentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var plan models.EMIPlan
+	if err := emiPlanCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&plan); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "EMI plan not found"})
+		return
+	}
+	if plan.Status != models.EMIPlanActive && plan.Status != models.EMIPlanCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "EMI plan is not active", "status": plan.Status})
+		return
+	}
+
+	next := plan.NextInstallment()
+	if next == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "EMI plan already repaid"})
+		return
+	}
+
+	// Only matches while the installment is still due, so a double submit
+	// cannot collect it twice
+	now := time.Now()
+	res, err := emiPlanCollection.UpdateOne(ctx,
+		bson.M{
+			"_id":          plan.ID,
+			"status":       models.EMIPlanActive,
+			"installments": bson.M{"$elemMatch": bson.M{"number": next.Number, "status": models.InstallmentDue}},
+		},
+		bson.M{
+			"$set": bson.M{
+				"installments.$.status":    models.InstallmentPaid,
+				"installments.$.paid_at":   now,
+				"installments.$.reference": input.Reference,
+				"updated_at":               now,
+			},
+			"$inc": bson.M{"amount_paid": next.Amount},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record installment"})
+		return
+	}
+	if res.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Installment already recorded"})
+		return
+	}
+
+	status := models.EMIPlanActive
+	if next.Number == plan.TenureMonths {
+		status = models.EMIPlanCompleted
+		if _, err := emiPlanCollection.UpdateOne(ctx, bson.M{"_id": plan.ID}, bson.M{"$set": bson.M{"status": status}}); err != nil {
+			log.Printf("⚠️ Failed to close EMI plan %s: %v", plan.ID.Hex(), err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Installment recorded",
+		"installment": next.Number,
+		"amount":      next.Amount,
+		"plan_status": status,
+	})
+}
+
+// GET /admin/emi/due?before=2024-07-31
+// Lists active plans with installments due on or before the date (today by default).
+func GetDueEMIInstallments(c *gin.Context) {
+	before := time.Now()
+	if val := c.Query("before"); val != "" {
+		t, err := time.Parse("2006-01-02", val)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, use YYYY-MM-DD"})
+			return
+		}
+		before = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := emiPlanCollection.Find(ctx, bson.M{
+		"status": models.EMIPlanActive,
+		"installments": bson.M{"$elemMatch": bson.M{
+			"status":   models.InstallmentDue,
+			"due_date": bson.M{"$lte": before},
+		}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch EMI plans"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var plans []models.EMIPlan
+	if err := cursor.All(ctx, &plans); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse EMI plans"})
+		return
+	}
+
+	due := make([]gin.H, 0, len(plans))
+	for _, plan := range plans {
+		installments := []models.EMIInstallment{}
+		amount := 0.0
+		for _, inst := range plan.Installments {
+			if inst.Status == models.InstallmentDue && !inst.DueDate.After(before) {
+				installments = append(installments, inst)
+				amount += inst.Amount
+			}
+		}
+		due = append(due, gin.H{
+			"plan_id":      plan.ID,
+			"order_id":     plan.OrderID,
+			"user_id":      plan.UserID,
+			"installments": installments,
+			"amount_due":   models.RoundAmount(amount),
+		})
+	}
+
+	c.JSON(http.StatusOK, due)
+}
+
+// PUT /admin/emi/configs
+// Creates or replaces the EMI terms of a category, or the default terms.
+func UpsertEMIConfig(c *gin.Context) {
+	var input models.EMIConfigInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, months := range input.Tenures {
+		if months <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tenures must be positive months"})
+			return
+		}
+	}
+
+	filter := bson.M{"category_id": bson.M{"$exists": false}}
+	set := bson.M{
+		"tenures":          input.Tenures,
+		"interest_rate":    input.InterestRate,
+		"min_order_amount": input.MinOrderAmount,
+		"updated_at":       time.Now(),
+	}
+	if input.CategoryID != "" {
+		categoryID, err := primitive.ObjectIDFromHex(input.CategoryID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+			return
+		}
+		filter = bson.M{"category_id": categoryID}
+		set["category_id"] = categoryID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var cfg models.EMIConfig
+	err := emiConfigCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save EMI terms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "EMI terms saved", "config": cfg})
+}
+
+// GET /admin/emi/configs
+func GetEMIConfigs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := emiConfigCollection.Find(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch EMI terms"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var configs []models.EMIConfig
+	if err := cursor.All(ctx, &configs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse EMI terms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, configs)
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The entitlement service: what a farmer's plan includes is counted in the
+// subscription's usage, per service, and starts again from zero when the
+// next billing period is paid for. Active subscriptions and those still in
+// their grace period are entitled; paused and unpaid ones are not. Uses
+// beyond the quota go ahead uncovered, to be charged as usual.
+
+var errEntitlementContended = errors.New("entitlement usage changed while being taken")
+
+// entitledSubscriptionStatuses are the statuses whose plan can be used
+var entitledSubscriptionStatuses = []string{models.SubscriptionActive, models.SubscriptionPastDue}
+
+// entitledSubscription returns the farmer's subscription and plan if they
+// are entitled to anything right now
+func entitledSubscription(ctx context.Context, userID primitive.ObjectID) (models.Subscription, models.SubscriptionPlan, bool, error) {
+	var plan models.SubscriptionPlan
+	sub, err := currentSubscription(ctx, userID)
+	if errors.Is(err, errNoSubscription) {
+		return sub, plan, false, nil
+	}
+	if err != nil {
+		return sub, plan, false, err
+	}
+	entitled := false
+	for _, status := range entitledSubscriptionStatuses {
+		entitled = entitled || sub.Status == status
+	}
+	if !entitled {
+		return sub, plan, false, nil
+	}
+	plan, err = subscriptionPlan(ctx, sub.PlanID)
+	if errors.Is(err, errPlanNotFound) {
+		return sub, plan, false, nil // subscriptions from before the catalogue
+	}
+	return sub, plan, err == nil, err
+}
+
+// useEntitlement takes up to amount of service from the farmer's plan for
+// this period and returns what it covered, or nil if nothing. The quota is
+// checked in the same update that counts the use, so parallel bookings
+// cannot overdraw it.
+func useEntitlement(ctx context.Context, userID primitive.ObjectID, service string, amount float64) (*models.EntitlementGrant, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		sub, plan, ok, err := entitledSubscription(ctx, userID)
+		if err != nil || !ok {
+			return nil, err
+		}
+		entitlement, ok := plan.Entitlement(service)
+		if !ok {
+			return nil, nil
+		}
+		covered := entitlement.Covers(sub.Usage[service], amount)
+		if covered <= 0 {
+			return nil, nil
+		}
+
+		field := "usage." + service
+		filter := bson.M{
+			"_id":                  sub.ID,
+			"plan_id":              sub.PlanID,
+			"status":               bson.M{"$in": entitledSubscriptionStatuses},
+			"current_period_start": sub.CurrentPeriodStart,
+		}
+		if !entitlement.Unlimited() {
+			filter[field] = bson.M{"$not": bson.M{"$gt": entitlement.Quota - covered}}
+		}
+		res, err := database.GetCollection("subscriptions").UpdateOne(ctx, filter, bson.M{"$inc": bson.M{field: covered}})
+		if err != nil {
+			return nil, err
+		}
+		if res.ModifiedCount == 1 {
+			return &models.EntitlementGrant{
+				SubscriptionID: sub.ID,
+				PeriodStart:    sub.CurrentPeriodStart,
+				Service:        service,
+				Amount:         covered,
+			}, nil
+		}
+		// Another booking, a renewal or a plan switch got there first
+	}
+	return nil, errEntitlementContended
+}
+
+// releaseEntitlement gives back what a cancelled use was covered for, as
+// long as its billing period is still running
+func releaseEntitlement(ctx context.Context, grant *models.EntitlementGrant) error {
+	if grant == nil {
+		return nil
+	}
+	_, err := database.GetCollection("subscriptions").UpdateOne(ctx,
+		bson.M{
+			"_id":                    grant.SubscriptionID,
+			"current_period_start":   grant.PeriodStart,
+			"usage." + grant.Service: bson.M{"$gte": grant.Amount},
+		},
+		bson.M{"$inc": bson.M{"usage." + grant.Service: -grant.Amount}},
+	)
+	return err
+}
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GuestTokenHeader carries the device token of a visitor's cart
+const GuestTokenHeader = "X-Guest-Token"
+
+var guestCartCollection *mongo.Collection
+
+// Tokens are issued by newGuestToken; anything else is refused so a guest
+// cart cannot be guessed from a short or predictable value
+var guestTokenPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// InitGuestCartCollection initializes the guest cart collection; call once after DB connection is ready
+func InitGuestCartCollection() {
+	guestCartCollection = config.DB.Collection("guest_carts")
+}
+
+func newGuestToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// guestToken reads the visitor's token from the request header. It returns
+// "" if there is none and false (after responding) if it is malformed.
+func guestToken(c *gin.Context) (string, bool) {
+	token := c.GetHeader(GuestTokenHeader)
+	if token != "" && !guestTokenPattern.MatchString(token) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid guest token"})
+		return "", false
+	}
+	return token, true
+}
+
+// mergeGuestCart moves a visitor's cart into the signed-in user's cart,
+// adding quantities for products already there, and returns how many
+// lines were merged. The guest cart is removed in the same transaction.
+func mergeGuestCart(ctx context.Context, token string, userID primitive.ObjectID) (int, error) {
+	if token == "" || !guestTokenPattern.MatchString(token) {
+		return 0, nil
+	}
+
+	merged := 0
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		merged = 0
+		cursor, err := guestCartCollection.Find(ctx, bson.M{"token": token})
+		if err != nil {
+			return err
+		}
+		var items []models.GuestCartItem
+		if err := cursor.All(ctx, &items); err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			// Taking the line out first means two sign-ins at once cannot both add it
+			err := guestCartCollection.FindOneAndDelete(ctx, bson.M{"_id": item.ID}).Decode(&item)
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			_, err = cartCollection.UpdateOne(ctx,
+				bson.M{"user_id": userID, "product_id": item.ProductID},
+				bson.M{
+					"$inc": bson.M{"quantity": item.Quantity},
+					"$setOnInsert": bson.M{
+						"_id":          primitive.NewObjectID(),
+						"price_at_add": item.PriceAtAdd,
+						"created_at":   item.CreatedAt,
+					},
+				},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				return err
+			}
+			merged++
+		}
+		return nil
+	})
+	return merged, err
+}
+
+// touchGuestCart moves the expiry of every line of a guest cart on, so the
+// cart is kept or dropped as a whole
+func touchGuestCart(ctx context.Context, token string, now time.Time) {
+	if _, err := guestCartCollection.UpdateMany(ctx, bson.M{"token": token}, bson.M{"$set": bson.M{"updated_at": now}}); err != nil {
+		log.Printf("⚠️ Failed to refresh guest cart expiry: %v", err)
+	}
+}
+
+// mergeGuestCartOnLogin merges the cart of the request's guest token, if
+// any, into the user who just signed in. Failures are logged, not fatal:
+// the farmer is still signed in and the guest cart is kept for a retry.
+func mergeGuestCartOnLogin(ctx context.Context, c *gin.Context, userID primitive.ObjectID) int {
+	token := c.GetHeader(GuestTokenHeader)
+	if token == "" || userID.IsZero() {
+		return 0
+	}
+	merged, err := mergeGuestCart(ctx, token, userID)
+	if err != nil {
+		log.Printf("⚠️ Failed to merge guest cart into user %s: %v", userID.Hex(), err)
+	}
+	return merged
+}
+
+// ======================= GUEST =======================
+
+// POST /api/guest-cart
+// Adds a product to the visitor's cart. Without a token a new one is issued;
+// the app sends it back in the X-Guest-Token header from then on.
+func AddToGuestCart(c *gin.Context) {
+	var input models.CartQuantityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	productID, err := primitive.ObjectIDFromHex(input.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
+
+	token, ok := guestToken(c)
+	if !ok {
+		return
+	}
+	if token == "" {
+		if token, err = newGuestToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start guest cart"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var product models.Product
+	if err := database.GetCollection("products").FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	now := time.Now()
+	_, err = guestCartCollection.UpdateOne(ctx,
+		bson.M{"token": token, "product_id": productID},
+		bson.M{
+			"$inc": bson.M{"quantity": input.Quantity},
+			"$set": bson.M{"updated_at": now},
+			"$setOnInsert": bson.M{
+				"_id":          primitive.NewObjectID(),
+				"price_at_add": product.Price,
+				"created_at":   now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to cart"})
+		return
+	}
+	touchGuestCart(ctx, token, now)
+
+	c.Header(GuestTokenHeader, token)
+	c.JSON(http.StatusOK, gin.H{"message": "Added to cart", "guestToken": token})
+}
+
+// GET /api/guest-cart
+func ViewGuestCart(c *gin.Context) {
+	token, ok := guestToken(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var items []models.CartItem
+	if token != "" {
+		cursor, err := guestCartCollection.Find(ctx, bson.M{"token": token}, options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var guestItems []models.GuestCartItem
+		if err := cursor.All(ctx, &guestItems); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading cart items"})
+			return
+		}
+		for _, g := range guestItems {
+			items = append(items, g.CartItem())
+		}
+	}
+
+	// Guests have no state on file, so GST is worked out as a local sale
+	summary, err := buildCartSummary(ctx, primitive.NilObjectID, items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price cart"})
+		return
+	}
+
+	message := "Cart fetched successfully"
+	if len(items) == 0 {
+		message = "Cart is empty"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "cart": summary})
+}
+
+// PUT /api/guest-cart/update-qty
+func UpdateGuestCartQuantity(c *gin.Context) {
+	var input models.CartQuantityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	productID, err := primitive.ObjectIDFromHex(input.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
+	token, ok := guestToken(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	res, err := guestCartCollection.UpdateOne(ctx,
+		bson.M{"token": token, "product_id": productID},
+		bson.M{"$set": bson.M{"quantity": input.Quantity, "updated_at": now}},
+	)
+	if err != nil || res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found or update failed"})
+		return
+	}
+	touchGuestCart(ctx, token, now)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cart quantity updated"})
+}
+
+// DELETE /api/guest-cart/:productId
+func RemoveFromGuestCart(c *gin.Context) {
+	productID, err := primitive.ObjectIDFromHex(c.Param("productId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
+	token, ok := guestToken(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := guestCartCollection.DeleteOne(ctx, bson.M{"token": token, "product_id": productID})
+	if err != nil || res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart"})
+}
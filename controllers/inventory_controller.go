@@ -0,0 +1,630 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	warehouseCollection        *mongo.Collection
+	inventoryCollection        *mongo.Collection
+	stockMovementCollection    *mongo.Collection
+	stockReservationCollection *mongo.Collection
+)
+
+// errInsufficientStock is returned when an order asks for more than is available
+var errInsufficientStock = errors.New("insufficient stock")
+
+// InitInventoryCollections initializes inventory collections; call once after DB connection is ready
+func InitInventoryCollections() {
+	warehouseCollection = config.DB.Collection("warehouses")
+	inventoryCollection = config.DB.Collection("inventory")
+	stockMovementCollection = config.DB.Collection("stock_movements")
+	stockReservationCollection = config.DB.Collection("stock_reservations")
+}
+
+// availableExpr matches inventory rows with at least qty units not yet reserved
+func availableExpr(qty int) bson.M {
+	return bson.M{"$gte": bson.A{bson.M{"$subtract": bson.A{"$on_hand", "$reserved"}}, qty}}
+}
+
+// recordStockMovement appends an entry to the inventory ledger
+func recordStockMovement(ctx context.Context, m models.StockMovement) {
+	m.ID = primitive.NewObjectID()
+	m.CreatedAt = time.Now()
+	if _, err := stockMovementCollection.InsertOne(ctx, m); err != nil {
+		log.Printf("⚠️ Failed to record stock movement for product %s: %v", m.ProductID.Hex(), err)
+	}
+}
+
+// stockTracked reports whether a product is stocked in any warehouse.
+// Products listed before inventory was tracked have no rows until stock is
+// received for them, and sell on their in_stock flag as before.
+func stockTracked(ctx context.Context, productID primitive.ObjectID) (bool, error) {
+	n, err := inventoryCollection.CountDocuments(ctx, bson.M{"product_id": productID}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// syncProductInStock keeps products.in_stock in line with the inventory totals
+func syncProductInStock(ctx context.Context, productID primitive.ObjectID) {
+	if tracked, err := stockTracked(ctx, productID); err != nil || !tracked {
+		return
+	}
+	available, err := availableQuantity(ctx, productID)
+	if err != nil {
+		log.Printf("⚠️ Failed to compute stock for product %s: %v", productID.Hex(), err)
+		return
+	}
+
+	_, err = database.GetCollection("products").UpdateOne(ctx,
+		bson.M{"_id": productID},
+		bson.M{"$set": bson.M{"in_stock": available > 0}},
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to update in_stock for product %s: %v", productID.Hex(), err)
+	}
+}
+
+// availableQuantity sums unreserved stock for a product across all warehouses
+func availableQuantity(ctx context.Context, productID primitive.ObjectID) (int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"product_id": productID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       nil,
+			"available": bson.M{"$sum": bson.M{"$subtract": bson.A{"$on_hand", "$reserved"}}},
+		}}},
+	}
+
+	cursor, err := inventoryCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Available int `bson:"available"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Available, nil
+}
+
+// availableQuantities is availableQuantity for several products in one query
+func availableQuantities(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"product_id": bson.M{"$in": productIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$product_id",
+			"available": bson.M{"$sum": bson.M{"$subtract": bson.A{"$on_hand", "$reserved"}}},
+		}}},
+	}
+
+	cursor, err := inventoryCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		ProductID primitive.ObjectID `bson:"_id"`
+		Available int                `bson:"available"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+	available := make(map[primitive.ObjectID]int, len(result))
+	for _, r := range result {
+		available[r.ProductID] = r.Available
+	}
+	return available, nil
+}
+
+// reserveStock holds stock for every item of an order, splitting across
+// warehouses when one cannot cover the full quantity. Each warehouse row is
+// updated conditionally so concurrent checkouts can never oversell. If any
+// item cannot be covered, everything reserved so far is released again.
+func reserveStock(ctx context.Context, orderID primitive.ObjectID, items []models.CartItem) error {
+	wanted := map[primitive.ObjectID]int{}
+	var productIDs []primitive.ObjectID
+	for _, item := range items {
+		if _, seen := wanted[item.ProductID]; !seen {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		wanted[item.ProductID] += item.Quantity
+	}
+
+	for _, productID := range productIDs {
+		if err := reserveProduct(ctx, orderID, productID, wanted[productID]); err != nil {
+			if relErr := releaseStock(ctx, orderID); relErr != nil {
+				log.Printf("⚠️ Failed to roll back reservations for order %s: %v", orderID.Hex(), relErr)
+			}
+			return err
+		}
+	}
+
+	for _, productID := range productIDs {
+		syncProductInStock(ctx, productID)
+	}
+	return nil
+}
+
+func reserveProduct(ctx context.Context, orderID, productID primitive.ObjectID, qty int) error {
+	cursor, err := inventoryCollection.Find(ctx, bson.M{
+		"product_id": productID,
+		"$expr":      availableExpr(1),
+	})
+	if err != nil {
+		return err
+	}
+	var rows []models.InventoryItem
+	if err := cursor.All(ctx, &rows); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		tracked, err := stockTracked(ctx, productID)
+		if err != nil {
+			return err
+		}
+		if !tracked {
+			return untrackedStock(ctx, productID)
+		}
+	}
+
+	remaining := qty
+	for _, row := range rows {
+		if remaining == 0 {
+			break
+		}
+		take := row.OnHand - row.Reserved
+		if take > remaining {
+			take = remaining
+		}
+
+		res, err := inventoryCollection.UpdateOne(ctx,
+			bson.M{"_id": row.ID, "$expr": availableExpr(take)},
+			bson.M{
+				"$inc": bson.M{"reserved": take},
+				"$set": bson.M{"updated_at": time.Now()},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			continue // another checkout took this stock first
+		}
+
+		now := time.Now()
+		_, err = stockReservationCollection.InsertOne(ctx, models.StockReservation{
+			ID:          primitive.NewObjectID(),
+			OrderID:     orderID,
+			ProductID:   productID,
+			WarehouseID: row.WarehouseID,
+			Quantity:    take,
+			Status:      "reserved",
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			// Undo the hold we just placed; it is not tracked by a reservation yet
+			inventoryCollection.UpdateOne(ctx, bson.M{"_id": row.ID}, bson.M{"$inc": bson.M{"reserved": -take}})
+			return err
+		}
+
+		recordStockMovement(ctx, models.StockMovement{
+			ProductID:   productID,
+			WarehouseID: row.WarehouseID,
+			OrderID:     &orderID,
+			Type:        models.StockMovementReserve,
+			Quantity:    take,
+		})
+		remaining -= take
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("%w for product %s", errInsufficientStock, productID.Hex())
+	}
+	return nil
+}
+
+// untrackedStock lets an order through for a product not yet stocked in any
+// warehouse as long as the product is still marked in stock
+func untrackedStock(ctx context.Context, productID primitive.ObjectID) error {
+	var product models.Product
+	err := database.GetCollection("products").FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	if err != nil || !product.InStock {
+		return fmt.Errorf("%w for product %s", errInsufficientStock, productID.Hex())
+	}
+	return nil
+}
+
+// releaseStock returns every open reservation of an order to available stock
+func releaseStock(ctx context.Context, orderID primitive.ObjectID) error {
+	return settleReservations(ctx, orderID, "released")
+}
+
+// dispatchStock removes an order's reserved stock from on-hand once it leaves the warehouse
+func dispatchStock(ctx context.Context, orderID primitive.ObjectID) error {
+	return settleReservations(ctx, orderID, "dispatched")
+}
+
+func settleReservations(ctx context.Context, orderID primitive.ObjectID, status string) error {
+	cursor, err := stockReservationCollection.Find(ctx, bson.M{"order_id": orderID, "status": "reserved"})
+	if err != nil {
+		return err
+	}
+	var reservations []models.StockReservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return err
+	}
+
+	for _, r := range reservations {
+		// Claim the reservation first so a concurrent settle cannot apply it twice
+		res, err := stockReservationCollection.UpdateOne(ctx,
+			bson.M{"_id": r.ID, "status": "reserved"},
+			bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+
+		inc := bson.M{"reserved": -r.Quantity}
+		movement := models.StockMovementRelease
+		qty := -r.Quantity
+		if status == "dispatched" {
+			inc["on_hand"] = -r.Quantity
+			movement = models.StockMovementDispatch
+		}
+
+		_, err = inventoryCollection.UpdateOne(ctx,
+			bson.M{"product_id": r.ProductID, "warehouse_id": r.WarehouseID},
+			bson.M{"$inc": inc, "$set": bson.M{"updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+
+		recordStockMovement(ctx, models.StockMovement{
+			ProductID:   r.ProductID,
+			WarehouseID: r.WarehouseID,
+			OrderID:     &orderID,
+			Type:        movement,
+			Quantity:    qty,
+		})
+		syncProductInStock(ctx, r.ProductID)
+	}
+	return nil
+}
+
+// restockReturn puts returned units back on hand at the warehouses the order
+// was dispatched from. No items means the whole order. Products that were
+// not tracked when the order shipped have no warehouse to go back to.
+func restockReturn(ctx context.Context, orderID primitive.ObjectID, items []models.ReturnItem) error {
+	cursor, err := stockReservationCollection.Find(ctx, bson.M{"order_id": orderID, "status": "dispatched"})
+	if err != nil {
+		return err
+	}
+	var reservations []models.StockReservation
+	if err := cursor.All(ctx, &reservations); err != nil {
+		return err
+	}
+
+	returned := map[primitive.ObjectID]int{}
+	for _, item := range items {
+		returned[item.ProductID] += item.Quantity
+	}
+	for _, r := range reservations {
+		qty := r.Quantity
+		if len(items) > 0 {
+			qty = min(qty, returned[r.ProductID])
+			returned[r.ProductID] -= qty
+		}
+		if qty == 0 {
+			continue
+		}
+
+		_, err := inventoryCollection.UpdateOne(ctx,
+			bson.M{"product_id": r.ProductID, "warehouse_id": r.WarehouseID},
+			bson.M{"$inc": bson.M{"on_hand": qty}, "$set": bson.M{"updated_at": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+
+		recordStockMovement(ctx, models.StockMovement{
+			ProductID:   r.ProductID,
+			WarehouseID: r.WarehouseID,
+			OrderID:     &orderID,
+			Type:        models.StockMovementReturn,
+			Quantity:    qty,
+		})
+		syncProductInStock(ctx, r.ProductID)
+	}
+	return nil
+}
+
+// ======================= ADMIN =======================
+
+// POST /admin/warehouses
+func CreateWarehouse(c *gin.Context) {
+	var input models.WarehouseInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	warehouse := models.Warehouse{
+		ID:        primitive.NewObjectID(),
+		Code:      input.Code,
+		Name:      input.Name,
+		District:  input.District,
+		CreatedAt: time.Now(),
+	}
+	if _, err := warehouseCollection.InsertOne(ctx, warehouse); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Warehouse code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create warehouse"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Warehouse created", "warehouse": warehouse})
+}
+
+// GET /admin/warehouses
+func GetWarehouses(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := warehouseCollection.Find(ctx, bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch warehouses"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var warehouses []models.Warehouse
+	if err := cursor.All(ctx, &warehouses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse warehouses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, warehouses)
+}
+
+// POST /admin/inventory/adjust
+func AdjustStock(c *gin.Context) {
+	var input models.StockAdjustmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	movementType := input.Type
+	if movementType == "" {
+		movementType = models.StockMovementReceipt
+	}
+	if movementType != models.StockMovementReceipt && movementType != models.StockMovementAdjustment {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be 'receipt' or 'adjustment'"})
+		return
+	}
+
+	productID, err := primitive.ObjectIDFromHex(input.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
+	warehouseID, err := primitive.ObjectIDFromHex(input.WarehouseID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse_id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if count, _ := database.GetCollection("products").CountDocuments(ctx, bson.M{"_id": productID}); count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if count, _ := warehouseCollection.CountDocuments(ctx, bson.M{"_id": warehouseID}); count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+		return
+	}
+
+	filter := bson.M{"product_id": productID, "warehouse_id": warehouseID}
+	update := bson.M{
+		"$inc": bson.M{"on_hand": input.Quantity},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+
+	if input.Quantity > 0 {
+		update["$setOnInsert"] = bson.M{"reserved": 0}
+		_, err = inventoryCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+			return
+		}
+	} else {
+		// Never take on-hand below what is already promised to orders
+		filter["$expr"] = bson.M{"$gte": bson.A{bson.M{"$add": bson.A{"$on_hand", input.Quantity}}, "$reserved"}}
+		res, err := inventoryCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+			return
+		}
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Adjustment exceeds unreserved stock"})
+			return
+		}
+	}
+
+	recordStockMovement(ctx, models.StockMovement{
+		ProductID:   productID,
+		WarehouseID: warehouseID,
+		Type:        movementType,
+		Quantity:    input.Quantity,
+		Reason:      input.Reason,
+	})
+	syncProductInStock(ctx, productID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stock updated"})
+}
+
+// GET /admin/inventory/product/:productId
+func GetProductInventory(c *gin.Context) {
+	productID, err := primitive.ObjectIDFromHex(c.Param("productId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := inventoryCollection.Find(ctx, bson.M{"product_id": productID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var rows []models.InventoryItem
+	if err := cursor.All(ctx, &rows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse inventory"})
+		return
+	}
+
+	onHand, reserved := 0, 0
+	for _, row := range rows {
+		onHand += row.OnHand
+		reserved += row.Reserved
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productID,
+		"on_hand":    onHand,
+		"reserved":   reserved,
+		"available":  onHand - reserved,
+		"warehouses": rows,
+	})
+}
+
+// GET /admin/inventory/movements?product_id=&warehouse_id=&order_id=
+func GetStockMovements(c *gin.Context) {
+	filter := bson.M{}
+	for param, field := range map[string]string{
+		"product_id":   "product_id",
+		"warehouse_id": "warehouse_id",
+		"order_id":     "order_id",
+	} {
+		if val := c.Query(param); val != "" {
+			objID, err := primitive.ObjectIDFromHex(val)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			filter[field] = objID
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(200)
+	cursor, err := stockMovementCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var movements []models.StockMovement
+	if err := cursor.All(ctx, &movements); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, movements)
+}
+
+// ======================= PUBLIC =======================
+
+// GET /product/:id/stock
+// A product not stocked in any warehouse yet sells on its in_stock flag, as
+// at checkout; it is reported untracked, with no available count.
+func GetProductStock(c *gin.Context) {
+	productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tracked, err := stockTracked(ctx, productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
+		return
+	}
+	if !tracked {
+		var product models.Product
+		err := database.GetCollection("products").FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"product_id": productID,
+			"tracked":    false,
+			"available":  nil,
+			"in_stock":   product.InStock,
+		})
+		return
+	}
+
+	available, err := availableQuantity(ctx, productID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productID,
+		"tracked":    true,
+		"available":  available,
+		"in_stock":   available > 0,
+	})
+}
@@ -2,16 +2,196 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/internal/invoice"
+	"github.com/ashishnagargoje0/backend/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"github.com/ashishnagargoje0/backend/models"
-	 "github.com/ashishnagargoje0/backend/database"
-	
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const invoiceUploadPath = "uploads/invoices"
+
+// invoiceClaimTimeout is how long an order's invoice may stay claimed but
+// unnumbered before another request takes the claim over
+const invoiceClaimTimeout = time.Minute
+
+// errInvoicePending is returned while another request is issuing the invoice
+var errInvoicePending = errors.New("invoice is being issued")
+
+// nextInvoiceSequence hands out consecutive numbers per financial year, as GST requires
+func nextInvoiceSequence(ctx context.Context, financialYear string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := database.GetCollection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": "invoice/" + financialYear},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	return counter.Seq, err
+}
+
+// writeInvoicePDF renders the invoice into uploads/ and returns the file path
+func writeInvoicePDF(inv models.Invoice) (string, error) {
+	if err := os.MkdirAll(invoiceUploadPath, os.ModePerm); err != nil {
+		return "", err
+	}
+	path := filepath.Join(invoiceUploadPath, strings.ReplaceAll(inv.InvoiceNo, "/", "-")+".pdf")
+	return path, os.WriteFile(path, invoice.Render(inv), 0o644)
+}
+
+// issueInvoice creates the tax invoice of a paid order, or returns the one
+// already issued. The order's invoice record is claimed before a number is
+// taken, so concurrent or repeated calls never consume a second number and
+// the series has no gaps.
+func issueInvoice(ctx context.Context, order models.Order) (models.Invoice, error) {
+	var inv models.Invoice
+	now := time.Now()
+	res, err := database.InvoiceCollection.UpdateOne(ctx,
+		bson.M{"order_id": order.ID},
+		bson.M{"$setOnInsert": bson.M{"order_id": order.ID, "user_id": order.UserID, "created_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return inv, err
+	}
+	claimID, claimed := res.UpsertedID.(primitive.ObjectID)
+	if !claimed {
+		// Issued already, or still being numbered by another request
+		if err := database.InvoiceCollection.FindOne(ctx, bson.M{"order_id": order.ID}).Decode(&inv); err != nil || inv.InvoiceNo != "" {
+			return inv, err
+		}
+		// A claim left unnumbered by a request that gave up is taken over
+		res, err := database.InvoiceCollection.UpdateOne(ctx,
+			bson.M{"_id": inv.ID, "invoice_number": bson.M{"$exists": false}, "created_at": bson.M{"$lte": now.Add(-invoiceClaimTimeout)}},
+			bson.M{"$set": bson.M{"created_at": now}},
+		)
+		if err != nil {
+			return inv, err
+		}
+		if res.ModifiedCount == 0 {
+			return inv, errInvoicePending
+		}
+		claimID = inv.ID
+	}
+
+	var user models.User
+	_ = database.GetCollection("users").FindOne(ctx, bson.M{"_id": order.UserID}).Decode(&user)
+	buyer := models.InvoiceParty{Name: user.Name, StateCode: order.PlaceOfSupply, State: models.GSTStateName(order.PlaceOfSupply)}
+	if address := order.ShippingAddress; address != nil {
+		buyer.Address = strings.Join(nonEmpty(address.Line1, address.Line2, address.City, address.District, address.Pincode), ", ")
+		buyer.State = address.State
+	}
+	if buyer.Name == "" {
+		buyer.Name = "Customer"
+	}
+
+	fy := models.FinancialYear(now)
+	seq, err := nextInvoiceSequence(ctx, fy)
+	if err != nil {
+		return inv, err
+	}
+
+	inv = models.NewInvoice(order, models.FormatInvoiceNumber(invoice.NumberPrefix(), fy, seq), invoice.SellerFromEnv(), buyer)
+	inv.ID = claimID
+	if _, err := database.InvoiceCollection.ReplaceOne(ctx, bson.M{"_id": claimID}, inv); err != nil {
+		return inv, err
+	}
+
+	// The PDF is rendered again on download if this fails
+	if path, err := writeInvoicePDF(inv); err == nil {
+		inv.PDFPath = path
+		database.InvoiceCollection.UpdateOne(ctx, bson.M{"_id": inv.ID}, bson.M{"$set": bson.M{"pdf_path": path}})
+	}
+	return inv, nil
+}
+
+// nonEmpty drops the blank parts of an address
+func nonEmpty(parts ...string) []string {
+	kept := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// issueInvoiceForOrder is issueInvoice for callers holding only the order ID
+func issueInvoiceForOrder(ctx context.Context, orderID primitive.ObjectID) error {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+		return err
+	}
+	_, err := issueInvoice(ctx, order)
+	return err
+}
+
+// GET /api/orders/invoice/:orderId
+// Streams the GST invoice PDF of a paid order to its owner (or an admin).
+func GetInvoice(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order models.Order
+	err = orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+	if err != nil || (order.UserID != userID && c.GetString("role") != "admin") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var inv models.Invoice
+	err = database.InvoiceCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&inv)
+	if err == mongo.ErrNoDocuments || (err == nil && inv.InvoiceNo == "") {
+		if order.Status == models.OrderStatusPending || order.Status == models.OrderStatusCancelled {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice is issued once the order is paid"})
+			return
+		}
+		// Paid before invoicing existed, or issuing failed at payment time
+		inv, err = issueInvoice(ctx, order)
+	}
+	if errors.Is(err, errInvoicePending) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice is being issued, please try again shortly"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invoice"})
+		return
+	}
+
+	// Re-render if the file was lost, e.g. on a fresh container
+	if _, statErr := os.Stat(inv.PDFPath); inv.PDFPath == "" || statErr != nil {
+		path, err := writeInvoicePDF(inv)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invoice"})
+			return
+		}
+		inv.PDFPath = path
+		database.InvoiceCollection.UpdateOne(ctx, bson.M{"_id": inv.ID}, bson.M{"$set": bson.M{"pdf_path": path}})
+	}
+
+	c.FileAttachment(inv.PDFPath, strings.ReplaceAll(inv.InvoiceNo, "/", "-")+".pdf")
+}
+
 func GetInvoiceByID(c *gin.Context) {
 	invoiceID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(invoiceID)
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ======================= ADMIN =======================
+
+// GET /admin/ledger/entries?user_id=&account=&kind=&page=1&limit=20
+// The journal, newest first, for auditing a farmer or an account.
+func AdminListLedgerEntries(c *gin.Context) {
+	page, limit, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{}
+	if kind := c.Query("kind"); kind != "" {
+		filter["kind"] = kind
+	}
+	posting := bson.M{}
+	if account := c.Query("account"); account != "" {
+		posting["account"] = account
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		posting["user_id"] = userID
+	}
+	if len(posting) > 0 {
+		filter["postings"] = bson.M{"$elemMatch": posting}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	total, err := database.LedgerCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := database.LedgerCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ledger"})
+		return
+	}
+	entries := []models.LedgerEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "page": page, "limit": limit, "total": total})
+}
+
+// GET /admin/ledger/reconciliation
+// Account totals, and every balance or record that disagrees with the ledger.
+func AdminLedgerReconciliation(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := buildReconciliationReport(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile ledger"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
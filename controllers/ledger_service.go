@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The ledger service: every movement of rupees or coins is also posted here
+// as a balanced double-entry record, next to the balance it changes and in
+// the same transaction. The reconciliation report checks the two agree.
+
+var errLedgerEntryExists = errors.New("ledger entry already posted")
+
+// postLedger records a balanced entry. An event that was already posted
+// (same kind and reference) returns errLedgerEntryExists.
+func postLedger(ctx context.Context, entry models.LedgerEntry) error {
+	if !entry.Balanced() {
+		return fmt.Errorf("ledger entry %s %s is not balanced", entry.Kind, entry.Reference)
+	}
+	_, err := database.LedgerCollection.InsertOne(ctx, entry)
+	if mongo.IsDuplicateKeyError(err) {
+		return errLedgerEntryExists
+	}
+	return err
+}
+
+// walletLedgerEntry is the counterpart of a wallet_transactions entry: the
+// farmer's wallet against refunds payable for refunds, or against revenue
+// for order payments and admin adjustments
+func walletLedgerEntry(tx models.WalletTransaction) models.LedgerEntry {
+	wallet := models.UserAccount(models.AccountUserWallet, tx.UserID)
+	other := models.PlatformAccount(models.AccountPlatformRevenue)
+	if tx.Source == models.WalletSourceRefund {
+		other = models.PlatformAccount(models.AccountRefundsPayable)
+	}
+	debit, credit := other, wallet
+	if tx.Type == models.WalletDebit {
+		debit, credit = wallet, other
+	}
+	return models.NewLedgerEntry(models.LedgerKindWallet, "wallet:"+tx.ID.Hex(), models.LedgerCurrencyINR,
+		tx.Amount, debit, credit, tx.Reason)
+}
+
+// coinsLedgerEntry moves n coins between the farmer and the coin pool
+func coinsLedgerEntry(userID primitive.ObjectID, n int, kind, reference, reason string) models.LedgerEntry {
+	coins := models.UserAccount(models.AccountUserCoins, userID)
+	pool := models.PlatformAccount(models.AccountCoinPool)
+	if kind == models.LedgerKindCoinsDebit {
+		return models.NewLedgerEntry(kind, reference, models.LedgerCurrencyCoin, float64(n), coins, pool, reason)
+	}
+	return models.NewLedgerEntry(kind, reference, models.LedgerCurrencyCoin, float64(n), pool, coins, reason)
+}
+
+// ======================= RECONCILIATION =======================
+
+// buildReconciliationReport totals every ledger account and compares the
+// user accounts, refunds payable and the gateway with the records they
+// mirror. Anything that does not agree is listed as a mismatch.
+func buildReconciliationReport(ctx context.Context) (models.ReconciliationReport, error) {
+	report := models.ReconciliationReport{GeneratedAt: time.Now(), Mismatches: []models.ReconciliationMismatch{}}
+
+	accounts, err := ledgerAccountBalances(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Accounts = accounts
+
+	unbalanced, err := unbalancedLedgerEntries(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Mismatches = append(report.Mismatches, unbalanced...)
+
+	ledgerWallets, err := ledgerUserBalances(ctx, models.AccountUserWallet)
+	if err != nil {
+		return report, err
+	}
+	wallets, err := sumByUser(ctx, database.GetCollection("wallets"), mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$_id", "total": bson.M{"$sum": "$balance"}}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	report.Mismatches = append(report.Mismatches, models.CompareUserBalances(models.CheckWalletBalance, ledgerWallets, wallets)...)
+
+	statements, err := sumByUser(ctx, database.WalletTransactionCollection, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "total": bson.M{"$sum": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$type", models.WalletDebit}},
+			bson.M{"$multiply": bson.A{"$amount", -1}},
+			"$amount",
+		}}}}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	report.Mismatches = append(report.Mismatches, models.CompareUserBalances(models.CheckWalletStatement, ledgerWallets, statements)...)
+
+	ledgerCoins, err := ledgerUserBalances(ctx, models.AccountUserCoins)
+	if err != nil {
+		return report, err
+	}
+	coins, err := sumByUser(ctx, database.GetCollection("coins"), mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "total": bson.M{"$sum": "$coins"}}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	report.Mismatches = append(report.Mismatches, models.CompareUserBalances(models.CheckCoinBalance, ledgerCoins, coins)...)
+
+	// Refunds payable is what was issued but not paid out: the failed refunds
+	failedRefunds, err := sumAll(ctx, database.RefundCollection, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": models.RefundStatusFailed}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$amount"}}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	if m, ok := models.CompareAmounts(models.CheckRefundsPayable, accountBalance(accounts, models.AccountRefundsPayable), failedRefunds); ok {
+		report.Mismatches = append(report.Mismatches, m)
+	}
+
+	// The gateway holds what was captured there less what it refunded
+	collected, err := sumAll(ctx, database.PaymentCollection, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"provider": bson.M{"$ne": models.WalletProvider},
+			"status":   bson.M{"$in": bson.A{models.PaymentStatusCaptured, models.PaymentStatusRefunded}},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$subtract": bson.A{"$amount", bson.M{"$ifNull": bson.A{"$refunded_amount", 0}}}}}}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	if m, ok := models.CompareAmounts(models.CheckPaymentGateway, accountBalance(accounts, models.AccountPaymentGateway), collected); ok {
+		report.Mismatches = append(report.Mismatches, m)
+	}
+
+	report.Reconciled = len(report.Mismatches) == 0
+	return report, nil
+}
+
+// ledgerAccountBalances totals each account, all farmers together
+func ledgerAccountBalances(ctx context.Context) ([]models.LedgerAccountBalance, error) {
+	cursor, err := database.LedgerCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$unwind", Value: "$postings"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     bson.M{"account": "$postings.account", "currency": "$currency"},
+			"debits":  bson.M{"$sum": "$postings.debit"},
+			"credits": bson.M{"$sum": "$postings.credit"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			Account  string `bson:"account"`
+			Currency string `bson:"currency"`
+		} `bson:"_id"`
+		Debits  float64 `bson:"debits"`
+		Credits float64 `bson:"credits"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	accounts := []models.LedgerAccountBalance{}
+	for _, row := range rows {
+		balance := row.Debits - row.Credits
+		if models.CreditNormal(row.ID.Account) {
+			balance = -balance
+		}
+		accounts = append(accounts, models.LedgerAccountBalance{
+			Account:  row.ID.Account,
+			Currency: row.ID.Currency,
+			Debits:   models.RoundAmount(row.Debits),
+			Credits:  models.RoundAmount(row.Credits),
+			Balance:  models.RoundAmount(balance),
+		})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Account < accounts[j].Account })
+	return accounts, nil
+}
+
+func accountBalance(accounts []models.LedgerAccountBalance, name string) float64 {
+	for _, a := range accounts {
+		if a.Account == name {
+			return a.Balance
+		}
+	}
+	return 0
+}
+
+// ledgerUserBalances is each farmer's balance on a credit-normal user account
+func ledgerUserBalances(ctx context.Context, account string) (map[primitive.ObjectID]float64, error) {
+	return sumByUser(ctx, database.LedgerCollection, mongo.Pipeline{
+		{{Key: "$unwind", Value: "$postings"}},
+		{{Key: "$match", Value: bson.M{"postings.account": account}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$postings.user_id",
+			"total": bson.M{"$sum": bson.M{"$subtract": bson.A{"$postings.credit", "$postings.debit"}}},
+		}}},
+	})
+}
+
+// unbalancedLedgerEntries finds entries written around postLedger
+func unbalancedLedgerEntries(ctx context.Context) ([]models.ReconciliationMismatch, error) {
+	cursor, err := database.LedgerCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{
+			"kind":      1,
+			"reference": 1,
+			"debits":    bson.M{"$sum": "$postings.debit"},
+			"credits":   bson.M{"$sum": "$postings.credit"},
+		}}},
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$gte": bson.A{
+			bson.M{"$abs": bson.M{"$subtract": bson.A{"$debits", "$credits"}}}, 0.005,
+		}}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Kind      string  `bson:"kind"`
+		Reference string  `bson:"reference"`
+		Debits    float64 `bson:"debits"`
+		Credits   float64 `bson:"credits"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	var mismatches []models.ReconciliationMismatch
+	for _, row := range rows {
+		mismatches = append(mismatches, models.ReconciliationMismatch{
+			Check:     models.CheckUnbalancedEntry,
+			Reference: row.Kind + " " + row.Reference,
+			Ledger:    models.RoundAmount(row.Debits),
+			Actual:    models.RoundAmount(row.Credits),
+		})
+	}
+	return mismatches, nil
+}
+
+// sumByUser runs a pipeline that groups {_id: user ID, total} into a map
+func sumByUser(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline) (map[primitive.ObjectID]float64, error) {
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		UserID primitive.ObjectID `bson:"_id"`
+		Total  float64            `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	totals := make(map[primitive.ObjectID]float64, len(rows))
+	for _, row := range rows {
+		totals[row.UserID] += row.Total
+	}
+	return totals, nil
+}
+
+// sumAll runs a pipeline that groups everything into one {total}
+func sumAll(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline) (float64, error) {
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	var rows []struct {
+		Total float64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Total, nil
+}
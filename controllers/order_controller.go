@@ -2,10 +2,15 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/internal/payment"
 	"github.com/ashishnagargoje0/backend/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,69 +20,73 @@ import (
 
 var orderCollection *mongo.Collection
 
+// errProductUnavailable is returned when a cart line points at a product that no longer exists
+var errProductUnavailable = errors.New("product no longer available")
+
 // InitOrderCollection initializes the orders collection; call this once after DB connection is ready
 func InitOrderCollection() {
 	orderCollection = config.DB.Collection("orders")
 }
 
-// ======================= ORDER =======================
-
-// OrderCheckout handles order placement from the user's cart.
-func OrderCheckout(c *gin.Context) {
-	userIDVal, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
+// cartProducts loads the products referenced by cart items in one query
+func cartProducts(ctx context.Context, cartItems []models.CartItem) (map[primitive.ObjectID]models.Product, error) {
+	productIDs := make([]primitive.ObjectID, 0, len(cartItems))
+	for _, item := range cartItems {
+		productIDs = append(productIDs, item.ProductID)
 	}
 
-	userID, ok := userIDVal.(primitive.ObjectID)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cartCol := config.DB.Collection("carts")
-	cursor, err := cartCol.Find(ctx, bson.M{"user_id": userID})
+	cursor, err := database.GetCollection("products").Find(ctx, bson.M{"_id": bson.M{"$in": productIDs}})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
-		return
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var cartItems []models.CartItem
-	if err := cursor.All(ctx, &cartItems); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode cart items"})
-		return
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
 	}
-	if len(cartItems) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
-		return
+	byID := make(map[primitive.ObjectID]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
 	}
+	return byID, nil
+}
 
-	order := models.Order{
-		UserID:    userID,
-		Items:     cartItems,
-		Status:    "pending",
-		CreatedAt: time.Now(),
-	}
-	_, err = orderCollection.InsertOne(ctx, order)
+// snapshotOrderItems copies the current name and price of every cart product
+// into order lines, so the order keeps its price if the product changes later.
+func snapshotOrderItems(ctx context.Context, cartItems []models.CartItem) ([]models.OrderItem, error) {
+	byID, err := cartProducts(ctx, cartItems)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
-		return
+		return nil, err
 	}
 
-	_, err = cartCol.DeleteMany(ctx, bson.M{"user_id": userID})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
-		return
+	items := make([]models.OrderItem, 0, len(cartItems))
+	for _, ci := range cartItems {
+		product, ok := byID[ci.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errProductUnavailable, ci.ProductID.Hex())
+		}
+		items = append(items, orderItemFromProduct(product, ci.Quantity))
 	}
+	return items, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order placed successfully", "order": order})
+// orderItemFromProduct snapshots a product at its current price
+func orderItemFromProduct(product models.Product, quantity int) models.OrderItem {
+	return models.OrderItem{
+		ProductID:  product.ID,
+		CategoryID: product.CategoryID,
+		Name:       product.Name,
+		ImageURL:   product.ImageURL,
+		HSNCode:    product.HSNCode,
+		GSTRate:    product.GSTRate,
+		UnitPrice:  product.Price,
+		Quantity:   quantity,
+	}
 }
 
+// ======================= ORDER =======================
+
 // GetOrderHistory fetches all orders for the logged-in user.
 func GetOrderHistory(c *gin.Context) {
 	userID, ok := getUserObjectID(c)
@@ -128,7 +137,7 @@ func GetOrderByID(c *gin.Context) {
 
 // ======================= PAYMENT =======================
 
-// InitiatePayment simulates payment initiation (e.g., Razorpay).
+// InitiatePayment creates a payment for a pending order with the configured gateway.
 func InitiatePayment(c *gin.Context) {
 	var req struct {
 		OrderID string `json:"orderId"`
@@ -139,170 +148,186 @@ func InitiatePayment(c *gin.Context) {
 		return
 	}
 
-	_, err := primitive.ObjectIDFromHex(req.OrderID)
+	orderID, err := primitive.ObjectIDFromHex(req.OrderID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
 		return
 	}
 
-	// Dummy payment ID generation
-	paymentID := primitive.NewObjectID().Hex()
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Payment initiated",
-		"payment_id": paymentID,
-		"gateway":    req.Method,
-	})
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
 
-// VerifyPayment updates payment status.
-func VerifyPayment(c *gin.Context) {
-	var req struct {
-		OrderID   string `json:"orderId"`
-		PaymentID string `json:"paymentId"`
-		Status    string `json:"status"` // "success" / "failed"
+	order, err := findUserOrder(ctx, orderID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
 	}
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if order.Status != models.OrderStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is not awaiting payment"})
 		return
 	}
 
-	orderID, err := primitive.ObjectIDFromHex(req.OrderID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+	// Orders placed before checkout confirmed covered ones may still be
+	// waiting here; the gateway takes no ₹0 payments
+	if order.TotalAmount <= 0 {
+		err := transitionOrderFrom(ctx, order.ID, []string{models.OrderStatusPending}, models.OrderStatusPaid, coveredOrderNote, "",
+			bson.M{"payment_status": paymentCovered})
+		if err != nil {
+			respondTransitionError(c, err)
+			return
+		}
+		confirmCoveredOrder(ctx, order.ID)
+		c.JSON(http.StatusOK, gin.H{"message": "Nothing to pay; order confirmed", "amount": 0})
 		return
 	}
 
-	if req.Status != "success" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment failed"})
+	// Wallet payments settle at once, without the gateway
+	if req.Method == "Wallet" {
+		pay, err := payOrderFromWallet(ctx, order)
+		switch {
+		case errors.Is(err, errInsufficientWalletBalance):
+			balance, _ := walletBalance(ctx, userID)
+			c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance", "balance": balance, "amount": order.TotalAmount})
+		case errors.Is(err, errInvalidTransition), errors.Is(err, errWalletEntryExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Order is not awaiting payment"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pay from wallet"})
+		default:
+			c.JSON(http.StatusOK, gin.H{"message": "Order paid from wallet", "payment_id": pay.ID.Hex(), "gateway": pay.Provider, "amount": pay.Amount})
+		}
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	_, err = orderCollection.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$set": bson.M{
-		"status":         "paid",
-		"payment_status": "success",
-		"updated_at":     time.Now(),
-	}})
+	intent, err := paymentGateway.CreateIntent(ctx, order.ID.Hex(), order.TotalAmount)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment status"})
+		log.Printf("⚠️ Gateway %s failed to create payment for order %s: %v", paymentGateway.Name(), order.ID.Hex(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create payment with gateway"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
-}
+	now := time.Now()
+	pay := models.Payment{
+		ID:              primitive.NewObjectID(),
+		OrderID:         order.ID,
+		UserID:          userID,
+		Method:          req.Method,
+		Provider:        intent.Provider,
+		ProviderOrderID: intent.ProviderOrderID,
+		Amount:          intent.Amount,
+		Currency:        intent.Currency,
+		Status:          models.PaymentStatusCreated,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if _, err := database.PaymentCollection.InsertOne(ctx, pay); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
 
-// GetPaymentOptions returns available payment methods.
-func GetPaymentOptions(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"methods": []string{"COD", "UPI", "CreditCard", "EMI"},
+		"message":           "Payment initiated",
+		"payment_id":        pay.ID.Hex(),
+		"gateway":           intent.Provider,
+		"provider_order_id": intent.ProviderOrderID,
+		"amount":            intent.Amount,
+		"currency":          intent.Currency,
+		"key_id":            intent.KeyID,
 	})
 }
 
-// ======================= EMI =======================
-
-// ApplyEMIPlan simulates EMI application.
-func ApplyEMIPlan(c *gin.Context) {
+// VerifyPayment checks the gateway signature of a completed checkout and
+// captures the payment. The client can no longer just claim success, nor
+// failure: a reported failure is checked with the gateway first.
+func VerifyPayment(c *gin.Context) {
 	var req struct {
-		OrderID string `json:"orderId"`
-		Months  int    `json:"months"`
+		OrderID           string `json:"orderId"`
+		PaymentID         string `json:"paymentId"`         // our payment record from InitiatePayment
+		ProviderPaymentID string `json:"providerPaymentId"` // e.g. razorpay_payment_id
+		Signature         string `json:"signature"`         // e.g. razorpay_signature
+		Status            string `json:"status"`            // "failed" when the checkout reports an error
 	}
-	if err := c.BindJSON(&req); err != nil || req.Months <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":      "EMI application submitted",
-		"orderId":      req.OrderID,
-		"months":       req.Months,
-		"status":       "under_review",
-		"interestRate": 12.5,
-	})
-}
-
-// GetEMIStatus returns simulated EMI plan status.
-func GetEMIStatus(c *gin.Context) {
-	orderID := c.Query("orderId")
-	if orderID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID required"})
+	orderID, err := primitive.ObjectIDFromHex(req.OrderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"orderId":      orderID,
-		"emiApproved":  true,
-		"months":       6,
-		"monthlyEMI":   1200,
-		"status":       "approved",
-		"interestRate": 12.5,
-	})
-}
-
-// ======================= INVOICE =======================
-
-// GetInvoice returns a simulated invoice URL.
-func GetInvoice(c *gin.Context) {
-	orderID := c.Param("orderId")
-	if orderID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
+	paymentID, err := primitive.ObjectIDFromHex(req.PaymentID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"invoice_url": "https://cdn.shetiseva.in/invoices/" + orderID + ".pdf",
-	})
-}
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
 
-// ======================= DELIVERY =======================
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
 
-// GetDeliveryAgentStatus returns agent's live location.
-func GetDeliveryAgentStatus(c *gin.Context) {
-	orderID := c.Query("orderId")
-	if orderID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID required"})
+	if _, err := findUserOrder(ctx, orderID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"orderId":        orderID,
-		"agentName":      "Ravi Pawar",
-		"location":       "Nagpur",
-		"eta":            "15 mins",
-		"status":         "On the way",
-		"contactNumber":  "+91-9876543210",
-	})
-}
-
-// ConfirmDelivery marks the order as delivered.
-func ConfirmDelivery(c *gin.Context) {
-	var req struct {
-		OrderID string `json:"orderId"`
+	var pay models.Payment
+	err = database.PaymentCollection.FindOne(ctx, bson.M{"_id": paymentID, "order_id": orderID}).Decode(&pay)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
 	}
-	if err := c.BindJSON(&req); err != nil || req.OrderID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if pay.Status != models.PaymentStatusCreated && pay.Status != models.PaymentStatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment already processed"})
 		return
 	}
 
-	orderID, err := primitive.ObjectIDFromHex(req.OrderID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+	if req.Status == "failed" {
+		taken, err := settleReportedFailure(ctx, pay)
+		switch {
+		case errors.Is(err, errGatewayUnconfirmed):
+			log.Printf("⚠️ Reported failure of payment %s not checked: %v", pay.ID.Hex(), err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Could not confirm the payment with the gateway"})
+		case err != nil:
+			respondTransitionError(c, err)
+		case taken:
+			c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payment failed"})
+		}
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	if !paymentGateway.VerifySignature(pay.ProviderOrderID, req.ProviderPaymentID, req.Signature) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": payment.ErrInvalidSignature.Error()})
+		return
+	}
 
-	_, err = orderCollection.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$set": bson.M{
-		"status":      "delivered",
-		"deliveredAt": time.Now(),
-	}})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm delivery"})
+	// A capture error does not mean the money is not taken: the attempt stays
+	// open for the gateway's webhook to settle
+	err = paymentGateway.Capture(ctx, req.ProviderPaymentID, pay.Amount)
+	if err != nil && !errors.Is(err, payment.ErrAlreadyCaptured) {
+		log.Printf("⚠️ Capture failed for payment %s: %v", pay.ID.Hex(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to capture payment"})
+		return
+	}
+
+	if err := completePayment(ctx, pay, req.ProviderPaymentID); err != nil {
+		respondTransitionError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order marked as delivered"})
+	c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
+}
+
+// GetPaymentOptions returns available payment methods.
+func GetPaymentOptions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"methods": []string{"COD", "UPI", "CreditCard", "EMI", "Wallet"},
+	})
 }
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	errOrderNotFound     = errors.New("order not found")
+	errInvalidTransition = errors.New("invalid order status transition")
+)
+
+// newOrderHistory starts the status timeline of a freshly placed order
+func newOrderHistory(at time.Time) []models.OrderStatusEvent {
+	return []models.OrderStatusEvent{{
+		Status:    models.OrderStatusPending,
+		Note:      "Order placed",
+		ChangedAt: at,
+	}}
+}
+
+// transitionOrder moves an order to a new status and appends it to the
+// timeline. The update only matches when the current status is allowed to
+// move to `to`, so two concurrent requests cannot both succeed. Extra fields
+// are $set alongside the status.
+func transitionOrder(ctx context.Context, orderID primitive.ObjectID, to, note, changedBy string, extra bson.M) error {
+	return transitionOrderFrom(ctx, orderID, models.OrderStatusesBefore(to), to, note, changedBy, extra)
+}
+
+// transitionOrderFrom is transitionOrder narrowed to a subset of source
+// statuses, e.g. an unpaid order may only expire while still pending.
+func transitionOrderFrom(ctx context.Context, orderID primitive.ObjectID, from []string, to, note, changedBy string, extra bson.M) error {
+	for _, status := range from {
+		if !models.CanTransitionOrder(status, to) {
+			return fmt.Errorf("%w: %s → %s", errInvalidTransition, status, to)
+		}
+	}
+	if len(from) == 0 {
+		return fmt.Errorf("%w: nothing can move to %q", errInvalidTransition, to)
+	}
+
+	now := time.Now()
+	set := bson.M{"status": to, "updated_at": now}
+	for k, v := range extra {
+		set[k] = v
+	}
+	event := models.OrderStatusEvent{Status: to, Note: note, ChangedBy: changedBy, ChangedAt: now}
+
+	res, err := orderCollection.UpdateOne(ctx,
+		bson.M{"_id": orderID, "status": bson.M{"$in": from}},
+		bson.M{"$set": set, "$push": bson.M{"status_history": event}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	var current models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errOrderNotFound
+		}
+		return err
+	}
+	return fmt.Errorf("%w: %s → %s", errInvalidTransition, current.Status, to)
+}
+
+// respondTransitionError maps transitionOrder errors to HTTP responses
+func respondTransitionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	case errors.Is(err, errInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+	}
+}
+
+// settleCancelledOrder gives back everything a cancelled order held: the
+// reserved stock, the coupon use, the coins redeemed and, if it was paid
+// online, the money. Coins the order earned are taken back and a referral
+// it qualified is dropped. Only a failed refund is returned as an error,
+// together with its refund record; the rest is logged.
+func settleCancelledOrder(ctx context.Context, order models.Order, reason string) (*models.Refund, error) {
+	if err := releaseStock(ctx, order.ID); err != nil {
+		log.Printf("⚠️ Failed to release stock for order %s: %v", order.ID.Hex(), err)
+	}
+	if err := closeEMIPlan(ctx, order.ID); err != nil {
+		log.Printf("⚠️ Failed to close EMI plan of order %s: %v", order.ID.Hex(), err)
+	}
+	if err := releaseCoupon(ctx, order.ID); err != nil {
+		log.Printf("⚠️ Failed to release coupon for order %s: %v", order.ID.Hex(), err)
+	}
+	// Coins go back once per order, however many times it is settled
+	if err := returnCoins(ctx, order.UserID, order.CoinsUsed, "order:"+order.ID.Hex(), "Order cancelled"); err != nil && !errors.Is(err, errLedgerEntryExists) {
+		log.Printf("⚠️ Failed to return %d coins for order %s: %v", order.CoinsUsed, order.ID.Hex(), err)
+	}
+	if err := revokeEarnedCoins(ctx, order.UserID, models.CoinEventOrderPaid, order.ID.Hex()); err != nil {
+		log.Printf("⚠️ Failed to take back coins earned by order %s: %v", order.ID.Hex(), err)
+	}
+	if err := dropReferral(ctx, order.ID, "First order was cancelled"); err != nil {
+		log.Printf("⚠️ Failed to drop referral of order %s: %v", order.ID.Hex(), err)
+	}
+
+	refund, err := issueRefund(ctx, order, models.Refund{Reason: reason, Method: models.RefundToOriginal})
+	if errors.Is(err, errNothingToRefund) {
+		return nil, nil
+	}
+	return refund, err
+}
+
+// pendingOrderTTL is how long an order may wait for payment, configurable
+// in minutes with PENDING_ORDER_TTL_MINUTES
+func pendingOrderTTL() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("PENDING_ORDER_TTL_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return models.DefaultPendingOrderTTL
+}
+
+// expirePendingOrders cancels orders left unpaid for longer than
+// pendingOrderTTL, so the stock, coupon and coins they hold go back
+func expirePendingOrders(ctx context.Context) error {
+	cursor, err := orderCollection.Find(ctx, bson.M{
+		"status":         models.OrderStatusPending,
+		"payment_status": bson.M{"$ne": emiAwaitingApproval}, // the dealer decides on these
+		"created_at":     bson.M{"$lte": time.Now().Add(-pendingOrderTTL())},
+	})
+	if err != nil {
+		return err
+	}
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return err
+	}
+
+	const reason = "Payment not received in time"
+	for _, order := range orders {
+		err := transitionOrderFrom(ctx, order.ID, []string{models.OrderStatusPending}, models.OrderStatusCancelled,
+			reason, "", bson.M{"cancelled_at": time.Now(), "cancel_reason": reason})
+		if errors.Is(err, errInvalidTransition) {
+			continue // paid or cancelled in the meantime
+		}
+		if err != nil {
+			log.Printf("⚠️ Failed to expire order %s: %v", order.ID.Hex(), err)
+			continue
+		}
+		if _, err := settleCancelledOrder(ctx, order, reason); err != nil {
+			log.Printf("⚠️ Failed to settle expired order %s: %v", order.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// RunPendingOrderExpiryJob cancels unpaid orders every interval until ctx is done
+func RunPendingOrderExpiryJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := expirePendingOrders(runCtx); err != nil {
+			log.Printf("⚠️ Pending order expiry run failed: %v", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// POST /api/orders/:id/cancel
+// The farmer may cancel until the order ships. Paid orders are refunded to
+// the original payment method straight away.
+func CancelOrder(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input models.CancelOrderInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+	reason := input.Reason
+	if reason == "" {
+		reason = "Cancelled by customer"
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	order, err := findUserOrder(ctx, orderID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if !models.CanCustomerCancel(order.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can no longer be cancelled", "status": order.Status})
+		return
+	}
+
+	now := time.Now()
+	err = transitionOrderFrom(ctx, orderID, models.CustomerCancellableStatuses(), models.OrderStatusCancelled,
+		reason, c.GetString("email"), bson.M{"cancelled_at": now, "cancel_reason": reason})
+	if err != nil {
+		respondTransitionError(c, err)
+		return
+	}
+
+	// The order is cancelled either way; a refused refund stays on record
+	// for the payments team to retry
+	refund, err := settleCancelledOrder(ctx, order, reason)
+	if err != nil {
+		log.Printf("⚠️ Order %s cancelled but refund failed: %v", orderID.Hex(), err)
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Order cancelled. Your refund is delayed and will be retried",
+			"status":  models.OrderStatusCancelled,
+			"refund":  refund,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled", "status": models.OrderStatusCancelled, "refund": refund})
+}
+
+// GET /api/orders/:id/timeline
+func GetOrderTimeline(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order models.Order
+	err = orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+	if err != nil || (order.UserID != userID && c.GetString("role") != "admin") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id": order.ID,
+		"status":   order.Status,
+		"timeline": order.StatusHistory,
+	})
+}
+
+// adminOwnedElsewhere says which flow moves an order into the statuses an
+// admin cannot set by hand, because of what comes with them: the payment
+// (coins, referral), the delivery OTP, and the return's refund and restock
+var adminOwnedElsewhere = map[string]string{
+	models.OrderStatusPaid:      "Orders are marked paid when their payment is captured",
+	models.OrderStatusDelivered: "Orders are delivered by the agent with the customer's OTP",
+	models.OrderStatusReturned:  "Orders are returned through a return request and its quality check",
+}
+
+// PUT /admin/orders/:id/status
+// Packs, ships or cancels an order.
+func AdminUpdateOrderStatus(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input models.OrderStatusUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil || !models.IsValidOrderStatus(input.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	if reason, ok := adminOwnedElsewhere[input.Status]; ok {
+		c.JSON(http.StatusConflict, gin.H{"error": reason})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	extra := bson.M{}
+	if input.Status == models.OrderStatusCancelled {
+		extra["cancelled_at"] = time.Now()
+		extra["cancel_reason"] = input.Note
+	}
+
+	if err := transitionOrder(ctx, orderID, input.Status, input.Note, c.GetString("email"), extra); err != nil {
+		respondTransitionError(c, err)
+		return
+	}
+
+	// Stock follows the order: it leaves the warehouse on shipping and goes
+	// back on the shelf if the order is cancelled before that, along with
+	// the coupon, coins and money.
+	switch input.Status {
+	case models.OrderStatusShipped:
+		if err := dispatchStock(ctx, orderID); err != nil {
+			log.Printf("⚠️ Failed to dispatch stock for order %s: %v", orderID.Hex(), err)
+		}
+	case models.OrderStatusCancelled:
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+			log.Printf("⚠️ Order %s cancelled but not settled: %v", orderID.Hex(), err)
+			break
+		}
+		reason := input.Note
+		if reason == "" {
+			reason = "Cancelled by admin"
+		}
+		refund, err := settleCancelledOrder(ctx, order, reason)
+		if err != nil {
+			log.Printf("⚠️ Order %s cancelled but refund failed: %v", orderID.Hex(), err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Order status updated", "status": input.Status, "refund": refund})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order status updated", "status": input.Status})
+}
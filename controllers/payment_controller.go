@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/internal/payment"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var paymentGateway payment.PaymentGateway
+
+var errGatewayUnconfirmed = errors.New("payment not confirmed with the gateway")
+
+// InitPaymentGateway selects the payment provider from the environment; call once at startup
+func InitPaymentGateway() {
+	paymentGateway = payment.NewGatewayFromEnv()
+	log.Printf("✅ Payment gateway: %s", paymentGateway.Name())
+}
+
+// SetPaymentGateway overrides the payment provider, e.g. with a mock in tests
+func SetPaymentGateway(g payment.PaymentGateway) {
+	paymentGateway = g
+}
+
+// findUserOrder loads an order only if it belongs to the given user
+func findUserOrder(ctx context.Context, orderID, userID primitive.ObjectID) (models.Order, error) {
+	var order models.Order
+	err := orderCollection.FindOne(ctx, bson.M{"_id": orderID, "user_id": userID}).Decode(&order)
+	if err != nil {
+		return order, errOrderNotFound
+	}
+	return order, nil
+}
+
+// openAttempt matches a payment attempt that money can still settle: one
+// not completed yet, or failed without taking any (a later try on the same
+// provider order can still succeed)
+func openAttempt(paymentID primitive.ObjectID) bson.M {
+	return bson.M{
+		"_id": paymentID,
+		"$or": bson.A{
+			bson.M{"status": models.PaymentStatusCreated},
+			bson.M{"status": models.PaymentStatusFailed, "provider_payment_id": bson.M{"$exists": false}},
+		},
+	}
+}
+
+// completePayment records a captured payment and marks its order, or
+// subscription invoice, paid. Money that can no longer be applied is
+// refunded, and errInvalidTransition or errSubscriptionInvoiceNotOpen
+// returned.
+// It is a no-op if the payment was already settled, so retries are safe.
+func completePayment(ctx context.Context, pay models.Payment, providerPaymentID string) error {
+	res, err := database.PaymentCollection.UpdateOne(ctx,
+		openAttempt(pay.ID),
+		bson.M{
+			"$set": bson.M{
+				"status":              models.PaymentStatusCaptured,
+				"provider_payment_id": providerPaymentID,
+				"updated_at":          time.Now(),
+			},
+			"$unset": bson.M{"failure_reason": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return nil
+	}
+
+	description := fmt.Sprintf("Payment for order %s", pay.OrderID.Hex())
+	if pay.SubscriptionInvoiceID != nil {
+		description = fmt.Sprintf("Payment for subscription invoice %s", pay.SubscriptionInvoiceID.Hex())
+	}
+	// A missing posting shows up in the reconciliation report
+	err = postLedger(ctx, models.NewLedgerEntry(models.LedgerKindPayment, "payment:"+pay.ID.Hex(), models.LedgerCurrencyINR,
+		pay.Amount,
+		models.PlatformAccount(models.AccountPaymentGateway),
+		models.PlatformAccount(models.AccountPlatformRevenue),
+		description,
+	))
+	if err != nil && !errors.Is(err, errLedgerEntryExists) {
+		log.Printf("⚠️ Failed to post payment %s to the ledger: %v", pay.ID.Hex(), err)
+	}
+
+	if pay.SubscriptionInvoiceID != nil {
+		inv, err := settleSubscriptionInvoice(ctx, *pay.SubscriptionInvoiceID, &pay.ID)
+		var reason string
+		switch {
+		case errors.Is(err, errSubscriptionInvoiceNotOpen):
+			reason = "Subscription invoice was void" // e.g. the grace period ran out
+		case errors.Is(err, errSubscriptionCancelled):
+			reason = "Subscription was cancelled"
+		case err == nil && (inv.PaymentID == nil || *inv.PaymentID != pay.ID):
+			reason = "Subscription invoice was already paid" // e.g. from the wallet by the renewal job
+		default:
+			return err
+		}
+		pay.ProviderPaymentID = providerPaymentID
+		if _, rerr := refundUnappliedPayment(ctx, pay, pay.Amount, reason); rerr != nil {
+			log.Printf("⚠️ Payment %s captured but not applied to subscription invoice %s, and was not refunded: %v", pay.ID.Hex(), pay.SubscriptionInvoiceID.Hex(), rerr)
+		}
+		return errSubscriptionInvoiceNotOpen
+	}
+
+	err = transitionOrder(ctx, pay.OrderID, models.OrderStatusPaid, "Payment captured", "", bson.M{
+		"payment_status": "success",
+		"payment_id":     pay.ID,
+	})
+	if errors.Is(err, errInvalidTransition) {
+		// Money arrived for an order that can no longer be paid (cancelled, or
+		// already paid by another attempt)
+		pay.ProviderPaymentID = providerPaymentID
+		if _, rerr := refundLatePayment(ctx, pay); rerr != nil {
+			log.Printf("⚠️ Payment %s captured but order %s cannot be marked paid, and was not refunded: %v", pay.ID.Hex(), pay.OrderID.Hex(), rerr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// The invoice can be issued again on download, so a failure here is not fatal
+	if err := issueInvoiceForOrder(ctx, pay.OrderID); err != nil {
+		log.Printf("⚠️ Failed to issue invoice for order %s: %v", pay.OrderID.Hex(), err)
+	}
+	onOrderPaid(ctx, pay.UserID, pay.OrderID, pay.Amount)
+	return nil
+}
+
+// failPayment marks a payment attempt failed. The order stays pending so
+// the farmer can try again; one left unpaid is cancelled, and its stock
+// released, by the pending-order expiry. A subscription invoice is likewise
+// left open.
+func failPayment(ctx context.Context, pay models.Payment, reason string) error {
+	res, err := database.PaymentCollection.UpdateOne(ctx,
+		bson.M{"_id": pay.ID, "status": models.PaymentStatusCreated},
+		bson.M{"$set": bson.M{
+			"status":         models.PaymentStatusFailed,
+			"failure_reason": reason,
+			"updated_at":     time.Now(),
+		}},
+	)
+	if err != nil || res.ModifiedCount == 0 {
+		return err
+	}
+
+	if pay.SubscriptionInvoiceID != nil {
+		recordSubscriptionAttempt(ctx, *pay.SubscriptionInvoiceID, reason)
+		return nil
+	}
+
+	_, err = orderCollection.UpdateOne(ctx,
+		bson.M{"_id": pay.OrderID, "status": models.OrderStatusPending},
+		bson.M{"$set": bson.M{"payment_status": "failed", "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// settleReportedFailure handles a checkout the app reports failed. Its word
+// is not taken for it: if the gateway says a try on the same provider order
+// took the money, the attempt is settled with that try, and it is failed
+// only otherwise. taken reports which it was.
+func settleReportedFailure(ctx context.Context, pay models.Payment) (taken bool, err error) {
+	tries, err := paymentGateway.Payments(ctx, pay.ProviderOrderID)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", errGatewayUnconfirmed, err)
+	}
+	for _, try := range tries {
+		if try.Taken() {
+			return true, settleTakenPayment(ctx, pay, try)
+		}
+	}
+	return false, failPayment(ctx, pay, "Checkout reported failure")
+}
+
+// settleTakenPayment completes an attempt with a try the gateway says took
+// the money, capturing it first if it is only authorized
+func settleTakenPayment(ctx context.Context, pay models.Payment, try payment.ProviderPayment) error {
+	if models.RoundAmount(try.Amount) != models.RoundAmount(pay.Amount) {
+		if try.Status == payment.PaymentAuthorized {
+			// Never captured, so the gateway releases it by itself
+			return failPayment(ctx, pay, fmt.Sprintf("Authorized %.2f instead of %.2f", try.Amount, pay.Amount))
+		}
+		return rejectCapturedAmount(ctx, pay, try.ID, try.Amount)
+	}
+	if try.Status == payment.PaymentAuthorized {
+		err := paymentGateway.Capture(ctx, try.ID, pay.Amount)
+		if err != nil && !errors.Is(err, payment.ErrAlreadyCaptured) {
+			return fmt.Errorf("%w: %v", errGatewayUnconfirmed, err)
+		}
+	}
+	return completePayment(ctx, pay, try.ID)
+}
+
+// rejectCapturedAmount handles a capture of another amount than the attempt
+// asked for: the attempt fails and whatever was taken is given back
+func rejectCapturedAmount(ctx context.Context, pay models.Payment, providerPaymentID string, captured float64) error {
+	reason := fmt.Sprintf("Captured %.2f instead of %.2f", captured, pay.Amount)
+	res, err := database.PaymentCollection.UpdateOne(ctx,
+		openAttempt(pay.ID),
+		bson.M{"$set": bson.M{
+			"status":              models.PaymentStatusFailed,
+			"failure_reason":      reason,
+			"provider_payment_id": providerPaymentID,
+			"updated_at":          time.Now(),
+		}},
+	)
+	if err != nil || res.ModifiedCount == 0 {
+		return err
+	}
+	log.Printf("⚠️ Payment %s: %s", pay.ID.Hex(), reason)
+
+	// A refused refund is kept on record for the payments team to retry
+	pay.ProviderPaymentID = providerPaymentID
+	if _, err := refundUnappliedPayment(ctx, pay, captured, reason); err != nil {
+		log.Printf("⚠️ Failed to refund payment %s: %v", pay.ID.Hex(), err)
+	}
+	return nil
+}
+
+// recordPaymentRefund adds a gateway refund to a payment. Each provider
+// refund ID is counted once, however many times it is reported.
+func recordPaymentRefund(ctx context.Context, pay models.Payment, providerRefundID string, amount float64) error {
+	res, err := database.PaymentCollection.UpdateOne(ctx,
+		bson.M{"_id": pay.ID, "provider_refund_ids": bson.M{"$ne": providerRefundID}},
+		bson.M{
+			"$inc":  bson.M{"refunded_amount": amount},
+			"$push": bson.M{"provider_refund_ids": providerRefundID},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return nil
+	}
+
+	// Mark the payment, and its order, refunded once the full amount is back
+	res, err = database.PaymentCollection.UpdateOne(ctx,
+		bson.M{"_id": pay.ID, "$expr": bson.M{"$gte": bson.A{"$refunded_amount", "$amount"}}},
+		bson.M{"$set": bson.M{"status": models.PaymentStatusRefunded}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		_, err = orderCollection.UpdateOne(ctx, bson.M{"_id": pay.OrderID}, bson.M{"$set": bson.M{
+			"payment_status": "refunded",
+			"updated_at":     time.Now(),
+		}})
+	}
+	return err
+}
+
+// ======================= WEBHOOK =======================
+
+// POST /payments/webhook
+// Server-to-server notifications from the gateway. The request is
+// authenticated by its signature, not a user token, and each event ID is
+// processed once even if the provider delivers it again.
+func PaymentWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
+		return
+	}
+
+	event, err := paymentGateway.ParseWebhook(body, c.Request.Header)
+	if err != nil {
+		if errors.Is(err, payment.ErrInvalidSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	webhookEvents := database.GetCollection("payment_webhook_events")
+	record := models.PaymentWebhookEvent{
+		ID:         primitive.NewObjectID(),
+		Provider:   paymentGateway.Name(),
+		EventID:    event.ID,
+		Type:       event.Type,
+		ReceivedAt: time.Now(),
+	}
+	if _, err := webhookEvents.InsertOne(ctx, record); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusOK, gin.H{"message": "Event already processed"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record event"})
+		return
+	}
+
+	if err := handleWebhookEvent(ctx, event); err != nil {
+		// Forget the event so the provider's retry gets processed again
+		webhookEvents.DeleteOne(ctx, bson.M{"_id": record.ID})
+		log.Printf("⚠️ Failed to process %s webhook %s: %v", event.Type, event.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event processed"})
+}
+
+func handleWebhookEvent(ctx context.Context, event *payment.WebhookEvent) error {
+	var pay models.Payment
+	var filter bson.M
+
+	switch event.Type {
+	case payment.EventPaymentCaptured, payment.EventPaymentFailed:
+		filter = bson.M{"provider_order_id": event.ProviderOrderID}
+	case payment.EventPaymentRefunded:
+		filter = bson.M{"provider_payment_id": event.ProviderPaymentID}
+	default:
+		return nil // not an event we act on
+	}
+
+	err := database.PaymentCollection.FindOne(ctx, filter).Decode(&pay)
+	if err == mongo.ErrNoDocuments {
+		log.Printf("⚠️ Webhook %s refers to an unknown payment", event.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case payment.EventPaymentCaptured:
+		if models.RoundAmount(event.Amount) != models.RoundAmount(pay.Amount) {
+			return rejectCapturedAmount(ctx, pay, event.ProviderPaymentID, event.Amount)
+		}
+		err = completePayment(ctx, pay, event.ProviderPaymentID)
+		if errors.Is(err, errInvalidTransition) || errors.Is(err, errSubscriptionInvoiceNotOpen) {
+			return nil // logged by completePayment; retrying will not help
+		}
+		return err
+	case payment.EventPaymentFailed:
+		reason := event.Reason
+		if reason == "" {
+			reason = "Payment failed at gateway"
+		}
+		return failPayment(ctx, pay, reason)
+	default:
+		if err := recordPaymentRefund(ctx, pay, event.ProviderRefundID, event.Amount); err != nil {
+			return err
+		}
+		// A refund the gateway accepted as pending is done once it is reported
+		_, err = database.RefundCollection.UpdateOne(ctx,
+			bson.M{"provider_refund_id": event.ProviderRefundID, "status": models.RefundStatusInitiated},
+			bson.M{"$set": bson.M{"status": models.RefundStatusProcessed, "updated_at": time.Now()}},
+		)
+		return err
+	}
+}
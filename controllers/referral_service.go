@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/ashishnagargoje0/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The referral service: every farmer gets a code at signup; a farmer who
+// joins with it is rewarded together with the referrer once their first
+// paid order is delivered and past its return window. Until then the
+// referral is only qualified, and cancelling or returning the order drops it.
+
+// referralRewards is what the referrer and the referee each earn, in coins:
+// the admin's referral rules where set, otherwise REFERRAL_REFERRER_COINS
+// and REFERRAL_REFEREE_COINS or the defaults
+func referralRewards(ctx context.Context) (referrer, referee int) {
+	referrer, referee = models.DefaultReferrerCoins, models.DefaultRefereeCoins
+	if n, err := strconv.Atoi(os.Getenv("REFERRAL_REFERRER_COINS")); err == nil && n >= 0 {
+		referrer = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("REFERRAL_REFEREE_COINS")); err == nil && n >= 0 {
+		referee = n
+	}
+	if rule, ok, err := coinRule(ctx, models.CoinEventReferral); err == nil && ok {
+		referrer = 0
+		if rule.Active {
+			referrer = rule.CoinsFor(0)
+		}
+	}
+	if rule, ok, err := coinRule(ctx, models.CoinEventReferralJoined); err == nil && ok {
+		referee = 0
+		if rule.Active {
+			referee = rule.CoinsFor(0)
+		}
+	}
+	return referrer, referee
+}
+
+// referralCodeFor returns the farmer's referral code, creating it the first
+// time. Farmers who signed up before codes existed get theirs on first use.
+func referralCodeFor(ctx context.Context, userID primitive.ObjectID) (models.ReferralCode, error) {
+	referrals := config.DB.Collection("referrals")
+
+	var code models.ReferralCode
+	err := referrals.FindOne(ctx, bson.M{"user_id": userID}).Decode(&code)
+	if err != mongo.ErrNoDocuments {
+		return code, err
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		generated, err := utils.GenerateReferralCode()
+		if err != nil {
+			return code, err
+		}
+		code = models.ReferralCode{ID: primitive.NewObjectID(), UserID: userID, Code: generated, CreatedAt: time.Now()}
+		_, err = referrals.InsertOne(ctx, code)
+		if err == nil {
+			return code, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return code, err
+		}
+		// Either the code is taken or a parallel request created ours
+		if err := referrals.FindOne(ctx, bson.M{"user_id": userID}).Decode(&code); err == nil {
+			return code, nil
+		}
+	}
+	return code, errors.New("could not generate a unique referral code")
+}
+
+// hasPaidOrder reports whether the farmer has paid for any order other than
+// exceptOrder
+func hasPaidOrder(ctx context.Context, userID, exceptOrder primitive.ObjectID) (bool, error) {
+	n, err := database.PaymentCollection.CountDocuments(ctx, bson.M{
+		"user_id":  userID,
+		"order_id": bson.M{"$ne": exceptOrder},
+		"status":   bson.M{"$in": bson.A{models.PaymentStatusCaptured, models.PaymentStatusRefunded}},
+	})
+	return n > 0, err
+}
+
+// referralPhone returns the farmer's phone number as verified by OTP, in
+// its last ten digits so +91 and 0 prefixes name the same number. It is
+// empty when the farmer has no verified phone.
+func referralPhone(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return "", err
+	}
+	if !user.IsVerified {
+		return "", nil
+	}
+	digits := make([]rune, 0, len(user.Phone))
+	for _, r := range user.Phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) < 10 {
+		return "", nil
+	}
+	return string(digits[len(digits)-10:]), nil
+}
+
+// deviceFingerprint identifies the device a request comes from by what the
+// server sees of it, so the app cannot claim to be a new phone. The client
+// IP is only as good as the trusted proxies; referralPhone is the stronger
+// check.
+func deviceFingerprint(c *gin.Context) string {
+	sum := sha256.Sum256([]byte(c.ClientIP() + "|" + c.Request.UserAgent()))
+	return hex.EncodeToString(sum[:])
+}
+
+// qualifyReferral holds a pending referral against the referee's first paid
+// order. Only the first paid order counts; the coins wait for rewardReferral.
+func qualifyReferral(ctx context.Context, refereeID, orderID primitive.ObjectID) error {
+	uses := config.DB.Collection("referral_uses")
+
+	var use models.ReferralUse
+	err := uses.FindOne(ctx, bson.M{"user_id": refereeID, "status": models.ReferralPending}).Decode(&use)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	paidBefore, err := hasPaidOrder(ctx, refereeID, orderID)
+	if err != nil {
+		return err
+	}
+	if paidBefore {
+		_, err := uses.UpdateOne(ctx, bson.M{"_id": use.ID, "status": models.ReferralPending}, bson.M{"$set": bson.M{
+			"status":           models.ReferralRejected,
+			"rejection_reason": "Referee had already paid for an order",
+		}})
+		return err
+	}
+
+	_, err = uses.UpdateOne(ctx, bson.M{"_id": use.ID, "status": models.ReferralPending}, bson.M{"$set": bson.M{
+		"status":       models.ReferralQualified,
+		"order_id":     orderID,
+		"qualified_at": time.Now(),
+	}})
+	return err
+}
+
+// dropReferral rejects the referral held against an order that was
+// cancelled or returned, so no coins are paid for it
+func dropReferral(ctx context.Context, orderID primitive.ObjectID, reason string) error {
+	_, err := config.DB.Collection("referral_uses").UpdateOne(ctx,
+		bson.M{"order_id": orderID, "status": models.ReferralQualified},
+		bson.M{"$set": bson.M{"status": models.ReferralRejected, "rejection_reason": reason}},
+	)
+	return err
+}
+
+// rewardReferral pays both sides of a qualified referral. Each side's coins
+// are credited once, however often it is called.
+func rewardReferral(ctx context.Context, use models.ReferralUse) error {
+	uses := config.DB.Collection("referral_uses")
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		res, err := uses.UpdateOne(ctx, bson.M{"_id": use.ID, "status": models.ReferralQualified}, bson.M{"$set": bson.M{
+			"status":      models.ReferralRewarded,
+			"rewarded_at": time.Now(),
+		}})
+		if err != nil || res.ModifiedCount == 0 {
+			return err // rewarded by a parallel run
+		}
+
+		// The coins were fixed when the code was used; the rules still cap
+		// them and set their expiry
+		err = grantReferralCoins(ctx, use.ReferrerID, models.CoinEventReferral, use.ID, use.ReferrerCoins)
+		if err == nil || errors.Is(err, errLedgerEntryExists) {
+			err = grantReferralCoins(ctx, use.UserID, models.CoinEventReferralJoined, use.ID, use.RefereeCoins)
+		}
+		if errors.Is(err, errLedgerEntryExists) {
+			err = nil
+		}
+		if err != nil && !database.InTransaction(ctx) {
+			// Back to qualified; the next run credits whichever side is missing
+			if _, rerr := uses.UpdateOne(ctx, bson.M{"_id": use.ID}, bson.M{
+				"$set":   bson.M{"status": models.ReferralQualified},
+				"$unset": bson.M{"rewarded_at": ""},
+			}); rerr != nil {
+				log.Printf("⚠️ Referral %s marked rewarded but coins not credited: %v", use.ID.Hex(), rerr)
+			}
+		}
+		return err
+	})
+}
+
+// rewardDueReferrals rewards the qualified referrals whose order was
+// delivered, has no return open and is past its return window
+func rewardDueReferrals(ctx context.Context) error {
+	cursor, err := config.DB.Collection("referral_uses").Find(ctx, bson.M{"status": models.ReferralQualified})
+	if err != nil {
+		return err
+	}
+	var uses []models.ReferralUse
+	if err := cursor.All(ctx, &uses); err != nil {
+		return err
+	}
+
+	closedReturns := []string{models.ReturnStatusRejected, models.ReturnStatusQCFailed, models.ReturnStatusRefunded}
+	for _, use := range uses {
+		if use.OrderID == nil {
+			continue
+		}
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"_id": *use.OrderID}).Decode(&order); err != nil {
+			log.Printf("⚠️ Order %s of referral %s not found: %v", use.OrderID.Hex(), use.ID.Hex(), err)
+			continue
+		}
+		switch order.Status {
+		case models.OrderStatusCancelled, models.OrderStatusReturned:
+			if err := dropReferral(ctx, order.ID, "First order was "+order.Status); err != nil {
+				log.Printf("⚠️ Failed to drop referral %s: %v", use.ID.Hex(), err)
+			}
+			continue
+		case models.OrderStatusDelivered:
+		default:
+			continue
+		}
+		if order.DeliveredAt == nil || time.Since(*order.DeliveredAt) < returnWindow() {
+			continue
+		}
+		open, err := returnRequestCollection.CountDocuments(ctx, bson.M{"order_id": order.ID, "status": bson.M{"$nin": closedReturns}})
+		if err != nil || open > 0 {
+			continue
+		}
+		if err := rewardReferral(ctx, use); err != nil {
+			log.Printf("⚠️ Failed to reward referral %s: %v", use.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// RunReferralRewardJob rewards referrals that have come due every interval
+// until ctx is done
+func RunReferralRewardJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := rewardDueReferrals(runCtx); err != nil {
+			log.Printf("⚠️ Referral reward run failed: %v", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func grantReferralCoins(ctx context.Context, userID primitive.ObjectID, event string, useID primitive.ObjectID, coins int) error {
+	rule, _, err := coinRule(ctx, event)
+	if err != nil {
+		return err
+	}
+	_, err = grantCoins(ctx, userID, rule, useID.Hex(), coins)
+	return err
+}
+
+// onOrderPaid runs the side effects of a farmer's order being paid that
+// must not hold up the payment itself: coins for the order and the referral
+func onOrderPaid(ctx context.Context, userID, orderID primitive.ObjectID, amount float64) {
+	if _, err := earnCoins(ctx, userID, models.CoinEventOrderPaid, orderID.Hex(), amount); err != nil {
+		log.Printf("⚠️ Failed to give coins for order %s: %v", orderID.Hex(), err)
+	}
+	if err := qualifyReferral(ctx, userID, orderID); err != nil {
+		log.Printf("⚠️ Failed to qualify referral for order %s: %v", orderID.Hex(), err)
+	}
+}
@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The refund service: every rupee given back for an order is a models.Refund
+// issued here, whether it comes from a cancellation, an approved refund
+// request or a returned parcel. The total refunded never exceeds what the
+// order cost, nor what was actually collected for it. Each refund reserves
+// its amount in the order's refunded_total before anything is paid out.
+
+var (
+	errNothingToRefund        = errors.New("nothing left to refund on this order")
+	errRefundExceedsRemaining = errors.New("refund amount exceeds what is left to refund")
+	errRefundContended        = errors.New("refunds on this order changed while being issued")
+	errRefundFailed           = errors.New("refund failed at the payment gateway")
+)
+
+// collectedFor returns what the farmer actually paid for the order: the
+// captured payment, or the down payment and instalments of an EMI plan.
+// Orders paid neither way, e.g. covered by discounts, have nothing to give back.
+func collectedFor(ctx context.Context, order models.Order) (float64, error) {
+	if order.PaymentID != nil {
+		var pay models.Payment
+		if err := database.PaymentCollection.FindOne(ctx, bson.M{"_id": *order.PaymentID}).Decode(&pay); err != nil {
+			return 0, err
+		}
+		if pay.Status != models.PaymentStatusCaptured && pay.Status != models.PaymentStatusRefunded {
+			return 0, nil
+		}
+		return pay.Amount, nil
+	}
+
+	var plan models.EMIPlan
+	err := emiPlanCollection.FindOne(ctx, bson.M{
+		"order_id": order.ID,
+		"status":   bson.M{"$in": []string{models.EMIPlanActive, models.EMIPlanCompleted, models.EMIPlanCancelled}},
+	}).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return plan.Collected(), nil
+}
+
+// refundable returns the most the order can still be refunded and the
+// ceiling its refunded_total may reach
+func refundable(ctx context.Context, order models.Order) (remaining, limit float64, err error) {
+	collected, err := collectedFor(ctx, order)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit = models.RoundAmount(min(order.TotalAmount, collected))
+	return models.RoundAmount(limit - order.RefundedTotal), limit, nil
+}
+
+// reserveRefund counts amount (0 = everything left) against the order's
+// refunded_total and returns what was reserved. The limit is checked in the
+// same update that adds to the total, so parallel refunds cannot overpay.
+func reserveRefund(ctx context.Context, orderID primitive.ObjectID, amount float64) (float64, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+			return 0, err
+		}
+		remaining, limit, err := refundable(ctx, order)
+		if err != nil {
+			return 0, err
+		}
+		if remaining <= 0 {
+			return 0, errNothingToRefund
+		}
+		take := models.RoundAmount(amount)
+		if take <= 0 {
+			take = remaining
+		}
+		if take > remaining {
+			return 0, fmt.Errorf("%w: ₹%.2f left", errRefundExceedsRemaining, remaining)
+		}
+
+		res, err := orderCollection.UpdateOne(ctx,
+			bson.M{"_id": orderID, "refunded_total": bson.M{"$not": bson.M{"$gt": limit - take + 0.005}}},
+			bson.M{"$inc": bson.M{"refunded_total": take}},
+		)
+		if err != nil {
+			return 0, err
+		}
+		if res.ModifiedCount == 1 {
+			return take, nil
+		}
+		// Another refund on the order got there first
+	}
+	return 0, errRefundContended
+}
+
+// releaseRefund gives back a reservation whose refund was never recorded
+func releaseRefund(ctx context.Context, orderID primitive.ObjectID, amount float64) {
+	if _, err := orderCollection.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{"$inc": bson.M{"refunded_total": -amount}}); err != nil {
+		log.Printf("⚠️ Failed to release ₹%.2f of refunds reserved on order %s: %v", amount, orderID.Hex(), err)
+	}
+}
+
+// issueRefund pays refund.Amount (0 = everything still refundable) back for
+// the order by refund.Method. An amount above what is left is refused, not
+// cut down. Reason and any request links come from the caller; the rest of
+// the record is filled in here. A refund the gateway refuses keeps its
+// share of the order until it is retried.
+func issueRefund(ctx context.Context, order models.Order, refund models.Refund) (*models.Refund, error) {
+	amount, err := reserveRefund(ctx, order.ID, refund.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refund.ID = primitive.NewObjectID()
+	refund.OrderID = order.ID
+	refund.UserID = order.UserID
+	refund.Amount = amount
+	refund.Status = models.RefundStatusInitiated
+	refund.CreatedAt = now
+	refund.UpdatedAt = now
+
+	var issued *models.Refund
+	if refund.Method == models.RefundToWallet {
+		issued, err = refundToWallet(ctx, refund)
+	} else {
+		refund.Method = models.RefundToOriginal
+		issued, err = refundOrderPayment(ctx, order, refund)
+	}
+	if issued == nil && err != nil {
+		releaseRefund(ctx, order.ID, amount)
+	}
+	return issued, err
+}
+
+// refundToWallet credits the refund to the farmer's wallet, which cannot be
+// refused, so the refund is processed at once
+func refundToWallet(ctx context.Context, refund models.Refund) (*models.Refund, error) {
+	refund.Method = models.RefundToWallet
+	refund.Status = models.RefundStatusProcessed
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := insertRefund(ctx, refund); err != nil {
+			return err
+		}
+		_, err := creditWallet(ctx, refund.UserID, refund.Amount, models.WalletSourceRefund,
+			"refund:"+refund.ID.Hex(), fmt.Sprintf("Refund for order %s", refund.OrderID.Hex()))
+		if err != nil && !database.InTransaction(ctx) {
+			database.RefundCollection.DeleteOne(ctx, bson.M{"_id": refund.ID})
+			database.LedgerCollection.DeleteOne(ctx, bson.M{"kind": models.LedgerKindRefund, "reference": "refund:" + refund.ID.Hex()})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// refundOrderPayment gives the refund back to the original payment method
+// through the gateway. A refused refund is kept with status failed so it can
+// be retried; the returned error then wraps errRefundFailed. Orders with no
+// captured payment (e.g. cash on delivery) return errNothingToRefund and
+// must be refunded to the wallet.
+func refundOrderPayment(ctx context.Context, order models.Order, refund models.Refund) (*models.Refund, error) {
+	if order.PaymentID == nil {
+		return nil, errNothingToRefund
+	}
+	var pay models.Payment
+	if err := database.PaymentCollection.FindOne(ctx, bson.M{"_id": *order.PaymentID}).Decode(&pay); err != nil {
+		return nil, err
+	}
+	remaining := models.RoundAmount(pay.Amount - pay.RefundedAmount)
+	if pay.Status != models.PaymentStatusCaptured || remaining <= 0 {
+		return nil, errNothingToRefund
+	}
+	if refund.Amount > remaining {
+		return nil, fmt.Errorf("%w: ₹%.2f left on the payment", errRefundExceedsRemaining, remaining)
+	}
+
+	refund.PaymentID = &pay.ID
+	refund.Provider = pay.Provider
+
+	// Orders paid from the wallet are refunded to it
+	if pay.Provider == models.WalletProvider {
+		paid, err := refundToWallet(ctx, refund)
+		if err != nil {
+			return nil, err
+		}
+		if err := recordPaymentRefund(ctx, pay, "wallet:"+paid.ID.Hex(), paid.Amount); err != nil {
+			log.Printf("⚠️ Failed to record refund %s on payment %s: %v", paid.ID.Hex(), pay.ID.Hex(), err)
+		}
+		return paid, nil
+	}
+
+	if err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		return insertRefund(ctx, refund)
+	}); err != nil {
+		return nil, err
+	}
+	return sendGatewayRefund(ctx, pay, refund)
+}
+
+// refundLatePayment gives back in full a payment captured when its order
+// could no longer take it: cancelled meanwhile (e.g. by the pending-order
+// expiry while the farmer was still at the checkout), or already paid by
+// another attempt. Only the payment the order was paid with is kept.
+func refundLatePayment(ctx context.Context, pay models.Payment) (*models.Refund, error) {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"_id": pay.OrderID}).Decode(&order); err != nil {
+		return nil, err
+	}
+	if order.PaymentID != nil && *order.PaymentID == pay.ID {
+		return nil, fmt.Errorf("%w: payment paid for the order", errNothingToRefund)
+	}
+	reason := "Payment received after the order was cancelled"
+	if order.Status != models.OrderStatusCancelled {
+		reason = "Order was already paid"
+	}
+	return refundUnappliedPayment(ctx, pay, pay.Amount, reason)
+}
+
+// refundUnappliedPayment gives back amount of a captured payment that never
+// paid for its order. The refund is not counted against what the order cost.
+func refundUnappliedPayment(ctx context.Context, pay models.Payment, amount float64, reason string) (*models.Refund, error) {
+	now := time.Now()
+	refund := models.Refund{
+		ID:        primitive.NewObjectID(),
+		OrderID:   pay.OrderID,
+		UserID:    pay.UserID,
+		PaymentID: &pay.ID,
+		Reason:    reason,
+		Amount:    amount,
+		Method:    models.RefundToOriginal,
+		Provider:  pay.Provider,
+		Unapplied: true,
+		Status:    models.RefundStatusInitiated,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		return insertRefund(ctx, refund)
+	}); err != nil {
+		return nil, err
+	}
+	return sendGatewayRefund(ctx, pay, refund)
+}
+
+// insertRefund stores a new refund and posts what it owes the farmer to
+// refunds payable, which the payout then clears
+func insertRefund(ctx context.Context, refund models.Refund) error {
+	if _, err := database.RefundCollection.InsertOne(ctx, refund); err != nil {
+		return err
+	}
+	err := postLedger(ctx, models.NewLedgerEntry(models.LedgerKindRefund, "refund:"+refund.ID.Hex(), models.LedgerCurrencyINR,
+		refund.Amount,
+		models.PlatformAccount(models.AccountPlatformRevenue),
+		models.PlatformAccount(models.AccountRefundsPayable),
+		refundDescription(refund),
+	))
+	if err != nil && !database.InTransaction(ctx) {
+		database.RefundCollection.DeleteOne(ctx, bson.M{"_id": refund.ID})
+	}
+	return err
+}
+
+// sendGatewayRefund asks the gateway to pay an initiated or failed refund
+func sendGatewayRefund(ctx context.Context, pay models.Payment, refund models.Refund) (*models.Refund, error) {
+	result, err := paymentGateway.Refund(ctx, pay.ProviderPaymentID, refund.Amount)
+	if err != nil {
+		log.Printf("⚠️ Gateway refused refund %s for order %s: %v", refund.ID.Hex(), refund.OrderID.Hex(), err)
+		refund.Status = models.RefundStatusFailed
+		refund.FailureReason = err.Error()
+		if _, uerr := database.RefundCollection.UpdateOne(ctx, bson.M{"_id": refund.ID}, bson.M{"$set": bson.M{
+			"status":         refund.Status,
+			"failure_reason": refund.FailureReason,
+			"updated_at":     time.Now(),
+		}}); uerr != nil {
+			log.Printf("⚠️ Failed to mark refund %s failed: %v", refund.ID.Hex(), uerr)
+		}
+		return &refund, fmt.Errorf("%w: %v", errRefundFailed, err)
+	}
+
+	// Gateways may accept a refund as pending; the webhook settles it later
+	refund.ProviderRefundID = result.ProviderRefundID
+	refund.FailureReason = ""
+	refund.Status = models.RefundStatusInitiated
+	if result.Status == models.RefundStatusProcessed {
+		refund.Status = models.RefundStatusProcessed
+	}
+	if _, err := database.RefundCollection.UpdateOne(ctx, bson.M{"_id": refund.ID}, bson.M{
+		"$set": bson.M{
+			"status":             refund.Status,
+			"provider_refund_id": refund.ProviderRefundID,
+			"updated_at":         time.Now(),
+		},
+		"$unset": bson.M{"failure_reason": ""},
+	}); err != nil {
+		log.Printf("⚠️ Failed to record gateway refund %s on refund %s: %v", result.ProviderRefundID, refund.ID.Hex(), err)
+	}
+	if err := recordPaymentRefund(ctx, pay, result.ProviderRefundID, result.Amount); err != nil {
+		log.Printf("⚠️ Failed to record refund %s on payment %s: %v", result.ProviderRefundID, pay.ID.Hex(), err)
+	}
+	err = postLedger(ctx, models.NewLedgerEntry(models.LedgerKindRefundPaid, "refund:"+refund.ID.Hex(), models.LedgerCurrencyINR,
+		result.Amount,
+		models.PlatformAccount(models.AccountRefundsPayable),
+		models.PlatformAccount(models.AccountPaymentGateway),
+		"Refund "+result.ProviderRefundID,
+	))
+	if err != nil && !errors.Is(err, errLedgerEntryExists) {
+		log.Printf("⚠️ Failed to post refund %s to the ledger: %v", refund.ID.Hex(), err)
+	}
+	return &refund, nil
+}
+
+// retryRefund sends a failed gateway refund again. The refund is claimed
+// first so two admins cannot pay it twice.
+func retryRefund(ctx context.Context, refundID primitive.ObjectID) (*models.Refund, error) {
+	var refund models.Refund
+	err := database.RefundCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": refundID, "status": models.RefundStatusFailed, "method": models.RefundToOriginal},
+		bson.M{"$set": bson.M{"status": models.RefundStatusInitiated, "updated_at": time.Now()}},
+	).Decode(&refund)
+	if err != nil {
+		return nil, errNothingToRefund
+	}
+
+	var pay models.Payment
+	if err := database.PaymentCollection.FindOne(ctx, bson.M{"_id": refund.PaymentID}).Decode(&pay); err != nil {
+		return nil, err
+	}
+	return sendGatewayRefund(ctx, pay, refund)
+}
+
+// respondRefundError maps issueRefund errors to HTTP responses. A refund
+// refused by the gateway is included so the admin can retry it.
+func respondRefundError(c *gin.Context, err error, refund *models.Refund) {
+	switch {
+	case errors.Is(err, errNothingToRefund), errors.Is(err, errRefundContended):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errRefundExceedsRemaining):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errRefundFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "refund": refund})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue refund"})
+	}
+}
+
+// refundDescription names what a refund gives back money for in the ledger
+func refundDescription(refund models.Refund) string {
+	if refund.OrderID.IsZero() && refund.PaymentID != nil {
+		return fmt.Sprintf("Refund of payment %s", refund.PaymentID.Hex())
+	}
+	return fmt.Sprintf("Refund for order %s", refund.OrderID.Hex())
+}
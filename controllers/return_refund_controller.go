@@ -1,14 +1,23 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
 	"github.com/ashishnagargoje0/backend/models"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Declare collections as uninitialized
@@ -21,53 +30,293 @@ func InitReturnRefundCollections() {
 	refundRequestCollection = config.DB.Collection("refund_requests")
 }
 
+var (
+	errRMANotFound      = errors.New("request not found")
+	errInvalidRMAStatus = errors.New("invalid request status transition")
+)
+
+// returnWindow is how long after delivery a farmer may ask for a return,
+// configurable in days with RETURN_WINDOW_DAYS
+func returnWindow() time.Duration {
+	if days, err := strconv.Atoi(os.Getenv("RETURN_WINDOW_DAYS")); err == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return models.DefaultReturnWindow
+}
+
+// refundMethodFor picks where a refund goes. Orders that were never paid
+// online (e.g. cash on delivery) can only be refunded to the wallet.
+func refundMethodFor(order models.Order, requested string) string {
+	if requested == models.RefundToWallet || order.PaymentID == nil {
+		return models.RefundToWallet
+	}
+	return models.RefundToOriginal
+}
+
+// transitionRMA moves a return or refund request from one of `from` to `to`
+// and appends it to the request's history. Like transitionOrder, the update
+// only matches the expected statuses, so concurrent admins cannot both act.
+func transitionRMA(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, from []string, to, note, changedBy string, extra bson.M, out interface{}) error {
+	now := time.Now()
+	set := bson.M{"status": to, "updated_at": now}
+	for k, v := range extra {
+		set[k] = v
+	}
+	event := models.RMAEvent{Status: to, Note: note, ChangedBy: changedBy, ChangedAt: now}
+
+	err := coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": from}},
+		bson.M{"$set": set, "$push": bson.M{"history": event}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(out)
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	var current struct {
+		Status string `bson:"status"`
+	}
+	if err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&current); err != nil {
+		return errRMANotFound
+	}
+	return fmt.Errorf("%w: %s → %s", errInvalidRMAStatus, current.Status, to)
+}
+
+// respondRMAError maps transitionRMA errors to HTTP responses
+func respondRMAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errRMANotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+	case errors.Is(err, errInvalidRMAStatus):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update request"})
+	}
+}
+
+// payRefundRequest issues the money for an approved refund request and
+// closes it, along with the return that raised it. A refund the gateway
+// refuses stays linked to the request and can be retried; when no refund
+// could be recorded at all, the request goes back to pending to be
+// approved again.
+func payRefundRequest(ctx context.Context, req models.RefundRequest, changedBy string) (*models.Refund, error) {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"_id": req.OrderID}).Decode(&order); err != nil {
+		return nil, errOrderNotFound
+	}
+
+	refund, err := issueRefund(ctx, order, models.Refund{
+		RefundRequestID: &req.ID,
+		ReturnRequestID: req.ReturnRequestID,
+		Reason:          req.Reason,
+		Amount:          req.Amount,
+		Method:          req.Method,
+	})
+	if refund == nil {
+		var reopened models.RefundRequest
+		rerr := transitionRMA(ctx, refundRequestCollection, req.ID, []string{models.RefundRequestApproved}, models.RefundRequestPending,
+			"Refund not issued: "+err.Error(), changedBy, nil, &reopened)
+		if rerr != nil {
+			log.Printf("⚠️ Refund request %s left approved without a refund: %v", req.ID.Hex(), rerr)
+		}
+		return nil, err
+	}
+	if _, uerr := refundRequestCollection.UpdateOne(ctx, bson.M{"_id": req.ID}, bson.M{"$set": bson.M{"refund_id": refund.ID}}); uerr != nil {
+		log.Printf("⚠️ Refund %s not linked to refund request %s: %v", refund.ID.Hex(), req.ID.Hex(), uerr)
+	}
+	if err != nil {
+		return refund, err
+	}
+	return refund, closeRefundRequest(ctx, req, *refund, changedBy)
+}
+
+// closeRefundRequest marks a request refunded once its money went out, and
+// the return behind it too. A return of the whole order returns the order.
+func closeRefundRequest(ctx context.Context, req models.RefundRequest, refund models.Refund, changedBy string) error {
+	note := fmt.Sprintf("₹%.2f refunded to %s", refund.Amount, refund.Method)
+	var closed models.RefundRequest
+	err := transitionRMA(ctx, refundRequestCollection, req.ID, []string{models.RefundRequestApproved}, models.RefundRequestRefunded,
+		note, changedBy, bson.M{"refund_id": refund.ID, "amount": refund.Amount}, &closed)
+	if err != nil || req.ReturnRequestID == nil {
+		return err
+	}
+
+	var ret models.ReturnRequest
+	err = transitionRMA(ctx, returnRequestCollection, *req.ReturnRequestID, []string{models.ReturnStatusQCPassed}, models.ReturnStatusRefunded,
+		note, changedBy, bson.M{"refund_id": refund.ID}, &ret)
+	if err != nil {
+		return err
+	}
+	if len(ret.Items) == 0 {
+		err := transitionOrder(ctx, ret.OrderID, models.OrderStatusReturned, "Returned and refunded", changedBy, nil)
+		if err != nil && !errors.Is(err, errInvalidTransition) {
+			return err
+		}
+		if err := revokeEarnedCoins(ctx, ret.UserID, models.CoinEventOrderPaid, ret.OrderID.Hex()); err != nil {
+			log.Printf("⚠️ Failed to take back coins earned by order %s: %v", ret.OrderID.Hex(), err)
+		}
+		if err := dropReferral(ctx, ret.OrderID, "First order was returned"); err != nil {
+			log.Printf("⚠️ Failed to drop referral of order %s: %v", ret.OrderID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// ======================= RETURNS =======================
+
 // POST /order/return
+// A delivered order, or some of its items, can be returned within the
+// return window. The request waits for admin approval.
 func SubmitReturnRequest(c *gin.Context) {
 	var input models.ReturnRequestInput
-
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	if input.OrderID == "" || input.Reason == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID and reason are required"})
+	orderID, err := primitive.ObjectIDFromHex(input.OrderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Order ID format"})
 		return
 	}
 
-	orderID, err := primitive.ObjectIDFromHex(input.OrderID)
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := findUserOrder(ctx, orderID, userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Order ID format"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != models.OrderStatusDelivered {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only delivered orders can be returned"})
+		return
+	}
+	window := returnWindow()
+	if !models.ReturnWindowOpen(order.DeliveredAt, window, time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Returns are accepted within %d days of delivery", int(window.Hours()/24))})
 		return
 	}
 
+	ordered := map[primitive.ObjectID]int{}
+	for _, line := range order.Items {
+		ordered[line.ProductID] += line.Quantity
+	}
+	var items []models.ReturnItem
+	for _, in := range input.Items {
+		productID, err := primitive.ObjectIDFromHex(in.ProductID)
+		if err != nil || in.Quantity > ordered[productID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Returned items must be part of the order", "product_id": in.ProductID})
+			return
+		}
+		items = append(items, models.ReturnItem{ProductID: productID, Quantity: in.Quantity})
+	}
+
+	open, err := returnRequestCollection.CountDocuments(ctx, bson.M{
+		"order_id": orderID,
+		"status":   bson.M{"$nin": models.ClosedReturnStatuses()},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit return request"})
+		return
+	}
+	if open > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A return is already in progress for this order"})
+		return
+	}
+
+	now := time.Now()
 	returnReq := models.ReturnRequest{
-		ID:        primitive.NewObjectID(),
-		OrderID:   orderID,
-		Reason:    input.Reason,
-		CreatedAt: time.Now().Unix(),
-		Status:    "pending",
+		ID:           primitive.NewObjectID(),
+		OrderID:      orderID,
+		UserID:       userID,
+		Items:        items,
+		Reason:       input.Reason,
+		ReturnType:   input.ReturnType,
+		RefundMethod: refundMethodFor(order, input.RefundMethod),
+		RefundAmount: models.ReturnAmount(order, items),
+		Status:       models.ReturnStatusPending,
+		History:      []models.RMAEvent{{Status: models.ReturnStatusPending, Note: input.Reason, ChangedBy: c.GetString("email"), ChangedAt: now}},
+		CreatedAt:    now,
 	}
 
-	_, err = returnRequestCollection.InsertOne(c, returnReq)
+	_, err = returnRequestCollection.InsertOne(ctx, returnReq)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit return request"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Return request submitted", "returnRequestId": returnReq.ID.Hex()})
+	c.JSON(http.StatusOK, gin.H{"message": "Return request submitted", "returnRequestId": returnReq.ID.Hex(), "return": returnReq})
+}
+
+// GET /order/returns
+func GetMyReturnRequests(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := returnRequestCollection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+	returns := []models.ReturnRequest{}
+	if err := cursor.All(ctx, &returns); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode returns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"returns": returns})
 }
 
+// GET /order/returns/:id
+// Status, pickup, quality check and refund of one of the farmer's returns.
+func GetMyReturnRequest(c *gin.Context) {
+	returnID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var ret models.ReturnRequest
+	if err := returnRequestCollection.FindOne(ctx, bson.M{"_id": returnID, "user_id": userID}).Decode(&ret); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Return not found"})
+		return
+	}
+
+	response := gin.H{"return": ret}
+	if ret.RefundID != nil {
+		var refund models.Refund
+		if err := database.RefundCollection.FindOne(ctx, bson.M{"_id": *ret.RefundID}).Decode(&refund); err == nil {
+			response["refund"] = refund
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ======================= REFUND REQUESTS =======================
+
 // POST /refund/request
+// Money back without a return, e.g. for an item missing from the parcel.
 func SubmitRefundRequest(c *gin.Context) {
 	var input models.RefundRequestInput
-
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	if input.OrderID == "" || input.Amount <= 0 || input.Reason == "" {
+	if input.Amount <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID, amount, and reason are required"})
 		return
 	}
@@ -78,16 +327,50 @@ func SubmitRefundRequest(c *gin.Context) {
 		return
 	}
 
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := findUserOrder(ctx, orderID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	switch order.Status {
+	case models.OrderStatusPending:
+		c.JSON(http.StatusConflict, gin.H{"error": "Order has not been paid"})
+		return
+	case models.OrderStatusCancelled:
+		c.JSON(http.StatusConflict, gin.H{"error": "Cancelled orders are refunded automatically"})
+		return
+	}
+
+	remaining, _, err := refundable(ctx, order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit refund request"})
+		return
+	}
+	if input.Amount > remaining {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount exceeds what was paid and not yet refunded", "refundable": remaining})
+		return
+	}
+
+	now := time.Now()
 	refundReq := models.RefundRequest{
 		ID:        primitive.NewObjectID(),
 		OrderID:   orderID,
+		UserID:    userID,
 		Amount:    input.Amount,
 		Reason:    input.Reason,
-		CreatedAt: time.Now().Unix(),
-		Status:    "pending",
+		Method:    refundMethodFor(order, input.Method),
+		Status:    models.RefundRequestPending,
+		History:   []models.RMAEvent{{Status: models.RefundRequestPending, Note: input.Reason, ChangedBy: c.GetString("email"), ChangedAt: now}},
+		CreatedAt: now,
 	}
 
-	_, err = refundRequestCollection.InsertOne(c, refundReq)
+	_, err = refundRequestCollection.InsertOne(ctx, refundReq)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit refund request"})
 		return
@@ -95,3 +378,354 @@ func SubmitRefundRequest(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Refund request submitted", "refundRequestId": refundReq.ID.Hex()})
 }
+
+// GET /refund/requests
+func GetMyRefundRequests(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := refundRequestCollection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refund requests"})
+		return
+	}
+	requests := []models.RefundRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode refund requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refund_requests": requests})
+}
+
+// GET /refund/requests/:id
+func GetMyRefundRequest(c *gin.Context) {
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund request ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var req models.RefundRequest
+	if err := refundRequestCollection.FindOne(ctx, bson.M{"_id": requestID, "user_id": userID}).Decode(&req); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund request not found"})
+		return
+	}
+
+	response := gin.H{"refund_request": req}
+	if req.RefundID != nil {
+		var refund models.Refund
+		if err := database.RefundCollection.FindOne(ctx, bson.M{"_id": *req.RefundID}).Decode(&refund); err == nil {
+			response["refund"] = refund
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ======================= ADMIN =======================
+
+// statusFilter builds a list filter from the optional ?status= query
+func statusFilter(c *gin.Context) bson.M {
+	if status := c.Query("status"); status != "" {
+		return bson.M{"status": status}
+	}
+	return bson.M{}
+}
+
+// GET /admin/returns?status=pending
+// The approval queue, oldest first.
+func AdminListReturnRequests(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := returnRequestCollection.Find(ctx, statusFilter(c), options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+	returns := []models.ReturnRequest{}
+	if err := cursor.All(ctx, &returns); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode returns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"returns": returns})
+}
+
+// adminReturnAction runs one admin step of the return lifecycle and answers
+// with the updated return
+func adminReturnAction(c *gin.Context, to, note string, extra bson.M) (models.ReturnRequest, bool) {
+	var ret models.ReturnRequest
+	returnID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return ID"})
+		return ret, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = transitionRMA(ctx, returnRequestCollection, returnID, models.ReturnStatusesBefore(to), to, note, c.GetString("email"), extra, &ret)
+	if err != nil {
+		respondRMAError(c, err)
+		return ret, false
+	}
+	return ret, true
+}
+
+// POST /admin/returns/:id/approve
+func AdminApproveReturn(c *gin.Context) {
+	if ret, ok := adminReturnAction(c, models.ReturnStatusApproved, "Return approved", nil); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Return approved", "return": ret})
+	}
+}
+
+// POST /admin/returns/:id/reject
+func AdminRejectReturn(c *gin.Context) {
+	var input models.RMARejectInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rejection reason is required"})
+		return
+	}
+	if ret, ok := adminReturnAction(c, models.ReturnStatusRejected, input.Reason, bson.M{"rejection_reason": input.Reason}); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Return rejected", "return": ret})
+	}
+}
+
+// POST /admin/returns/:id/pickup
+// Books, or re-books, collection of the goods from the farm.
+func AdminScheduleReturnPickup(c *gin.Context) {
+	var input models.SchedulePickupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ScheduledFor.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pickup must be scheduled in the future"})
+		return
+	}
+
+	pickup := models.ReturnPickup{ScheduledFor: input.ScheduledFor, Address: input.Address, Notes: input.Notes}
+	note := "Pickup scheduled for " + input.ScheduledFor.Format("02 Jan 2006 15:04")
+	if ret, ok := adminReturnAction(c, models.ReturnStatusPickupScheduled, note, bson.M{"pickup": pickup}); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Pickup scheduled", "return": ret})
+	}
+}
+
+// POST /admin/returns/:id/picked-up
+func AdminMarkReturnPickedUp(c *gin.Context) {
+	if ret, ok := adminReturnAction(c, models.ReturnStatusPickedUp, "Goods collected", bson.M{"pickup.picked_up_at": time.Now()}); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Return picked up", "return": ret})
+	}
+}
+
+// POST /admin/returns/:id/quality-check
+// Goods that pass go back into stock and are refunded straight away, to the
+// method the farmer chose, through a refund request linked to the return.
+func AdminReturnQualityCheck(c *gin.Context) {
+	var input models.QualityCheckInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quality check result is required"})
+		return
+	}
+
+	admin := c.GetString("email")
+	check := models.QualityCheck{Passed: *input.Passed, Notes: input.Notes, CheckedBy: admin, CheckedAt: time.Now()}
+	to := models.ReturnStatusQCFailed
+	if check.Passed {
+		to = models.ReturnStatusQCPassed
+	}
+	ret, ok := adminReturnAction(c, to, input.Notes, bson.M{"quality_check": check})
+	if !ok {
+		return
+	}
+	if !check.Passed {
+		c.JSON(http.StatusOK, gin.H{"message": "Return failed quality check", "return": ret})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if err := restockReturn(ctx, ret.OrderID, ret.Items); err != nil {
+		log.Printf("⚠️ Failed to restock return %s: %v", ret.ID.Hex(), err)
+	}
+
+	now := time.Now()
+	req := models.RefundRequest{
+		ID:              primitive.NewObjectID(),
+		OrderID:         ret.OrderID,
+		UserID:          ret.UserID,
+		ReturnRequestID: &ret.ID,
+		Amount:          ret.RefundAmount,
+		Reason:          "Return: " + ret.Reason,
+		Method:          ret.RefundMethod,
+		Status:          models.RefundRequestApproved,
+		History:         []models.RMAEvent{{Status: models.RefundRequestApproved, Note: "Return passed quality check", ChangedBy: admin, ChangedAt: now}},
+		CreatedAt:       now,
+	}
+	if _, err := refundRequestCollection.InsertOne(ctx, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Quality check saved but refund request not created"})
+		return
+	}
+	if _, err := returnRequestCollection.UpdateOne(ctx, bson.M{"_id": ret.ID}, bson.M{"$set": bson.M{"refund_request_id": req.ID}}); err != nil {
+		log.Printf("⚠️ Refund request %s not linked to return %s: %v", req.ID.Hex(), ret.ID.Hex(), err)
+	}
+
+	refund, err := payRefundRequest(ctx, req, admin)
+	if err != nil {
+		respondRefundError(c, err, refund)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Return accepted and refunded", "refund": refund})
+}
+
+// GET /admin/refund-requests?status=pending
+func AdminListRefundRequests(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := refundRequestCollection.Find(ctx, statusFilter(c), options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refund requests"})
+		return
+	}
+	requests := []models.RefundRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode refund requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refund_requests": requests})
+}
+
+// POST /admin/refund-requests/:id/approve
+// Approves a farmer's refund request, optionally for a different amount or
+// method, and pays it.
+func AdminApproveRefundRequest(c *gin.Context) {
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund request ID"})
+		return
+	}
+	var input models.ApproveRefundInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	extra := bson.M{}
+	if input.Amount > 0 {
+		extra["amount"] = input.Amount
+	}
+	if input.Method != "" {
+		extra["method"] = input.Method
+	}
+
+	admin := c.GetString("email")
+	var req models.RefundRequest
+	err = transitionRMA(ctx, refundRequestCollection, requestID, []string{models.RefundRequestPending}, models.RefundRequestApproved,
+		"Refund approved", admin, extra, &req)
+	if err != nil {
+		respondRMAError(c, err)
+		return
+	}
+
+	refund, err := payRefundRequest(ctx, req, admin)
+	if err != nil {
+		respondRefundError(c, err, refund)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Refund approved and issued", "refund": refund})
+}
+
+// POST /admin/refund-requests/:id/reject
+func AdminRejectRefundRequest(c *gin.Context) {
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund request ID"})
+		return
+	}
+	var input models.RMARejectInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rejection reason is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var req models.RefundRequest
+	err = transitionRMA(ctx, refundRequestCollection, requestID, []string{models.RefundRequestPending}, models.RefundRequestRejected,
+		input.Reason, c.GetString("email"), bson.M{"rejection_reason": input.Reason}, &req)
+	if err != nil {
+		respondRMAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Refund request rejected", "refund_request": req})
+}
+
+// GET /admin/refunds?status=failed
+func AdminListRefunds(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.RefundCollection.Find(ctx, statusFilter(c), options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+	refunds := []models.Refund{}
+	if err := cursor.All(ctx, &refunds); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refunds": refunds})
+}
+
+// POST /admin/refunds/:id/retry
+// Sends a refund the gateway refused once more; on success the refund
+// request and return behind it are closed.
+func AdminRetryRefund(c *gin.Context) {
+	refundID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	refund, err := retryRefund(ctx, refundID)
+	if err != nil {
+		respondRefundError(c, err, refund)
+		return
+	}
+
+	if refund.RefundRequestID != nil {
+		var req models.RefundRequest
+		err := refundRequestCollection.FindOne(ctx, bson.M{"_id": *refund.RefundRequestID}).Decode(&req)
+		if err == nil {
+			err = closeRefundRequest(ctx, req, *refund, c.GetString("email"))
+		}
+		if err != nil {
+			log.Printf("⚠️ Refund %s paid but request %s not closed: %v", refund.ID.Hex(), refund.RefundRequestID.Hex(), err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Refund sent", "refund": refund})
+}
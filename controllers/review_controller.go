@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"time"
 
@@ -52,7 +54,36 @@ func SubmitReview(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Review submitted successfully"})
+	// Only a farmer who received the product is rewarded, once per product
+	// however many times it is reviewed
+	coins := 0
+	bought, err := receivedProduct(c, userID, input.ProductID)
+	if err != nil {
+		log.Printf("⚠️ Purchase behind review by user %s not checked: %v", userID.Hex(), err)
+	}
+	if bought {
+		coins, err = earnCoins(c, userID, models.CoinEventReviewSubmitted, input.ProductID, 0)
+		if err != nil {
+			log.Printf("⚠️ Failed to give coins for review by user %s: %v", userID.Hex(), err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review submitted successfully", "coins_earned": coins})
+}
+
+// receivedProduct reports whether the farmer has a delivered order with
+// the product in it
+func receivedProduct(ctx context.Context, userID primitive.ObjectID, productID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return false, nil
+	}
+	n, err := orderCollection.CountDocuments(ctx, bson.M{
+		"user_id":          userID,
+		"status":           models.OrderStatusDelivered,
+		"items.product_id": id,
+	})
+	return n > 0, err
 }
 
 func GetProductReviews(c *gin.Context) {
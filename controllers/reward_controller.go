@@ -0,0 +1,493 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/ashishnagargoje0/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errRewardOutOfStock = errors.New("reward is out of stock")
+
+// issueVoucher fulfils a digital redemption with a fresh voucher code
+func issueVoucher(ctx context.Context, redemption models.RewardRedemption) (models.RewardRedemption, error) {
+	var issued models.RewardRedemption
+	for attempt := 0; attempt < 3; attempt++ {
+		code, err := utils.GenerateVoucherCode()
+		if err != nil {
+			return redemption, err
+		}
+		err = transitionRMA(ctx, config.DB.Collection("reward_redemptions"), redemption.ID,
+			models.RedemptionStatusesBefore(models.RedemptionVoucherIssued), models.RedemptionVoucherIssued,
+			"Voucher issued", "", bson.M{"voucher_code": code}, &issued)
+		if !mongo.IsDuplicateKeyError(err) {
+			return issued, err
+		}
+	}
+	return redemption, errors.New("could not generate a unique voucher code")
+}
+
+// failRedemption closes a redemption that cannot be fulfilled, puts its unit
+// back in stock and gives the farmer their coins back. Calling it again on a
+// failed redemption whose coins never went back retries the refund.
+func failRedemption(ctx context.Context, redemptionID primitive.ObjectID, reason, changedBy string) (models.RewardRedemption, error) {
+	var redemption models.RewardRedemption
+	coll := config.DB.Collection("reward_redemptions")
+	err := transitionRMA(ctx, coll, redemptionID,
+		models.RedemptionStatusesBefore(models.RedemptionFailed), models.RedemptionFailed,
+		reason, changedBy, bson.M{"failure_reason": reason}, &redemption)
+	if errors.Is(err, errInvalidRMAStatus) {
+		if ferr := coll.FindOne(ctx, bson.M{"_id": redemptionID}).Decode(&redemption); ferr != nil ||
+			redemption.Status != models.RedemptionFailed || redemption.CoinsRefunded {
+			return redemption, err
+		}
+		return redemption, refundRedemption(ctx, &redemption)
+	}
+	if err != nil {
+		return redemption, err
+	}
+
+	if redemption.StockReserved {
+		if _, err := config.DB.Collection("rewards").UpdateOne(ctx, bson.M{"_id": redemption.RewardID, "stock": bson.M{"$exists": true}},
+			bson.M{"$inc": bson.M{"stock": 1}}); err != nil {
+			log.Printf("⚠️ Failed to restock reward %s: %v", redemption.RewardID.Hex(), err)
+		}
+	}
+
+	return redemption, refundRedemption(ctx, &redemption)
+}
+
+// refundRedemption gives back the coins spent on a failed redemption
+func refundRedemption(ctx context.Context, redemption *models.RewardRedemption) error {
+	// Same reference as the redemption, so the coins go back only once
+	err := returnCoins(ctx, redemption.UserID, redemption.Cost, "reward:"+redemption.ID.Hex(), "Reward not fulfilled: "+redemption.RewardName)
+	if err != nil && !errors.Is(err, errLedgerEntryExists) {
+		return fmt.Errorf("coins not refunded: %w", err)
+	}
+	redemption.CoinsRefunded = true
+	if _, err := config.DB.Collection("reward_redemptions").UpdateOne(ctx, bson.M{"_id": redemption.ID},
+		bson.M{"$set": bson.M{"coins_refunded": true}}); err != nil {
+		log.Printf("⚠️ Failed to mark coins refunded on redemption %s: %v", redemption.ID.Hex(), err)
+	}
+	return nil
+}
+
+// ====== GET /rewards/catalog ======
+func GetRewardsCatalog(c *gin.Context) {
+	rewardsCollection := config.DB.Collection("rewards")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := rewardsCollection.Find(ctx, bson.M{"active": true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rewards"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	rewards := []models.Reward{}
+	if err := cursor.All(ctx, &rewards); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode rewards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rewards)
+}
+
+// ====== POST /rewards/redeem ======
+// Takes a unit of stock and the coins together. Digital rewards get their
+// voucher at once; physical ones wait for an admin to dispatch them.
+func RedeemReward(c *gin.Context) {
+	var input models.RewardRedeemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redeem request"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	rewardsCollection := config.DB.Collection("rewards")
+	redemptionsCollection := config.DB.Collection("reward_redemptions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Find reward by ID
+	var reward models.Reward
+	err := rewardsCollection.FindOne(ctx, bson.M{"_id": input.RewardID, "active": true}).Decode(&reward)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reward not found"})
+		return
+	}
+	if !reward.InStock() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Reward is out of stock"})
+		return
+	}
+	if !reward.IsDigital() && input.Address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Address is required for this reward"})
+		return
+	}
+
+	now := time.Now()
+	redemption := models.RewardRedemption{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		RewardID:   reward.ID,
+		RewardName: reward.Name,
+		RewardType: models.RewardPhysical,
+		Cost:       reward.Cost,
+		Status:     models.RedemptionRequested,
+		Address:    input.Address,
+		History:    []models.RMAEvent{{Status: models.RedemptionRequested, ChangedAt: now}},
+		RedeemedAt: now,
+		UpdatedAt:  now,
+	}
+	if reward.IsDigital() {
+		redemption.RewardType = models.RewardDigital
+		redemption.Address = ""
+	}
+
+	// Take the stock, spend the coins and record the redemption together, so
+	// a farmer can neither overspend in parallel requests nor lose coins for
+	// nothing
+	err = database.WithTransaction(ctx, func(ctx context.Context) error {
+		if reward.Stock != nil {
+			res, err := rewardsCollection.UpdateOne(ctx, bson.M{"_id": reward.ID, "stock": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"stock": -1}})
+			if err != nil {
+				return err
+			}
+			if res.ModifiedCount == 0 {
+				return errRewardOutOfStock
+			}
+			redemption.StockReserved = true
+		}
+		undo := func(coins bool) {
+			if database.InTransaction(ctx) {
+				return // aborting the transaction undoes everything
+			}
+			if redemption.StockReserved {
+				rewardsCollection.UpdateOne(ctx, bson.M{"_id": reward.ID}, bson.M{"$inc": bson.M{"stock": 1}})
+			}
+			if coins {
+				if rerr := returnCoins(ctx, userID, reward.Cost, "reward:"+redemption.ID.Hex(), "Redemption failed"); rerr != nil {
+					log.Printf("⚠️ Failed to return %d coins to user %s: %v", reward.Cost, userID.Hex(), rerr)
+				}
+			}
+		}
+
+		if err := deductCoins(ctx, userID, reward.Cost, "reward:"+redemption.ID.Hex(), "Redeemed: "+reward.Name); err != nil {
+			undo(false)
+			return err
+		}
+		if _, err := redemptionsCollection.InsertOne(ctx, redemption); err != nil {
+			undo(true)
+			return err
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errInsufficientCoins):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient coins"})
+		return
+	case errors.Is(err, errRewardOutOfStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "Reward is out of stock"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem reward"})
+		return
+	}
+
+	if reward.IsDigital() {
+		issued, err := issueVoucher(ctx, redemption)
+		if err != nil {
+			log.Printf("⚠️ Voucher not issued for redemption %s: %v", redemption.ID.Hex(), err)
+			failed, ferr := failRedemption(ctx, redemption.ID, "Voucher could not be issued", "")
+			if ferr != nil {
+				log.Printf("⚠️ Failed to close redemption %s: %v", redemption.ID.Hex(), ferr)
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Voucher could not be issued; your coins have been returned", "redemption": failed})
+			return
+		}
+		redemption = issued
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reward redeemed successfully", "redemption": redemption})
+}
+
+// ====== GET /rewards/redemptions ======
+func GetMyRedemptions(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("reward_redemptions").Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.M{"redeemed_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch redemptions"})
+		return
+	}
+	redemptions := []models.RewardRedemption{}
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode redemptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"redemptions": redemptions})
+}
+
+// ======================= ADMIN =======================
+
+// GET /admin/rewards
+// The whole catalogue, inactive rewards included.
+func AdminListRewards(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("rewards").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"cost": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rewards"})
+		return
+	}
+	rewards := []models.Reward{}
+	if err := cursor.All(ctx, &rewards); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode rewards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rewards": rewards})
+}
+
+// rewardFromInput fills a reward from what the admin posted
+func rewardFromInput(input models.RewardInput) models.Reward {
+	reward := models.Reward{
+		Name:        input.Name,
+		Description: input.Description,
+		Cost:        input.Cost,
+		Type:        input.Type,
+		Stock:       input.Stock,
+		Active:      input.Active == nil || *input.Active,
+		UpdatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if reward.Type == "" {
+		reward.Type = models.RewardPhysical
+	}
+	return reward
+}
+
+// POST /admin/rewards
+func AdminCreateReward(c *gin.Context) {
+	var input models.RewardInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	reward := rewardFromInput(input)
+	reward.ID = primitive.NewObjectID()
+	reward.CreatedAt = reward.UpdatedAt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := config.DB.Collection("rewards").InsertOne(ctx, reward); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reward"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Reward created", "reward": reward})
+}
+
+// PUT /admin/rewards/:id
+// Replaces the reward's details. Omitting stock makes it unlimited.
+func AdminUpdateReward(c *gin.Context) {
+	rewardID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reward ID"})
+		return
+	}
+	var input models.RewardInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	reward := rewardFromInput(input)
+	set := bson.M{
+		"name":        reward.Name,
+		"description": reward.Description,
+		"cost":        reward.Cost,
+		"type":        reward.Type,
+		"active":      reward.Active,
+		"updated_at":  reward.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	if reward.Stock != nil {
+		set["stock"] = *reward.Stock
+	} else {
+		update["$unset"] = bson.M{"stock": ""}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = config.DB.Collection("rewards").FindOneAndUpdate(ctx, bson.M{"_id": rewardID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&reward)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reward not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reward"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reward updated", "reward": reward})
+}
+
+// DELETE /admin/rewards/:id
+// Redemptions keep the reward's name and cost, so past claims are unaffected.
+func AdminDeleteReward(c *gin.Context) {
+	rewardID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reward ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := config.DB.Collection("rewards").DeleteOne(ctx, bson.M{"_id": rewardID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete reward"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reward not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reward deleted"})
+}
+
+// GET /admin/rewards/redemptions?status=requested
+// The fulfilment queue, oldest first.
+func AdminListRedemptions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("reward_redemptions").Find(ctx, statusFilter(c), options.Find().SetSort(bson.M{"redeemed_at": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch redemptions"})
+		return
+	}
+	redemptions := []models.RewardRedemption{}
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode redemptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"redemptions": redemptions})
+}
+
+// adminRedemptionAction moves a physical redemption along and responds on error
+func adminRedemptionAction(c *gin.Context, to, note string, extra bson.M) (models.RewardRedemption, bool) {
+	var redemption models.RewardRedemption
+	redemptionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redemption ID"})
+		return redemption, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Digital rewards are fulfilled by their voucher, never shipped
+	coll := config.DB.Collection("reward_redemptions")
+	if err := coll.FindOne(ctx, bson.M{"_id": redemptionID}).Decode(&redemption); err != nil {
+		respondRMAError(c, errRMANotFound)
+		return redemption, false
+	}
+	if redemption.RewardType == models.RewardDigital {
+		c.JSON(http.StatusConflict, gin.H{"error": "Digital rewards are fulfilled by voucher"})
+		return redemption, false
+	}
+	err = transitionRMA(ctx, coll, redemptionID, models.RedemptionStatusesBefore(to), to, note, c.GetString("email"), extra, &redemption)
+	if err != nil {
+		respondRMAError(c, err)
+		return redemption, false
+	}
+	return redemption, true
+}
+
+// POST /admin/rewards/redemptions/:id/dispatch
+func AdminDispatchRedemption(c *gin.Context) {
+	var input models.DispatchRedemptionInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+	note := input.Note
+	if note == "" {
+		note = "Reward dispatched"
+	}
+	extra := bson.M{}
+	if input.TrackingNumber != "" {
+		extra["tracking_number"] = input.TrackingNumber
+	}
+	if redemption, ok := adminRedemptionAction(c, models.RedemptionDispatched, note, extra); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Reward dispatched", "redemption": redemption})
+	}
+}
+
+// POST /admin/rewards/redemptions/:id/deliver
+func AdminDeliverRedemption(c *gin.Context) {
+	if redemption, ok := adminRedemptionAction(c, models.RedemptionDelivered, "Reward delivered", nil); ok {
+		c.JSON(http.StatusOK, gin.H{"message": "Reward delivered", "redemption": redemption})
+	}
+}
+
+// POST /admin/rewards/redemptions/:id/fail
+// The reward cannot be fulfilled (e.g. lost in transit); the unit goes back
+// in stock and the coins back to the farmer.
+func AdminFailRedemption(c *gin.Context) {
+	redemptionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redemption ID"})
+		return
+	}
+	var input models.FailRedemptionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	redemption, err := failRedemption(ctx, redemptionID, input.Reason, c.GetString("email"))
+	if errors.Is(err, errRMANotFound) || errors.Is(err, errInvalidRMAStatus) {
+		respondRMAError(c, err)
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️ Redemption %s failed but %v", redemptionID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Redemption closed but coins not refunded; retry to refund", "redemption": redemption})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Redemption failed; coins refunded", "redemption": redemption})
+}
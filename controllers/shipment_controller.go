@@ -0,0 +1,523 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	shipmentCollection     *mongo.Collection
+	locationPingCollection *mongo.Collection
+)
+
+const (
+	podUploadPath          = "uploads/pod"
+	maxDeliveryOTPAttempts = 5  // per delivery attempt, each with a fresh OTP
+	maxDeliveryOTPTries    = 15 // per shipment, however often it goes out again
+)
+
+var (
+	errShipmentNotFound          = errors.New("shipment not found")
+	errInvalidShipmentTransition = errors.New("invalid shipment status transition")
+)
+
+// InitShipmentCollections initializes delivery tracking collections; call once after DB connection is ready
+func InitShipmentCollections() {
+	shipmentCollection = config.DB.Collection("shipments")
+	locationPingCollection = config.DB.Collection("shipment_locations")
+}
+
+// transitionShipment moves an agent's shipment to a new status and appends
+// it to the tracking timeline. Like transitionOrder, the update only matches
+// from a status that may move to `to`, so concurrent updates cannot both win.
+// Extra fields are $set alongside the status.
+func transitionShipment(ctx context.Context, shipmentID, agentID primitive.ObjectID, to, note string, loc *models.GeoPoint, extra bson.M) (models.Shipment, error) {
+	var shipment models.Shipment
+	from := models.ShipmentStatusesBefore(to)
+	if len(from) == 0 {
+		return shipment, fmt.Errorf("%w: nothing can move to %q", errInvalidShipmentTransition, to)
+	}
+
+	now := time.Now()
+	set := bson.M{"status": to, "updated_at": now}
+	if loc != nil {
+		set["last_location"] = loc
+		set["last_location_at"] = now
+	}
+	for k, v := range extra {
+		set[k] = v
+	}
+	event := models.ShipmentEvent{Status: to, Note: note, Location: loc, At: now}
+
+	err := shipmentCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": shipmentID, "agent_id": agentID, "status": bson.M{"$in": from}},
+		bson.M{"$set": set, "$push": bson.M{"events": event}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&shipment)
+	if err == nil {
+		return shipment, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return shipment, err
+	}
+
+	if err := shipmentCollection.FindOne(ctx, bson.M{"_id": shipmentID, "agent_id": agentID}).Decode(&shipment); err != nil {
+		return shipment, errShipmentNotFound
+	}
+	return shipment, fmt.Errorf("%w: %s → %s", errInvalidShipmentTransition, shipment.Status, to)
+}
+
+// ======================= ADMIN =======================
+
+// POST /admin/shipments
+// Hands a packed order to a delivery agent.
+func AssignShipment(c *gin.Context) {
+	var input models.AssignShipmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(input.OrderID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	agentID, err := primitive.ObjectIDFromHex(input.AgentID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid agent ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order models.Order
+	if err := orderCollection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.Status != models.OrderStatusPacked {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order must be packed before it is assigned"})
+		return
+	}
+
+	var agent models.User
+	err = config.DB.Collection("users").FindOne(ctx, bson.M{"_id": agentID, "role": "agent"}).Decode(&agent)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery agent not found"})
+		return
+	}
+
+	now := time.Now()
+	shipment := models.Shipment{
+		ID:          primitive.NewObjectID(),
+		OrderID:     orderID,
+		AgentID:     agentID,
+		AgentName:   agent.Name,
+		AgentPhone:  agent.Phone,
+		Status:      models.ShipmentAssigned,
+		Destination: input.Destination,
+		Events:      []models.ShipmentEvent{{Status: models.ShipmentAssigned, Note: "Assigned to " + agent.Name, At: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := shipmentCollection.InsertOne(ctx, shipment); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order already has a shipment"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipment assigned", "shipment": shipment})
+}
+
+// GET /admin/shipments/:orderId/proof
+// Proof of delivery for resolving "not received" disputes.
+func GetDeliveryProof(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var shipment models.Shipment
+	if err := shipmentCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&shipment); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+	if shipment.Proof == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order has not been delivered"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orderId":   orderID,
+		"agentId":   shipment.AgentID,
+		"agentName": shipment.AgentName,
+		"proof":     shipment.Proof,
+		"timeline":  shipment.Events,
+	})
+}
+
+// GET /admin/shipments/:orderId/proof/photo
+func GetDeliveryProofPhoto(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var shipment models.Shipment
+	if err := shipmentCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&shipment); err != nil ||
+		shipment.Proof == nil || shipment.Proof.PhotoPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No delivery photo"})
+		return
+	}
+
+	c.File(shipment.Proof.PhotoPath)
+}
+
+// ======================= AGENT =======================
+
+// GET /agent/shipments
+// Lists the agent's shipments that are not yet delivered.
+func GetAgentShipments(c *gin.Context) {
+	agentIDRaw, _ := c.Get("user_id")
+	agentID := agentIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := shipmentCollection.Find(ctx,
+		bson.M{"agent_id": agentID, "status": bson.M{"$ne": models.ShipmentDelivered}},
+		options.Find().SetSort(bson.M{"created_at": 1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipments"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	shipments := []models.Shipment{}
+	if err := cursor.All(ctx, &shipments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse shipments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shipments)
+}
+
+// POST /agent/shipments/:id/location
+func PostShipmentLocation(c *gin.Context) {
+	shipmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	var input models.LocationPingInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	agentIDRaw, _ := c.Get("user_id")
+	agentID := agentIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var shipment models.Shipment
+	err = shipmentCollection.FindOne(ctx, bson.M{
+		"_id":      shipmentID,
+		"agent_id": agentID,
+		"status":   bson.M{"$ne": models.ShipmentDelivered},
+	}).Decode(&shipment)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+		return
+	}
+
+	now := time.Now()
+	loc := models.GeoPoint{Lat: input.Lat, Lng: input.Lng}
+	ping := models.LocationPing{
+		ID:         primitive.NewObjectID(),
+		ShipmentID: shipmentID,
+		AgentID:    agentID,
+		Location:   loc,
+		RecordedAt: now,
+	}
+	if _, err := locationPingCollection.InsertOne(ctx, ping); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record location"})
+		return
+	}
+
+	set := bson.M{"last_location": loc, "last_location_at": now, "updated_at": now}
+	if input.ETAMinutes > 0 {
+		set["eta"] = now.Add(time.Duration(input.ETAMinutes) * time.Minute)
+	} else if shipment.Destination != nil {
+		set["eta"] = models.EstimateETA(loc, *shipment.Destination, now)
+	}
+	if _, err := shipmentCollection.UpdateOne(ctx, bson.M{"_id": shipmentID}, bson.M{"$set": set}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location updated", "eta": set["eta"]})
+}
+
+// POST /agent/shipments/:id/status
+func UpdateShipmentStatus(c *gin.Context) {
+	shipmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	var input models.ShipmentStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Status == models.ShipmentDelivered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Complete delivery with the farmer's OTP"})
+		return
+	}
+
+	agentIDRaw, _ := c.Get("user_id")
+	agentID := agentIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Every delivery attempt gets a fresh OTP for the farmer to read out
+	extra := bson.M{}
+	if input.Status == models.ShipmentOutForDelivery {
+		otp, err := generateDeliveryOTP()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate delivery OTP"})
+			return
+		}
+		extra["delivery_otp"] = otp
+		extra["otp_attempts"] = 0
+	}
+
+	shipment, err := transitionShipment(ctx, shipmentID, agentID, input.Status, input.Note, input.Location, extra)
+	if !respondShipmentError(c, err) {
+		return
+	}
+
+	// Keep the order in step with the parcel
+	if input.Status == models.ShipmentPickedUp {
+		err = transitionOrder(ctx, shipment.OrderID, models.OrderStatusShipped, "Picked up by "+shipment.AgentName, c.GetString("email"), nil)
+		if err == nil {
+			if derr := dispatchStock(ctx, shipment.OrderID); derr != nil {
+				log.Printf("⚠️ Failed to dispatch stock for order %s: %v", shipment.OrderID.Hex(), derr)
+			}
+		} else {
+			log.Printf("⚠️ Shipment %s picked up but order %s was not updated: %v", shipment.ID.Hex(), shipment.OrderID.Hex(), err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipment updated", "shipment": shipment})
+}
+
+// respondShipmentError maps transitionShipment errors to HTTP responses and
+// reports whether the caller may carry on
+func respondShipmentError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, errShipmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+	case errors.Is(err, errInvalidShipmentTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipment"})
+	default:
+		return true
+	}
+	return false
+}
+
+// POST /agent/shipments/:id/deliver (multipart: otp, optional photo, lat, lng)
+// Completes delivery once the agent enters the OTP shown to the farmer. The
+// OTP, an optional doorstep photo and the agent's position are kept as proof.
+func CompleteDelivery(c *gin.Context) {
+	shipmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+	otp := c.PostForm("otp")
+	if otp == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery OTP required"})
+		return
+	}
+
+	agentIDRaw, _ := c.Get("user_id")
+	agentID := agentIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Each try is counted before the OTP is compared, in the same update that
+	// checks the limits, so parallel guesses cannot get past them
+	var shipment models.Shipment
+	err = shipmentCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":          shipmentID,
+			"agent_id":     agentID,
+			"status":       models.ShipmentOutForDelivery,
+			"otp_attempts": bson.M{"$lt": maxDeliveryOTPAttempts},
+			"otp_tries":    bson.M{"$lt": maxDeliveryOTPTries},
+		},
+		bson.M{"$inc": bson.M{"otp_attempts": 1, "otp_tries": 1}},
+	).Decode(&shipment)
+	if err == mongo.ErrNoDocuments {
+		if err := shipmentCollection.FindOne(ctx, bson.M{"_id": shipmentID, "agent_id": agentID}).Decode(&shipment); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipment not found"})
+			return
+		}
+		switch {
+		case shipment.Status != models.ShipmentOutForDelivery:
+			c.JSON(http.StatusConflict, gin.H{"error": "Shipment is not out for delivery"})
+		case shipment.OTPTries >= maxDeliveryOTPTries:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many wrong OTPs for this shipment; contact support"})
+		default:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many wrong OTPs; mark this attempt failed and try again"})
+		}
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check delivery OTP"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(otp), []byte(shipment.DeliveryOTP)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid delivery OTP"})
+		return
+	}
+
+	now := time.Now()
+	proof := models.ProofOfDelivery{OTPVerified: true, DeliveredAt: now}
+	if lat, lng := c.PostForm("lat"), c.PostForm("lng"); lat != "" && lng != "" {
+		latF, latErr := strconv.ParseFloat(lat, 64)
+		lngF, lngErr := strconv.ParseFloat(lng, 64)
+		if latErr == nil && lngErr == nil {
+			proof.Location = &models.GeoPoint{Lat: latF, Lng: lngF}
+		}
+	}
+
+	if file, err := c.FormFile("photo"); err == nil {
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Photo must be a JPG or PNG"})
+			return
+		}
+		if err := os.MkdirAll(podUploadPath, os.ModePerm); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload folder"})
+			return
+		}
+		proof.PhotoPath = filepath.Join(podUploadPath, fmt.Sprintf("%s_%d%s", shipmentID.Hex(), now.Unix(), ext))
+		if err := c.SaveUploadedFile(file, proof.PhotoPath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload photo"})
+			return
+		}
+	}
+
+	shipment, err = transitionShipment(ctx, shipmentID, agentID, models.ShipmentDelivered, "Delivered, OTP verified", proof.Location,
+		bson.M{"proof": proof, "delivery_otp": ""})
+	if !respondShipmentError(c, err) {
+		return
+	}
+
+	err = transitionOrder(ctx, shipment.OrderID, models.OrderStatusDelivered, "Delivered by "+shipment.AgentName, c.GetString("email"),
+		bson.M{"delivered_at": now})
+	if err != nil {
+		log.Printf("⚠️ Shipment %s delivered but order %s was not updated: %v", shipment.ID.Hex(), shipment.OrderID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery completed", "shipment": shipment})
+}
+
+// generateDeliveryOTP returns a random 6-digit code
+func generateDeliveryOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// ======================= CUSTOMER =======================
+
+// GET /api/orders/delivery/agent-status?orderId=
+// Latest agent location, ETA and tracking timeline of the user's order.
+func GetDeliveryAgentStatus(c *gin.Context) {
+	orderID, err := primitive.ObjectIDFromHex(c.Query("orderId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := findUserOrder(ctx, orderID, userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var shipment models.Shipment
+	if err := shipmentCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&shipment); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order has not been handed to a delivery agent yet"})
+		return
+	}
+
+	resp := gin.H{
+		"orderId":       orderID,
+		"status":        shipment.Status,
+		"agentName":     shipment.AgentName,
+		"contactNumber": shipment.AgentPhone,
+		"location":      shipment.LastLocation,
+		"locationAt":    shipment.LastLocationAt,
+		"eta":           shipment.ETA,
+		"timeline":      shipment.Events,
+		"proof":         shipment.Proof,
+	}
+	// The farmer reads this out to the agent at the door, never before
+	if shipment.Status == models.ShipmentOutForDelivery {
+		resp["deliveryOtp"] = shipment.DeliveryOTP
+	}
+	c.JSON(http.StatusOK, resp)
+}
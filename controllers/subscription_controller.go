@@ -2,17 +2,45 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/internal/payment"
 	"github.com/ashishnagargoje0/backend/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ====== GET /subscription/plans ======
+func GetSubscriptionPlans(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("subscription_plans").Find(ctx, bson.M{"active": true}, options.Find().SetSort(bson.M{"price": 1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+	plans := []models.SubscriptionPlan{}
+	if err := cursor.All(ctx, &plans); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plans": plans})
+}
+
 // ====== POST /subscription/create ======
+// The subscription starts once its first invoice is paid, through
+// POST /subscription/invoices/:id/pay. Free plans start at once.
 func CreateSubscription(c *gin.Context) {
 	var input models.SubscriptionInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -23,30 +51,150 @@ func CreateSubscription(c *gin.Context) {
 	userIDRaw, _ := c.Get("user_id")
 	userID := userIDRaw.(primitive.ObjectID)
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	plan, err := subscriptionPlan(ctx, input.PlanID)
+	if err != nil || !plan.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plan not found"})
+		return
+	}
+
+	subscriptionCollection := config.DB.Collection("subscriptions")
+
+	live, err := subscriptionCollection.CountDocuments(ctx, bson.M{"user_id": userID, "status": bson.M{"$in": liveSubscriptionStatuses}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check subscriptions"})
+		return
+	}
+	if live > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a subscription; switch plans instead"})
+		return
+	}
+
+	// An earlier sign-up that was never paid gives way to this one
+	if prev, err := currentSubscription(ctx, userID); err == nil && prev.Status == models.SubscriptionIncomplete {
+		if err := cancelSubscription(ctx, prev.ID, "Replaced by a new sign-up"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+			return
+		}
+	}
+
+	now := time.Now()
 	subscription := models.Subscription{
+		ID:         primitive.NewObjectID(),
 		UserID:     userID,
-		PlanID:     input.PlanID,
-		Status:     "active",
-		StartedAt:  time.Now(),
-		CreatedAt:  time.Now(),
-		ModifiedAt: time.Now(),
+		PlanID:     plan.ID,
+		Status:     models.SubscriptionIncomplete,
+		StartedAt:  now,
+		CreatedAt:  now,
+		ModifiedAt: now,
 	}
 
+	if _, err := subscriptionCollection.InsertOne(ctx, subscription); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+
+	invoice, err := openSubscriptionInvoice(ctx, subscription, plan.ID, models.SubscriptionInvoiceSignup,
+		plan.Price, now, models.PeriodEnd(now, plan.Interval))
+	if err != nil {
+		cancelSubscription(ctx, subscription.ID, "Invoice not raised")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+
+	if invoice.Status == models.SubscriptionInvoicePaid {
+		c.JSON(http.StatusOK, gin.H{"message": "Subscription created", "subscription_id": subscription.ID, "invoice": invoice})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Subscription created; pay the invoice to start it", "subscription_id": subscription.ID, "invoice": invoice})
+}
+
+// ====== POST /subscription/switch ======
+// Moves to another plan. A dearer plan switches for the rest of the period
+// once the prorated difference is paid; a cheaper one takes over when the
+// period ends, so entitlements already used are not credited back. Asking
+// for the current plan drops a switch scheduled for the period end.
+func SwitchSubscriptionPlan(c *gin.Context) {
+	var input models.SubscriptionSwitchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	subscriptionCollection := config.DB.Collection("subscriptions")
+	sub, err := currentSubscription(ctx, userID)
+	if err != nil || sub.Status != models.SubscriptionActive || sub.CurrentPeriodEnd.IsZero() {
+		c.JSON(http.StatusConflict, gin.H{"error": "No active subscription to switch"})
+		return
+	}
+	if sub.PlanID == input.PlanID {
+		if sub.PendingPlanID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Already on this plan"})
+			return
+		}
+		if _, err := config.DB.Collection("subscriptions").UpdateOne(ctx,
+			bson.M{"_id": sub.ID}, bson.M{"$unset": bson.M{"pending_plan_id": ""}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch plan"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Scheduled plan switch dropped"})
+		return
+	}
+	if _, err := openInvoiceFor(ctx, sub.ID, models.SubscriptionInvoiceProration); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A plan switch is awaiting payment"})
+		return
+	}
 
-	res, err := subscriptionCollection.InsertOne(ctx, subscription)
+	current, err := subscriptionPlan(ctx, sub.PlanID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Current plan not found"})
+		return
+	}
+	plan, err := subscriptionPlan(ctx, input.PlanID)
+	if err != nil || !plan.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plan not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Subscription created", "subscription_id": res.InsertedID})
+	now := time.Now()
+	due := models.ProrateSwitch(current.Price, current.Interval, plan.Price, plan.Interval,
+		sub.CurrentPeriodStart, sub.CurrentPeriodEnd, now)
+
+	if due <= 0 {
+		res, err := config.DB.Collection("subscriptions").UpdateOne(ctx,
+			bson.M{"_id": sub.ID, "status": models.SubscriptionActive},
+			bson.M{"$set": bson.M{"pending_plan_id": plan.ID, "modified_at": now}},
+		)
+		if err != nil || res.MatchedCount == 0 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch plan"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Plan switches when the period ends", "plan": plan, "switches_at": sub.CurrentPeriodEnd})
+		return
+	}
+
+	invoice, err := openSubscriptionInvoice(ctx, sub, plan.ID, models.SubscriptionInvoiceProration, due, now, sub.CurrentPeriodEnd)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch plan"})
+		return
+	}
+	if invoice.Status == models.SubscriptionInvoicePaid {
+		c.JSON(http.StatusOK, gin.H{"message": "Plan switched", "plan": plan, "invoice": invoice})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Pay the invoice to switch plans", "plan": plan, "invoice": invoice})
 }
 
 // ====== POST /subscription/pause ======
+// Paused days are not billed: resuming pushes the renewal back by as long
+// as the subscription was paused.
 func PauseSubscription(c *gin.Context) {
 	userIDRaw, _ := c.Get("user_id")
 	userID := userIDRaw.(primitive.ObjectID)
@@ -56,11 +204,11 @@ func PauseSubscription(c *gin.Context) {
 
 	subscriptionCollection := config.DB.Collection("subscriptions")
 
-	filter := bson.M{"user_id": userID, "status": "active"}
+	filter := bson.M{"user_id": userID, "status": models.SubscriptionActive}
 	now := time.Now()
 	update := bson.M{
 		"$set": bson.M{
-			"status":      "paused",
+			"status":      models.SubscriptionPaused,
 			"paused_at":   now,
 			"modified_at": now,
 		},
@@ -85,22 +233,65 @@ func ResumeSubscription(c *gin.Context) {
 
 	subscriptionCollection := config.DB.Collection("subscriptions")
 
-	filter := bson.M{"user_id": userID, "status": "paused"}
-	update := bson.M{
-		"$set": bson.M{
-			"status":      "active",
-			"paused_at":   nil,
-			"modified_at": time.Now(),
-		},
+	var sub models.Subscription
+	if err := subscriptionCollection.FindOne(ctx, bson.M{"user_id": userID, "status": models.SubscriptionPaused}).Decode(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No paused subscription found or failed to resume"})
+		return
 	}
 
-	result, err := subscriptionCollection.UpdateOne(ctx, filter, update)
+	now := time.Now()
+	set := bson.M{
+		"status":      models.SubscriptionActive,
+		"modified_at": now,
+	}
+	if sub.PausedAt != nil && !sub.CurrentPeriodEnd.IsZero() {
+		set["current_period_end"] = sub.CurrentPeriodEnd.Add(now.Sub(*sub.PausedAt))
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{"paused_at": ""}}
+
+	result, err := subscriptionCollection.UpdateOne(ctx, bson.M{"_id": sub.ID, "status": models.SubscriptionPaused}, update)
 	if err != nil || result.ModifiedCount == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No paused subscription found or failed to resume"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Subscription resumed"})
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription resumed", "next_renewal_at": set["current_period_end"]})
+}
+
+// ====== POST /subscription/cancel ======
+// An active subscription runs to the end of the period it was paid for;
+// anything else ends now.
+func CancelSubscription(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, err := currentSubscription(ctx, userID)
+	if err != nil || sub.Status == models.SubscriptionCancelled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No subscription found"})
+		return
+	}
+
+	if sub.Status == models.SubscriptionActive && !sub.CurrentPeriodEnd.IsZero() {
+		_, err := config.DB.Collection("subscriptions").UpdateOne(ctx,
+			bson.M{"_id": sub.ID, "status": models.SubscriptionActive},
+			bson.M{"$set": bson.M{"cancel_at_period_end": true, "modified_at": time.Now()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Subscription will end at the end of the period", "ends_at": sub.CurrentPeriodEnd})
+		return
+	}
+
+	if err := cancelSubscription(ctx, sub.ID, "Cancelled by user"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription cancelled"})
 }
 
 // ====== GET /subscription/status ======
@@ -111,16 +302,244 @@ func GetSubscriptionStatus(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	subscriptionCollection := config.DB.Collection("subscriptions")
-
-	var subscription models.Subscription
-	err := subscriptionCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&subscription)
+	subscription, err := currentSubscription(ctx, userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No subscription found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, subscription)
+	response := gin.H{"subscription": subscription}
+	if plan, err := subscriptionPlan(ctx, subscription.PlanID); err == nil {
+		response["plan"] = plan
+	}
+	cursor, err := config.DB.Collection("subscription_invoices").Find(ctx, bson.M{
+		"subscription_id": subscription.ID,
+		"status":          models.SubscriptionInvoiceOpen,
+	})
+	if err == nil {
+		open := []models.SubscriptionInvoice{}
+		if cursor.All(ctx, &open) == nil {
+			response["open_invoices"] = open
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ====== GET /subscription/entitlements ======
+// What the farmer's plan includes and how much of it is left this period.
+func GetSubscriptionEntitlements(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, plan, entitled, err := entitledSubscription(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch entitlements"})
+		return
+	}
+	if !entitled {
+		c.JSON(http.StatusOK, gin.H{"entitled": false, "status": sub.Status, "entitlements": []models.EntitlementUsage{}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entitled":     true,
+		"status":       sub.Status,
+		"plan":         plan.Name,
+		"period_start": sub.CurrentPeriodStart,
+		"resets_at":    sub.CurrentPeriodEnd,
+		"entitlements": models.UsageOf(plan.Entitlements, sub.Usage),
+	})
+}
+
+// ====== GET /subscription/invoices ======
+func GetSubscriptionInvoices(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.DB.Collection("subscription_invoices").Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
+		return
+	}
+	invoices := []models.SubscriptionInvoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode invoices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invoices": invoices})
+}
+
+// ====== POST /subscription/invoices/:id/pay ======
+// "Wallet" pays at once; any other method starts a gateway checkout that
+// is completed through POST /subscription/invoices/:id/verify.
+func PaySubscriptionInvoice(c *gin.Context) {
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+	var input models.SubscriptionPayInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var invoice models.SubscriptionInvoice
+	err = config.DB.Collection("subscription_invoices").FindOne(ctx, bson.M{"_id": invoiceID, "user_id": userID}).Decode(&invoice)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return
+	}
+	if invoice.Status != models.SubscriptionInvoiceOpen || invoice.Lapsed(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice is not awaiting payment"})
+		return
+	}
+
+	if input.Method == "Wallet" {
+		paid, err := paySubscriptionInvoiceFromWallet(ctx, invoice)
+		switch {
+		case errors.Is(err, errInsufficientWalletBalance):
+			balance, _ := walletBalance(ctx, userID)
+			c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance", "balance": balance, "amount": invoice.Amount})
+		case errors.Is(err, errSubscriptionInvoiceNotOpen), errors.Is(err, errSubscriptionCancelled), errors.Is(err, errWalletEntryExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Invoice is not awaiting payment"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pay from wallet"})
+		default:
+			c.JSON(http.StatusOK, gin.H{"message": "Invoice paid from wallet", "invoice": paid})
+		}
+		return
+	}
+
+	intent, err := paymentGateway.CreateIntent(ctx, invoice.ID.Hex(), invoice.Amount)
+	if err != nil {
+		log.Printf("⚠️ Gateway %s failed to create payment for subscription invoice %s: %v", paymentGateway.Name(), invoice.ID.Hex(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create payment with gateway"})
+		return
+	}
+
+	now := time.Now()
+	pay := models.Payment{
+		ID:                    primitive.NewObjectID(),
+		SubscriptionInvoiceID: &invoice.ID,
+		UserID:                userID,
+		Method:                input.Method,
+		Provider:              intent.Provider,
+		ProviderOrderID:       intent.ProviderOrderID,
+		Amount:                intent.Amount,
+		Currency:              intent.Currency,
+		Status:                models.PaymentStatusCreated,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+	}
+	if _, err := database.PaymentCollection.InsertOne(ctx, pay); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Payment initiated",
+		"payment_id":        pay.ID.Hex(),
+		"gateway":           intent.Provider,
+		"provider_order_id": intent.ProviderOrderID,
+		"amount":            intent.Amount,
+		"currency":          intent.Currency,
+		"key_id":            intent.KeyID,
+	})
+}
+
+// ====== POST /subscription/invoices/:id/verify ======
+func VerifySubscriptionPayment(c *gin.Context) {
+	invoiceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+	var input models.SubscriptionVerifyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var pay models.Payment
+	err = database.PaymentCollection.FindOne(ctx, bson.M{
+		"_id":                     input.PaymentID,
+		"subscription_invoice_id": invoiceID,
+		"user_id":                 userID,
+	}).Decode(&pay)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if pay.Status != models.PaymentStatusCreated && pay.Status != models.PaymentStatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment already processed"})
+		return
+	}
+
+	if input.Status == "failed" {
+		taken, err := settleReportedFailure(ctx, pay)
+		switch {
+		case errors.Is(err, errGatewayUnconfirmed):
+			log.Printf("⚠️ Reported failure of payment %s not checked: %v", pay.ID.Hex(), err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Could not confirm the payment with the gateway"})
+		case errors.Is(err, errSubscriptionInvoiceNotOpen):
+			c.JSON(http.StatusConflict, gin.H{"error": "Invoice is no longer awaiting payment; the payment is refunded"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		case taken:
+			c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payment failed"})
+		}
+		return
+	}
+
+	if !paymentGateway.VerifySignature(pay.ProviderOrderID, input.ProviderPaymentID, input.Signature) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": payment.ErrInvalidSignature.Error()})
+		return
+	}
+
+	// A capture error does not mean the money is not taken: the attempt stays
+	// open for the gateway's webhook to settle
+	err = paymentGateway.Capture(ctx, input.ProviderPaymentID, pay.Amount)
+	if err != nil && !errors.Is(err, payment.ErrAlreadyCaptured) {
+		log.Printf("⚠️ Capture failed for payment %s: %v", pay.ID.Hex(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to capture payment"})
+		return
+	}
+
+	err = completePayment(ctx, pay, input.ProviderPaymentID)
+	if errors.Is(err, errSubscriptionInvoiceNotOpen) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invoice is no longer awaiting payment; the payment is refunded"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
 }
 
 // ====== GET /coins/balance ======
@@ -146,10 +565,115 @@ func GetCoinsBalance(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"coins": coins.Coins})
 }
 
+// ====== GET /coins/history?page=1&limit=20 ======
+// Every coin earned, spent, expired or taken back, newest first, and the
+// earned coins still waiting to expire.
+func GetCoinHistory(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	page, limit, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"postings": bson.M{"$elemMatch": bson.M{"account": models.AccountUserCoins, "user_id": userID}}}
+	total, err := database.LedgerCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coin history"})
+		return
+	}
+	cursor, err := database.LedgerCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coin history"})
+		return
+	}
+	var entries []models.LedgerEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode coin history"})
+		return
+	}
+
+	history := []models.CoinHistoryEntry{}
+	for _, entry := range entries {
+		for _, p := range entry.Postings {
+			if p.Name != models.AccountUserCoins || p.UserID == nil || *p.UserID != userID {
+				continue
+			}
+			history = append(history, models.CoinHistoryEntry{
+				Coins:       int(p.Credit - p.Debit),
+				Kind:        entry.Kind,
+				Reference:   entry.Reference,
+				Description: entry.Description,
+				CreatedAt:   entry.CreatedAt,
+			})
+		}
+	}
+
+	cursor, err = config.DB.Collection("coin_earnings").Find(ctx,
+		bson.M{"user_id": userID, "status": models.CoinEarningActive, "expires_at": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.M{"expires_at": 1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coin history"})
+		return
+	}
+	expiring := []models.CoinEarning{}
+	if err := cursor.All(ctx, &expiring); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode coin history"})
+		return
+	}
+
+	balance, err := coinBalance(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coins"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"coins":    balance,
+		"history":  history,
+		"expiring": expiring,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+	})
+}
+
+// ====== GET /referral/code ======
+func GetMyReferralCode(c *gin.Context) {
+	userIDRaw, _ := c.Get("user_id")
+	userID := userIDRaw.(primitive.ObjectID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	code, err := referralCodeFor(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get referral code"})
+		return
+	}
+
+	referrerCoins, refereeCoins := referralRewards(ctx)
+	c.JSON(http.StatusOK, gin.H{
+		"referral_code":  code.Code,
+		"referrer_coins": referrerCoins, // what you earn per friend
+		"referee_coins":  refereeCoins,  // what your friend earns
+	})
+}
+
 // ====== POST /referral/use ======
+// A farmer can be referred once, before their first paid order, and each
+// device can claim one referral.
 func UseReferralCode(c *gin.Context) {
 	var input models.ReferralUseInput
-	if err := c.ShouldBindJSON(&input); err != nil || input.ReferralCode == "" {
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral code"})
 		return
 	}
@@ -164,33 +688,100 @@ func UseReferralCode(c *gin.Context) {
 	defer cancel()
 
 	// Check if referral code exists and is valid
-	var ref bson.M
-	err := referralCollection.FindOne(ctx, bson.M{"code": input.ReferralCode}).Decode(&ref)
+	var ref models.ReferralCode
+	err := referralCollection.FindOne(ctx, bson.M{"code": strings.ToUpper(strings.TrimSpace(input.ReferralCode))}).Decode(&ref)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral code"})
 		return
 	}
+	if ref.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot use your own referral code"})
+		return
+	}
 
-	// Check if user already used this referral code
-	count, _ := referralUsesCollection.CountDocuments(ctx, bson.M{"user_id": userID, "referral_code": input.ReferralCode})
+	// Check if user was already referred
+	count, err := referralUsesCollection.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use referral code"})
+		return
+	}
 	if count > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Referral code already used"})
 		return
 	}
 
-	// Mark referral code used by user
-	_, err = referralUsesCollection.InsertOne(ctx, bson.M{
-		"user_id":       userID,
-		"referral_code": input.ReferralCode,
-		"referrer_id":   ref["user_id"],
-		"used_at":       time.Now(),
-	})
+	paid, err := hasPaidOrder(ctx, userID, primitive.NilObjectID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use referral code"})
 		return
 	}
+	if paid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Referral codes can only be used before your first paid order"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Referral code applied"})
+	// One referral per verified phone number, so new accounts cannot farm
+	// rewards: each needs a number of its own, proven by OTP
+	phone, err := referralPhone(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use referral code"})
+		return
+	}
+	if phone == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your phone number to use a referral code"})
+		return
+	}
+	count, err = referralUsesCollection.CountDocuments(ctx, bson.M{"phone": phone})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use referral code"})
+		return
+	}
+	if count > 0 {
+		log.Printf("⚠️ Referral code %s refused for user %s: phone already claimed a referral", ref.Code, userID.Hex())
+		c.JSON(http.StatusForbidden, gin.H{"error": "A referral was already claimed with this phone number"})
+		return
+	}
+
+	// Nor one per device. The device is recognised by the server, not told
+	// by the app.
+	device := deviceFingerprint(c)
+	count, err = referralUsesCollection.CountDocuments(ctx, bson.M{"device_id": device})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use referral code"})
+		return
+	}
+	if count > 0 {
+		log.Printf("⚠️ Referral code %s refused for user %s: device already claimed a referral", ref.Code, userID.Hex())
+		c.JSON(http.StatusForbidden, gin.H{"error": "A referral was already claimed on this device"})
+		return
+	}
+
+	referrerCoins, refereeCoins := referralRewards(ctx)
+	use := models.ReferralUse{
+		ID:            primitive.NewObjectID(),
+		UserID:        userID,
+		ReferrerID:    ref.UserID,
+		ReferralCode:  ref.Code,
+		Phone:         phone,
+		DeviceID:      device,
+		Status:        models.ReferralPending,
+		ReferrerCoins: referrerCoins,
+		RefereeCoins:  refereeCoins,
+		UsedAt:        time.Now(),
+	}
+	if _, err := referralUsesCollection.InsertOne(ctx, use); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Referral code already used"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use referral code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Referral code applied; coins are credited once your first order is delivered and kept",
+		"referee_coins": refereeCoins,
+	})
 }
 
 // ====== GET /referral/stats ======
@@ -203,90 +794,241 @@ func GetReferralStats(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	count, err := referralUsesCollection.CountDocuments(ctx, bson.M{"referrer_id": userID})
+	code, err := referralCodeFor(ctx, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get referral stats"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"referral_count": count})
+	cursor, err := referralUsesCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"referrer_id": userID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$status",
+			"count": bson.M{"$sum": 1},
+			"coins": bson.M{"$sum": "$referrer_coins"},
+		}}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get referral stats"})
+		return
+	}
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int    `bson:"count"`
+		Coins  int    `bson:"coins"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get referral stats"})
+		return
+	}
+
+	referralCount := 0
+	pending := gin.H{"count": 0, "coins": 0}
+	earned := gin.H{"count": 0, "coins": 0}
+	for _, g := range groups {
+		referralCount += g.Count
+		switch g.Status {
+		case models.ReferralPending:
+			pending = gin.H{"count": g.Count, "coins": g.Coins}
+		case models.ReferralRewarded:
+			earned = gin.H{"count": g.Count, "coins": g.Coins}
+		}
+	}
+
+	// The farmer's own referral, if they joined through someone's code
+	var referredBy *gin.H
+	var own models.ReferralUse
+	if err := referralUsesCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&own); err == nil {
+		referredBy = &gin.H{"status": own.Status, "coins": own.RefereeCoins}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"referral_code":  code.Code,
+		"referral_count": referralCount,
+		"pending":        pending,
+		"earned":         earned,
+		"referred_by":    referredBy,
+	})
 }
 
-// ====== GET /rewards/catalog ======
-func GetRewardsCatalog(c *gin.Context) {
-	rewardsCollection := config.DB.Collection("rewards")
+// ======================= ADMIN =======================
 
+// GET /admin/coins/rules
+// Every earn event with its rule; events without one earn nothing.
+func AdminListCoinRules(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cursor, err := rewardsCollection.Find(ctx, bson.M{})
+	cursor, err := config.DB.Collection("coin_rules").Find(ctx, bson.M{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rewards"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coin rules"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var rewards []models.Reward
-	if err := cursor.All(ctx, &rewards); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode rewards"})
+	var rules []models.CoinRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode coin rules"})
 		return
 	}
 
-	c.JSON(http.StatusOK, rewards)
+	byEvent := gin.H{}
+	for _, event := range models.CoinEvents() {
+		byEvent[event] = nil
+	}
+	for _, rule := range rules {
+		byEvent[rule.Event] = rule
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": byEvent})
 }
 
-// ====== POST /rewards/redeem ======
-func RedeemReward(c *gin.Context) {
-	var input models.RewardRedeemInput
+// PUT /admin/coins/rules/:event
+// Sets how many coins the event earns, its caps and expiry. Coins already
+// earned keep the expiry they were given.
+func AdminSetCoinRule(c *gin.Context) {
+	event := c.Param("event")
+	if !models.IsCoinEvent(event) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown coin event", "events": models.CoinEvents()})
+		return
+	}
+
+	var input models.CoinRuleInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redeem request"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if input.PerAmount > 0 && event != models.CoinEventOrderPaid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "per_amount only applies to order_paid"})
 		return
 	}
 
-	userIDRaw, _ := c.Get("user_id")
-	userID := userIDRaw.(primitive.ObjectID)
+	rule := models.CoinRule{
+		Event:         event,
+		Coins:         input.Coins,
+		PerAmount:     input.PerAmount,
+		MaxPerEvent:   input.MaxPerEvent,
+		MaxPerUser:    input.MaxPerUser,
+		CapWindowDays: input.CapWindowDays,
+		ExpiryDays:    input.ExpiryDays,
+		Active:        *input.Active,
+		UpdatedBy:     c.GetString("email"),
+		UpdatedAt:     time.Now(),
+	}
 
-	coinsCollection := config.DB.Collection("coins")
-	rewardsCollection := config.DB.Collection("rewards")
-	redemptionsCollection := config.DB.Collection("reward_redemptions")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	_, err := config.DB.Collection("coin_rules").ReplaceOne(ctx, bson.M{"_id": event}, rule, options.Replace().SetUpsert(true))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save coin rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Coin rule saved", "rule": rule})
+}
+
+// GET /admin/subscription/plans
+// The whole catalogue, retired plans included.
+func AdminListSubscriptionPlans(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Find reward by ID
-	var reward models.Reward
-	err := rewardsCollection.FindOne(ctx, bson.M{"_id": input.RewardID}).Decode(&reward)
+	cursor, err := config.DB.Collection("subscription_plans").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"price": 1}))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Reward not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+	plans := []models.SubscriptionPlan{}
+	if err := cursor.All(ctx, &plans); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode plans"})
 		return
 	}
 
-	// Find user's coin balance
-	var coins models.CoinsBalance
-	err = coinsCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&coins)
-	if err != nil || coins.Coins < reward.Cost {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient coins"})
+	c.JSON(http.StatusOK, gin.H{"plans": plans})
+}
+
+// planFromInput fills a plan from what the admin posted
+func planFromInput(input models.SubscriptionPlanInput) models.SubscriptionPlan {
+	plan := models.SubscriptionPlan{
+		Name:             input.Name,
+		Description:      input.Description,
+		Price:            models.RoundAmount(input.Price),
+		Interval:         input.Interval,
+		IncludedServices: input.IncludedServices,
+		Entitlements:     input.Entitlements,
+		GraceDays:        input.GraceDays,
+		Active:           input.Active == nil || *input.Active,
+		UpdatedAt:        time.Now(),
+	}
+	if plan.IncludedServices == nil {
+		plan.IncludedServices = []string{}
+	}
+	if plan.Entitlements == nil {
+		plan.Entitlements = []models.PlanEntitlement{}
+	}
+	return plan
+}
+
+// POST /admin/subscription/plans
+func AdminCreateSubscriptionPlan(c *gin.Context) {
+	var input models.SubscriptionPlanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	// Deduct coins
-	update := bson.M{"$inc": bson.M{"coins": -reward.Cost}}
-	_, err = coinsCollection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deduct coins"})
+	plan := planFromInput(input)
+	plan.ID = primitive.NewObjectID()
+	plan.CreatedAt = plan.UpdatedAt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := config.DB.Collection("subscription_plans").InsertOne(ctx, plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create plan"})
 		return
 	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Plan created", "plan": plan})
+}
 
-	// Record redemption
-	_, err = redemptionsCollection.InsertOne(ctx, bson.M{
-		"user_id":     userID,
-		"reward_id":   reward.ID,
-		"redeemed_at": time.Now(),
-	})
+// PUT /admin/subscription/plans/:id
+// Subscribers are billed the new price from their next renewal, and get the
+// new entitlements at once. Plans are retired with active=false rather than
+// deleted, since subscriptions still refer to them.
+func AdminUpdateSubscriptionPlan(c *gin.Context) {
+	planID, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record redemption"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plan ID"})
+		return
+	}
+	var input models.SubscriptionPlanInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Reward redeemed successfully"})
+	plan := planFromInput(input)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = config.DB.Collection("subscription_plans").FindOneAndUpdate(ctx, bson.M{"_id": planID},
+		bson.M{"$set": bson.M{
+			"name":              plan.Name,
+			"description":       plan.Description,
+			"price":             plan.Price,
+			"interval":          plan.Interval,
+			"included_services": plan.IncludedServices,
+			"entitlements":      plan.Entitlements,
+			"grace_days":        plan.GraceDays,
+			"active":            plan.Active,
+			"updated_at":        plan.UpdatedAt,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plan"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Plan updated", "plan": plan})
 }
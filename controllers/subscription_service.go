@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The subscription service: a subscription is billed through subscription
+// invoices, one per billing period plus one for each upgrade. An invoice is
+// paid from the farmer's wallet when the balance allows, otherwise through
+// the gateway, and paying it is what moves the subscription onto the
+// invoice's plan and period. The renewal job raises and charges the invoices
+// as periods end, and cancels subscriptions left unpaid past their grace.
+
+var (
+	errNoSubscription             = errors.New("no subscription found")
+	errSubscriptionExists         = errors.New("subscription already exists")
+	errPlanNotFound               = errors.New("plan not found")
+	errSubscriptionInvoiceNotOpen = errors.New("invoice is not open")
+	errSubscriptionCancelled      = errors.New("subscription is cancelled")
+)
+
+// liveSubscriptionStatuses are the statuses of a subscription the farmer
+// still holds; a farmer has at most one
+var liveSubscriptionStatuses = []string{
+	models.SubscriptionActive, models.SubscriptionPastDue, models.SubscriptionPaused,
+}
+
+func subscriptionPlan(ctx context.Context, planID primitive.ObjectID) (models.SubscriptionPlan, error) {
+	var plan models.SubscriptionPlan
+	err := database.GetCollection("subscription_plans").FindOne(ctx, bson.M{"_id": planID}).Decode(&plan)
+	if err == mongo.ErrNoDocuments {
+		return plan, errPlanNotFound
+	}
+	return plan, err
+}
+
+// currentSubscription returns the farmer's latest subscription
+func currentSubscription(ctx context.Context, userID primitive.ObjectID) (models.Subscription, error) {
+	var sub models.Subscription
+	err := database.GetCollection("subscriptions").FindOne(ctx, bson.M{"user_id": userID},
+		options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return sub, errNoSubscription
+	}
+	return sub, err
+}
+
+// openSubscriptionInvoice raises an invoice against the subscription, taking
+// any proration credit off it first. An invoice the credit covers in full is
+// settled at once.
+func openSubscriptionInvoice(ctx context.Context, sub models.Subscription, planID primitive.ObjectID, kind string, amount float64, start, end time.Time) (models.SubscriptionInvoice, error) {
+	credit := models.RoundAmount(min(max(sub.Credit, 0), amount))
+	inv := models.SubscriptionInvoice{
+		ID:             primitive.NewObjectID(),
+		SubscriptionID: sub.ID,
+		UserID:         sub.UserID,
+		PlanID:         planID,
+		Kind:           kind,
+		Amount:         models.RoundAmount(amount - credit),
+		CreditApplied:  credit,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		Status:         models.SubscriptionInvoiceOpen,
+		CreatedAt:      time.Now(),
+	}
+	if _, err := database.GetCollection("subscription_invoices").InsertOne(ctx, inv); err != nil {
+		return inv, err
+	}
+	if inv.Amount == 0 {
+		return settleSubscriptionInvoice(ctx, inv.ID, nil)
+	}
+	return inv, nil
+}
+
+// settleSubscriptionInvoice marks an open invoice paid and applies it to its
+// subscription. Settling an invoice that is already paid is a no-op; a
+// proration whose period has ended is voided instead, and so is an invoice
+// of a subscription cancelled meanwhile.
+func settleSubscriptionInvoice(ctx context.Context, invoiceID primitive.ObjectID, paymentID *primitive.ObjectID) (models.SubscriptionInvoice, error) {
+	var inv models.SubscriptionInvoice
+	invoices := database.GetCollection("subscription_invoices")
+	now := time.Now()
+	set := bson.M{"status": models.SubscriptionInvoicePaid, "paid_at": now}
+	if paymentID != nil {
+		set["payment_id"] = *paymentID
+	}
+	err := invoices.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":    invoiceID,
+			"status": models.SubscriptionInvoiceOpen,
+			"$or": bson.A{
+				bson.M{"kind": bson.M{"$ne": models.SubscriptionInvoiceProration}},
+				bson.M{"period_end": bson.M{"$gt": now}},
+			},
+		},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&inv)
+	if err == mongo.ErrNoDocuments {
+		if err := invoices.FindOne(ctx, bson.M{"_id": invoiceID}).Decode(&inv); err != nil {
+			return inv, err
+		}
+		if inv.Status == models.SubscriptionInvoicePaid {
+			return inv, nil
+		}
+		if inv.Status == models.SubscriptionInvoiceOpen && inv.Lapsed(now) {
+			if err := voidProrationInvoices(ctx, inv.SubscriptionID); err != nil {
+				log.Printf("⚠️ Failed to void lapsed proration invoice %s: %v", inv.ID.Hex(), err)
+			}
+		}
+		return inv, errSubscriptionInvoiceNotOpen
+	}
+	if err != nil {
+		return inv, err
+	}
+
+	update := bson.M{"plan_id": inv.PlanID, "modified_at": now}
+	unset := bson.M{"grace_until": "", "pending_plan_id": ""}
+	if inv.Kind != models.SubscriptionInvoiceProration {
+		update["status"] = models.SubscriptionActive
+		update["current_period_start"] = inv.PeriodStart
+		update["current_period_end"] = inv.PeriodEnd
+		update["usage"] = bson.M{} // entitlements start again each period
+	}
+	res, err := database.GetCollection("subscriptions").UpdateOne(ctx,
+		bson.M{"_id": inv.SubscriptionID, "status": bson.M{"$ne": models.SubscriptionCancelled}},
+		bson.M{
+			"$set":   update,
+			"$unset": unset,
+			"$inc":   bson.M{"credit": -inv.CreditApplied},
+		},
+	)
+	if err != nil {
+		return inv, err
+	}
+	if res.MatchedCount == 0 {
+		// Cancelling voids the open invoices; this one was caught mid-payment
+		_, err := invoices.UpdateOne(ctx,
+			bson.M{"_id": inv.ID},
+			bson.M{
+				"$set":   bson.M{"status": models.SubscriptionInvoiceVoid},
+				"$unset": bson.M{"paid_at": "", "payment_id": ""},
+			},
+		)
+		if err != nil {
+			log.Printf("⚠️ Failed to void subscription invoice %s of a cancelled subscription: %v", inv.ID.Hex(), err)
+		}
+		return inv, errSubscriptionCancelled
+	}
+	return inv, nil
+}
+
+// paySubscriptionInvoiceFromWallet pays an open invoice in full from the
+// farmer's wallet. The debit is referenced by invoice, so it is paid once.
+func paySubscriptionInvoiceFromWallet(ctx context.Context, inv models.SubscriptionInvoice) (models.SubscriptionInvoice, error) {
+	now := time.Now()
+	pay := models.Payment{
+		ID:                    primitive.NewObjectID(),
+		SubscriptionInvoiceID: &inv.ID,
+		UserID:                inv.UserID,
+		Method:                "Wallet",
+		Provider:              models.WalletProvider,
+		ProviderOrderID:       "wallet_" + inv.ID.Hex(),
+		Amount:                inv.Amount,
+		Currency:              "INR",
+		Status:                models.PaymentStatusCaptured,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+	}
+
+	var paid models.SubscriptionInvoice
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		entry, err := debitWallet(ctx, inv.UserID, inv.Amount, models.WalletSourceSubscription,
+			"subscription:"+inv.ID.Hex(), fmt.Sprintf("Subscription %s invoice", inv.Kind))
+		if err != nil {
+			return err
+		}
+		pay.ProviderPaymentID = entry.ID.Hex()
+
+		undo := func() {
+			if database.InTransaction(ctx) {
+				return // aborting the transaction undoes the debit
+			}
+			if _, err := creditWallet(ctx, inv.UserID, inv.Amount, models.WalletSourceSubscription,
+				"reversal:"+entry.ID.Hex(), "Payment reversed"); err != nil {
+				log.Printf("⚠️ Failed to reverse wallet debit %s: %v", entry.ID.Hex(), err)
+			}
+		}
+
+		if _, err := database.PaymentCollection.InsertOne(ctx, pay); err != nil {
+			undo()
+			return err
+		}
+		paid, err = settleSubscriptionInvoice(ctx, inv.ID, &pay.ID)
+		if err != nil {
+			undo()
+			if !database.InTransaction(ctx) {
+				database.PaymentCollection.DeleteOne(ctx, bson.M{"_id": pay.ID})
+			}
+		}
+		return err
+	})
+	if err != nil {
+		recordSubscriptionAttempt(ctx, inv.ID, err.Error())
+		return inv, err
+	}
+	return paid, nil
+}
+
+// recordSubscriptionAttempt notes a failed attempt to pay an invoice; the
+// invoice stays open for the next one
+func recordSubscriptionAttempt(ctx context.Context, invoiceID primitive.ObjectID, reason string) {
+	_, err := database.GetCollection("subscription_invoices").UpdateOne(ctx,
+		bson.M{"_id": invoiceID, "status": models.SubscriptionInvoiceOpen},
+		bson.M{"$inc": bson.M{"attempts": 1}, "$set": bson.M{"last_error": reason}},
+	)
+	if err != nil {
+		log.Printf("⚠️ Failed to record payment attempt on subscription invoice %s: %v", invoiceID.Hex(), err)
+	}
+}
+
+// cancelSubscription ends a subscription now and voids its open invoices
+func cancelSubscription(ctx context.Context, subID primitive.ObjectID, reason string) error {
+	now := time.Now()
+	_, err := database.GetCollection("subscriptions").UpdateOne(ctx,
+		bson.M{"_id": subID, "status": bson.M{"$ne": models.SubscriptionCancelled}},
+		bson.M{"$set": bson.M{"status": models.SubscriptionCancelled, "cancelled_at": now, "modified_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = database.GetCollection("subscription_invoices").UpdateMany(ctx,
+		bson.M{"subscription_id": subID, "status": models.SubscriptionInvoiceOpen},
+		bson.M{"$set": bson.M{"status": models.SubscriptionInvoiceVoid, "last_error": reason}},
+	)
+	return err
+}
+
+// voidProrationInvoices voids the subscription's unpaid plan switches, which
+// lapse with the period they were raised for
+func voidProrationInvoices(ctx context.Context, subID primitive.ObjectID) error {
+	_, err := database.GetCollection("subscription_invoices").UpdateMany(ctx,
+		bson.M{"subscription_id": subID, "kind": models.SubscriptionInvoiceProration, "status": models.SubscriptionInvoiceOpen},
+		bson.M{"$set": bson.M{"status": models.SubscriptionInvoiceVoid, "last_error": "Period ended before the switch was paid"}},
+	)
+	return err
+}
+
+// openInvoiceFor returns the subscription's open invoice of the given kind
+func openInvoiceFor(ctx context.Context, subID primitive.ObjectID, kind string) (models.SubscriptionInvoice, error) {
+	var inv models.SubscriptionInvoice
+	err := database.GetCollection("subscription_invoices").FindOne(ctx, bson.M{
+		"subscription_id": subID,
+		"kind":            kind,
+		"status":          models.SubscriptionInvoiceOpen,
+	}, options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&inv)
+	return inv, err
+}
+
+// renewSubscription bills the next period of a subscription whose period has
+// ended, on the cheaper plan if the farmer switched to one. A renewal the
+// wallet cannot cover leaves the subscription past due for the plan's grace
+// period, during which the farmer can pay it through the gateway.
+func renewSubscription(ctx context.Context, sub models.Subscription, now time.Time) error {
+	if sub.CancelAtPeriodEnd {
+		return cancelSubscription(ctx, sub.ID, "Cancelled at period end")
+	}
+	if err := voidProrationInvoices(ctx, sub.ID); err != nil {
+		return err
+	}
+	planID := sub.PlanID
+	if sub.PendingPlanID != nil {
+		planID = *sub.PendingPlanID
+	}
+	plan, err := subscriptionPlan(ctx, planID)
+	if err != nil {
+		return err
+	}
+
+	start := sub.CurrentPeriodEnd
+	inv, err := openSubscriptionInvoice(ctx, sub, plan.ID, models.SubscriptionInvoiceRenewal,
+		plan.Price, start, models.PeriodEnd(start, plan.Interval))
+	if mongo.IsDuplicateKeyError(err) {
+		// Raised by an earlier run that stopped before charging it
+		inv, err = openInvoiceFor(ctx, sub.ID, models.SubscriptionInvoiceRenewal)
+	}
+	if err != nil || inv.Status != models.SubscriptionInvoiceOpen {
+		return err
+	}
+
+	if _, err := paySubscriptionInvoiceFromWallet(ctx, inv); err == nil {
+		return nil
+	} else if !errors.Is(err, errInsufficientWalletBalance) {
+		log.Printf("⚠️ Wallet charge for subscription invoice %s failed: %v", inv.ID.Hex(), err)
+	}
+
+	graceUntil := start.Add(plan.GracePeriod())
+	_, err = database.GetCollection("subscriptions").UpdateOne(ctx,
+		bson.M{"_id": sub.ID, "status": models.SubscriptionActive},
+		bson.M{"$set": bson.M{"status": models.SubscriptionPastDue, "grace_until": graceUntil, "modified_at": now}},
+	)
+	return err
+}
+
+// retryPastDue charges a past-due renewal from the wallet again, and cancels
+// the subscription once its grace period is over
+func retryPastDue(ctx context.Context, sub models.Subscription, now time.Time) error {
+	inv, err := openInvoiceFor(ctx, sub.ID, models.SubscriptionInvoiceRenewal)
+	if err == nil {
+		if _, err := paySubscriptionInvoiceFromWallet(ctx, inv); err == nil {
+			return nil
+		}
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+	if sub.GraceUntil != nil && now.After(*sub.GraceUntil) {
+		return cancelSubscription(ctx, sub.ID, "Renewal not paid within the grace period")
+	}
+	return nil
+}
+
+// renewSubscriptions runs one pass of the renewal job
+func renewSubscriptions(ctx context.Context) error {
+	now := time.Now()
+	subs := database.GetCollection("subscriptions")
+
+	run := func(filter bson.M, fn func(context.Context, models.Subscription, time.Time) error) error {
+		cursor, err := subs.Find(ctx, filter)
+		if err != nil {
+			return err
+		}
+		var due []models.Subscription
+		if err := cursor.All(ctx, &due); err != nil {
+			return err
+		}
+		for _, sub := range due {
+			if err := fn(ctx, sub, now); err != nil {
+				log.Printf("⚠️ Subscription %s not renewed: %v", sub.ID.Hex(), err)
+			}
+		}
+		return nil
+	}
+
+	if err := run(bson.M{"status": models.SubscriptionActive, "current_period_end": bson.M{"$lte": now}}, renewSubscription); err != nil {
+		return err
+	}
+	if err := run(bson.M{"status": models.SubscriptionPastDue}, retryPastDue); err != nil {
+		return err
+	}
+	// Sign-ups nobody paid for within a day are dropped
+	return run(bson.M{"status": models.SubscriptionIncomplete, "created_at": bson.M{"$lte": now.Add(-24 * time.Hour)}},
+		func(ctx context.Context, sub models.Subscription, _ time.Time) error {
+			return cancelSubscription(ctx, sub.ID, "Sign-up not paid")
+		})
+}
+
+// RunSubscriptionRenewalJob renews subscriptions every interval until ctx is done
+func RunSubscriptionRenewalJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		if err := renewSubscriptions(runCtx); err != nil {
+			log.Printf("⚠️ Subscription renewal run failed: %v", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 	"time"
 
@@ -38,21 +39,50 @@ func SubmitSupportTicket(c *gin.Context) {
 		return
 	}
 
+	// Plans with priority support get their tickets handled first
+	priority := "normal"
+	grant, err := useEntitlement(c, userID, models.EntitlementPrioritySupport, 1)
+	unchecked := err != nil
+	if unchecked {
+		log.Printf("⚠️ Priority support entitlement not checked for user %s: %v", userID.Hex(), err)
+	}
+	if grant != nil {
+		priority = "high"
+	}
+	submitted := false
+	defer func() {
+		if submitted {
+			return
+		}
+		if rerr := releaseEntitlement(c, grant); rerr != nil {
+			log.Printf("⚠️ Failed to give back priority support entitlement to user %s: %v", userID.Hex(), rerr)
+		}
+	}()
+
 	ticket := bson.M{
 		"userId":    userID,
 		"subject":   input.Subject,
 		"message":   input.Message,
 		"status":    "open",
+		"priority":  priority,
 		"createdAt": time.Now().Unix(),
 	}
+	if grant != nil {
+		ticket["entitlement"] = grant
+	}
+	if unchecked {
+		// Still taken, but flagged so support can check the farmer's plan by hand
+		ticket["entitlement_unchecked"] = true
+	}
 
-	_, err := supportCollection.InsertOne(c, ticket)
+	_, err = supportCollection.InsertOne(c, ticket)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit ticket"})
 		return
 	}
+	submitted = true
 
-	c.JSON(http.StatusOK, gin.H{"message": "Support ticket submitted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Support ticket submitted successfully", "priority": priority})
 }
 
 
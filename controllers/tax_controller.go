@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// placeOfSupply is the buyer's state from their profile, used to decide
+// between CGST+SGST and IGST. Empty means unknown, which is taxed as local.
+func placeOfSupply(ctx context.Context, userID primitive.ObjectID) string {
+	var user models.User
+	if err := database.GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return ""
+	}
+	return models.GSTStateCode(user.State)
+}
+
+// PUT /admin/products/:id/tax
+func UpdateProductTax(c *gin.Context) {
+	productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var input models.ProductTaxInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidGSTRate(input.GSTRate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "GST rate must be one of the slabs", "slabs": models.GSTSlabs})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := database.GetCollection("products").UpdateOne(ctx,
+		bson.M{"_id": productID},
+		bson.M{"$set": bson.M{"hsn_code": input.HSNCode, "gst_rate": input.GSTRate}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product tax"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product tax updated", "hsn_code": input.HSNCode, "gst_rate": input.GSTRate})
+}
@@ -64,6 +64,7 @@ func UpdateUserProfile(c *gin.Context) {
 		Name       string `json:"name"`
 		Phone      string `json:"phone"`
 		ProfilePic string `json:"profile_pic"`
+		State      string `json:"state"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -81,6 +82,9 @@ func UpdateUserProfile(c *gin.Context) {
 	if input.ProfilePic != "" {
 		update["profile_pic"] = input.ProfilePic
 	}
+	if input.State != "" {
+		update["state"] = input.State
+	}
 
 	if len(update) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No update fields provided"})
@@ -90,6 +94,18 @@ func UpdateUserProfile(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if input.Phone != "" {
+		// A new number is not verified by OTP until the farmer logs in with it
+		_, err := userCollection.UpdateOne(ctx,
+			bson.M{"email": userEmail, "phone": bson.M{"$ne": input.Phone}},
+			bson.M{"$set": bson.M{"is_verified": false}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+	}
+
 	_, err := userCollection.UpdateOne(ctx, bson.M{"email": userEmail}, bson.M{"$set": update})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The wallet service: balances only change through creditWallet and
+// debitWallet, which write the statement entry, its double-entry posting and
+// the new balance together.
+
+var (
+	errInsufficientWalletBalance = errors.New("insufficient wallet balance")
+	errWalletEntryExists         = errors.New("wallet entry already applied")
+)
+
+// walletBalance returns the user's balance; no wallet yet means zero
+func walletBalance(ctx context.Context, userID primitive.ObjectID) (float64, error) {
+	var wallet models.Wallet
+	err := database.GetCollection("wallets").FindOne(ctx, bson.M{"_id": userID}).Decode(&wallet)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return wallet.Balance, err
+}
+
+// creditWallet adds amount to the user's wallet. A non-empty reference
+// (e.g. "refund:<id>") is applied at most once; a repeat returns
+// errWalletEntryExists.
+func creditWallet(ctx context.Context, userID primitive.ObjectID, amount float64, source, reference, reason string) (models.WalletTransaction, error) {
+	return moveWallet(ctx, userID, models.RoundAmount(amount), models.WalletCredit, source, reference, reason)
+}
+
+// debitWallet takes amount from the user's wallet, failing with
+// errInsufficientWalletBalance rather than going negative
+func debitWallet(ctx context.Context, userID primitive.ObjectID, amount float64, source, reference, reason string) (models.WalletTransaction, error) {
+	return moveWallet(ctx, userID, models.RoundAmount(amount), models.WalletDebit, source, reference, reason)
+}
+
+func moveWallet(ctx context.Context, userID primitive.ObjectID, amount float64, kind, source, reference, reason string) (models.WalletTransaction, error) {
+	var entry models.WalletTransaction
+	if amount <= 0 {
+		return entry, fmt.Errorf("wallet amount must be positive, got %.2f", amount)
+	}
+	delta := amount
+	if kind == models.WalletDebit {
+		delta = -amount
+	}
+
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		filter := bson.M{"_id": userID}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if kind == models.WalletDebit {
+			filter["balance"] = bson.M{"$gte": amount}
+		} else {
+			opts.SetUpsert(true)
+		}
+
+		var wallet models.Wallet
+		err := database.GetCollection("wallets").FindOneAndUpdate(ctx, filter,
+			bson.M{"$inc": bson.M{"balance": delta}, "$set": bson.M{"updated_at": time.Now()}},
+			opts,
+		).Decode(&wallet)
+		if err == mongo.ErrNoDocuments {
+			return errInsufficientWalletBalance
+		}
+		if err != nil {
+			return err
+		}
+
+		entry = models.WalletTransaction{
+			ID:           primitive.NewObjectID(),
+			UserID:       userID,
+			Amount:       amount,
+			Type:         kind,
+			Source:       source,
+			Reference:    reference,
+			Reason:       reason,
+			BalanceAfter: models.RoundAmount(wallet.Balance),
+			CreatedAt:    time.Now(),
+		}
+		_, err = database.WalletTransactionCollection.InsertOne(ctx, entry)
+		if err == nil {
+			if err = postLedger(ctx, walletLedgerEntry(entry)); err == nil {
+				return nil
+			}
+			if !database.InTransaction(ctx) {
+				database.WalletTransactionCollection.DeleteOne(ctx, bson.M{"_id": entry.ID})
+			}
+		}
+		if !database.InTransaction(ctx) {
+			// Without a transaction the balance has already moved; put it back
+			if _, rerr := database.GetCollection("wallets").UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$inc": bson.M{"balance": -delta}}); rerr != nil {
+				log.Printf("⚠️ Wallet of user %s is off by %.2f: %v", userID.Hex(), delta, rerr)
+			}
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return errWalletEntryExists
+		}
+		return err
+	})
+	return entry, err
+}
+
+// payOrderFromWallet pays a pending order in full from the farmer's wallet:
+// the debit, the captured payment and the order moving to paid are written
+// together. The debit is referenced by order, so an order is paid once.
+func payOrderFromWallet(ctx context.Context, order models.Order) (models.Payment, error) {
+	now := time.Now()
+	pay := models.Payment{
+		ID:              primitive.NewObjectID(),
+		OrderID:         order.ID,
+		UserID:          order.UserID,
+		Method:          "Wallet",
+		Provider:        models.WalletProvider,
+		ProviderOrderID: "wallet_" + order.ID.Hex(),
+		Amount:          order.TotalAmount,
+		Currency:        "INR",
+		Status:          models.PaymentStatusCaptured,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		entry, err := debitWallet(ctx, order.UserID, order.TotalAmount, models.WalletSourceOrder,
+			"order:"+order.ID.Hex(), fmt.Sprintf("Payment for order %s", order.ID.Hex()))
+		if err != nil {
+			return err
+		}
+		pay.ProviderPaymentID = entry.ID.Hex()
+
+		undo := func() {
+			if database.InTransaction(ctx) {
+				return // aborting the transaction undoes the debit
+			}
+			if _, err := creditWallet(ctx, order.UserID, order.TotalAmount, models.WalletSourceOrder,
+				"reversal:"+entry.ID.Hex(), "Payment reversed"); err != nil {
+				log.Printf("⚠️ Failed to reverse wallet debit %s: %v", entry.ID.Hex(), err)
+			}
+		}
+
+		if _, err := database.PaymentCollection.InsertOne(ctx, pay); err != nil {
+			undo()
+			return err
+		}
+		err = transitionOrderFrom(ctx, order.ID, []string{models.OrderStatusPending}, models.OrderStatusPaid, "Paid from wallet", "", bson.M{
+			"payment_status": "success",
+			"payment_id":     pay.ID,
+		})
+		if err != nil {
+			undo()
+			if !database.InTransaction(ctx) {
+				database.PaymentCollection.DeleteOne(ctx, bson.M{"_id": pay.ID})
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	// The invoice can be issued again on download, so a failure here is not fatal
+	if err := issueInvoiceForOrder(ctx, order.ID); err != nil {
+		log.Printf("⚠️ Failed to issue invoice for order %s: %v", order.ID.Hex(), err)
+	}
+	onOrderPaid(ctx, order.UserID, order.ID, order.TotalAmount)
+	return pay, nil
+}
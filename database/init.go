@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -44,6 +45,263 @@ func InitDatabase() {
 	} else {
 		fmt.Println("✅ KYC phone unique index created")
 	}
+
+	// Inventory: one stock row per product per warehouse
+	warehouseCol := db.Collection("warehouses")
+	if _, err := warehouseCol.Indexes().CreateOne(ctx, mongoIndex("code", true)); err != nil {
+		log.Printf("⚠️ Warehouse code index not created: %v", err)
+	}
+
+	inventoryCol := db.Collection("inventory")
+	unique := true
+	inventoryIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "product_id", Value: 1}, {Key: "warehouse_id", Value: 1}},
+		Options: &options.IndexOptions{Unique: &unique},
+	}
+	if _, err := inventoryCol.Indexes().CreateOne(ctx, inventoryIndex); err != nil {
+		log.Printf("⚠️ Inventory product/warehouse index not created: %v", err)
+	} else {
+		fmt.Println("✅ Inventory product/warehouse unique index created")
+	}
+
+	// Payment webhooks: each provider event is processed once
+	webhookCol := db.Collection("payment_webhook_events")
+	webhookIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "event_id", Value: 1}},
+		Options: &options.IndexOptions{Unique: &unique},
+	}
+	if _, err := webhookCol.Indexes().CreateOne(ctx, webhookIndex); err != nil {
+		log.Printf("⚠️ Payment webhook event index not created: %v", err)
+	}
+
+	// EMI: one plan per order, one set of terms per category (and one default)
+	if _, err := db.Collection("emi_plans").Indexes().CreateOne(ctx, mongoIndex("order_id", true)); err != nil {
+		log.Printf("⚠️ EMI plan order index not created: %v", err)
+	}
+	if _, err := db.Collection("emi_configs").Indexes().CreateOne(ctx, mongoIndex("category_id", true)); err != nil {
+		log.Printf("⚠️ EMI config category index not created: %v", err)
+	}
+
+	// Invoices: one per order, numbers unique within the series. An order's
+	// invoice is claimed before it is numbered, so only issued numbers are
+	// indexed; the older index over every invoice is replaced.
+	invoiceCol := db.Collection("invoices")
+	if _, err := invoiceCol.Indexes().CreateOne(ctx, mongoIndex("order_id", true)); err != nil {
+		log.Printf("⚠️ Invoice order_id index not created: %v", err)
+	}
+	invoiceCol.Indexes().DropOne(ctx, "invoice_number_1")
+	invoiceNumberIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "invoice_number", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("invoice_number_issued").
+			SetPartialFilterExpression(bson.M{"invoice_number": bson.M{"$type": "string"}}),
+	}
+	if _, err := invoiceCol.Indexes().CreateOne(ctx, invoiceNumberIndex); err != nil {
+		log.Printf("⚠️ Invoice invoice_number index not created: %v", err)
+	}
+
+	// Delivery tracking: one shipment per order, pings looked up per shipment
+	shipmentCol := db.Collection("shipments")
+	if _, err := shipmentCol.Indexes().CreateOne(ctx, mongoIndex("order_id", true)); err != nil {
+		log.Printf("⚠️ Shipment order index not created: %v", err)
+	}
+	if _, err := shipmentCol.Indexes().CreateOne(ctx, mongoIndex("agent_id", false)); err != nil {
+		log.Printf("⚠️ Shipment agent index not created: %v", err)
+	}
+	if _, err := db.Collection("shipment_locations").Indexes().CreateOne(ctx, mongoIndex("shipment_id", false)); err != nil {
+		log.Printf("⚠️ Shipment location index not created: %v", err)
+	}
+
+	// Coupons: codes are unique; redemptions are counted per coupon and farmer
+	if _, err := db.Collection("coupons").Indexes().CreateOne(ctx, mongoIndex("code", true)); err != nil {
+		log.Printf("⚠️ Coupon code index not created: %v", err)
+	}
+	redemptionIndex := mongo.IndexModel{Keys: bson.D{{Key: "coupon_id", Value: 1}, {Key: "user_id", Value: 1}}}
+	if _, err := db.Collection("coupon_redemptions").Indexes().CreateOne(ctx, redemptionIndex); err != nil {
+		log.Printf("⚠️ Coupon redemption index not created: %v", err)
+	}
+	if _, err := db.Collection("coupon_redemptions").Indexes().CreateOne(ctx, mongoIndex("order_id", true)); err != nil {
+		log.Printf("⚠️ Coupon redemption order index not created: %v", err)
+	}
+
+	// Cart: one line per product per user, so concurrent adds sum up
+	cartIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "product_id", Value: 1}},
+		Options: &options.IndexOptions{Unique: &unique},
+	}
+	if _, err := db.Collection("cart").Indexes().CreateOne(ctx, cartIndex); err != nil {
+		log.Printf("⚠️ Cart user/product index not created: %v", err)
+	}
+
+	// Guest carts: looked up by device token, dropped GuestCartTTL after their last change
+	guestCartCol := db.Collection("guest_carts")
+	guestCartIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "token", Value: 1}, {Key: "product_id", Value: 1}},
+		Options: &options.IndexOptions{Unique: &unique},
+	}
+	if _, err := guestCartCol.Indexes().CreateOne(ctx, guestCartIndex); err != nil {
+		log.Printf("⚠️ Guest cart token index not created: %v", err)
+	}
+	guestCartTTL := mongo.IndexModel{
+		Keys:    bson.D{{Key: "updated_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(models.GuestCartTTL.Seconds())),
+	}
+	if _, err := guestCartCol.Indexes().CreateOne(ctx, guestCartTTL); err != nil {
+		log.Printf("⚠️ Guest cart expiry index not created: %v", err)
+	}
+
+	reservationCol := db.Collection("stock_reservations")
+	if _, err := reservationCol.Indexes().CreateOne(ctx, mongoIndex("order_id", false)); err != nil {
+		log.Printf("⚠️ Stock reservation order index not created: %v", err)
+	}
+
+	refundCol := db.Collection("refunds")
+	if _, err := refundCol.Indexes().CreateOne(ctx, mongoIndex("order_id", false)); err != nil {
+		log.Printf("⚠️ Refund order index not created: %v", err)
+	}
+	if _, err := refundCol.Indexes().CreateOne(ctx, mongoIndex("provider_refund_id", false)); err != nil {
+		log.Printf("⚠️ Refund provider ID index not created: %v", err)
+	}
+
+	// Wallet ledger: statements are read newest first, and an entry with a
+	// reference (e.g. refund:<id>) can only be applied once
+	walletTxCol := db.Collection("wallet_transactions")
+	walletStatementIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	}
+	if _, err := walletTxCol.Indexes().CreateOne(ctx, walletStatementIndex); err != nil {
+		log.Printf("⚠️ Wallet statement index not created: %v", err)
+	}
+	walletReferenceIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "type", Value: 1}, {Key: "reference", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"reference": bson.M{"$type": "string"}}),
+	}
+	if _, err := walletTxCol.Indexes().CreateOne(ctx, walletReferenceIndex); err != nil {
+		log.Printf("⚠️ Wallet reference index not created: %v", err)
+	}
+
+	// Ledger: each business event is posted once, and entries are looked up
+	// per farmer account
+	ledgerCol := db.Collection("ledger_entries")
+	ledgerEventIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "reference", Value: 1}},
+		Options: &options.IndexOptions{Unique: &unique},
+	}
+	if _, err := ledgerCol.Indexes().CreateOne(ctx, ledgerEventIndex); err != nil {
+		log.Printf("⚠️ Ledger event index not created: %v", err)
+	}
+	ledgerAccountIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "postings.user_id", Value: 1}, {Key: "postings.account", Value: 1}, {Key: "created_at", Value: -1}},
+	}
+	if _, err := ledgerCol.Indexes().CreateOne(ctx, ledgerAccountIndex); err != nil {
+		log.Printf("⚠️ Ledger account index not created: %v", err)
+	}
+
+	// Referrals: one code per farmer, and a farmer is referred at most once
+	for _, field := range []string{"code", "user_id"} {
+		if _, err := db.Collection("referrals").Indexes().CreateOne(ctx, mongoIndex(field, true)); err != nil {
+			log.Printf("⚠️ Referral %s index not created: %v", field, err)
+		}
+	}
+	referralUsesCol := db.Collection("referral_uses")
+	if _, err := referralUsesCol.Indexes().CreateOne(ctx, mongoIndex("user_id", true)); err != nil {
+		log.Printf("⚠️ Referral use index not created: %v", err)
+	}
+	for _, field := range []string{"referrer_id", "device_id"} {
+		if _, err := referralUsesCol.Indexes().CreateOne(ctx, mongoIndex(field, false)); err != nil {
+			log.Printf("⚠️ Referral use %s index not created: %v", field, err)
+		}
+	}
+	// ...and a phone number is referred at most once
+	referralPhoneIndex := mongoIndex("phone", true)
+	referralPhoneIndex.Options.SetPartialFilterExpression(bson.M{"phone": bson.M{"$exists": true}})
+	if _, err := referralUsesCol.Indexes().CreateOne(ctx, referralPhoneIndex); err != nil {
+		log.Printf("⚠️ Referral use phone index not created: %v", err)
+	}
+
+	// Coin earnings: each subject earns once, and the expiry job scans by date
+	coinEarningsCol := db.Collection("coin_earnings")
+	coinEarningIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "event", Value: 1}, {Key: "subject", Value: 1}},
+		Options: &options.IndexOptions{Unique: &unique},
+	}
+	if _, err := coinEarningsCol.Indexes().CreateOne(ctx, coinEarningIndex); err != nil {
+		log.Printf("⚠️ Coin earning index not created: %v", err)
+	}
+	coinExpiryIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+	}
+	if _, err := coinEarningsCol.Indexes().CreateOne(ctx, coinExpiryIndex); err != nil {
+		log.Printf("⚠️ Coin expiry index not created: %v", err)
+	}
+
+	// Reward redemptions: listed per farmer and by status for fulfilment;
+	// voucher codes are never handed out twice
+	redemptionsCol := db.Collection("reward_redemptions")
+	for _, field := range []string{"user_id", "status"} {
+		if _, err := redemptionsCol.Indexes().CreateOne(ctx, mongoIndex(field, false)); err != nil {
+			log.Printf("⚠️ Reward redemption %s index not created: %v", field, err)
+		}
+	}
+	voucherIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "voucher_code", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"voucher_code": bson.M{"$type": "string"}}),
+	}
+	if _, err := redemptionsCol.Indexes().CreateOne(ctx, voucherIndex); err != nil {
+		log.Printf("⚠️ Voucher code index not created: %v", err)
+	}
+
+	// Subscriptions: looked up per farmer, and the renewal job scans by status
+	// and period end. Each period is invoiced for renewal once.
+	subscriptionsCol := db.Collection("subscriptions")
+	subscriptionIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "current_period_end", Value: 1}}},
+	}
+	if _, err := subscriptionsCol.Indexes().CreateMany(ctx, subscriptionIndexes); err != nil {
+		log.Printf("⚠️ Subscription indexes not created: %v", err)
+	}
+	subscriptionInvoicesCol := db.Collection("subscription_invoices")
+	for _, field := range []string{"subscription_id", "user_id"} {
+		if _, err := subscriptionInvoicesCol.Indexes().CreateOne(ctx, mongoIndex(field, false)); err != nil {
+			log.Printf("⚠️ Subscription invoice %s index not created: %v", field, err)
+		}
+	}
+	renewalIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "period_start", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"kind": models.SubscriptionInvoiceRenewal}),
+	}
+	if _, err := subscriptionInvoicesCol.Indexes().CreateOne(ctx, renewalIndex); err != nil {
+		log.Printf("⚠️ Subscription renewal index not created: %v", err)
+	}
+
+	// Returns and refund requests: listed per farmer and per order
+	for _, name := range []string{"return_requests", "refund_requests"} {
+		for _, field := range []string{"user_id", "order_id"} {
+			if _, err := db.Collection(name).Indexes().CreateOne(ctx, mongoIndex(field, false)); err != nil {
+				log.Printf("⚠️ %s %s index not created: %v", name, field, err)
+			}
+		}
+	}
+
+	// Idempotency keys: one per caller, dropped once the replay window is over
+	idempotencyCol := db.Collection("idempotency_keys")
+	idempotencyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "key", Value: 1}},
+		Options: &options.IndexOptions{Unique: &unique},
+	}
+	if _, err := idempotencyCol.Indexes().CreateOne(ctx, idempotencyIndex); err != nil {
+		log.Printf("⚠️ Idempotency key index not created: %v", err)
+	}
+	idempotencyTTL := mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(models.IdempotencyWindow.Seconds())),
+	}
+	if _, err := idempotencyCol.Indexes().CreateOne(ctx, idempotencyTTL); err != nil {
+		log.Printf("⚠️ Idempotency key expiry index not created: %v", err)
+	}
 }
 
 // mongoIndex is a helper to define a MongoDB index
@@ -4,10 +4,15 @@ package database
 import (
 	"context"
 	"log"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -57,4 +62,424 @@ func RunMigrations() {
 	} else {
 		log.Printf("✅ Updated %d orders with default status", res2.ModifiedCount)
 	}
+
+	// 🚀 Migration 4: Start a status timeline for orders placed before it existed
+	res3, err := orderCol.UpdateMany(ctx, bson.M{"status_history": bson.M{"$exists": false}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"status_history": bson.A{bson.M{
+			"status":     "$status",
+			"note":       "Migrated",
+			"changed_at": "$created_at",
+		}}}}},
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to backfill order status history: %v", err)
+	} else {
+		log.Printf("✅ Backfilled status history on %d orders", res3.ModifiedCount)
+	}
+
+	// 🚀 Migration 5: Fold the old "carts" collection into "cart", adding up
+	// quantities for products that were in both
+	mergeLegacyCarts(ctx, db)
+
+	// 🚀 Migration 6: Return and refund requests used to store created_at as
+	// Unix seconds and had no owner or history; bring them up to date
+	for _, name := range []string{"return_requests", "refund_requests"} {
+		col := db.Collection(name)
+		res, err := col.UpdateMany(ctx, bson.M{"created_at": bson.M{"$type": bson.A{"long", "int"}}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": bson.M{"$multiply": bson.A{"$created_at", 1000}}}}}},
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to convert %s timestamps: %v", name, err)
+			continue
+		}
+		if res.ModifiedCount > 0 {
+			log.Printf("✅ Converted timestamps on %d %s", res.ModifiedCount, name)
+		}
+
+		_, err = col.UpdateMany(ctx, bson.M{"history": bson.M{"$exists": false}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"history": bson.A{bson.M{
+				"status":     "$status",
+				"note":       "Migrated",
+				"changed_at": "$created_at",
+			}}}}},
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to backfill %s history: %v", name, err)
+		}
+
+		// Owner comes from the order the request is about
+		cursor, err := col.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"user_id": bson.M{"$exists": false}}}},
+			{{Key: "$lookup", Value: bson.M{"from": "orders", "localField": "order_id", "foreignField": "_id", "as": "order"}}},
+			{{Key: "$set", Value: bson.M{"user_id": bson.M{"$arrayElemAt": bson.A{"$order.user_id", 0}}}}},
+			{{Key: "$unset", Value: "order"}},
+			{{Key: "$merge", Value: bson.M{"into": name, "on": "_id", "whenMatched": "merge", "whenNotMatched": "discard"}}},
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to backfill %s owners: %v", name, err)
+			continue
+		}
+		cursor.Close(ctx)
+	}
+
+	// 🚀 Migration 7: Coins and wallet balances from before the ledger get an
+	// opening entry, so the ledger agrees with them from the start
+	openLedgerBalances(ctx, db, "coins", "user_id", "coins", models.AccountUserCoins, models.LedgerCurrencyCoin, models.AccountCoinPool)
+	openLedgerBalances(ctx, db, "wallets", "_id", "balance", models.AccountUserWallet, models.LedgerCurrencyINR, models.AccountPlatformRevenue)
+
+	// 🚀 Migration 8: Referral uses were stored without the referrer or a
+	// status; look the referrer up by code and leave them pending at the
+	// default rewards
+	cursor, err := db.Collection("referral_uses").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$exists": false}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "referrals", "localField": "referral_code", "foreignField": "code", "as": "referral"}}},
+		{{Key: "$set", Value: bson.M{
+			"referrer_id":    bson.M{"$arrayElemAt": bson.A{"$referral.user_id", 0}},
+			"status":         models.ReferralPending,
+			"referrer_coins": models.DefaultReferrerCoins,
+			"referee_coins":  models.DefaultRefereeCoins,
+		}}},
+		{{Key: "$unset", Value: "referral"}},
+		{{Key: "$merge", Value: bson.M{"into": "referral_uses", "on": "_id", "whenMatched": "merge", "whenNotMatched": "discard"}}},
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to backfill referral uses: %v", err)
+	} else {
+		cursor.Close(ctx)
+	}
+
+	// 🚀 Migration 9: Rewards from before the admin catalogue stay on offer as
+	// physical rewards with unlimited stock, and their redemptions join the
+	// fulfilment queue
+	if _, err := db.Collection("rewards").UpdateMany(ctx,
+		bson.M{"active": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"active": true, "type": models.RewardPhysical}},
+	); err != nil {
+		log.Printf("⚠️ Failed to backfill rewards: %v", err)
+	}
+	cursor, err = db.Collection("reward_redemptions").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$exists": false}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "rewards", "localField": "reward_id", "foreignField": "_id", "as": "reward"}}},
+		{{Key: "$set", Value: bson.M{
+			"reward_name": bson.M{"$arrayElemAt": bson.A{"$reward.name", 0}},
+			"reward_type": models.RewardPhysical,
+			"cost":        bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$reward.cost", 0}}, 0}},
+			"status":      models.RedemptionRequested,
+			"history": bson.A{bson.M{
+				"status":     models.RedemptionRequested,
+				"note":       "Migrated",
+				"changed_at": "$redeemed_at",
+			}},
+		}}},
+		{{Key: "$unset", Value: "reward"}},
+		{{Key: "$merge", Value: bson.M{"into": "reward_redemptions", "on": "_id", "whenMatched": "merge", "whenNotMatched": "discard"}}},
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to backfill reward redemptions: %v", err)
+	} else {
+		cursor.Close(ctx)
+	}
+
+	// 🚀 Migration 10: Products listed before warehouse stock was tracked get
+	// their opening stock in the default warehouse. Until OPENING_STOCK is set
+	// they are left untracked and sell on their in_stock flag as before.
+	if n, err := strconv.Atoi(os.Getenv("OPENING_STOCK")); err == nil && n > 0 {
+		openInventory(ctx, db, n)
+	}
+
+	// 🚀 Migration 11: Orders refunded before refunded_total was kept on the
+	// order get it from their refunds, failed ones included since they are
+	// still to be retried
+	cursor, err = db.Collection("refunds").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"unapplied": bson.M{"$ne": true}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$order_id", "refunded_total": bson.M{"$sum": "$amount"}}}},
+		{{Key: "$merge", Value: bson.M{
+			"into": "orders",
+			"on":   "_id",
+			"whenMatched": bson.A{bson.M{"$set": bson.M{
+				"refunded_total": bson.M{"$ifNull": bson.A{"$refunded_total", "$$new.refunded_total"}},
+			}}},
+			"whenNotMatched": "discard",
+		}}},
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to backfill order refund totals: %v", err)
+	} else {
+		cursor.Close(ctx)
+	}
+	// 🚀 Migration 12: Manual credits from before the wallet ledger were kept
+	// in wallet_transactions with the user ID as a string and no balance.
+	// They are added to each farmer's wallet and posted to the ledger.
+	migrateLegacyWalletTransactions(ctx, db)
+}
+
+// legacyWalletTransaction is a wallet_transactions row written before the
+// wallet ledger, with the farmer's ID stored as a hex string
+type legacyWalletTransaction struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    string             `bson:"user_id"`
+	Amount    float64            `bson:"amount"`
+	Type      string             `bson:"type"`
+	Reason    string             `bson:"reason"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// migrateLegacyWalletTransactions moves the legacy rows of each farmer onto
+// the wallet ledger in one transaction. A row is converted only while its
+// user ID is still a string, so running it again changes nothing.
+func migrateLegacyWalletTransactions(ctx context.Context, db *mongo.Database) {
+	walletTx := db.Collection("wallet_transactions")
+	cursor, err := walletTx.Find(ctx, bson.M{"user_id": bson.M{"$type": "string"}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		log.Printf("⚠️ Failed to read legacy wallet transactions: %v", err)
+		return
+	}
+	var rows []legacyWalletTransaction
+	if err := cursor.All(ctx, &rows); err != nil {
+		log.Printf("⚠️ Failed to read legacy wallet transactions: %v", err)
+		return
+	}
+
+	byUser := map[primitive.ObjectID][]legacyWalletTransaction{}
+	var users []primitive.ObjectID
+	for _, row := range rows {
+		userID, err := primitive.ObjectIDFromHex(row.UserID)
+		if err != nil {
+			log.Printf("⚠️ Legacy wallet transaction %s has an invalid user ID %q", row.ID.Hex(), row.UserID)
+			continue
+		}
+		if _, seen := byUser[userID]; !seen {
+			users = append(users, userID)
+		}
+		byUser[userID] = append(byUser[userID], row)
+	}
+
+	migrated := 0
+	for _, userID := range users {
+		err := WithTransaction(ctx, func(ctx context.Context) error {
+			return migrateLegacyWallet(ctx, db, userID, byUser[userID])
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to migrate legacy wallet of user %s: %v", userID.Hex(), err)
+			continue
+		}
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("✅ Moved legacy wallet credits of %d users onto the wallet ledger", migrated)
+	}
+}
+
+// migrateLegacyWallet converts one farmer's legacy rows into wallet ledger
+// entries and adds their sum to the wallet balance
+func migrateLegacyWallet(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, rows []legacyWalletTransaction) error {
+	var wallet models.Wallet
+	err := db.Collection("wallets").FindOne(ctx, bson.M{"_id": userID}).Decode(&wallet)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	balance := wallet.Balance
+	var entries []interface{}
+	for _, row := range rows {
+		amount := models.RoundAmount(row.Amount)
+		kind, delta := models.WalletCredit, amount
+		debit := models.PlatformAccount(models.AccountPlatformRevenue)
+		credit := models.UserAccount(models.AccountUserWallet, userID)
+		if row.Type == models.WalletDebit {
+			kind, delta = models.WalletDebit, -amount
+			debit, credit = credit, debit
+		}
+
+		res, err := db.Collection("wallet_transactions").UpdateOne(ctx,
+			bson.M{"_id": row.ID, "user_id": row.UserID},
+			bson.M{"$set": bson.M{
+				"user_id":       userID,
+				"type":          kind,
+				"source":        models.WalletSourceManual,
+				"reference":     "legacy:" + row.ID.Hex(),
+				"balance_after": models.RoundAmount(balance + delta),
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			continue // converted by another run
+		}
+		balance = models.RoundAmount(balance + delta)
+		entries = append(entries, models.NewLedgerEntry(models.LedgerKindWallet, "wallet:"+row.ID.Hex(), models.LedgerCurrencyINR,
+			amount, debit, credit, row.Reason))
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if _, err := db.Collection("wallets").UpdateOne(ctx, bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"balance": models.RoundAmount(balance - wallet.Balance)}, "$set": bson.M{"updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return err
+	}
+	_, err = db.Collection("ledger_entries").InsertMany(ctx, entries)
+	return err
+}
+
+// openInventory gives every in-stock product without an inventory row
+// openingStock units in the default warehouse, creating it if need be
+func openInventory(ctx context.Context, db *mongo.Database, openingStock int) {
+	code := os.Getenv("DEFAULT_WAREHOUSE_CODE")
+	if code == "" {
+		code = "MAIN"
+	}
+	var warehouse models.Warehouse
+	err := db.Collection("warehouses").FindOneAndUpdate(ctx,
+		bson.M{"code": code},
+		bson.M{"$setOnInsert": bson.M{"name": "Main warehouse", "created_at": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&warehouse)
+	if err != nil {
+		log.Printf("⚠️ Failed to find or create warehouse %s: %v", code, err)
+		return
+	}
+
+	cursor, err := db.Collection("products").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"in_stock": true}}},
+		{{Key: "$lookup", Value: bson.M{"from": "inventory", "localField": "_id", "foreignField": "product_id", "as": "stock"}}},
+		{{Key: "$match", Value: bson.M{"stock": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to find products without inventory: %v", err)
+		return
+	}
+	var products []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &products); err != nil {
+		log.Printf("⚠️ Failed to decode products without inventory: %v", err)
+		return
+	}
+
+	inventory := db.Collection("inventory")
+	opened := 0
+	for _, p := range products {
+		now := time.Now()
+		_, err := inventory.InsertOne(ctx, models.InventoryItem{
+			ProductID:   p.ID,
+			WarehouseID: warehouse.ID,
+			OnHand:      openingStock,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			if !mongo.IsDuplicateKeyError(err) {
+				log.Printf("⚠️ Failed to open inventory of product %s: %v", p.ID.Hex(), err)
+			}
+			continue
+		}
+		db.Collection("stock_movements").InsertOne(ctx, models.StockMovement{
+			ProductID:   p.ID,
+			WarehouseID: warehouse.ID,
+			Type:        models.StockMovementReceipt,
+			Quantity:    openingStock,
+			Reason:      "Opening stock",
+			CreatedAt:   now,
+		})
+		opened++
+	}
+	if opened > 0 {
+		log.Printf("✅ Opened inventory for %d products in warehouse %s", opened, code)
+	}
+}
+
+// openLedgerBalances posts an opening balance for each farmer in coll who
+// has a balance but nothing on the ledger account yet. Farmers who already
+// have postings are left alone, so running it again changes nothing.
+func openLedgerBalances(ctx context.Context, db *mongo.Database, coll, userField, balanceField, account, currency, counterpart string) {
+	cursor, err := db.Collection(coll).Find(ctx, bson.M{balanceField: bson.M{"$gt": 0}})
+	if err != nil {
+		log.Printf("⚠️ Failed to read %s for opening balances: %v", coll, err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	ledger := db.Collection("ledger_entries")
+	opened := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		userID, ok := doc[userField].(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		var balance float64
+		switch v := doc[balanceField].(type) {
+		case int32:
+			balance = float64(v)
+		case int64:
+			balance = float64(v)
+		case float64:
+			balance = v
+		}
+
+		n, err := ledger.CountDocuments(ctx, bson.M{"postings": bson.M{"$elemMatch": bson.M{"account": account, "user_id": userID}}})
+		if err != nil || n > 0 {
+			continue
+		}
+		entry := models.NewLedgerEntry(models.LedgerKindOpening, account+":"+userID.Hex(), currency, balance,
+			models.PlatformAccount(counterpart), models.UserAccount(account, userID), "Opening balance")
+		if _, err := ledger.InsertOne(ctx, entry); err != nil && !mongo.IsDuplicateKeyError(err) {
+			log.Printf("⚠️ Failed to open %s balance of user %s: %v", account, userID.Hex(), err)
+			continue
+		}
+		opened++
+	}
+	if opened > 0 {
+		log.Printf("✅ Opened %d %s balances on the ledger", opened, account)
+	}
+}
+
+// mergeLegacyCarts moves every line of the old "carts" collection into "cart"
+func mergeLegacyCarts(ctx context.Context, db *mongo.Database) {
+	legacyCarts := db.Collection("carts")
+	cursor, err := legacyCarts.Find(ctx, bson.M{})
+	if err != nil {
+		log.Printf("⚠️ Failed to read legacy carts: %v", err)
+		return
+	}
+	var legacy []struct {
+		ID        interface{} `bson:"_id"`
+		UserID    interface{} `bson:"user_id"`
+		ProductID interface{} `bson:"product_id"`
+		Quantity  int         `bson:"quantity"`
+		CreatedAt time.Time   `bson:"created_at"`
+	}
+	if err := cursor.All(ctx, &legacy); err != nil {
+		log.Printf("⚠️ Failed to decode legacy carts: %v", err)
+		return
+	}
+	cartCol := db.Collection("cart")
+	moved := 0
+	for _, item := range legacy {
+		_, err := cartCol.UpdateOne(ctx,
+			bson.M{"user_id": item.UserID, "product_id": item.ProductID},
+			bson.M{
+				"$inc":         bson.M{"quantity": item.Quantity},
+				"$setOnInsert": bson.M{"created_at": item.CreatedAt},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Printf("⚠️ Failed to move legacy cart item %v: %v", item.ID, err)
+			continue
+		}
+		legacyCarts.DeleteOne(ctx, bson.M{"_id": item.ID})
+		moved++
+	}
+	if moved > 0 {
+		log.Printf("✅ Moved %d legacy cart items into cart", moved)
+	}
 }
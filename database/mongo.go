@@ -17,6 +17,16 @@ var (
 	ContactCollection  *mongo.Collection
 	KYCCollection      *mongo.Collection
 	OrderCollection    *mongo.Collection
+	PaymentCollection  *mongo.Collection
+	InvoiceCollection  *mongo.Collection
+
+	RefundCollection            *mongo.Collection
+	WalletTransactionCollection *mongo.Collection
+	LedgerCollection            *mongo.Collection
+
+	MandiPriceCollection       *mongo.Collection
+	MandiAlertCollection       *mongo.Collection
+	TransportBookingCollection *mongo.Collection
 )
 
 // ConnectDB assigns MongoDB collections after config.DB is connected
@@ -34,6 +44,14 @@ func ConnectDB() {
 	ContactCollection = config.DB.Collection("contacts")
 	KYCCollection = config.DB.Collection("kyc_docs")
 	OrderCollection = config.DB.Collection("orders")
+	PaymentCollection = config.DB.Collection("payments")
+	InvoiceCollection = config.DB.Collection("invoices")
+	RefundCollection = config.DB.Collection("refunds")
+	WalletTransactionCollection = config.DB.Collection("wallet_transactions")
+	LedgerCollection = config.DB.Collection("ledger_entries")
+	MandiPriceCollection = config.DB.Collection("mandi_prices")
+	MandiAlertCollection = config.DB.Collection("mandi_alerts")
+	TransportBookingCollection = config.DB.Collection("transport_bookings")
 
 	log.Println("✅ MongoDB collections assigned.")
 }
@@ -56,5 +56,30 @@ func SeedDatabase() {
 	}
 	fmt.Println("✅ Districts seeded.")
 
-	// ✅ 3. Optional: Seed Configs or Initial Products (skip if already done)
+	// ✅ 3. Seed a default warehouse so stock can be received right away
+	warehouseCol := db.Collection("warehouses")
+	filter := bson.M{"code": "MAIN"}
+	update := bson.M{"$setOnInsert": bson.M{"code": "MAIN", "name": "Main Warehouse", "district": "Pune", "created_at": time.Now()}}
+	if _, err := warehouseCol.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		log.Printf("⚠️ Failed to seed default warehouse: %v", err)
+	} else {
+		fmt.Println("✅ Default warehouse seeded.")
+	}
+
+	// ✅ 4. Seed default EMI terms; admins can override them per category
+	emiCol := db.Collection("emi_configs")
+	filter = bson.M{"category_id": bson.M{"$exists": false}}
+	update = bson.M{"$setOnInsert": bson.M{
+		"tenures":          []int{3, 6, 9, 12},
+		"interest_rate":    12.5,
+		"min_order_amount": 5000.0,
+		"updated_at":       time.Now(),
+	}}
+	if _, err := emiCol.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		log.Printf("⚠️ Failed to seed default EMI terms: %v", err)
+	} else {
+		fmt.Println("✅ Default EMI terms seeded.")
+	}
+
+	// ✅ 5. Optional: Seed Configs or Initial Products (skip if already done)
 }
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// errCodeIllegalOperation is what a standalone server answers to a transaction
+const errCodeIllegalOperation = 20
+
+// transactionsUnsupported is set once the server has refused a transaction
+var transactionsUnsupported atomic.Bool
+
+// WithTransaction runs fn in a multi-document transaction. The driver
+// retries fn on transient errors (e.g. a write conflict with a concurrent
+// checkout) and retries the commit, so fn must be safe to run again.
+//
+// Called inside another transaction, fn simply joins it.
+//
+// A standalone mongod (a plain local dev setup) cannot run transactions;
+// there fn runs once without one and callers keep their own compensation
+// for that case (see InTransaction).
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !transactionsUnsupported.Load() && !InTransaction(ctx) {
+		session, err := config.DB.Client().StartSession()
+		if err != nil {
+			return err
+		}
+		defer session.EndSession(ctx)
+
+		opts := options.Transaction().
+			SetReadConcern(readconcern.Snapshot()).
+			SetWriteConcern(writeconcern.Majority())
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		}, opts)
+
+		var serverErr mongo.ServerError
+		if !errors.As(err, &serverErr) || !serverErr.HasErrorCode(errCodeIllegalOperation) {
+			return err
+		}
+		transactionsUnsupported.Store(true)
+		log.Println("⚠️ MongoDB is not a replica set; multi-document writes run without transactions")
+	}
+	return fn(ctx)
+}
+
+// InTransaction reports whether ctx belongs to a running transaction, in
+// which case a failed step is rolled back by aborting rather than by hand
+func InTransaction(ctx context.Context) bool {
+	return mongo.SessionFromContext(ctx) != nil
+}
@@ -0,0 +1,218 @@
+package invoice
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ashishnagargoje0/backend/models"
+)
+
+// SellerFromEnv reads the registered business details printed on every invoice
+func SellerFromEnv() models.InvoiceParty {
+	state := envOr("SELLER_STATE", "Maharashtra")
+	return models.InvoiceParty{
+		Name:      envOr("SELLER_NAME", "ShetiSeva Agro Services"),
+		GSTIN:     os.Getenv("SELLER_GSTIN"),
+		Address:   envOr("SELLER_ADDRESS", "Pune, Maharashtra"),
+		State:     state,
+		StateCode: envOr("SELLER_STATE_CODE", models.GSTStateCode(state)),
+	}
+}
+
+// NumberPrefix is the invoice series prefix, e.g. "SS" in SS/24-25/000042
+func NumberPrefix() string {
+	return envOr("INVOICE_PREFIX", "SS")
+}
+
+// placeOfSupplyLabel prints a GST state code with its name, e.g. "27-Maharashtra"
+func placeOfSupplyLabel(code string) string {
+	if name := models.GSTStateName(code); name != "" {
+		return code + "-" + name
+	}
+	return code
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// table columns: left edge of text columns, right edge of amount columns
+var columns = []struct {
+	title string
+	x     float64
+	right bool
+}{
+	{"#", 40, false},
+	{"Item", 56, false},
+	{"HSN", 190, false},
+	{"Qty", 245, true},
+	{"Rate", 295, true},
+	{"Taxable", 350, true},
+	{"GST%", 380, true},
+	{"CGST", 425, true},
+	{"SGST", 470, true},
+	{"IGST", 515, true},
+	{"Total", 562, true},
+}
+
+const (
+	marginLeft  = 36.0
+	marginRight = pageWidth - 30
+	rowHeight   = 16.0
+	pageBottom  = pageHeight - 90
+)
+
+// Render lays out a GST tax invoice as a PDF document
+func Render(inv models.Invoice) []byte {
+	d := newPDF()
+	y := header(d, inv)
+
+	for i, item := range inv.Items {
+		if y > pageBottom {
+			d.addPage()
+			y = tableHeader(d, 50)
+		}
+		row := []string{
+			fmt.Sprintf("%d", i+1),
+			truncate(item.Name, 26),
+			item.HSNCode,
+			fmt.Sprintf("%d", item.Quantity),
+			money(item.Price),
+			money(item.TaxableValue),
+			trimRate(item.GSTRate),
+			money(item.CGST),
+			money(item.SGST),
+			money(item.IGST),
+			money(item.LineTotal),
+		}
+		for c, col := range columns {
+			if col.right {
+				d.textRight(col.x, y, 8, false, row[c])
+			} else {
+				d.text(col.x, y, 8, false, row[c])
+			}
+		}
+		y += rowHeight
+	}
+
+	if y > pageBottom-80 {
+		d.addPage()
+		y = 50
+	}
+	d.line(marginLeft, y-10, marginRight, y-10)
+	y += 6
+
+	totals := [][2]string{}
+	if inv.Discount > 0 {
+		totals = append(totals,
+			[2]string{"Gross amount", money(inv.Subtotal)},
+			[2]string{"Discount", "-" + money(inv.Discount)},
+		)
+	}
+	totals = append(totals, [][2]string{
+		{"Taxable value", money(inv.TaxableValue)},
+		{"CGST", money(inv.CGST)},
+		{"SGST", money(inv.SGST)},
+		{"IGST", money(inv.IGST)},
+		{"Invoice total (Rs.)", money(inv.Total)},
+	}...)
+	for i, t := range totals {
+		bold := i == len(totals)-1
+		d.text(380, y, 9, bold, t[0])
+		d.textRight(columns[len(columns)-1].x, y, 9, bold, t[1])
+		y += 14
+	}
+
+	y += 16
+	d.text(marginLeft, y, 8, false, "Prices are inclusive of GST. Tax is payable on reverse charge: No.")
+	d.text(marginLeft, y+12, 8, false, "This is a computer generated invoice and does not require a signature.")
+
+	return d.bytes()
+}
+
+// header draws the seller, invoice and buyer blocks and the table header,
+// returning the y position of the first item row
+func header(d *pdfDoc, inv models.Invoice) float64 {
+	d.text(marginLeft, 50, 16, true, "TAX INVOICE")
+
+	y := 78.0
+	d.text(marginLeft, y, 11, true, inv.Seller.Name)
+	for _, line := range []string{
+		inv.Seller.Address,
+		"GSTIN: " + orDash(inv.Seller.GSTIN),
+		fmt.Sprintf("State: %s (%s)", inv.Seller.State, inv.Seller.StateCode),
+	} {
+		y += 13
+		d.text(marginLeft, y, 9, false, line)
+	}
+
+	y = 78.0
+	for _, line := range []string{
+		"Invoice No: " + inv.InvoiceNo,
+		"Invoice Date: " + inv.Date.Format("02 Jan 2006"),
+		"Order ID: " + inv.OrderID.Hex(),
+		"Place of Supply: " + placeOfSupplyLabel(inv.PlaceOfSupply),
+	} {
+		d.text(360, y, 9, false, line)
+		y += 13
+	}
+
+	y = 150.0
+	d.text(marginLeft, y, 10, true, "Bill To")
+	buyer := []string{inv.Buyer.Name}
+	if inv.Buyer.Address != "" {
+		buyer = append(buyer, inv.Buyer.Address)
+	}
+	if inv.Buyer.GSTIN != "" {
+		buyer = append(buyer, "GSTIN: "+inv.Buyer.GSTIN)
+	}
+	if inv.Buyer.State != "" {
+		buyer = append(buyer, "State: "+inv.Buyer.State)
+	}
+	for _, line := range buyer {
+		y += 13
+		d.text(marginLeft, y, 9, false, line)
+	}
+
+	return tableHeader(d, y+30)
+}
+
+// tableHeader draws the column titles at y and returns the first row position
+func tableHeader(d *pdfDoc, y float64) float64 {
+	d.line(marginLeft, y-12, marginRight, y-12)
+	for _, col := range columns {
+		if col.right {
+			d.textRight(col.x, y, 8, true, col.title)
+		} else {
+			d.text(col.x, y, 8, true, col.title)
+		}
+	}
+	d.line(marginLeft, y+6, marginRight, y+6)
+	return y + rowHeight + 4
+}
+
+func money(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+func trimRate(rate float64) string {
+	return strings.TrimSuffix(fmt.Sprintf("%.2f", rate), ".00")
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,149 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+)
+
+var (
+	// ErrInvalidSignature is returned when a gateway callback cannot be authenticated
+	ErrInvalidSignature = errors.New("invalid payment signature")
+	// ErrAlreadyCaptured is returned by Capture when the payment was captured
+	// before, e.g. by the gateway's auto-capture or an earlier attempt
+	ErrAlreadyCaptured = errors.New("payment already captured")
+)
+
+// Intent is a payment order created on the gateway that the app completes with the user
+type Intent struct {
+	Provider        string  `json:"provider"`
+	ProviderOrderID string  `json:"provider_order_id"`
+	Amount          float64 `json:"amount"`
+	Currency        string  `json:"currency"`
+	KeyID           string  `json:"key_id,omitempty"` // public key the mobile checkout needs
+}
+
+// Webhook event types, normalized across providers
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+	EventPaymentRefunded = "payment.refunded"
+)
+
+// WebhookEvent is a verified, provider-neutral server-to-server notification
+type WebhookEvent struct {
+	ID                string
+	Type              string // one of the Event* constants, or the raw provider event name
+	ProviderOrderID   string
+	ProviderPaymentID string
+	ProviderRefundID  string
+	Amount            float64
+	Reason            string
+}
+
+// Statuses of a try at paying a provider order, as the gateway reports it
+const (
+	PaymentAuthorized = "authorized" // money taken, waiting to be captured
+	PaymentCaptured   = "captured"
+	PaymentFailed     = "failed"
+)
+
+// ProviderPayment is one try at paying a provider order
+type ProviderPayment struct {
+	ID     string
+	Status string // one of the Payment* statuses, or the raw provider status
+	Amount float64
+}
+
+// Taken reports whether the try took the payer's money
+func (p ProviderPayment) Taken() bool {
+	return p.Status == PaymentAuthorized || p.Status == PaymentCaptured
+}
+
+// RefundResult describes a refund accepted by the gateway
+type RefundResult struct {
+	ProviderRefundID string  `json:"provider_refund_id"`
+	Amount           float64 `json:"amount"`
+	Status           string  `json:"status"`
+}
+
+// PaymentGateway is implemented by every payment provider we support
+type PaymentGateway interface {
+	// Name identifies the provider, e.g. "razorpay" or "mock"
+	Name() string
+	// CreateIntent registers a payment of amount (in rupees) for our order reference
+	CreateIntent(ctx context.Context, receipt string, amount float64) (*Intent, error)
+	// VerifySignature checks the signature the checkout returned for a completed payment
+	VerifySignature(providerOrderID, providerPaymentID, signature string) bool
+	// Capture settles an authorized payment
+	Capture(ctx context.Context, providerPaymentID string, amount float64) error
+	// Payments lists every try at paying a provider order, so what the
+	// checkout reports can be checked against what was actually taken
+	Payments(ctx context.Context, providerOrderID string) ([]ProviderPayment, error)
+	// Refund returns amount (in rupees) of a captured payment to the payer
+	Refund(ctx context.Context, providerPaymentID string, amount float64) (*RefundResult, error)
+	// ParseWebhook authenticates a webhook request body and decodes it.
+	// It returns ErrInvalidSignature when the signature header does not match.
+	ParseWebhook(body []byte, header http.Header) (*WebhookEvent, error)
+}
+
+// NewGatewayFromEnv picks the provider configured by PAYMENT_PROVIDER.
+// The mock provider, whose signatures anyone can forge, is only used when
+// PAYMENT_PROVIDER=mock is set explicitly; otherwise the Razorpay keys are
+// required and the server refuses to start without them.
+func NewGatewayFromEnv() PaymentGateway {
+	if os.Getenv("PAYMENT_PROVIDER") == "mock" {
+		secret := os.Getenv("MOCK_PAYMENT_SECRET")
+		if secret == "" {
+			secret = "mock_secret"
+		}
+		return NewMockGateway(secret)
+	}
+
+	keyID := os.Getenv("RAZORPAY_KEY_ID")
+	keySecret := os.Getenv("RAZORPAY_KEY_SECRET")
+	if keyID == "" || keySecret == "" {
+		log.Fatal("❌ RAZORPAY_KEY_ID and RAZORPAY_KEY_SECRET must be set (or PAYMENT_PROVIDER=mock for development)")
+	}
+	return NewRazorpayGateway(keyID, keySecret, os.Getenv("RAZORPAY_WEBHOOK_SECRET"))
+}
+
+// SignHMAC returns the hex HMAC-SHA256 of message, as used by Razorpay-style signatures
+func SignHMAC(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyHMAC compares a hex signature against the expected HMAC in constant time
+func VerifyHMAC(secret, message, signature string) bool {
+	expected, err := hex.DecodeString(SignHMAC(secret, message))
+	if err != nil {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, got)
+}
+
+// toPaise converts a rupee amount to the smallest currency unit
+func toPaise(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// eventIDOrDigest falls back to a digest of the body when the provider sends no event ID
+func eventIDOrDigest(id string, body []byte) string {
+	if id != "" {
+		return id
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
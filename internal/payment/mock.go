@@ -0,0 +1,118 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockGateway is an in-process provider for local development and tests.
+// It signs payments the same way Razorpay does, so the verify flow is
+// exercised end to end without network calls.
+type MockGateway struct {
+	secret string
+
+	mu       sync.Mutex
+	tries    map[string][]ProviderPayment // provider order ID → tries at paying it
+	captured map[string]float64           // provider payment ID → captured amount
+	refunded map[string]float64           // provider payment ID → refunded amount
+}
+
+// NewMockGateway creates a mock provider that signs with secret
+func NewMockGateway(secret string) *MockGateway {
+	return &MockGateway{
+		secret:   secret,
+		tries:    map[string][]ProviderPayment{},
+		captured: map[string]float64{},
+		refunded: map[string]float64{},
+	}
+}
+
+func (g *MockGateway) Name() string { return "mock" }
+
+func (g *MockGateway) CreateIntent(ctx context.Context, receipt string, amount float64) (*Intent, error) {
+	return &Intent{
+		Provider:        g.Name(),
+		ProviderOrderID: "mock_order_" + primitive.NewObjectID().Hex(),
+		Amount:          amount,
+		Currency:        "INR",
+	}, nil
+}
+
+// Sign produces the signature a real checkout would return for a payment
+func (g *MockGateway) Sign(providerOrderID, providerPaymentID string) string {
+	return SignHMAC(g.secret, providerOrderID+"|"+providerPaymentID)
+}
+
+func (g *MockGateway) VerifySignature(providerOrderID, providerPaymentID, signature string) bool {
+	return VerifyHMAC(g.secret, providerOrderID+"|"+providerPaymentID, signature)
+}
+
+// Pay records a try at paying a provider order, as the checkout would make
+// it, with status PaymentAuthorized or PaymentFailed
+func (g *MockGateway) Pay(providerOrderID, providerPaymentID string, amount float64, status string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tries[providerOrderID] = append(g.tries[providerOrderID], ProviderPayment{ID: providerPaymentID, Status: status, Amount: amount})
+}
+
+func (g *MockGateway) Payments(ctx context.Context, providerOrderID string) ([]ProviderPayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payments := make([]ProviderPayment, 0, len(g.tries[providerOrderID]))
+	for _, try := range g.tries[providerOrderID] {
+		if _, ok := g.captured[try.ID]; ok {
+			try.Status = PaymentCaptured
+		}
+		payments = append(payments, try)
+	}
+	return payments, nil
+}
+
+func (g *MockGateway) Capture(ctx context.Context, providerPaymentID string, amount float64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.captured[providerPaymentID]; ok {
+		return ErrAlreadyCaptured
+	}
+	g.captured[providerPaymentID] = amount
+	return nil
+}
+
+func (g *MockGateway) Refund(ctx context.Context, providerPaymentID string, amount float64) (*RefundResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	captured, ok := g.captured[providerPaymentID]
+	if !ok {
+		return nil, errors.New("payment not captured")
+	}
+	if g.refunded[providerPaymentID]+amount > captured {
+		return nil, errors.New("refund exceeds captured amount")
+	}
+	g.refunded[providerPaymentID] += amount
+
+	return &RefundResult{
+		ProviderRefundID: "mock_rfnd_" + primitive.NewObjectID().Hex(),
+		Amount:           amount,
+		Status:           "processed",
+	}, nil
+}
+
+// SignWebhook produces the X-Mock-Signature header for a webhook body
+func (g *MockGateway) SignWebhook(body []byte) string {
+	return SignHMAC(g.secret, string(body))
+}
+
+// ParseWebhook accepts Razorpay-shaped payloads signed via SignWebhook
+func (g *MockGateway) ParseWebhook(body []byte, header http.Header) (*WebhookEvent, error) {
+	if !VerifyHMAC(g.secret, string(body), header.Get("X-Mock-Signature")) {
+		return nil, ErrInvalidSignature
+	}
+	return parseRazorpayEvent(body, header.Get("X-Mock-Event-Id"))
+}
@@ -0,0 +1,218 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const razorpayBaseURL = "https://api.razorpay.com/v1"
+
+// RazorpayGateway talks to the Razorpay Orders and Payments APIs
+type RazorpayGateway struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	baseURL       string
+	client        *http.Client
+}
+
+// NewRazorpayGateway creates a gateway authenticated with the given API keys.
+// webhookSecret is the secret configured for the webhook in the Razorpay dashboard.
+func NewRazorpayGateway(keyID, keySecret, webhookSecret string) *RazorpayGateway {
+	return &RazorpayGateway{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		baseURL:       razorpayBaseURL,
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (g *RazorpayGateway) Name() string { return "razorpay" }
+
+func (g *RazorpayGateway) CreateIntent(ctx context.Context, receipt string, amount float64) (*Intent, error) {
+	var resp struct {
+		ID       string `json:"id"`
+		Currency string `json:"currency"`
+	}
+	err := g.post(ctx, "/orders", map[string]interface{}{
+		"amount":   toPaise(amount),
+		"currency": "INR",
+		"receipt":  receipt,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Intent{
+		Provider:        g.Name(),
+		ProviderOrderID: resp.ID,
+		Amount:          amount,
+		Currency:        resp.Currency,
+		KeyID:           g.keyID,
+	}, nil
+}
+
+// VerifySignature checks HMAC_SHA256(order_id + "|" + payment_id) with the key secret
+func (g *RazorpayGateway) VerifySignature(providerOrderID, providerPaymentID, signature string) bool {
+	return VerifyHMAC(g.keySecret, providerOrderID+"|"+providerPaymentID, signature)
+}
+
+func (g *RazorpayGateway) Capture(ctx context.Context, providerPaymentID string, amount float64) error {
+	err := g.post(ctx, "/payments/"+providerPaymentID+"/capture", map[string]interface{}{
+		"amount":   toPaise(amount),
+		"currency": "INR",
+	}, nil)
+	if err != nil && strings.Contains(err.Error(), "already been captured") {
+		return ErrAlreadyCaptured
+	}
+	return err
+}
+
+func (g *RazorpayGateway) Payments(ctx context.Context, providerOrderID string) ([]ProviderPayment, error) {
+	var resp struct {
+		Items []struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+			Amount int64  `json:"amount"`
+		} `json:"items"`
+	}
+	if err := g.call(ctx, http.MethodGet, "/orders/"+providerOrderID+"/payments", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	payments := make([]ProviderPayment, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		payments = append(payments, ProviderPayment{ID: item.ID, Status: item.Status, Amount: float64(item.Amount) / 100})
+	}
+	return payments, nil
+}
+
+func (g *RazorpayGateway) Refund(ctx context.Context, providerPaymentID string, amount float64) (*RefundResult, error) {
+	var resp struct {
+		ID     string `json:"id"`
+		Amount int64  `json:"amount"`
+		Status string `json:"status"`
+	}
+	err := g.post(ctx, "/payments/"+providerPaymentID+"/refund", map[string]interface{}{
+		"amount": toPaise(amount),
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RefundResult{
+		ProviderRefundID: resp.ID,
+		Amount:           float64(resp.Amount) / 100,
+		Status:           resp.Status,
+	}, nil
+}
+
+// ParseWebhook checks X-Razorpay-Signature, an HMAC of the raw body with the webhook secret
+func (g *RazorpayGateway) ParseWebhook(body []byte, header http.Header) (*WebhookEvent, error) {
+	if g.webhookSecret == "" || !VerifyHMAC(g.webhookSecret, string(body), header.Get("X-Razorpay-Signature")) {
+		return nil, ErrInvalidSignature
+	}
+	return parseRazorpayEvent(body, header.Get("X-Razorpay-Event-Id"))
+}
+
+// parseRazorpayEvent decodes a Razorpay webhook payload into a WebhookEvent
+func parseRazorpayEvent(body []byte, eventID string) (*WebhookEvent, error) {
+	var payload struct {
+		Event   string `json:"event"`
+		Payload struct {
+			Payment struct {
+				Entity struct {
+					ID               string `json:"id"`
+					OrderID          string `json:"order_id"`
+					Amount           int64  `json:"amount"`
+					ErrorDescription string `json:"error_description"`
+				} `json:"entity"`
+			} `json:"payment"`
+			Refund struct {
+				Entity struct {
+					ID        string `json:"id"`
+					PaymentID string `json:"payment_id"`
+					Amount    int64  `json:"amount"`
+				} `json:"entity"`
+			} `json:"refund"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	pay := payload.Payload.Payment.Entity
+	event := &WebhookEvent{
+		ID:                eventIDOrDigest(eventID, body),
+		Type:              payload.Event,
+		ProviderOrderID:   pay.OrderID,
+		ProviderPaymentID: pay.ID,
+		Amount:            float64(pay.Amount) / 100,
+		Reason:            pay.ErrorDescription,
+	}
+
+	switch payload.Event {
+	case "payment.captured":
+		event.Type = EventPaymentCaptured
+	case "payment.failed":
+		event.Type = EventPaymentFailed
+	case "refund.processed":
+		refund := payload.Payload.Refund.Entity
+		event.Type = EventPaymentRefunded
+		event.ProviderRefundID = refund.ID
+		event.ProviderPaymentID = refund.PaymentID
+		event.Amount = float64(refund.Amount) / 100
+	}
+	return event, nil
+}
+
+func (g *RazorpayGateway) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	return g.call(ctx, http.MethodPost, path, body, out)
+}
+
+// call sends body, if any, as JSON and decodes the response into out
+func (g *RazorpayGateway) call(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, payload)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.keyID, g.keySecret)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("razorpay API error (%d): %s", resp.StatusCode, respBody)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -31,11 +32,19 @@ func main() {
 	controllers.InitUserCollection()
 	controllers.InitKYCCollection()
 	controllers.InitCartCollection()
+	controllers.InitGuestCartCollection()
 	controllers.InitOrderCollection()
 	controllers.InitReturnRefundCollections()      // ✅ Added for return/refund
 	controllers.InitSupportCollection()            // ✅ Added for support tickets
 	controllers.InitVoiceFeedbackCollection()      // ✅ Added for voice feedback
 	controllers.InitReviewCollection() 
+	controllers.InitInventoryCollections()
+	controllers.InitEMICollections()
+	controllers.InitShipmentCollections()
+	controllers.InitCouponCollections()
+	controllers.InitConsultationCollection()
+	controllers.InitDroneBookingCollection()
+	controllers.InitPaymentGateway()
 
 	// ========== 3. Database Setup ==========
 	db.InitDatabase()
@@ -49,6 +58,10 @@ func main() {
 
 	// ========== 5. Setup Gin ==========
 	router := gin.New()
+	// ClientIP only believes X-Forwarded-For from our own proxies
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
 	router.Use(gin.Recovery())
 	router.Use(telemetry.TracingMiddleware("shetiseva-backend"))
 	router.Use(telemetry.MetricsMiddleware())
@@ -68,6 +81,7 @@ func main() {
 	routes.AuthRoutes(router)
 	routes.CartRoutes(router)
 	routes.OrderRoutes(router)
+	routes.PaymentRoutes(router)
 	routes.ContactRoutes(router)
 	routes.UserRoutes(router)
 	routes.KYCRoutes(router)
@@ -77,9 +91,15 @@ func main() {
 	routes.CompareRoutes(router)
 	routes.MarketplaceRoutes(router)
 	routes.AdminRoutes(router)
+	routes.InventoryRoutes(router)
+	routes.EMIRoutes(router)
+	routes.ShipmentRoutes(router)
+	routes.CouponRoutes(router)
 
 	// ✅ NEW routes added for extended functionality
 	routes.RefundRoutes(router)
+	routes.WalletRoutes(router)
+	routes.SubscriptionRoutes(router)
 	routes.SupportRoutes(router)
 	routes.ReviewRoutes(router)
 	routes.FeedbackRoutes(router)
@@ -90,6 +110,14 @@ func main() {
 	routes.AIRoutes(router)
 	routes.ChatbotRoutes(router)
 
+	// Background jobs stop when the server shuts down
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go controllers.RunCoinExpiryJob(jobs, time.Hour)
+	go controllers.RunSubscriptionRenewalJob(jobs, time.Hour)
+	go controllers.RunPendingOrderExpiryJob(jobs, 5*time.Minute)
+	go controllers.RunReferralRewardJob(jobs, time.Hour)
+
 	// ========== 8. Start Server with Graceful Shutdown ==========
 	srv := &http.Server{
 		Addr:    ":8080",
@@ -117,3 +145,15 @@ func main() {
 
 	log.Println("✅ Server exited properly")
 }
+
+// trustedProxies lists the load balancers in front of the API, from the
+// comma-separated TRUSTED_PROXIES; none by default
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,200 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// IdempotencyKeyHeader is sent by clients that may retry a request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyReplayedHeader marks a response served from the store
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// A request still in progress after this long is assumed to have died
+	// with the server, and a retry may run it again
+	idempotencyLockTimeout = time.Minute
+)
+
+// responseRecorder keeps a copy of what the handler writes
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes a route safe to retry. When the request has an
+// Idempotency-Key header, the first response for that key is stored and sent
+// back unchanged to retries within models.IdempotencyWindow; the handler does
+// not run again. Keys are scoped to the caller, so use it after
+// AuthMiddleware or AdminMiddleware. Requests without the header pass through.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		record := models.IdempotencyRecord{
+			ID:          primitive.NewObjectID(),
+			Key:         key,
+			Owner:       idempotencyOwner(c),
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: hex.EncodeToString(sum[:]),
+			Status:      models.IdempotencyInProgress,
+			CreatedAt:   time.Now(),
+		}
+
+		existing, err := claimIdempotencyKey(record)
+		if err != nil {
+			log.Printf("⚠️ Idempotency key %q not stored: %v", key, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+			c.Abort()
+			return
+		}
+		if existing != nil {
+			replayIdempotent(c, record, *existing)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		finishIdempotentRequest(record, recorder)
+	}
+}
+
+// idempotencyOwner is the caller a key belongs to, so two farmers who
+// happen to pick the same key never see each other's responses
+func idempotencyOwner(c *gin.Context) string {
+	if userID, ok := c.Get("user_id"); ok {
+		if id, ok := userID.(primitive.ObjectID); ok {
+			return id.Hex()
+		}
+		return fmt.Sprint(userID)
+	}
+	return c.GetString("email")
+}
+
+// claimIdempotencyKey stores record as in progress. If the caller already
+// used the key and that record is still live, it is returned instead.
+func claimIdempotencyKey(record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys := database.GetCollection("idempotency_keys")
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := keys.InsertOne(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		var existing models.IdempotencyRecord
+		err = keys.FindOne(ctx, bson.M{"owner": record.Owner, "key": record.Key}).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			continue // expired and removed in the meantime
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		stale := existing.Status == models.IdempotencyInProgress && record.CreatedAt.Sub(existing.CreatedAt) > idempotencyLockTimeout
+		expired := existing.Status == models.IdempotencyCompleted && !existing.Replayable(record.CreatedAt)
+		if !stale && !expired {
+			return &existing, nil
+		}
+		// The TTL index removes old keys lazily; take this one over now
+		if _, err := keys.DeleteOne(ctx, bson.M{"_id": existing.ID, "status": existing.Status}); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("key %q is contended", record.Key)
+}
+
+// replayIdempotent answers a retry from the stored record
+func replayIdempotent(c *gin.Context, request, stored models.IdempotencyRecord) {
+	defer c.Abort()
+
+	if stored.Method != request.Method || stored.Path != request.Path || stored.RequestHash != request.RequestHash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return
+	}
+	if stored.Status != models.IdempotencyCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+		return
+	}
+
+	c.Header(idempotencyReplayedHeader, "true")
+	c.Data(stored.ResponseCode, stored.ResponseType, stored.ResponseBody)
+}
+
+// finishIdempotentRequest stores the handler's response for replay. Server
+// errors are not stored: the key is freed so the client can retry for real.
+func finishIdempotentRequest(record models.IdempotencyRecord, recorder *responseRecorder) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys := database.GetCollection("idempotency_keys")
+	if recorder.Status() >= http.StatusInternalServerError {
+		if _, err := keys.DeleteOne(ctx, bson.M{"_id": record.ID}); err != nil {
+			log.Printf("⚠️ Idempotency key %q not released: %v", record.Key, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	_, err := keys.UpdateOne(ctx, bson.M{"_id": record.ID}, bson.M{"$set": bson.M{
+		"status":        models.IdempotencyCompleted,
+		"response_code": recorder.Status(),
+		"response_type": recorder.Header().Get("Content-Type"),
+		"response_body": recorder.body.Bytes(),
+		"completed_at":  now,
+	}})
+	if err != nil {
+		log.Printf("⚠️ Response for idempotency key %q not stored: %v", record.Key, err)
+	}
+}
@@ -7,9 +7,100 @@ import (
 )
 
 type CartItem struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
-	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
-	Quantity  int                `bson:"quantity" json:"quantity"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"` // ✅ Add this line
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ProductID  primitive.ObjectID `bson:"product_id" json:"product_id"`
+	Quantity   int                `bson:"quantity" json:"quantity"`
+	PriceAtAdd float64            `bson:"price_at_add,omitempty" json:"price_at_add,omitempty"` // product price when first added
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`                         // ✅ Add this line
+}
+
+// GuestCartTTL is how long a guest cart is kept after it was last changed
+const GuestCartTTL = 30 * 24 * time.Hour
+
+// GuestCartItem is a cart line of a visitor who has not signed in yet,
+// keyed by the token the app keeps for the device
+type GuestCartItem struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Token      string             `bson:"token" json:"-"`
+	ProductID  primitive.ObjectID `bson:"product_id" json:"product_id"`
+	Quantity   int                `bson:"quantity" json:"quantity"`
+	PriceAtAdd float64            `bson:"price_at_add,omitempty" json:"price_at_add,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"` // the whole cart's last change; it expires GuestCartTTL later
+}
+
+// CartItem converts a guest line so it can be priced like a signed-in cart
+func (g GuestCartItem) CartItem() CartItem {
+	return CartItem{
+		ID:         g.ID,
+		ProductID:  g.ProductID,
+		Quantity:   g.Quantity,
+		PriceAtAdd: g.PriceAtAdd,
+		CreatedAt:  g.CreatedAt,
+	}
+}
+
+// CartQuantityInput sets or adds to the quantity of a product in a cart
+type CartQuantityInput struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// CartLine is a cart item joined with the live product, as shown to the farmer
+type CartLine struct {
+	ID           primitive.ObjectID `json:"id"`
+	ProductID    primitive.ObjectID `json:"product_id"`
+	Name         string             `json:"name"`
+	ImageURL     string             `json:"image_url,omitempty"`
+	UnitPrice    float64            `json:"unit_price"`
+	PriceAtAdd   float64            `json:"price_at_add,omitempty"`
+	Quantity     int                `json:"quantity"`
+	LineTotal    float64            `json:"line_total"`
+	GSTRate      float64            `json:"gst_rate"`
+	Available    int                `json:"available"` // unreserved stock across warehouses
+	InStock      bool               `json:"in_stock"`  // enough stock for the quantity in the cart
+	PriceChanged bool               `json:"price_changed"`
+	Unavailable  bool               `json:"unavailable"` // product was removed from the catalogue
+}
+
+// NewCartLine prices a cart item at the product's current price and flags
+// anything that would stop checkout or surprise the farmer there. product
+// is nil when the product no longer exists.
+func NewCartLine(item CartItem, product *Product, available int) CartLine {
+	line := CartLine{
+		ID:         item.ID,
+		ProductID:  item.ProductID,
+		PriceAtAdd: item.PriceAtAdd,
+		Quantity:   item.Quantity,
+	}
+	if product == nil {
+		line.Unavailable = true
+		return line
+	}
+
+	line.Name = product.Name
+	line.ImageURL = product.ImageURL
+	line.UnitPrice = product.Price
+	line.GSTRate = product.GSTRate
+	line.LineTotal = RoundAmount(product.Price * float64(item.Quantity))
+	line.Available = available
+	line.InStock = available >= item.Quantity
+	line.PriceChanged = item.PriceAtAdd > 0 && item.PriceAtAdd != product.Price
+	return line
+}
+
+// CartSummary is the priced cart: live lines, discounts, GST and grand total
+type CartSummary struct {
+	Items         []CartLine        `json:"items"`
+	ItemCount     int               `json:"item_count"`
+	Subtotal      float64           `json:"subtotal"`
+	Discounts     []AppliedDiscount `json:"discounts"`
+	Discount      float64           `json:"discount"`
+	Tax           TaxBreakdown      `json:"tax"`
+	Total         float64           `json:"total"` // GST included
+	Coupon        string            `json:"coupon,omitempty"`
+	CouponError   string            `json:"coupon_error,omitempty"`
+	PriceChanged  bool              `json:"price_changed"`  // some line's price moved since it was added
+	CheckoutReady bool              `json:"checkout_ready"` // false while any line is out of stock or removed
 }
@@ -1,9 +1,158 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CoinValue is what one ShetiSeva coin is worth, in rupees, when redeemed at checkout
+const CoinValue = 1.0
 
 // CoinsBalance represents the coin balance of a user
 type CoinsBalance struct {
 	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
 	Coins  int                `bson:"coins" json:"coins"`
 }
+
+// Events that earn coins, each configured by a CoinRule
+const (
+	CoinEventOrderPaid            = "order_paid"
+	CoinEventReviewSubmitted      = "review_submitted"
+	CoinEventKYCApproved          = "kyc_approved"
+	CoinEventConsultationFeedback = "consultation_feedback"
+	CoinEventReferral             = "referral"        // to the referrer
+	CoinEventReferralJoined       = "referral_joined" // to the referee
+)
+
+// CoinEvents lists every event a rule can be set for
+func CoinEvents() []string {
+	return []string{
+		CoinEventOrderPaid, CoinEventReviewSubmitted, CoinEventKYCApproved,
+		CoinEventConsultationFeedback, CoinEventReferral, CoinEventReferralJoined,
+	}
+}
+
+// IsCoinEvent reports whether event is one of CoinEvents
+func IsCoinEvent(event string) bool {
+	for _, e := range CoinEvents() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// CoinRule is the admin's setting for how many coins an event earns. An
+// event with no rule, or an inactive one, earns nothing.
+type CoinRule struct {
+	Event         string    `bson:"_id" json:"event"`
+	Coins         int       `bson:"coins" json:"coins"`
+	PerAmount     float64   `bson:"per_amount,omitempty" json:"per_amount,omitempty"`           // e.g. 100: Coins per ₹100 paid
+	MaxPerEvent   int       `bson:"max_per_event,omitempty" json:"max_per_event,omitempty"`     // 0 = no cap
+	MaxPerUser    int       `bson:"max_per_user,omitempty" json:"max_per_user,omitempty"`       // per CapWindowDays; 0 = no cap
+	CapWindowDays int       `bson:"cap_window_days,omitempty" json:"cap_window_days,omitempty"` // 0 = for all time
+	ExpiryDays    int       `bson:"expiry_days,omitempty" json:"expiry_days,omitempty"`         // 0 = never expire
+	Active        bool      `bson:"active" json:"active"`
+	UpdatedBy     string    `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// CoinsFor is what one event earns: a flat Coins, or Coins for every full
+// PerAmount rupees of amount, never more than MaxPerEvent
+func (r CoinRule) CoinsFor(amount float64) int {
+	coins := r.Coins
+	if r.PerAmount > 0 {
+		coins = int(amount/r.PerAmount) * r.Coins
+	}
+	return r.capEvent(coins)
+}
+
+func (r CoinRule) capEvent(coins int) int {
+	if r.MaxPerEvent > 0 && coins > r.MaxPerEvent {
+		return r.MaxPerEvent
+	}
+	return coins
+}
+
+// Grantable trims coins to what the farmer may still earn, having already
+// earned `earned` from this event within the cap window
+func (r CoinRule) Grantable(coins, earned int) int {
+	coins = r.capEvent(coins)
+	if r.MaxPerUser > 0 && earned+coins > r.MaxPerUser {
+		coins = r.MaxPerUser - earned
+	}
+	if coins < 0 {
+		return 0
+	}
+	return coins
+}
+
+// CapWindowStart is the start of the window MaxPerUser counts over; the
+// zero time means all time
+func (r CoinRule) CapWindowStart(now time.Time) time.Time {
+	if r.CapWindowDays <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -r.CapWindowDays)
+}
+
+// ExpiresAt is when coins earned now expire, or nil if they do not
+func (r CoinRule) ExpiresAt(now time.Time) *time.Time {
+	if r.ExpiryDays <= 0 {
+		return nil
+	}
+	at := now.AddDate(0, 0, r.ExpiryDays)
+	return &at
+}
+
+// CoinRuleInput is posted by admins to set the rule for an event
+type CoinRuleInput struct {
+	Coins         int     `json:"coins" binding:"gte=0"`
+	PerAmount     float64 `json:"per_amount" binding:"gte=0"`
+	MaxPerEvent   int     `json:"max_per_event" binding:"gte=0"`
+	MaxPerUser    int     `json:"max_per_user" binding:"gte=0"`
+	CapWindowDays int     `json:"cap_window_days" binding:"gte=0"`
+	ExpiryDays    int     `json:"expiry_days" binding:"gte=0"`
+	Active        *bool   `json:"active" binding:"required"`
+}
+
+// Coin earning statuses
+const (
+	CoinEarningActive  = "active"  // some coins left to spend
+	CoinEarningUsed    = "used"    // all spent
+	CoinEarningExpired = "expired" // the rest taken back at expiry
+	CoinEarningRevoked = "revoked" // the rest taken back, e.g. the order was cancelled
+)
+
+// CoinEarning is a batch of coins earned from one event. Spending uses up
+// the batches that expire soonest first; whatever is left when a batch
+// expires is taken back. Coins spent on something later cancelled go back
+// to the batches they came from, so they still expire with them.
+type CoinEarning struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Event     string             `bson:"event" json:"event"`
+	Subject   string             `bson:"subject" json:"subject"` // what earned it, e.g. the order ID
+	Coins     int                `bson:"coins" json:"coins"`
+	Remaining int                `bson:"remaining" json:"remaining"`
+	Status    string             `bson:"status" json:"status"`
+	Uses      []CoinUse          `bson:"uses,omitempty" json:"-"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// CoinUse is what one spend (e.g. order:<id>) took from a batch
+type CoinUse struct {
+	Reference string `bson:"reference"`
+	Coins     int    `bson:"coins"`
+}
+
+// CoinHistoryEntry is one line of a farmer's coin history
+type CoinHistoryEntry struct {
+	Coins       int       `json:"coins"` // negative when spent or taken back
+	Kind        string    `json:"kind"`
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
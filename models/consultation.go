@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Consultation statuses
+const (
+	ConsultationBooked    = "booked"
+	ConsultationCompleted = "completed" // held; the farmer can now give feedback
+)
+
+// ConsultationInput books a consultation with an expert
+type ConsultationInput struct {
+	ExpertID string `json:"expert_id" binding:"required"`
+	Topic    string `json:"topic" binding:"required"`
+}
+
+// ConsultationFeedback is what a farmer says about a consultation they had
+type ConsultationFeedback struct {
+	ConsultationID primitive.ObjectID `bson:"consultation_id" json:"consultation_id" binding:"required"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Rating         int                `bson:"rating" json:"rating" binding:"required,min=1,max=5"`
+	Comment        string             `bson:"comment" json:"comment"`
+	Timestamp      time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// DroneBookingInput books drone spraying over a field
+type DroneBookingInput struct {
+	FieldArea float64 `json:"field_area" binding:"required,gt=0"` // in acres
+	Location  string  `json:"location" binding:"required"`
+	Purpose   string  `json:"purpose"`
+	Date      string  `json:"date" binding:"required"` // YYYY-MM-DD
+}
@@ -0,0 +1,290 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Coupon types
+const (
+	CouponFlat       = "flat"       // fixed rupee amount off
+	CouponPercentage = "percentage" // percent of the eligible amount, optionally capped
+)
+
+// Kinds of discount recorded on an order
+const (
+	DiscountCoupon    = "coupon"
+	DiscountPromotion = "promotion"
+	DiscountCoins     = "coins"
+)
+
+// Reasons a coupon cannot be applied
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponInactive      = errors.New("coupon is not active")
+	ErrCouponNotStarted    = errors.New("coupon is not valid yet")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponMinCartValue  = errors.New("cart value is below the coupon minimum")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to any item in the cart")
+	ErrCouponUsageLimit    = errors.New("coupon usage limit reached")
+	ErrCouponUserLimit     = errors.New("you have already used this coupon")
+)
+
+var couponRejections = []error{
+	ErrCouponNotFound, ErrCouponInactive, ErrCouponNotStarted, ErrCouponExpired,
+	ErrCouponMinCartValue, ErrCouponNotApplicable, ErrCouponUsageLimit, ErrCouponUserLimit,
+}
+
+// IsCouponRejection reports whether err explains why a coupon cannot be
+// used, as opposed to a failure looking it up
+func IsCouponRejection(err error) bool {
+	for _, reason := range couponRejections {
+		if errors.Is(err, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// Coupon is an admin-managed discount code. Empty ProductIDs and CategoryIDs
+// mean the coupon applies to the whole cart.
+type Coupon struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Code         string               `bson:"code" json:"code"` // stored upper-case
+	Description  string               `bson:"description,omitempty" json:"description,omitempty"`
+	Type         string               `bson:"type" json:"type"` // flat, percentage
+	Value        float64              `bson:"value" json:"value"`
+	MaxDiscount  float64              `bson:"max_discount,omitempty" json:"max_discount,omitempty"` // cap for percentage coupons
+	MinCartValue float64              `bson:"min_cart_value" json:"min_cart_value"`
+	UsageLimit   int                  `bson:"usage_limit" json:"usage_limit"`       // total redemptions, 0 = unlimited
+	PerUserLimit int                  `bson:"per_user_limit" json:"per_user_limit"` // redemptions per farmer, 0 = unlimited
+	UsedCount    int                  `bson:"used_count" json:"used_count"`
+	ProductIDs   []primitive.ObjectID `bson:"product_ids,omitempty" json:"product_ids,omitempty"`
+	CategoryIDs  []primitive.ObjectID `bson:"category_ids,omitempty" json:"category_ids,omitempty"`
+	ValidFrom    *time.Time           `bson:"valid_from,omitempty" json:"valid_from,omitempty"`
+	ValidUntil   *time.Time           `bson:"valid_until,omitempty" json:"valid_until,omitempty"`
+	Active       bool                 `bson:"active" json:"active"`
+	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Promotion is an automatic quantity offer, e.g. buy 10 bags get 1 free.
+// Every BuyQuantity+FreeQuantity units of an eligible product in the cart
+// are charged as BuyQuantity, so the farmer adds 11 bags and pays for 10.
+type Promotion struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name         string               `bson:"name" json:"name"`
+	ProductIDs   []primitive.ObjectID `bson:"product_ids,omitempty" json:"product_ids,omitempty"`
+	CategoryIDs  []primitive.ObjectID `bson:"category_ids,omitempty" json:"category_ids,omitempty"`
+	BuyQuantity  int                  `bson:"buy_quantity" json:"buy_quantity"`
+	FreeQuantity int                  `bson:"free_quantity" json:"free_quantity"`
+	ValidFrom    *time.Time           `bson:"valid_from,omitempty" json:"valid_from,omitempty"`
+	ValidUntil   *time.Time           `bson:"valid_until,omitempty" json:"valid_until,omitempty"`
+	Active       bool                 `bson:"active" json:"active"`
+	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
+}
+
+// AppliedDiscount is one coupon, promotion or coin redemption locked into an
+// order at checkout
+type AppliedDiscount struct {
+	Kind   string             `bson:"kind" json:"kind"` // coupon, promotion, coins
+	ID     primitive.ObjectID `bson:"id" json:"id"`
+	Code   string             `bson:"code,omitempty" json:"code,omitempty"`
+	Label  string             `bson:"label" json:"label"`
+	Amount float64            `bson:"amount" json:"amount"`
+}
+
+// CouponRedemption records one use of a coupon, for per-user limits
+type CouponRedemption struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CouponID  primitive.ObjectID `bson:"coupon_id" json:"coupon_id"`
+	Code      string             `bson:"code" json:"code"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	OrderID   primitive.ObjectID `bson:"order_id" json:"order_id"`
+	Amount    float64            `bson:"amount" json:"amount"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// NormalizeCouponCode trims and upper-cases a code as typed by the farmer
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func inWindow(from, until *time.Time, now time.Time) bool {
+	return (from == nil || !now.Before(*from)) && (until == nil || now.Before(*until))
+}
+
+func inScope(productIDs, categoryIDs []primitive.ObjectID, item OrderItem) bool {
+	if len(productIDs) == 0 && len(categoryIDs) == 0 {
+		return true
+	}
+	for _, id := range productIDs {
+		if id == item.ProductID {
+			return true
+		}
+	}
+	for _, id := range categoryIDs {
+		if id == item.CategoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// RunningAt reports whether the promotion applies at the given time
+func (p Promotion) RunningAt(now time.Time) bool {
+	return p.Active && inWindow(p.ValidFrom, p.ValidUntil, now)
+}
+
+// FreeUnits is how many of quantity units are free under the promotion
+func (p Promotion) FreeUnits(quantity int) int {
+	group := p.BuyQuantity + p.FreeQuantity
+	if p.BuyQuantity <= 0 || p.FreeQuantity <= 0 {
+		return 0
+	}
+	return quantity / group * p.FreeQuantity
+}
+
+// Check validates the coupon's status and validity window
+func (c Coupon) Check(now time.Time) error {
+	switch {
+	case !c.Active:
+		return ErrCouponInactive
+	case c.ValidFrom != nil && now.Before(*c.ValidFrom):
+		return ErrCouponNotStarted
+	case c.ValidUntil != nil && !now.Before(*c.ValidUntil):
+		return ErrCouponExpired
+	case c.UsageLimit > 0 && c.UsedCount >= c.UsageLimit:
+		return ErrCouponUsageLimit
+	}
+	return nil
+}
+
+// EvaluateDiscounts works out the promotions and coupon that apply to the
+// order lines. Promotions are applied first; the coupon then works on what
+// is left of the eligible lines. Each line's best promotion wins, they do
+// not stack. coupon may be nil.
+func EvaluateDiscounts(items []OrderItem, promotions []Promotion, coupon *Coupon, now time.Time) ([]AppliedDiscount, error) {
+	discounts := []AppliedDiscount{}
+	remaining := make([]float64, len(items))
+	cartValue := 0.0
+	for i, item := range items {
+		remaining[i] = RoundAmount(item.UnitPrice * float64(item.Quantity))
+		cartValue += remaining[i]
+	}
+
+	for i, item := range items {
+		var best *Promotion
+		bestAmount := 0.0
+		for p := range promotions {
+			promo := promotions[p]
+			if !promo.RunningAt(now) || !inScope(promo.ProductIDs, promo.CategoryIDs, item) {
+				continue
+			}
+			amount := RoundAmount(float64(promo.FreeUnits(item.Quantity)) * item.UnitPrice)
+			if amount > bestAmount {
+				best, bestAmount = &promotions[p], amount
+			}
+		}
+		if best == nil {
+			continue
+		}
+		remaining[i] = RoundAmount(remaining[i] - bestAmount)
+		discounts = append(discounts, AppliedDiscount{
+			Kind:   DiscountPromotion,
+			ID:     best.ID,
+			Label:  fmt.Sprintf("%s: %d %s free", best.Name, best.FreeUnits(item.Quantity), item.Name),
+			Amount: bestAmount,
+		})
+	}
+
+	if coupon == nil {
+		return discounts, nil
+	}
+	if err := coupon.Check(now); err != nil {
+		return discounts, err
+	}
+	if RoundAmount(cartValue) < coupon.MinCartValue {
+		return discounts, fmt.Errorf("%w of ₹%.2f", ErrCouponMinCartValue, coupon.MinCartValue)
+	}
+
+	eligible := 0.0
+	for i, item := range items {
+		if inScope(coupon.ProductIDs, coupon.CategoryIDs, item) {
+			eligible += remaining[i]
+		}
+	}
+	if eligible <= 0 {
+		return discounts, ErrCouponNotApplicable
+	}
+
+	amount := coupon.Value
+	if coupon.Type == CouponPercentage {
+		amount = eligible * coupon.Value / 100
+		if coupon.MaxDiscount > 0 && amount > coupon.MaxDiscount {
+			amount = coupon.MaxDiscount
+		}
+	}
+	if amount > eligible {
+		amount = eligible
+	}
+
+	label := coupon.Description
+	if label == "" {
+		label = "Coupon " + coupon.Code
+	}
+	discounts = append(discounts, AppliedDiscount{
+		Kind:   DiscountCoupon,
+		ID:     coupon.ID,
+		Code:   coupon.Code,
+		Label:  label,
+		Amount: RoundAmount(amount),
+	})
+	return discounts, nil
+}
+
+// TotalDiscount adds up the applied discounts
+func TotalDiscount(discounts []AppliedDiscount) float64 {
+	total := 0.0
+	for _, d := range discounts {
+		total += d.Amount
+	}
+	return RoundAmount(total)
+}
+
+// CouponInput is used by admins to create or edit a coupon
+type CouponInput struct {
+	Code         string     `json:"code" binding:"required,alphanum,min=3,max=20"`
+	Description  string     `json:"description"`
+	Type         string     `json:"type" binding:"required,oneof=flat percentage"`
+	Value        float64    `json:"value" binding:"required,gt=0"`
+	MaxDiscount  float64    `json:"max_discount" binding:"gte=0"`
+	MinCartValue float64    `json:"min_cart_value" binding:"gte=0"`
+	UsageLimit   int        `json:"usage_limit" binding:"gte=0"`
+	PerUserLimit int        `json:"per_user_limit" binding:"gte=0"`
+	ProductIDs   []string   `json:"product_ids"`
+	CategoryIDs  []string   `json:"category_ids"`
+	ValidFrom    *time.Time `json:"valid_from"`
+	ValidUntil   *time.Time `json:"valid_until"`
+	Active       *bool      `json:"active"` // defaults to true
+}
+
+// PromotionInput is used by admins to start an automatic promotion
+type PromotionInput struct {
+	Name         string     `json:"name" binding:"required"`
+	ProductIDs   []string   `json:"product_ids"`
+	CategoryIDs  []string   `json:"category_ids"`
+	BuyQuantity  int        `json:"buy_quantity" binding:"required,min=1"`
+	FreeQuantity int        `json:"free_quantity" binding:"required,min=1"`
+	ValidFrom    *time.Time `json:"valid_from"`
+	ValidUntil   *time.Time `json:"valid_until"`
+}
+
+// ApplyCouponInput is posted by the farmer to use a coupon on their cart
+type ApplyCouponInput struct {
+	Code string `json:"code" binding:"required"`
+}
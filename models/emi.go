@@ -0,0 +1,202 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EMI plan and installment statuses
+const (
+	EMIPlanPendingApproval = "pending_approval" // applied for; the order waits for the dealer
+	EMIPlanActive          = "active"
+	EMIPlanCompleted       = "completed"
+	EMIPlanRejected        = "rejected"
+	EMIPlanCancelled       = "cancelled" // the order was cancelled
+
+	InstallmentDue  = "due"
+	InstallmentPaid = "paid"
+)
+
+// EMIConfig sets the tenures and interest rate offered for a product
+// category. The config without a category is the default for the rest.
+type EMIConfig struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	CategoryID     *primitive.ObjectID `bson:"category_id,omitempty" json:"category_id,omitempty"`
+	Tenures        []int               `bson:"tenures" json:"tenures"`             // months
+	InterestRate   float64             `bson:"interest_rate" json:"interest_rate"` // annual %, reducing balance
+	MinOrderAmount float64             `bson:"min_order_amount" json:"min_order_amount"`
+	UpdatedAt      time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// AllowsTenure reports whether the config offers a plan of the given length
+func (c EMIConfig) AllowsTenure(months int) bool {
+	for _, t := range c.Tenures {
+		if t == months {
+			return true
+		}
+	}
+	return false
+}
+
+// EMIInstallment is one row of an amortization schedule
+type EMIInstallment struct {
+	Number    int        `bson:"number" json:"number"`
+	DueDate   time.Time  `bson:"due_date" json:"due_date"`
+	Amount    float64    `bson:"amount" json:"amount"`
+	Principal float64    `bson:"principal" json:"principal"`
+	Interest  float64    `bson:"interest" json:"interest"`
+	Balance   float64    `bson:"balance" json:"balance"` // principal still owed after this installment
+	Status    string     `bson:"status" json:"status"`   // due, paid
+	PaidAt    *time.Time `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	Reference string     `bson:"reference,omitempty" json:"reference,omitempty"`
+}
+
+// IsOverdue reports whether the installment is unpaid past its due date
+func (i EMIInstallment) IsOverdue(now time.Time) bool {
+	return i.Status == InstallmentDue && now.After(i.DueDate)
+}
+
+// EMIPlan finances an order over a fixed number of monthly installments
+type EMIPlan struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrderID            primitive.ObjectID `bson:"order_id" json:"order_id"`
+	UserID             primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Principal          float64            `bson:"principal" json:"principal"`
+	InterestRate       float64            `bson:"interest_rate" json:"interest_rate"`
+	TenureMonths       int                `bson:"tenure_months" json:"tenure_months"`
+	MonthlyInstallment float64            `bson:"monthly_installment" json:"monthly_installment"`
+	TotalInterest      float64            `bson:"total_interest" json:"total_interest"`
+	TotalPayable       float64            `bson:"total_payable" json:"total_payable"`
+	AmountPaid         float64            `bson:"amount_paid" json:"amount_paid"`                       // installments collected
+	DownPayment        float64            `bson:"down_payment,omitempty" json:"down_payment,omitempty"` // collected on approval, not financed
+	Status             string             `bson:"status" json:"status"`
+	Installments       []EMIInstallment   `bson:"installments" json:"installments"`
+	ReviewedBy         string             `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	ReviewNote         string             `bson:"review_note,omitempty" json:"review_note,omitempty"`
+	ApprovedAt         *time.Time         `bson:"approved_at,omitempty" json:"approved_at,omitempty"`
+	CreatedAt          time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Collected is what the farmer has actually paid towards the order so far
+func (p *EMIPlan) Collected() float64 {
+	return RoundAmount(p.DownPayment + p.AmountPaid)
+}
+
+// NextInstallment returns the earliest unpaid installment, or nil once the plan is repaid
+func (p *EMIPlan) NextInstallment() *EMIInstallment {
+	for i := range p.Installments {
+		if p.Installments[i].Status == InstallmentDue {
+			return &p.Installments[i]
+		}
+	}
+	return nil
+}
+
+// NewEMIPlan builds a plan for principal at an annual rate, with the first
+// installment due one month after start. The plan waits for approval.
+func NewEMIPlan(orderID, userID primitive.ObjectID, principal, annualRate float64, months int, start time.Time) EMIPlan {
+	schedule := BuildEMISchedule(principal, annualRate, months, start)
+
+	total := 0.0
+	for _, inst := range schedule {
+		total += inst.Amount
+	}
+	total = RoundAmount(total)
+
+	return EMIPlan{
+		OrderID:            orderID,
+		UserID:             userID,
+		Principal:          RoundAmount(principal),
+		InterestRate:       annualRate,
+		TenureMonths:       months,
+		MonthlyInstallment: MonthlyInstallment(principal, annualRate, months),
+		TotalInterest:      RoundAmount(total - principal),
+		TotalPayable:       total,
+		Status:             EMIPlanPendingApproval,
+		Installments:       schedule,
+		CreatedAt:          start,
+		UpdatedAt:          start,
+	}
+}
+
+// MonthlyInstallment is the fixed reducing-balance EMI:
+// P·r·(1+r)^n / ((1+r)^n − 1), with r the monthly rate.
+func MonthlyInstallment(principal, annualRate float64, months int) float64 {
+	if months <= 0 {
+		return 0
+	}
+	r := annualRate / 12 / 100
+	if r == 0 {
+		return RoundAmount(principal / float64(months))
+	}
+	f := math.Pow(1+r, float64(months))
+	return RoundAmount(principal * r * f / (f - 1))
+}
+
+// BuildEMISchedule splits each installment into interest on the balance
+// and principal. The last installment clears whatever rounding left over.
+func BuildEMISchedule(principal, annualRate float64, months int, start time.Time) []EMIInstallment {
+	emi := MonthlyInstallment(principal, annualRate, months)
+	r := annualRate / 12 / 100
+	balance := RoundAmount(principal)
+
+	schedule := make([]EMIInstallment, 0, months)
+	for n := 1; n <= months; n++ {
+		interest := RoundAmount(balance * r)
+		principalPart := RoundAmount(emi - interest)
+		if n == months || principalPart > balance {
+			principalPart = balance
+		}
+		balance = RoundAmount(balance - principalPart)
+
+		schedule = append(schedule, EMIInstallment{
+			Number:    n,
+			DueDate:   start.AddDate(0, n, 0),
+			Amount:    RoundAmount(principalPart + interest),
+			Principal: principalPart,
+			Interest:  interest,
+			Balance:   balance,
+			Status:    InstallmentDue,
+		})
+	}
+	return schedule
+}
+
+// EMIQuote previews a tenure before the farmer applies
+type EMIQuote struct {
+	Months             int     `json:"months"`
+	InterestRate       float64 `json:"interest_rate"`
+	MonthlyInstallment float64 `json:"monthly_installment"`
+	TotalInterest      float64 `json:"total_interest"`
+	TotalPayable       float64 `json:"total_payable"`
+}
+
+// EMIApplyInput is used to finance an order on EMI
+type EMIApplyInput struct {
+	OrderID string `json:"orderId" binding:"required"`
+	Months  int    `json:"months" binding:"required"`
+}
+
+// EMIConfigInput is used by admins to set EMI terms for a category.
+// Leave CategoryID empty to set the default terms.
+type EMIConfigInput struct {
+	CategoryID     string  `json:"category_id"`
+	Tenures        []int   `json:"tenures" binding:"required,min=1"`
+	InterestRate   float64 `json:"interest_rate" binding:"gte=0"`
+	MinOrderAmount float64 `json:"min_order_amount" binding:"gte=0"`
+}
+
+// EMIReviewInput is used by admins to approve or reject an EMI application.
+// A down payment collected on approval is taken off the financed amount.
+type EMIReviewInput struct {
+	DownPayment float64 `json:"down_payment" binding:"gte=0"`
+	Note        string  `json:"note"`
+}
+
+// EMIPaymentInput is used by admins to record a collected installment
+type EMIPaymentInput struct {
+	Reference string `json:"reference"` // UPI/bank transaction or receipt number
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IdempotencyWindow is how long a stored response is replayed for retries
+// carrying the same Idempotency-Key
+const IdempotencyWindow = 24 * time.Hour
+
+// Idempotency record states
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord holds the first response to a request sent with an
+// Idempotency-Key, so a retry of the same request gets the same answer
+// instead of placing a second order or charging twice
+type IdempotencyRecord struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Key          string             `bson:"key" json:"key"`
+	Owner        string             `bson:"owner" json:"owner"` // user ID, or admin email
+	Method       string             `bson:"method" json:"method"`
+	Path         string             `bson:"path" json:"path"`
+	RequestHash  string             `bson:"request_hash" json:"request_hash"` // SHA-256 of the body
+	Status       string             `bson:"status" json:"status"`
+	ResponseCode int                `bson:"response_code,omitempty" json:"response_code,omitempty"`
+	ResponseType string             `bson:"response_type,omitempty" json:"response_type,omitempty"`
+	ResponseBody []byte             `bson:"response_body,omitempty" json:"-"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	CompletedAt  *time.Time         `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// Replayable reports whether the stored response can still be sent back
+func (r IdempotencyRecord) Replayable(now time.Time) bool {
+	return r.Status == IdempotencyCompleted && now.Sub(r.CreatedAt) < IdempotencyWindow
+}
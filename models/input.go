@@ -17,9 +17,16 @@ type LoginInput struct {
 
 // ========== Return ==========
 type ReturnRequestInput struct {
-	OrderID    string `json:"order_id" binding:"required"`
-	Reason     string `json:"reason" binding:"required"`
-	ReturnType string `json:"return_type" binding:"required"`
+	OrderID      string            `json:"order_id" binding:"required"`
+	Reason       string            `json:"reason" binding:"required"`
+	ReturnType   string            `json:"return_type" binding:"required"`
+	Items        []ReturnItemInput `json:"items" binding:"dive"`                                    // empty = whole order
+	RefundMethod string            `json:"refund_method" binding:"omitempty,oneof=original wallet"` // default original
+}
+
+type ReturnItemInput struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
 }
 
 // ========== Refund ==========
@@ -27,6 +34,7 @@ type RefundRequestInput struct {
 	OrderID string  `json:"order_id" binding:"required"`
 	Amount  float64 `json:"amount" binding:"required"`
 	Reason  string  `json:"reason" binding:"required"`
+	Method  string  `json:"method" binding:"omitempty,oneof=original wallet"` // default original
 }
 
 // ========== Support ==========
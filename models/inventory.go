@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Warehouse is a physical location stock is held at (e.g. a district depot)
+type Warehouse struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code      string             `bson:"code" json:"code"`
+	Name      string             `bson:"name" json:"name"`
+	District  string             `bson:"district" json:"district"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// InventoryItem is the stock level of one product in one warehouse.
+// Available quantity is OnHand - Reserved.
+type InventoryItem struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProductID   primitive.ObjectID `bson:"product_id" json:"product_id"`
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	OnHand      int                `bson:"on_hand" json:"on_hand"`
+	Reserved    int                `bson:"reserved" json:"reserved"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Stock movement types recorded in the ledger
+const (
+	StockMovementReceipt    = "receipt"
+	StockMovementAdjustment = "adjustment"
+	StockMovementReserve    = "reserve"
+	StockMovementRelease    = "release"
+	StockMovementDispatch   = "dispatch"
+	StockMovementReturn     = "return" // returned units that passed quality check
+)
+
+// StockMovement is one entry in the inventory ledger
+type StockMovement struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ProductID   primitive.ObjectID  `bson:"product_id" json:"product_id"`
+	WarehouseID primitive.ObjectID  `bson:"warehouse_id" json:"warehouse_id"`
+	OrderID     *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	Type        string              `bson:"type" json:"type"`
+	Quantity    int                 `bson:"quantity" json:"quantity"` // signed change to on_hand or reserved
+	Reason      string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// StockReservation holds stock against an order until it is dispatched or released
+type StockReservation struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrderID     primitive.ObjectID `bson:"order_id" json:"order_id"`
+	ProductID   primitive.ObjectID `bson:"product_id" json:"product_id"`
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+	Status      string             `bson:"status" json:"status"` // reserved, released, dispatched
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// WarehouseInput is used by admins to create a warehouse
+type WarehouseInput struct {
+	Code     string `json:"code" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	District string `json:"district"`
+}
+
+// StockAdjustmentInput is used by admins to receive or correct stock.
+// Quantity is signed: positive adds stock, negative removes it.
+type StockAdjustmentInput struct {
+	ProductID   string `json:"product_id" binding:"required"`
+	WarehouseID string `json:"warehouse_id" binding:"required"`
+	Quantity    int    `json:"quantity" binding:"required"`
+	Type        string `json:"type"` // receipt (default) or adjustment
+	Reason      string `json:"reason"`
+}
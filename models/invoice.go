@@ -1,26 +1,114 @@
 package models
 
 import (
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"fmt"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// InvoiceParty identifies the seller or the buyer on a tax invoice
+type InvoiceParty struct {
+	Name      string `bson:"name" json:"name"`
+	GSTIN     string `bson:"gstin,omitempty" json:"gstin,omitempty"`
+	Address   string `bson:"address,omitempty" json:"address,omitempty"`
+	State     string `bson:"state,omitempty" json:"state,omitempty"`
+	StateCode string `bson:"state_code,omitempty" json:"state_code,omitempty"`
+}
+
 type InvoiceItem struct {
 	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
 	Name      string             `bson:"name" json:"name"`
+	HSNCode   string             `bson:"hsn_code,omitempty" json:"hsn_code,omitempty"`
 	Quantity  int                `bson:"quantity" json:"quantity"`
 	Price     float64            `bson:"price" json:"price"`
+	GSTRate   float64            `bson:"gst_rate" json:"gst_rate"`
+	LineTotal float64            `bson:"line_total" json:"line_total"`
+	LineTax   `bson:",inline"`
 }
 
 type Invoice struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	InvoiceNo   string             `bson:"invoice_number" json:"invoice_number"`
-	OrderID     primitive.ObjectID `bson:"order_id" json:"order_id"`
-	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
-	Amount      float64            `bson:"amount" json:"amount"`
-	Total       float64            `bson:"total" json:"total"`
-	TotalPrice  float64            `bson:"total_price" json:"total_price"`
-	Date        time.Time          `bson:"date" json:"date"`
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
-	Items       []InvoiceItem      `bson:"items" json:"items"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	InvoiceNo     string             `bson:"invoice_number" json:"invoice_number"`
+	OrderID       primitive.ObjectID `bson:"order_id" json:"order_id"`
+	UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Seller        InvoiceParty       `bson:"seller" json:"seller"`
+	Buyer         InvoiceParty       `bson:"buyer" json:"buyer"`
+	PlaceOfSupply string             `bson:"place_of_supply" json:"place_of_supply"` // GST state code
+	Subtotal      float64            `bson:"subtotal" json:"subtotal"`
+	Discount      float64            `bson:"discount" json:"discount"`
+	Total         float64            `bson:"total" json:"total"` // amount payable, GST included
+	PDFPath       string             `bson:"pdf_path,omitempty" json:"-"`
+	Date          time.Time          `bson:"date" json:"date"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	Items         []InvoiceItem      `bson:"items" json:"items"`
+	TaxBreakdown  `bson:",inline"`
+}
+
+// NewInvoice builds a tax invoice from an order's checkout snapshot. The
+// GST is worked out again against the seller's registered state, which
+// decides between CGST+SGST and IGST.
+func NewInvoice(order Order, invoiceNo string, seller, buyer InvoiceParty) Invoice {
+	sellerState := GSTStateCode(seller.StateCode)
+	if sellerState == "" {
+		sellerState = GSTStateCode(seller.State)
+	}
+	placeOfSupply := GSTStateCode(buyer.StateCode)
+	if placeOfSupply == "" {
+		placeOfSupply = GSTStateCode(buyer.State)
+	}
+	if placeOfSupply == "" {
+		placeOfSupply = sellerState
+	}
+
+	lines := make([]TaxLine, len(order.Items))
+	for i, item := range order.Items {
+		lines[i] = TaxLine{Rate: item.GSTRate, Amount: item.LineTotal}
+	}
+	perLine, breakdown := ComputeTax(lines, order.Discount, IsInterState(sellerState, placeOfSupply))
+
+	now := time.Now()
+	inv := Invoice{
+		InvoiceNo:     invoiceNo,
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		Seller:        seller,
+		Buyer:         buyer,
+		PlaceOfSupply: placeOfSupply,
+		Subtotal:      order.Subtotal,
+		Discount:      order.Discount,
+		Total:         order.TotalAmount,
+		TaxBreakdown:  breakdown,
+		Date:          now,
+		CreatedAt:     now,
+		Items:         make([]InvoiceItem, 0, len(order.Items)),
+	}
+	for i, item := range order.Items {
+		inv.Items = append(inv.Items, InvoiceItem{
+			ProductID: item.ProductID,
+			Name:      item.Name,
+			HSNCode:   item.HSNCode,
+			Quantity:  item.Quantity,
+			Price:     item.UnitPrice,
+			GSTRate:   item.GSTRate,
+			LineTotal: item.LineTotal,
+			LineTax:   perLine[i],
+		})
+	}
+	return inv
+}
+
+// FinancialYear returns the Indian financial year (April–March) of t, e.g. "24-25"
+func FinancialYear(t time.Time) string {
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%02d-%02d", start%100, (start+1)%100)
+}
+
+// FormatInvoiceNumber renders a number in a series, e.g. "SS/24-25/000042".
+// GST rules cap invoice numbers at 16 characters.
+func FormatInvoiceNumber(prefix, financialYear string, seq int64) string {
+	return fmt.Sprintf("%s/%s/%06d", prefix, financialYear, seq)
 }
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ledger accounts. The user accounts are kept per farmer (LedgerAccount.UserID);
+// the others belong to the platform.
+const (
+	AccountUserWallet      = "user_wallet"      // rupees held for the farmer
+	AccountUserCoins       = "user_coins"       // coins held by the farmer
+	AccountPlatformRevenue = "platform_revenue" // rupees earned on orders
+	AccountRefundsPayable  = "refunds_payable"  // refunds issued but not yet paid out
+	AccountPaymentGateway  = "payment_gateway"  // rupees collected at the gateway
+	AccountCoinPool        = "coin_pool"        // platform side of every coin given or spent
+)
+
+// Ledger currencies; an entry never mixes the two
+const (
+	LedgerCurrencyINR  = "INR"
+	LedgerCurrencyCoin = "COIN"
+)
+
+// What a ledger entry records
+const (
+	LedgerKindWallet      = "wallet"          // a wallet_transactions entry
+	LedgerKindCoinsDebit  = "coins_debit"     // coins spent
+	LedgerKindCoinsCredit = "coins_credit"    // coins given or returned
+	LedgerKindPayment     = "payment"         // gateway payment captured
+	LedgerKindRefund      = "refund"          // refund issued
+	LedgerKindRefundPaid  = "refund_paid"     // refund paid out by the gateway
+	LedgerKindOpening     = "opening_balance" // balance from before the ledger
+)
+
+// CreditNormal reports whether credits increase the account's balance:
+// true for what the platform owes or earns, false for what it holds
+func CreditNormal(account string) bool {
+	return account != AccountPaymentGateway && account != AccountCoinPool
+}
+
+// LedgerAccount names an account, and the farmer for user accounts
+type LedgerAccount struct {
+	Name   string              `bson:"account" json:"account"`
+	UserID *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+}
+
+// UserAccount is the farmer's own account of the given kind
+func UserAccount(name string, userID primitive.ObjectID) LedgerAccount {
+	return LedgerAccount{Name: name, UserID: &userID}
+}
+
+// PlatformAccount is one of the platform's shared accounts
+func PlatformAccount(name string) LedgerAccount {
+	return LedgerAccount{Name: name}
+}
+
+// LedgerPosting is one side of a ledger entry
+type LedgerPosting struct {
+	LedgerAccount `bson:",inline"`
+	Debit         float64 `bson:"debit" json:"debit"`
+	Credit        float64 `bson:"credit" json:"credit"`
+}
+
+// LedgerEntry is a double-entry journal record: its debits and credits add
+// up to the same amount. Kind and Reference identify the business event
+// (e.g. refund, refund:<id>); each event is posted once.
+type LedgerEntry struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Kind        string             `bson:"kind" json:"kind"`
+	Reference   string             `bson:"reference" json:"reference"`
+	Currency    string             `bson:"currency" json:"currency"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Postings    []LedgerPosting    `bson:"postings" json:"postings"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// NewLedgerEntry moves amount by debiting one account and crediting another
+func NewLedgerEntry(kind, reference, currency string, amount float64, debit, credit LedgerAccount, description string) LedgerEntry {
+	amount = RoundAmount(amount)
+	return LedgerEntry{
+		ID:          primitive.NewObjectID(),
+		Kind:        kind,
+		Reference:   reference,
+		Currency:    currency,
+		Description: description,
+		Postings: []LedgerPosting{
+			{LedgerAccount: debit, Debit: amount},
+			{LedgerAccount: credit, Credit: amount},
+		},
+		CreatedAt: time.Now(),
+	}
+}
+
+// Balanced reports whether the entry can be posted: at least two postings,
+// each a positive debit or credit, adding up to the same total
+func (e LedgerEntry) Balanced() bool {
+	if len(e.Postings) < 2 {
+		return false
+	}
+	debits, credits := 0.0, 0.0
+	for _, p := range e.Postings {
+		if p.Debit < 0 || p.Credit < 0 || (p.Debit > 0) == (p.Credit > 0) {
+			return false
+		}
+		debits += p.Debit
+		credits += p.Credit
+	}
+	return math.Abs(debits-credits) < 0.005
+}
+
+// Reconciliation checks
+const (
+	CheckUnbalancedEntry = "unbalanced_entry" // entry whose debits and credits differ
+	CheckWalletBalance   = "wallet_balance"   // wallets vs user_wallet
+	CheckWalletStatement = "wallet_statement" // wallet_transactions vs user_wallet
+	CheckCoinBalance     = "coin_balance"     // coins vs user_coins
+	CheckRefundsPayable  = "refunds_payable"  // failed refunds vs refunds_payable
+	CheckPaymentGateway  = "payment_gateway"  // captured gateway payments vs payment_gateway
+)
+
+// ReconciliationMismatch is a figure that does not agree with the ledger
+type ReconciliationMismatch struct {
+	Check     string              `json:"check"`
+	UserID    *primitive.ObjectID `json:"user_id,omitempty"`
+	Reference string              `json:"reference,omitempty"`
+	Ledger    float64             `json:"ledger"` // per the ledger
+	Actual    float64             `json:"actual"` // per the balance or records
+}
+
+// LedgerAccountBalance is an account's totals across all entries
+type LedgerAccountBalance struct {
+	Account  string  `json:"account"`
+	Currency string  `json:"currency"`
+	Debits   float64 `json:"debits"`
+	Credits  float64 `json:"credits"`
+	Balance  float64 `json:"balance"`
+}
+
+// ReconciliationReport compares the ledger with the balances kept elsewhere
+type ReconciliationReport struct {
+	GeneratedAt time.Time                `json:"generated_at"`
+	Accounts    []LedgerAccountBalance   `json:"accounts"`
+	Mismatches  []ReconciliationMismatch `json:"mismatches"`
+	Reconciled  bool                     `json:"reconciled"`
+}
+
+// CompareUserBalances lists the farmers whose actual balance differs from
+// the ledger; a farmer missing from either side counts as zero there
+func CompareUserBalances(check string, ledger, actual map[primitive.ObjectID]float64) []ReconciliationMismatch {
+	var mismatches []ReconciliationMismatch
+	seen := map[primitive.ObjectID]bool{}
+	for _, balances := range []map[primitive.ObjectID]float64{ledger, actual} {
+		for userID := range balances {
+			if seen[userID] {
+				continue
+			}
+			seen[userID] = true
+			if m, ok := CompareAmounts(check, ledger[userID], actual[userID]); ok {
+				id := userID
+				m.UserID = &id
+				mismatches = append(mismatches, m)
+			}
+		}
+	}
+	return mismatches
+}
+
+// CompareAmounts returns a mismatch if the two amounts differ by a paisa or more
+func CompareAmounts(check string, ledger, actual float64) (ReconciliationMismatch, bool) {
+	ledger, actual = RoundAmount(ledger), RoundAmount(actual)
+	if math.Abs(ledger-actual) < 0.005 {
+		return ReconciliationMismatch{}, false
+	}
+	return ReconciliationMismatch{Check: check, Ledger: ledger, Actual: actual}, true
+}
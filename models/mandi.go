@@ -0,0 +1,33 @@
+package models
+
+// PriceAlertInput asks to be told when a crop's mandi price crosses a threshold
+type PriceAlertInput struct {
+	UserID         string  `json:"user_id" binding:"required"`
+	Crop           string  `json:"crop" binding:"required"`
+	District       string  `json:"district" binding:"required"`
+	PriceThreshold float64 `json:"price_threshold" binding:"required"`
+	NotifyMethod   string  `json:"notify_method"` // e.g. "sms", "email"
+}
+
+// CancelPriceAlertInput names the alert to cancel
+type CancelPriceAlertInput struct {
+	UserID   string `json:"user_id" binding:"required"`
+	Crop     string `json:"crop" binding:"required"`
+	District string `json:"district" binding:"required"`
+}
+
+// TransportBookingInput books a vehicle to carry produce
+type TransportBookingInput struct {
+	UserID         string  `json:"user_id" binding:"required"`
+	Crop           string  `json:"crop" binding:"required"`
+	Quantity       float64 `json:"quantity" binding:"required"` // in quintals
+	PickupLocation string  `json:"pickup_location" binding:"required"`
+	DropLocation   string  `json:"drop_location" binding:"required"`
+	Date           string  `json:"date" binding:"required"`
+}
+
+// UpdateTransportStatusInput moves a transport booking on (admin)
+type UpdateTransportStatusInput struct {
+	BookingID string `json:"booking_id" binding:"required"`
+	Status    string `json:"status" binding:"required"`
+}
@@ -1,15 +1,123 @@
 package models
 
 import (
+	"fmt"
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// OrderItem is a snapshot of a cart line taken at checkout, so later
+// product price changes do not alter what the farmer owes.
+type OrderItem struct {
+	ProductID  primitive.ObjectID `bson:"product_id" json:"product_id"`
+	CategoryID primitive.ObjectID `bson:"category_id,omitempty" json:"category_id,omitempty"`
+	Name       string             `bson:"name" json:"name"`
+	ImageURL   string             `bson:"image_url,omitempty" json:"image_url,omitempty"`
+	HSNCode    string             `bson:"hsn_code,omitempty" json:"hsn_code,omitempty"`
+	GSTRate    float64            `bson:"gst_rate" json:"gst_rate"`
+	UnitPrice  float64            `bson:"unit_price" json:"unit_price"`
+	Quantity   int                `bson:"quantity" json:"quantity"`
+	LineTotal  float64            `bson:"line_total" json:"line_total"`
+	LineTax    `bson:",inline"`   // GST contained in the line after discount
+}
+
 type Order struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"` // Add this for order ID
-	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
-	Items     []CartItem         `bson:"items" json:"items"`
-	Status    string             `bson:"status" json:"status"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id"` // Add this for order ID
+	UserID          primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Items           []OrderItem         `bson:"items" json:"items"`
+	Subtotal        float64             `bson:"subtotal" json:"subtotal"`
+	Discount        float64             `bson:"discount" json:"discount"`
+	Discounts       []AppliedDiscount   `bson:"discounts,omitempty" json:"discounts,omitempty"` // coupon and promotions behind Discount
+	CouponCode      string              `bson:"coupon_code,omitempty" json:"coupon_code,omitempty"`
+	CoinsUsed       int                 `bson:"coins_used,omitempty" json:"coins_used,omitempty"`
+	Tax             float64             `bson:"tax" json:"tax"` // GST included in TotalAmount
+	TotalAmount     float64             `bson:"total_amount" json:"total_amount"`
+	ShippingAddress *ShippingAddress    `bson:"shipping_address,omitempty" json:"shipping_address,omitempty"` // as given at checkout
+	PlaceOfSupply   string              `bson:"place_of_supply,omitempty" json:"place_of_supply,omitempty"`   // GST state code the order ships to
+	TaxBreakdown    TaxBreakdown        `bson:"tax_breakdown" json:"tax_breakdown"`
+	Status          string              `bson:"status" json:"status"`
+	PaymentStatus   string              `bson:"payment_status,omitempty" json:"payment_status,omitempty"`
+	PaymentID       *primitive.ObjectID `bson:"payment_id,omitempty" json:"payment_id,omitempty"`
+	RefundedTotal   float64             `bson:"refunded_total,omitempty" json:"refunded_total,omitempty"` // refunds issued so far, including ones awaiting a retry
+	StatusHistory   []OrderStatusEvent  `bson:"status_history" json:"status_history"`
+	DeliveredAt     *time.Time          `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	CancelledAt     *time.Time          `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	CancelReason    string              `bson:"cancel_reason,omitempty" json:"cancel_reason,omitempty"`
+	CreatedAt       time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time           `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// CalculateTotals fills line totals, subtotal, grand total and the GST
+// breakdown from the item snapshot. Prices are GST-inclusive, so Tax is the
+// part of TotalAmount that is GST, not an extra charge. Discount and
+// PlaceOfSupply must be set before calling it.
+func (o *Order) CalculateTotals(sellerState string) {
+	subtotal := 0.0
+	lines := make([]TaxLine, len(o.Items))
+	for i := range o.Items {
+		o.Items[i].LineTotal = RoundAmount(o.Items[i].UnitPrice * float64(o.Items[i].Quantity))
+		subtotal += o.Items[i].LineTotal
+		lines[i] = TaxLine{Rate: o.Items[i].GSTRate, Amount: o.Items[i].LineTotal}
+	}
+
+	o.Subtotal = RoundAmount(subtotal)
+	o.TotalAmount = RoundAmount(o.Subtotal - o.Discount)
+	if o.TotalAmount < 0 {
+		o.TotalAmount = 0
+	}
+
+	perLine, breakdown := ComputeTax(lines, o.Discount, IsInterState(sellerState, o.PlaceOfSupply))
+	for i := range o.Items {
+		o.Items[i].LineTax = perLine[i]
+	}
+	o.TaxBreakdown = breakdown
+	o.Tax = breakdown.TotalTax
+}
+
+// RedeemCoins takes up to coins off what is left to pay after other
+// discounts and recalculates the totals. It returns the coins actually used,
+// which is fewer than asked when the order is worth less than them.
+func (o *Order) RedeemCoins(coins int, sellerState string) int {
+	if coins <= 0 {
+		return 0
+	}
+	o.CalculateTotals(sellerState)
+	used := int(math.Min(float64(coins), math.Floor(o.TotalAmount/CoinValue)))
+	if used <= 0 {
+		return 0
+	}
+
+	amount := RoundAmount(float64(used) * CoinValue)
+	o.Discounts = append(o.Discounts, AppliedDiscount{Kind: DiscountCoins, Label: fmt.Sprintf("%d coins redeemed", used), Amount: amount})
+	o.Discount = RoundAmount(o.Discount + amount)
+	o.CoinsUsed = used
+	o.CalculateTotals(sellerState)
+	return used
+}
+
+// ShippingAddress is where an order is delivered. Its state decides the
+// GST place of supply.
+type ShippingAddress struct {
+	Name      string `bson:"name" json:"name"`
+	Phone     string `bson:"phone" json:"phone"`
+	Line1     string `bson:"line1" json:"line1" binding:"required"`
+	Line2     string `bson:"line2,omitempty" json:"line2,omitempty"`
+	City      string `bson:"city" json:"city"`
+	District  string `bson:"district,omitempty" json:"district,omitempty"`
+	State     string `bson:"state" json:"state" binding:"required"`
+	StateCode string `bson:"state_code" json:"state_code"` // GST state code, filled in from State
+	Pincode   string `bson:"pincode" json:"pincode" binding:"required"`
+}
+
+// CheckoutInput is the optional body of a checkout request
+type CheckoutInput struct {
+	Coins           int              `json:"coins" binding:"gte=0"` // coins to redeem against the order
+	ShippingAddress *ShippingAddress `json:"shipping_address"`      // the profile's state is used without one
+}
+
+// RoundAmount rounds a rupee amount to paise
+func RoundAmount(v float64) float64 {
+	return math.Round(v*100) / 100
 }
@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Order lifecycle statuses
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusPacked    = "packed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusReturned  = "returned"
+)
+
+// DefaultPendingOrderTTL is how long an order may wait for payment before
+// it is cancelled and its stock released, when PENDING_ORDER_TTL_MINUTES is
+// not set
+const DefaultPendingOrderTTL = 30 * time.Minute
+
+// orderTransitions lists the statuses each status may move to.
+// Cancelled and returned are terminal.
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusPacked, OrderStatusCancelled},
+	OrderStatusPacked:    {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:   {OrderStatusDelivered},
+	OrderStatusDelivered: {OrderStatusReturned},
+}
+
+// customerCancellable are the statuses a farmer may cancel from: anything
+// before the parcel leaves the warehouse
+var customerCancellable = []string{OrderStatusPending, OrderStatusPaid, OrderStatusPacked}
+
+// CustomerCancellableStatuses lists the statuses a farmer may cancel an order from
+func CustomerCancellableStatuses() []string {
+	return append([]string(nil), customerCancellable...)
+}
+
+// CanCustomerCancel reports whether the farmer may still cancel an order
+func CanCustomerCancel(status string) bool {
+	for _, s := range customerCancellable {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusEvent is one entry in an order's status timeline
+type OrderStatusEvent struct {
+	Status    string    `bson:"status" json:"status"`
+	Note      string    `bson:"note,omitempty" json:"note,omitempty"`
+	ChangedBy string    `bson:"changed_by,omitempty" json:"changed_by,omitempty"`
+	ChangedAt time.Time `bson:"changed_at" json:"changed_at"`
+}
+
+// CancelOrderInput is the optional body of a farmer's cancel request
+type CancelOrderInput struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// OrderStatusUpdateInput is used by admins to move an order along its lifecycle
+type OrderStatusUpdateInput struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
+
+// IsValidOrderStatus reports whether status is part of the order lifecycle
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusPacked, OrderStatusShipped,
+		OrderStatusDelivered, OrderStatusCancelled, OrderStatusReturned:
+		return true
+	}
+	return false
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another
+func CanTransitionOrder(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusesBefore returns every status that may move directly to the given one
+func OrderStatusesBefore(to string) []string {
+	var from []string
+	for status, nexts := range orderTransitions {
+		for _, next := range nexts {
+			if next == to {
+				from = append(from, status)
+			}
+		}
+	}
+	return from
+}
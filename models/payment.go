@@ -6,12 +6,40 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Payment attempt statuses
+const (
+	PaymentStatusCreated  = "created"
+	PaymentStatusCaptured = "captured"
+	PaymentStatusFailed   = "failed"
+	PaymentStatusRefunded = "refunded"
+)
+
+// Payment is one attempt to pay for an order, or a subscription invoice,
+// through a payment gateway
 type Payment struct {
+	ID                    primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrderID               primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	SubscriptionInvoiceID *primitive.ObjectID `bson:"subscription_invoice_id,omitempty" json:"subscription_invoice_id,omitempty"` // instead of OrderID for subscription charges
+	UserID                primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Method                string              `bson:"method" json:"method"` // e.g., UPI, Card
+	Provider              string              `bson:"provider" json:"provider"`
+	ProviderOrderID       string              `bson:"provider_order_id" json:"provider_order_id"`
+	ProviderPaymentID     string              `bson:"provider_payment_id,omitempty" json:"provider_payment_id,omitempty"`
+	Amount                float64             `bson:"amount" json:"amount"`
+	Currency              string              `bson:"currency" json:"currency"`
+	Status                string              `bson:"status" json:"status"` // created, captured, failed, refunded
+	FailureReason         string              `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	RefundedAmount        float64             `bson:"refunded_amount,omitempty" json:"refunded_amount,omitempty"`
+	ProviderRefundIDs     []string            `bson:"provider_refund_ids,omitempty" json:"provider_refund_ids,omitempty"`
+	CreatedAt             time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt             time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// PaymentWebhookEvent records a processed gateway webhook so retries are ignored
+type PaymentWebhookEvent struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	OrderID    string             `bson:"order_id" json:"order_id"`
-	UserID     string             `bson:"user_id" json:"user_id"`
-	Method     string             `bson:"method" json:"method"` // e.g., UPI, Card
-	Amount     float64            `bson:"amount" json:"amount"`
-	Status     string             `bson:"status" json:"status"` // Paid, Failed, Refunded
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	Provider   string             `bson:"provider" json:"provider"`
+	EventID    string             `bson:"event_id" json:"event_id"`
+	Type       string             `bson:"type" json:"type"`
+	ReceivedAt time.Time          `bson:"received_at" json:"received_at"`
 }
@@ -7,8 +7,16 @@ type Product struct {
 	Name        string             `bson:"name" json:"name"`
 	Description string             `bson:"description" json:"description"`
 	CategoryID  primitive.ObjectID `bson:"category_id" json:"category_id"`
-	Price       float64            `bson:"price" json:"price"`
+	Price       float64            `bson:"price" json:"price"`                           // GST-inclusive
+	HSNCode     string             `bson:"hsn_code,omitempty" json:"hsn_code,omitempty"` // for tax invoices
+	GSTRate     float64            `bson:"gst_rate" json:"gst_rate"`                     // percent, e.g. 5, 12, 18
 	ImageURL    string             `bson:"image_url" json:"image_url"`
 	InStock     bool               `bson:"in_stock" json:"in_stock"`
 	Tags        []string           `bson:"tags,omitempty" json:"tags,omitempty"`
 }
+
+// ProductTaxInput is used by admins to set a product's HSN code and GST slab
+type ProductTaxInput struct {
+	HSNCode string  `json:"hsn_code" binding:"required,numeric,min=4,max=8"`
+	GSTRate float64 `json:"gst_rate"`
+}
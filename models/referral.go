@@ -1,25 +1,57 @@
 package models
 
 import (
-    "go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// ReferralUseInput is the input for using a referral code
-type ReferralUseInput struct {
-    ReferralCode string `json:"referral_code" binding:"required"`
+// Referral rewards, in coins, when REFERRAL_REFERRER_COINS and
+// REFERRAL_REFEREE_COINS are not set
+const (
+	DefaultReferrerCoins = 50
+	DefaultRefereeCoins  = 25
+)
+
+// Referral statuses. A referral is pending until the referee's first paid
+// order and qualified while that order can still be cancelled or returned.
+// Both sides are rewarded once it is delivered and its return window closes.
+const (
+	ReferralPending   = "pending"
+	ReferralQualified = "qualified"
+	ReferralRewarded  = "rewarded"
+	ReferralRejected  = "rejected" // the paid order was not the referee's first, or was not kept
+)
+
+// ReferralCode is the code a farmer shares to invite others. Every farmer
+// has exactly one, created at signup.
+type ReferralCode struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Code      string             `bson:"code" json:"code"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 }
 
-// Reward represents a redeemable reward item
-type Reward struct {
-    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    Name        string             `bson:"name" json:"name"`
-    Description string             `bson:"description" json:"description"`
-    Cost        int                `bson:"cost" json:"cost"` // cost in coins
-    CreatedAt   primitive.DateTime `bson:"created_at,omitempty" json:"created_at,omitempty"`
-    UpdatedAt   primitive.DateTime `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+// ReferralUse records a farmer (the referee) joining through someone's code.
+// The coins are fixed when the code is used.
+type ReferralUse struct {
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID          primitive.ObjectID  `bson:"user_id" json:"user_id"` // the referee
+	ReferrerID      primitive.ObjectID  `bson:"referrer_id" json:"referrer_id"`
+	ReferralCode    string              `bson:"referral_code" json:"referral_code"`
+	Phone           string              `bson:"phone,omitempty" json:"-"`     // the referee's verified phone number
+	DeviceID        string              `bson:"device_id,omitempty" json:"-"` // fingerprint of the device, taken by the server
+	Status          string              `bson:"status" json:"status"`
+	ReferrerCoins   int                 `bson:"referrer_coins" json:"referrer_coins"`
+	RefereeCoins    int                 `bson:"referee_coins" json:"referee_coins"`
+	OrderID         *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"` // the first paid order
+	QualifiedAt     *time.Time          `bson:"qualified_at,omitempty" json:"qualified_at,omitempty"`
+	RejectionReason string              `bson:"rejection_reason,omitempty" json:"rejection_reason,omitempty"`
+	UsedAt          time.Time           `bson:"used_at" json:"used_at"`
+	RewardedAt      *time.Time          `bson:"rewarded_at,omitempty" json:"rewarded_at,omitempty"`
 }
 
-// RewardRedeemInput is input to redeem a reward
-type RewardRedeemInput struct {
-    RewardID primitive.ObjectID `json:"reward_id" binding:"required"`
+// ReferralUseInput is the input for using a referral code
+type ReferralUseInput struct {
+	ReferralCode string `json:"referral_code" binding:"required"`
 }
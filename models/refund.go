@@ -6,11 +6,36 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Refund statuses
+const (
+	RefundStatusInitiated = "initiated" // recorded, not yet accepted by the gateway
+	RefundStatusProcessed = "processed"
+	RefundStatusFailed    = "failed" // gateway refused; see FailureReason
+)
+
+// Where a refund is paid to
+const (
+	RefundToOriginal = "original" // back to the card / UPI the order was paid with
+	RefundToWallet   = "wallet"   // ShetiSeva wallet balance, usable on the next order
+)
+
+// Refund is money actually given back for an order: when the farmer cancels
+// a paid order before it ships, or when a RefundRequest is approved
 type Refund struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	OrderID   string             `bson:"order_id" json:"order_id"`
-	Reason    string             `bson:"reason" json:"reason"`
-	Amount    float64            `bson:"amount" json:"amount"`
-	Status    string             `bson:"status" json:"status"` // e.g. Initiated, Approved
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrderID          primitive.ObjectID  `bson:"order_id" json:"order_id"`
+	UserID           primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	RefundRequestID  *primitive.ObjectID `bson:"refund_request_id,omitempty" json:"refund_request_id,omitempty"`
+	ReturnRequestID  *primitive.ObjectID `bson:"return_request_id,omitempty" json:"return_request_id,omitempty"`
+	PaymentID        *primitive.ObjectID `bson:"payment_id,omitempty" json:"payment_id,omitempty"`
+	Reason           string              `bson:"reason" json:"reason"`
+	Amount           float64             `bson:"amount" json:"amount"`
+	Method           string              `bson:"method" json:"method"` // original, wallet
+	Provider         string              `bson:"provider,omitempty" json:"provider,omitempty"`
+	Unapplied        bool                `bson:"unapplied,omitempty" json:"unapplied,omitempty"` // gives back a payment that never paid for the order
+	ProviderRefundID string              `bson:"provider_refund_id,omitempty" json:"provider_refund_id,omitempty"`
+	Status           string              `bson:"status" json:"status"` // initiated, processed, failed
+	FailureReason    string              `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	CreatedAt        time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time           `bson:"updated_at" json:"updated_at"`
 }
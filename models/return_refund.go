@@ -1,20 +1,184 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Return (RMA) statuses. A return moves
+// pending → approved → pickup_scheduled → picked_up → qc_passed → refunded,
+// and ends early as rejected (by the admin) or qc_failed (goods not accepted).
+const (
+	ReturnStatusPending         = "pending"
+	ReturnStatusApproved        = "approved"
+	ReturnStatusRejected        = "rejected"
+	ReturnStatusPickupScheduled = "pickup_scheduled"
+	ReturnStatusPickedUp        = "picked_up"
+	ReturnStatusQCPassed        = "qc_passed"
+	ReturnStatusQCFailed        = "qc_failed"
+	ReturnStatusRefunded        = "refunded"
+)
+
+var returnTransitions = map[string][]string{
+	ReturnStatusPending:         {ReturnStatusApproved, ReturnStatusRejected},
+	ReturnStatusApproved:        {ReturnStatusPickupScheduled},
+	ReturnStatusPickupScheduled: {ReturnStatusPickupScheduled, ReturnStatusPickedUp}, // rescheduling allowed
+	ReturnStatusPickedUp:        {ReturnStatusQCPassed, ReturnStatusQCFailed},
+	ReturnStatusQCPassed:        {ReturnStatusRefunded},
+}
+
+// ReturnStatusesBefore lists the return statuses that may move to `to`
+func ReturnStatusesBefore(to string) []string {
+	var from []string
+	for status, nexts := range returnTransitions {
+		for _, next := range nexts {
+			if next == to {
+				from = append(from, status)
+			}
+		}
+	}
+	return from
+}
+
+// ClosedReturnStatuses lists the statuses a return ends in
+func ClosedReturnStatuses() []string {
+	return []string{ReturnStatusRejected, ReturnStatusQCFailed, ReturnStatusRefunded}
+}
+
+// Refund request statuses
+const (
+	RefundRequestPending  = "pending"
+	RefundRequestApproved = "approved"
+	RefundRequestRejected = "rejected"
+	RefundRequestRefunded = "refunded"
+)
+
+// DefaultReturnWindow is how long after delivery a return may be requested
+// when RETURN_WINDOW_DAYS is not set
+const DefaultReturnWindow = 7 * 24 * time.Hour
+
+// ReturnWindowOpen reports whether an order delivered at deliveredAt can
+// still be returned
+func ReturnWindowOpen(deliveredAt *time.Time, window time.Duration, now time.Time) bool {
+	return deliveredAt != nil && now.Before(deliveredAt.Add(window))
+}
+
+// ReturnItem is a quantity of one order line sent back
+type ReturnItem struct {
+	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
+	Quantity  int                `bson:"quantity" json:"quantity"`
+}
+
+// ReturnAmount is what the farmer gets back for the returned items: their
+// share of what was actually paid, so order-level discounts are not refunded
+// twice. No items means the whole order.
+func ReturnAmount(order Order, items []ReturnItem) float64 {
+	if len(items) == 0 || order.Subtotal <= 0 {
+		return order.TotalAmount
+	}
+	returned := 0.0
+	for _, item := range items {
+		for _, line := range order.Items {
+			if line.ProductID == item.ProductID {
+				returned += line.UnitPrice * float64(item.Quantity)
+				break
+			}
+		}
+	}
+	amount := RoundAmount(order.TotalAmount * returned / order.Subtotal)
+	if amount > order.TotalAmount {
+		return order.TotalAmount
+	}
+	return amount
+}
+
+// RMAEvent is one entry in a return's, refund request's or reward
+// redemption's timeline
+type RMAEvent struct {
+	Status    string    `bson:"status" json:"status"`
+	Note      string    `bson:"note,omitempty" json:"note,omitempty"`
+	ChangedBy string    `bson:"changed_by,omitempty" json:"changed_by,omitempty"`
+	ChangedAt time.Time `bson:"changed_at" json:"changed_at"`
+}
+
+// ReturnPickup is the collection of the goods from the farm
+type ReturnPickup struct {
+	ScheduledFor time.Time  `bson:"scheduled_for" json:"scheduled_for"`
+	Address      string     `bson:"address,omitempty" json:"address,omitempty"`
+	Notes        string     `bson:"notes,omitempty" json:"notes,omitempty"`
+	PickedUpAt   *time.Time `bson:"picked_up_at,omitempty" json:"picked_up_at,omitempty"`
+}
+
+// QualityCheck is the warehouse's inspection of the returned goods
+type QualityCheck struct {
+	Passed    bool      `bson:"passed" json:"passed"`
+	Notes     string    `bson:"notes,omitempty" json:"notes,omitempty"`
+	CheckedBy string    `bson:"checked_by" json:"checked_by"`
+	CheckedAt time.Time `bson:"checked_at" json:"checked_at"`
+}
+
+// ReturnRequest is a farmer's request to send goods back (an RMA). Once the
+// goods pass the quality check it raises a RefundRequest for the money.
 type ReturnRequest struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	OrderID   primitive.ObjectID `bson:"order_id" json:"orderId" binding:"required"`
-	Reason    string             `bson:"reason" json:"reason" binding:"required"`
-	Status    string             `bson:"status" json:"status,omitempty"`  // ✅ Add this line
-	CreatedAt int64              `bson:"created_at" json:"createdAt,omitempty"`
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID         primitive.ObjectID  `bson:"order_id" json:"orderId"`
+	UserID          primitive.ObjectID  `bson:"user_id" json:"userId"`
+	Items           []ReturnItem        `bson:"items,omitempty" json:"items,omitempty"` // empty = whole order
+	Reason          string              `bson:"reason" json:"reason"`
+	ReturnType      string              `bson:"return_type,omitempty" json:"returnType,omitempty"` // e.g. damaged, wrong_item
+	RefundMethod    string              `bson:"refund_method" json:"refundMethod"`                 // original, wallet
+	RefundAmount    float64             `bson:"refund_amount" json:"refundAmount"`
+	Status          string              `bson:"status" json:"status"`
+	RejectionReason string              `bson:"rejection_reason,omitempty" json:"rejectionReason,omitempty"`
+	Pickup          *ReturnPickup       `bson:"pickup,omitempty" json:"pickup,omitempty"`
+	QualityCheck    *QualityCheck       `bson:"quality_check,omitempty" json:"qualityCheck,omitempty"`
+	RefundRequestID *primitive.ObjectID `bson:"refund_request_id,omitempty" json:"refundRequestId,omitempty"`
+	RefundID        *primitive.ObjectID `bson:"refund_id,omitempty" json:"refundId,omitempty"`
+	History         []RMAEvent          `bson:"history" json:"history"`
+	CreatedAt       time.Time           `bson:"created_at" json:"createdAt"`
+	UpdatedAt       time.Time           `bson:"updated_at,omitempty" json:"updatedAt,omitempty"`
 }
 
+// RefundRequest asks for money back on an order: raised by the farmer
+// (e.g. for a missing item) or by a return that passed its quality check.
+// Once paid it points at the Refund that carried the money.
 type RefundRequest struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	OrderID   primitive.ObjectID `bson:"order_id" json:"orderId" binding:"required"`
-	Amount    float64            `bson:"amount" json:"amount" binding:"required"`
-	Reason    string             `bson:"reason" json:"reason" binding:"required"`
-	Status    string             `bson:"status" json:"status,omitempty"`
-	CreatedAt int64              `bson:"created_at" json:"createdAt,omitempty"`
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	OrderID         primitive.ObjectID  `bson:"order_id" json:"orderId"`
+	UserID          primitive.ObjectID  `bson:"user_id" json:"userId"`
+	ReturnRequestID *primitive.ObjectID `bson:"return_request_id,omitempty" json:"returnRequestId,omitempty"`
+	Amount          float64             `bson:"amount" json:"amount"`
+	Reason          string              `bson:"reason" json:"reason"`
+	Method          string              `bson:"method" json:"method"` // original, wallet
+	Status          string              `bson:"status" json:"status"`
+	RejectionReason string              `bson:"rejection_reason,omitempty" json:"rejectionReason,omitempty"`
+	RefundID        *primitive.ObjectID `bson:"refund_id,omitempty" json:"refundId,omitempty"`
+	History         []RMAEvent          `bson:"history" json:"history"`
+	CreatedAt       time.Time           `bson:"created_at" json:"createdAt"`
+	UpdatedAt       time.Time           `bson:"updated_at,omitempty" json:"updatedAt,omitempty"`
+}
+
+// RMARejectInput is posted by admins to turn down a return or refund request
+type RMARejectInput struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// SchedulePickupInput is posted by admins to book collection of a return
+type SchedulePickupInput struct {
+	ScheduledFor time.Time `json:"scheduled_for" binding:"required"`
+	Address      string    `json:"address"`
+	Notes        string    `json:"notes"`
+}
+
+// QualityCheckInput records the inspection of returned goods
+type QualityCheckInput struct {
+	Passed *bool  `json:"passed" binding:"required"`
+	Notes  string `json:"notes"`
+}
+
+// ApproveRefundInput lets the admin adjust a refund request before paying it
+type ApproveRefundInput struct {
+	Amount float64 `json:"amount" binding:"gte=0"` // 0 keeps the requested amount
+	Method string  `json:"method" binding:"omitempty,oneof=original wallet"`
 }
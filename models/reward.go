@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reward kinds: physical rewards are shipped, digital ones are a voucher code
+const (
+	RewardPhysical = "physical"
+	RewardDigital  = "digital"
+)
+
+// Reward represents a redeemable reward item
+type Reward struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Cost        int                `bson:"cost" json:"cost"`                       // cost in coins
+	Type        string             `bson:"type,omitempty" json:"type"`             // physical (default) or digital
+	Stock       *int               `bson:"stock,omitempty" json:"stock,omitempty"` // nil = unlimited
+	Active      bool               `bson:"active" json:"active"`
+	CreatedAt   primitive.DateTime `bson:"created_at,omitempty" json:"created_at,omitempty"`
+	UpdatedAt   primitive.DateTime `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// IsDigital reports whether the reward is fulfilled with a voucher code
+func (r Reward) IsDigital() bool {
+	return r.Type == RewardDigital
+}
+
+// InStock reports whether the reward can still be redeemed
+func (r Reward) InStock() bool {
+	return r.Stock == nil || *r.Stock > 0
+}
+
+// RewardInput is posted by admins to create or update a reward
+type RewardInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Cost        int    `json:"cost" binding:"gte=0"`
+	Type        string `json:"type" binding:"omitempty,oneof=physical digital"`
+	Stock       *int   `json:"stock" binding:"omitempty,gte=0"` // omit for unlimited
+	Active      *bool  `json:"active"`                          // defaults to true
+}
+
+// RewardRedeemInput is input to redeem a reward. Physical rewards need
+// somewhere to ship to.
+type RewardRedeemInput struct {
+	RewardID primitive.ObjectID `json:"reward_id" binding:"required"`
+	Address  string             `json:"address"`
+}
+
+// Redemption statuses. Physical rewards go requested → dispatched →
+// delivered; digital ones go requested → voucher_issued. A redemption that
+// cannot be fulfilled ends as failed and the coins go back.
+const (
+	RedemptionRequested     = "requested"
+	RedemptionDispatched    = "dispatched"
+	RedemptionDelivered     = "delivered"
+	RedemptionVoucherIssued = "voucher_issued"
+	RedemptionFailed        = "failed"
+)
+
+var redemptionTransitions = map[string][]string{
+	RedemptionRequested:  {RedemptionDispatched, RedemptionVoucherIssued, RedemptionFailed},
+	RedemptionDispatched: {RedemptionDelivered, RedemptionFailed}, // e.g. lost in transit
+}
+
+// RedemptionStatusesBefore lists the redemption statuses that may move to `to`
+func RedemptionStatusesBefore(to string) []string {
+	var from []string
+	for status, nexts := range redemptionTransitions {
+		for _, next := range nexts {
+			if next == to {
+				from = append(from, status)
+			}
+		}
+	}
+	return from
+}
+
+// RewardRedemption is a farmer's claim on a reward, paid for in coins. It
+// keeps the reward's name and cost as they were when redeemed.
+type RewardRedemption struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RewardID       primitive.ObjectID `bson:"reward_id" json:"reward_id"`
+	RewardName     string             `bson:"reward_name" json:"reward_name"`
+	RewardType     string             `bson:"reward_type" json:"reward_type"`
+	Cost           int                `bson:"cost" json:"cost"`
+	StockReserved  bool               `bson:"stock_reserved" json:"-"` // a unit was taken from stock
+	Status         string             `bson:"status" json:"status"`
+	Address        string             `bson:"address,omitempty" json:"address,omitempty"`
+	TrackingNumber string             `bson:"tracking_number,omitempty" json:"tracking_number,omitempty"`
+	VoucherCode    string             `bson:"voucher_code,omitempty" json:"voucher_code,omitempty"`
+	FailureReason  string             `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	CoinsRefunded  bool               `bson:"coins_refunded,omitempty" json:"coins_refunded,omitempty"`
+	History        []RMAEvent         `bson:"history" json:"history"`
+	RedeemedAt     time.Time          `bson:"redeemed_at" json:"redeemed_at"`
+	UpdatedAt      time.Time          `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// DispatchRedemptionInput is posted by admins when a physical reward ships
+type DispatchRedemptionInput struct {
+	TrackingNumber string `json:"tracking_number"`
+	Note           string `json:"note"`
+}
+
+// FailRedemptionInput is posted by admins when a reward cannot be fulfilled
+type FailRedemptionInput struct {
+	Reason string `json:"reason" binding:"required"`
+}
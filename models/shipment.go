@@ -0,0 +1,142 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shipment statuses, in the order a delivery normally moves through them
+const (
+	ShipmentAssigned       = "assigned"
+	ShipmentPickedUp       = "picked_up"
+	ShipmentInTransit      = "in_transit"
+	ShipmentOutForDelivery = "out_for_delivery"
+	ShipmentDelivered      = "delivered"
+	ShipmentFailed         = "failed" // delivery attempt failed; can go out again
+)
+
+var shipmentTransitions = map[string][]string{
+	ShipmentAssigned:       {ShipmentPickedUp},
+	ShipmentPickedUp:       {ShipmentInTransit, ShipmentOutForDelivery},
+	ShipmentInTransit:      {ShipmentOutForDelivery, ShipmentFailed},
+	ShipmentOutForDelivery: {ShipmentDelivered, ShipmentFailed},
+	ShipmentFailed:         {ShipmentOutForDelivery},
+}
+
+// CanTransitionShipment reports whether a shipment may move from one status to another
+func CanTransitionShipment(from, to string) bool {
+	for _, next := range shipmentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ShipmentStatusesBefore lists the statuses that may move to `to`
+func ShipmentStatusesBefore(to string) []string {
+	var from []string
+	for status, nexts := range shipmentTransitions {
+		for _, next := range nexts {
+			if next == to {
+				from = append(from, status)
+			}
+		}
+	}
+	return from
+}
+
+// GeoPoint is a GPS position in decimal degrees
+type GeoPoint struct {
+	Lat float64 `bson:"lat" json:"lat"`
+	Lng float64 `bson:"lng" json:"lng"`
+}
+
+// DistanceKm is the great-circle distance between two points
+func (p GeoPoint) DistanceKm(q GeoPoint) float64 {
+	const earthRadiusKm = 6371.0
+	rad := math.Pi / 180
+	dLat := (q.Lat - p.Lat) * rad
+	dLng := (q.Lng - p.Lng) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(p.Lat*rad)*math.Cos(q.Lat*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// deliverySpeedKmph is a conservative average for two-wheelers and tempos on rural roads
+const deliverySpeedKmph = 25.0
+
+// EstimateETA guesses arrival time from the agent's position to the destination
+func EstimateETA(from, to GeoPoint, now time.Time) time.Time {
+	hours := from.DistanceKm(to) / deliverySpeedKmph
+	return now.Add(time.Duration(hours * float64(time.Hour))).Truncate(time.Minute)
+}
+
+// ShipmentEvent is one entry in a shipment's tracking timeline
+type ShipmentEvent struct {
+	Status   string    `bson:"status" json:"status"`
+	Note     string    `bson:"note,omitempty" json:"note,omitempty"`
+	Location *GeoPoint `bson:"location,omitempty" json:"location,omitempty"`
+	At       time.Time `bson:"at" json:"at"`
+}
+
+// Shipment tracks the delivery of one order by an agent
+type Shipment struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrderID        primitive.ObjectID `bson:"order_id" json:"order_id"`
+	AgentID        primitive.ObjectID `bson:"agent_id" json:"agent_id"`
+	AgentName      string             `bson:"agent_name" json:"agent_name"`
+	AgentPhone     string             `bson:"agent_phone,omitempty" json:"agent_phone,omitempty"`
+	Status         string             `bson:"status" json:"status"`
+	Destination    *GeoPoint          `bson:"destination,omitempty" json:"destination,omitempty"`
+	LastLocation   *GeoPoint          `bson:"last_location,omitempty" json:"last_location,omitempty"`
+	LastLocationAt *time.Time         `bson:"last_location_at,omitempty" json:"last_location_at,omitempty"`
+	ETA            *time.Time         `bson:"eta,omitempty" json:"eta,omitempty"`
+	DeliveryOTP    string             `bson:"delivery_otp,omitempty" json:"-"` // shown to the farmer only
+	OTPAttempts    int                `bson:"otp_attempts" json:"-"`           // tries at this delivery attempt's OTP
+	OTPTries       int                `bson:"otp_tries" json:"-"`              // tries over all attempts; never reset
+	Proof          *ProofOfDelivery   `bson:"proof,omitempty" json:"proof,omitempty"`
+	Events         []ShipmentEvent    `bson:"events" json:"events"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// ProofOfDelivery is the evidence captured when the agent hands over the parcel
+type ProofOfDelivery struct {
+	OTPVerified bool      `bson:"otp_verified" json:"otp_verified"`
+	PhotoPath   string    `bson:"photo_path,omitempty" json:"photo_path,omitempty"`
+	Location    *GeoPoint `bson:"location,omitempty" json:"location,omitempty"`
+	DeliveredAt time.Time `bson:"delivered_at" json:"delivered_at"`
+}
+
+// LocationPing is one GPS fix posted by an agent, kept for the route history
+type LocationPing struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ShipmentID primitive.ObjectID `bson:"shipment_id" json:"shipment_id"`
+	AgentID    primitive.ObjectID `bson:"agent_id" json:"agent_id"`
+	Location   GeoPoint           `bson:"location" json:"location"`
+	RecordedAt time.Time          `bson:"recorded_at" json:"recorded_at"`
+}
+
+// AssignShipmentInput is used by admins to hand a packed order to an agent
+type AssignShipmentInput struct {
+	OrderID     string    `json:"order_id" binding:"required"`
+	AgentID     string    `json:"agent_id" binding:"required"`
+	Destination *GeoPoint `json:"destination"` // farm or village drop point, if known
+}
+
+// LocationPingInput is posted by the agent app every few minutes
+type LocationPingInput struct {
+	Lat        float64 `json:"lat" binding:"required,min=-90,max=90"`
+	Lng        float64 `json:"lng" binding:"required,min=-180,max=180"`
+	ETAMinutes int     `json:"eta_minutes"` // agent's own estimate; overrides the computed one
+}
+
+// ShipmentStatusInput is posted by the agent when a delivery changes stage
+type ShipmentStatusInput struct {
+	Status   string    `json:"status" binding:"required"`
+	Note     string    `json:"note"`
+	Location *GeoPoint `json:"location"`
+}
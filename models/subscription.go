@@ -5,16 +5,166 @@ import (
 	"time"
 )
 
+// Subscription statuses
+const (
+	SubscriptionIncomplete = "incomplete" // first invoice not paid yet
+	SubscriptionActive     = "active"
+	SubscriptionPastDue    = "past_due" // renewal unpaid, still within the grace period; still entitled
+	SubscriptionPaused     = "paused"
+	SubscriptionCancelled  = "cancelled"
+)
+
+// Billing intervals of a plan
+const (
+	IntervalMonthly   = "monthly"
+	IntervalQuarterly = "quarterly"
+	IntervalYearly    = "yearly"
+)
+
+// DefaultGraceDays is how long an unpaid renewal keeps the subscription
+// going when the plan does not say otherwise
+const DefaultGraceDays = 7
+
+// PeriodEnd returns the end of a billing period of the given interval that
+// starts at start
+func PeriodEnd(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalQuarterly:
+		return start.AddDate(0, 3, 0)
+	case IntervalYearly:
+		return start.AddDate(1, 0, 0)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// Services a plan can entitle the farmer to
+const (
+	EntitlementConsultations   = "consultations"    // expert consultations
+	EntitlementDroneAcres      = "drone_acres"      // acres of drone spraying
+	EntitlementPrioritySupport = "priority_support" // support tickets handled first
+)
+
+// PlanEntitlement is one service a plan includes each billing period, e.g.
+// 3 consultations or 5 acres of drone spraying
+type PlanEntitlement struct {
+	Service string  `bson:"service" json:"service" binding:"required,oneof=consultations drone_acres priority_support"`
+	Quota   float64 `bson:"quota" json:"quota" binding:"gte=0"` // per billing period; 0 means unlimited
+}
+
+// Unlimited reports whether the entitlement has no quota
+func (e PlanEntitlement) Unlimited() bool {
+	return e.Quota <= 0
+}
+
+// Covers returns how much of amount the entitlement still covers when used
+// has already been taken this period
+func (e PlanEntitlement) Covers(used, amount float64) float64 {
+	if amount <= 0 {
+		return 0
+	}
+	if e.Unlimited() {
+		return amount
+	}
+	return max(min(amount, e.Quota-used), 0)
+}
+
+// EntitlementGrant records what a subscription covered of one use of a
+// service. It is kept on the booking so a cancellation can give it back.
+type EntitlementGrant struct {
+	SubscriptionID primitive.ObjectID `bson:"subscription_id" json:"subscription_id"`
+	PeriodStart    time.Time          `bson:"period_start" json:"period_start"`
+	Service        string             `bson:"service" json:"service"`
+	Amount         float64            `bson:"amount" json:"amount"`
+}
+
+// EntitlementUsage is how much of an entitlement is used and left this period
+type EntitlementUsage struct {
+	Service   string   `json:"service"`
+	Quota     float64  `json:"quota"`
+	Used      float64  `json:"used"`
+	Remaining *float64 `json:"remaining"` // null when unlimited
+}
+
+// UsageOf reports each of the plan's entitlements against usage
+func UsageOf(entitlements []PlanEntitlement, usage map[string]float64) []EntitlementUsage {
+	report := make([]EntitlementUsage, 0, len(entitlements))
+	for _, e := range entitlements {
+		u := EntitlementUsage{Service: e.Service, Quota: e.Quota, Used: usage[e.Service]}
+		if !e.Unlimited() {
+			left := max(e.Quota-u.Used, 0)
+			u.Remaining = &left
+		}
+		report = append(report, u)
+	}
+	return report
+}
+
+// SubscriptionPlan is an entry in the plan catalogue
+type SubscriptionPlan struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name             string             `bson:"name" json:"name"`
+	Description      string             `bson:"description" json:"description"`
+	Price            float64            `bson:"price" json:"price"` // per billing period, in rupees
+	Interval         string             `bson:"interval" json:"interval"`
+	IncludedServices []string           `bson:"included_services" json:"included_services"` // e.g. "2 soil tests"
+	Entitlements     []PlanEntitlement  `bson:"entitlements" json:"entitlements"`           // enforced when the farmer books
+	GraceDays        int                `bson:"grace_days" json:"grace_days"`
+	Active           bool               `bson:"active" json:"active"` // inactive plans take no new subscribers
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Entitlement returns the plan's entitlement to service, if it has one
+func (p SubscriptionPlan) Entitlement(service string) (PlanEntitlement, bool) {
+	for _, e := range p.Entitlements {
+		if e.Service == service {
+			return e, true
+		}
+	}
+	return PlanEntitlement{}, false
+}
+
+// GracePeriod is how long a renewal may stay unpaid before the
+// subscription is cancelled
+func (p SubscriptionPlan) GracePeriod() time.Duration {
+	days := p.GraceDays
+	if days <= 0 {
+		days = DefaultGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// SubscriptionPlanInput is what an admin sends to create or edit a plan
+type SubscriptionPlanInput struct {
+	Name             string            `json:"name" binding:"required"`
+	Description      string            `json:"description"`
+	Price            float64           `json:"price" binding:"gte=0"`
+	Interval         string            `json:"interval" binding:"required,oneof=monthly quarterly yearly"`
+	IncludedServices []string          `json:"included_services"`
+	Entitlements     []PlanEntitlement `json:"entitlements" binding:"dive"`
+	GraceDays        int               `json:"grace_days" binding:"gte=0"`
+	Active           *bool             `json:"active"` // defaults to true
+}
+
 // Subscription represents a user's subscription plan
 type Subscription struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
-	PlanID     primitive.ObjectID `bson:"plan_id" json:"plan_id"`
-	Status     string             `bson:"status" json:"status"` // active, paused, cancelled etc.
-	StartedAt  time.Time          `bson:"started_at" json:"started_at"`
-	PausedAt   *time.Time         `bson:"paused_at,omitempty" json:"paused_at,omitempty"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	ModifiedAt time.Time          `bson:"modified_at" json:"modified_at"`
+	ID                 primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID             primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	PlanID             primitive.ObjectID  `bson:"plan_id" json:"plan_id"`
+	Status             string              `bson:"status" json:"status"` // active, paused, cancelled etc.
+	StartedAt          time.Time           `bson:"started_at" json:"started_at"`
+	PausedAt           *time.Time          `bson:"paused_at,omitempty" json:"paused_at,omitempty"`
+	CurrentPeriodStart time.Time           `bson:"current_period_start,omitempty" json:"current_period_start,omitempty"`
+	CurrentPeriodEnd   time.Time           `bson:"current_period_end,omitempty" json:"next_renewal_at,omitempty"`
+	GraceUntil         *time.Time          `bson:"grace_until,omitempty" json:"grace_until,omitempty"`
+	CancelAtPeriodEnd  bool                `bson:"cancel_at_period_end,omitempty" json:"cancel_at_period_end,omitempty"`
+	CancelledAt        *time.Time          `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	PendingPlanID      *primitive.ObjectID `bson:"pending_plan_id,omitempty" json:"pending_plan_id,omitempty"` // cheaper plan taken up when the period ends
+	Credit             float64             `bson:"credit,omitempty" json:"credit,omitempty"`                   // proration credit taken off the next invoice
+	Usage              map[string]float64  `bson:"usage,omitempty" json:"usage,omitempty"`                     // entitlements used this period, by service
+	CreatedAt          time.Time           `bson:"created_at" json:"created_at"`
+	ModifiedAt         time.Time           `bson:"modified_at" json:"modified_at"`
 }
 
 // SubscriptionInput used for creating a subscription
@@ -22,3 +172,77 @@ type SubscriptionInput struct {
 	PlanID primitive.ObjectID `json:"plan_id" binding:"required"`
 }
 
+// SubscriptionInvoice kinds
+const (
+	SubscriptionInvoiceSignup    = "signup"
+	SubscriptionInvoiceRenewal   = "renewal"
+	SubscriptionInvoiceProration = "proration" // the difference owed for switching to a dearer plan
+)
+
+// SubscriptionInvoice statuses
+const (
+	SubscriptionInvoiceOpen = "open"
+	SubscriptionInvoicePaid = "paid"
+	SubscriptionInvoiceVoid = "void"
+)
+
+// SubscriptionInvoice is the charge for one billing period, or for the rest
+// of a period after a plan switch. Paying it moves the subscription on to
+// its plan and period.
+type SubscriptionInvoice struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	SubscriptionID primitive.ObjectID  `bson:"subscription_id" json:"subscription_id"`
+	UserID         primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	PlanID         primitive.ObjectID  `bson:"plan_id" json:"plan_id"`
+	Kind           string              `bson:"kind" json:"kind"`
+	Amount         float64             `bson:"amount" json:"amount"`                 // still to pay, after credit
+	CreditApplied  float64             `bson:"credit_applied" json:"credit_applied"` // proration credit used
+	PeriodStart    time.Time           `bson:"period_start" json:"period_start"`
+	PeriodEnd      time.Time           `bson:"period_end" json:"period_end"`
+	Status         string              `bson:"status" json:"status"`
+	PaymentID      *primitive.ObjectID `bson:"payment_id,omitempty" json:"payment_id,omitempty"`
+	Attempts       int                 `bson:"attempts" json:"attempts"`
+	LastError      string              `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+	PaidAt         *time.Time          `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+}
+
+// Lapsed reports whether the invoice can no longer be paid at now: a
+// proration is only owed while the period it covers is running
+func (inv SubscriptionInvoice) Lapsed(now time.Time) bool {
+	return inv.Kind == SubscriptionInvoiceProration && !now.Before(inv.PeriodEnd)
+}
+
+// SubscriptionSwitchInput moves a subscription to another plan
+type SubscriptionSwitchInput struct {
+	PlanID primitive.ObjectID `json:"plan_id" binding:"required"`
+}
+
+// SubscriptionPayInput pays an open invoice, from the wallet or through the gateway
+type SubscriptionPayInput struct {
+	Method string `json:"method" binding:"required"` // "Wallet", "UPI", "CreditCard"...
+}
+
+// SubscriptionVerifyInput completes a gateway checkout for an invoice
+type SubscriptionVerifyInput struct {
+	PaymentID         primitive.ObjectID `json:"payment_id" binding:"required"`
+	ProviderPaymentID string             `json:"provider_payment_id"`
+	Signature         string             `json:"signature"`
+	Status            string             `json:"status"` // "failed" when the checkout reports an error
+}
+
+// ProrateSwitch returns what switching plans at `at` costs for the rest of
+// the current period: the new plan's daily rate less the old one's, over the
+// days left. It comes out negative for a cheaper plan.
+func ProrateSwitch(oldPrice float64, oldInterval string, newPrice float64, newInterval string, start, end, at time.Time) float64 {
+	if !at.Before(end) {
+		return 0
+	}
+	if at.Before(start) {
+		at = start
+	}
+	left := end.Sub(at).Hours()
+	oldRate := oldPrice / PeriodEnd(start, oldInterval).Sub(start).Hours()
+	newRate := newPrice / PeriodEnd(start, newInterval).Sub(start).Hours()
+	return RoundAmount((newRate - oldRate) * left)
+}
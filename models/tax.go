@@ -0,0 +1,250 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Common GST slabs (percent) for farm inputs
+var GSTSlabs = []float64{0, 5, 12, 18, 28}
+
+// IsValidGSTRate reports whether rate is one of the GST slabs
+func IsValidGSTRate(rate float64) bool {
+	for _, s := range GSTSlabs {
+		if s == rate {
+			return true
+		}
+	}
+	return false
+}
+
+// GSTState is a state or union territory with its GST state code
+type GSTState struct {
+	Code string
+	Name string
+	Abbr string
+}
+
+// GSTStates are the states and union territories numbered for GST
+var GSTStates = []GSTState{
+	{"01", "Jammu and Kashmir", "JK"},
+	{"02", "Himachal Pradesh", "HP"},
+	{"03", "Punjab", "PB"},
+	{"04", "Chandigarh", "CH"},
+	{"05", "Uttarakhand", "UK"},
+	{"06", "Haryana", "HR"},
+	{"07", "Delhi", "DL"},
+	{"08", "Rajasthan", "RJ"},
+	{"09", "Uttar Pradesh", "UP"},
+	{"10", "Bihar", "BR"},
+	{"11", "Sikkim", "SK"},
+	{"12", "Arunachal Pradesh", "AR"},
+	{"13", "Nagaland", "NL"},
+	{"14", "Manipur", "MN"},
+	{"15", "Mizoram", "MZ"},
+	{"16", "Tripura", "TR"},
+	{"17", "Meghalaya", "ML"},
+	{"18", "Assam", "AS"},
+	{"19", "West Bengal", "WB"},
+	{"20", "Jharkhand", "JH"},
+	{"21", "Odisha", "OD"},
+	{"22", "Chhattisgarh", "CG"},
+	{"23", "Madhya Pradesh", "MP"},
+	{"24", "Gujarat", "GJ"},
+	{"26", "Dadra and Nagar Haveli and Daman and Diu", "DN"},
+	{"27", "Maharashtra", "MH"},
+	{"29", "Karnataka", "KA"},
+	{"30", "Goa", "GA"},
+	{"31", "Lakshadweep", "LD"},
+	{"32", "Kerala", "KL"},
+	{"33", "Tamil Nadu", "TN"},
+	{"34", "Puducherry", "PY"},
+	{"35", "Andaman and Nicobar Islands", "AN"},
+	{"36", "Telangana", "TS"},
+	{"37", "Andhra Pradesh", "AP"},
+	{"38", "Ladakh", "LA"},
+}
+
+// gstStateAliases are older names and abbreviations still seen in profiles
+var gstStateAliases = map[string]string{
+	"orissa": "21", "or": "21", "pondicherry": "34", "newdelhi": "07", "nctofdelhi": "07",
+	"uttaranchal": "05", "ut": "05", "ct": "22", "tg": "36", "damananddiu": "26", "dd": "26",
+	"dadraandnagarhaveli": "26",
+}
+
+// gstStateIndex finds a state's code by code, name, abbreviation or alias
+var gstStateIndex = func() map[string]string {
+	index := map[string]string{}
+	for _, st := range GSTStates {
+		index[st.Code] = st.Code
+		index[stateKey(st.Name)] = st.Code
+		index[stateKey(st.Abbr)] = st.Code
+	}
+	for alias, code := range gstStateAliases {
+		index[alias] = code
+	}
+	return index
+}()
+
+// stateKey lowercases a state and keeps only its letters and digits
+func stateKey(state string) string {
+	state = strings.ToLower(strings.ReplaceAll(state, "&", "and"))
+	var b strings.Builder
+	for _, r := range state {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// GSTStateCode resolves a state given as its GST code, name or abbreviation
+// ("27", "Maharashtra", "MH") to the two-digit code, or "" if it is unknown
+func GSTStateCode(state string) string {
+	key := stateKey(state)
+	if len(key) == 1 && key[0] >= '0' && key[0] <= '9' {
+		key = "0" + key
+	}
+	return gstStateIndex[key]
+}
+
+// GSTStateName returns the name of the state with the given GST code
+func GSTStateName(code string) string {
+	for _, st := range GSTStates {
+		if st.Code == code {
+			return st.Name
+		}
+	}
+	return ""
+}
+
+// IsInterState reports whether a sale is across state lines and so attracts
+// IGST instead of CGST+SGST. States are compared by GST state code, so "MH",
+// "27" and "Maharashtra" are the same place. An unknown buyer state is
+// treated as local.
+func IsInterState(sellerState, buyerState string) bool {
+	buyer := GSTStateCode(buyerState)
+	return buyer != "" && buyer != GSTStateCode(sellerState)
+}
+
+// TaxLine is one priced line to tax. Amount is GST-inclusive.
+type TaxLine struct {
+	Rate   float64
+	Amount float64
+}
+
+// LineTax is the GST contained in one TaxLine after its share of discount
+type LineTax struct {
+	TaxableValue float64 `bson:"taxable_value" json:"taxable_value"`
+	CGST         float64 `bson:"cgst" json:"cgst"`
+	SGST         float64 `bson:"sgst" json:"sgst"`
+	IGST         float64 `bson:"igst" json:"igst"`
+}
+
+// TaxSlab totals the lines taxed at one GST rate
+type TaxSlab struct {
+	Rate         float64 `bson:"rate" json:"rate"`
+	TaxableValue float64 `bson:"taxable_value" json:"taxable_value"`
+	CGST         float64 `bson:"cgst" json:"cgst"`
+	SGST         float64 `bson:"sgst" json:"sgst"`
+	IGST         float64 `bson:"igst" json:"igst"`
+}
+
+// TaxBreakdown is the GST contained in a cart or order total
+type TaxBreakdown struct {
+	InterState   bool      `bson:"inter_state" json:"inter_state"`
+	TaxableValue float64   `bson:"taxable_value" json:"taxable_value"`
+	CGST         float64   `bson:"cgst" json:"cgst"`
+	SGST         float64   `bson:"sgst" json:"sgst"`
+	IGST         float64   `bson:"igst" json:"igst"`
+	TotalTax     float64   `bson:"total_tax" json:"total_tax"`
+	Slabs        []TaxSlab `bson:"slabs" json:"slabs"`
+}
+
+// SplitGST backs the GST out of an inclusive amount and splits it into
+// CGST+SGST (half each) for local sales or IGST for inter-state ones.
+func SplitGST(amount, rate float64, interState bool) LineTax {
+	lt := LineTax{TaxableValue: RoundAmount(amount / (1 + rate/100))}
+	tax := RoundAmount(amount - lt.TaxableValue)
+	if interState {
+		lt.IGST = tax
+	} else {
+		lt.CGST = RoundAmount(tax / 2)
+		lt.SGST = RoundAmount(tax - lt.CGST)
+	}
+	return lt
+}
+
+// ComputeTax taxes each line and totals the result by slab. A cart-level
+// discount lowers the taxable value of every line in proportion to its amount.
+func ComputeTax(lines []TaxLine, discount float64, interState bool) ([]LineTax, TaxBreakdown) {
+	net := allocateDiscount(lines, discount)
+
+	breakdown := TaxBreakdown{InterState: interState, Slabs: []TaxSlab{}}
+	perLine := make([]LineTax, len(lines))
+	slabs := map[float64]*TaxSlab{}
+
+	for i, line := range lines {
+		lt := SplitGST(net[i], line.Rate, interState)
+		perLine[i] = lt
+
+		slab, ok := slabs[line.Rate]
+		if !ok {
+			slab = &TaxSlab{Rate: line.Rate}
+			slabs[line.Rate] = slab
+		}
+		slab.TaxableValue += lt.TaxableValue
+		slab.CGST += lt.CGST
+		slab.SGST += lt.SGST
+		slab.IGST += lt.IGST
+
+		breakdown.TaxableValue += lt.TaxableValue
+		breakdown.CGST += lt.CGST
+		breakdown.SGST += lt.SGST
+		breakdown.IGST += lt.IGST
+	}
+
+	for _, slab := range slabs {
+		slab.TaxableValue = RoundAmount(slab.TaxableValue)
+		slab.CGST = RoundAmount(slab.CGST)
+		slab.SGST = RoundAmount(slab.SGST)
+		slab.IGST = RoundAmount(slab.IGST)
+		breakdown.Slabs = append(breakdown.Slabs, *slab)
+	}
+	sort.Slice(breakdown.Slabs, func(i, j int) bool { return breakdown.Slabs[i].Rate < breakdown.Slabs[j].Rate })
+
+	breakdown.TaxableValue = RoundAmount(breakdown.TaxableValue)
+	breakdown.CGST = RoundAmount(breakdown.CGST)
+	breakdown.SGST = RoundAmount(breakdown.SGST)
+	breakdown.IGST = RoundAmount(breakdown.IGST)
+	breakdown.TotalTax = RoundAmount(breakdown.CGST + breakdown.SGST + breakdown.IGST)
+	return perLine, breakdown
+}
+
+// allocateDiscount spreads discount over the lines pro rata; the last line
+// takes the rounding remainder so the net amounts add up exactly.
+func allocateDiscount(lines []TaxLine, discount float64) []float64 {
+	net := make([]float64, len(lines))
+	total := 0.0
+	for i, line := range lines {
+		net[i] = line.Amount
+		total += line.Amount
+	}
+	if discount <= 0 || total <= 0 {
+		return net
+	}
+	if discount > total {
+		discount = total
+	}
+
+	remaining := RoundAmount(discount)
+	for i, line := range lines {
+		share := RoundAmount(discount * line.Amount / total)
+		if i == len(lines)-1 || share > remaining {
+			share = remaining
+		}
+		net[i] = RoundAmount(line.Amount - share)
+		remaining = RoundAmount(remaining - share)
+	}
+	return net
+}
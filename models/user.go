@@ -12,6 +12,7 @@ type User struct {
 	Role       string             `bson:"role,omitempty" json:"role"`
 	CreatedAt  int64              `bson:"created_at,omitempty" json:"created_at"`
 	OTP        string             `bson:"otp,omitempty" json:"otp,omitempty"`
+	State      string             `bson:"state,omitempty" json:"state,omitempty"` // for GST place of supply
 
 	// 🆕 KYC fields
 	KYCStatus string `bson:"kyc_status,omitempty" json:"kyc_status,omitempty"`
@@ -6,11 +6,49 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Wallet transaction types
+const (
+	WalletCredit = "Credit"
+	WalletDebit  = "Debit"
+)
+
+// Why money moved in or out of a wallet
+const (
+	WalletSourceRefund       = "refund"       // refund paid to the wallet
+	WalletSourceOrder        = "order"        // order paid from the wallet
+	WalletSourceManual       = "manual"       // admin adjustment
+	WalletSourceSubscription = "subscription" // subscription invoice paid from the wallet
+)
+
+// WalletProvider is the Payment.Provider of orders and subscriptions paid
+// from the wallet
+const WalletProvider = "wallet"
+
+// Wallet holds a farmer's running balance in rupees. It is kept in step
+// with the wallet_transactions ledger, which is the record of truth: every
+// change to Balance is written together with the entry that explains it.
+type Wallet struct {
+	UserID    primitive.ObjectID `bson:"_id" json:"user_id"`
+	Balance   float64            `bson:"balance" json:"balance"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// WalletTransaction is one entry in a farmer's wallet ledger
 type WalletTransaction struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID    string             `bson:"user_id" json:"user_id"`
-	Amount    float64            `bson:"amount" json:"amount"`
-	Type      string             `bson:"type" json:"type"` // Credit or Debit
-	Reason    string             `bson:"reason" json:"reason"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Amount       float64            `bson:"amount" json:"amount"`
+	Type         string             `bson:"type" json:"type"` // Credit or Debit
+	Source       string             `bson:"source" json:"source"`
+	Reference    string             `bson:"reference,omitempty" json:"reference,omitempty"` // e.g. refund:<id>; each is applied once
+	Reason       string             `bson:"reason" json:"reason"`
+	BalanceAfter float64            `bson:"balance_after" json:"balance_after"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// ManualCreditInput is used by admins to credit a farmer's wallet
+type ManualCreditInput struct {
+	UserID string  `json:"user_id" binding:"required"`
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Reason string  `json:"reason"`
 }
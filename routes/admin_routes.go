@@ -12,4 +12,34 @@ func AdminRoutes(router *gin.Engine) {
 
 	admin.POST("/kyc/approve", controllers.ApproveKYC)
 	admin.POST("/kyc/reject", controllers.RejectKYC)
+
+	admin.PUT("/orders/:id/status", controllers.AdminUpdateOrderStatus) // pack / ship / cancel
+	admin.PUT("/products/:id/tax", controllers.UpdateProductTax)        // HSN code and GST slab
+
+	// Money movements; safe to retry with an Idempotency-Key header
+	admin.POST("/refund/initiate", middlewares.IdempotencyMiddleware(), controllers.InitiateRefund)
+	admin.POST("/credit/manual-add", middlewares.IdempotencyMiddleware(), controllers.ManualCredit) // Wallet credit
+
+	// Double-entry ledger of every rupee and coin moved
+	admin.GET("/ledger/entries", controllers.AdminListLedgerEntries)
+	admin.GET("/ledger/reconciliation", controllers.AdminLedgerReconciliation)
+
+	// Coin earning rules: order paid, review, KYC, consultation feedback, referral
+	admin.GET("/coins/rules", controllers.AdminListCoinRules)
+	admin.PUT("/coins/rules/:event", controllers.AdminSetCoinRule)
+
+	// Subscription plan catalogue
+	admin.GET("/subscription/plans", controllers.AdminListSubscriptionPlans)
+	admin.POST("/subscription/plans", controllers.AdminCreateSubscriptionPlan)
+	admin.PUT("/subscription/plans/:id", controllers.AdminUpdateSubscriptionPlan)
+
+	// Rewards catalogue and redemption fulfilment
+	admin.GET("/rewards", controllers.AdminListRewards)
+	admin.POST("/rewards", controllers.AdminCreateReward)
+	admin.PUT("/rewards/:id", controllers.AdminUpdateReward)
+	admin.DELETE("/rewards/:id", controllers.AdminDeleteReward)
+	admin.GET("/rewards/redemptions", controllers.AdminListRedemptions) // ?status=requested
+	admin.POST("/rewards/redemptions/:id/dispatch", controllers.AdminDispatchRedemption)
+	admin.POST("/rewards/redemptions/:id/deliver", controllers.AdminDeliverRedemption)
+	admin.POST("/rewards/redemptions/:id/fail", controllers.AdminFailRedemption)
 }
@@ -6,22 +6,32 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// CartRoutes serves the signed-in user's own cart only; the user always
+// comes from the token, never from the URL or body.
 func CartRoutes(r *gin.Engine) {
-    cartGroup := r.Group("/api/cart")
-    cartGroup.Use(middlewares.AuthMiddleware()) // ✅ Add this
-    {
-        cartGroup.POST("/", controllers.AddToCart)
-        cartGroup.GET("/", controllers.ViewCart)             // <-- Added this route for logged-in user
-        cartGroup.GET("/:user_id", controllers.ViewCart)     // existing route (optional, or can be removed)
-        cartGroup.DELETE("/", controllers.RemoveFromCart)
-        cartGroup.PUT("/update-qty", controllers.UpdateCartQuantity)
-    }
-
-    // Checkout
-    r.POST("/api/checkout", middlewares.AuthMiddleware(), controllers.Checkout)
-    r.POST("/cart/add", controllers.AddToCart) // alias
-    r.GET("/cart/view", controllers.ViewCartByQueryParam)
-    r.DELETE("/cart/remove/:id", controllers.RemoveCartItemByID)
-}
+	cartGroup := r.Group("/api/cart")
+	cartGroup.Use(middlewares.AuthMiddleware())
+	{
+		cartGroup.POST("/", controllers.AddToCart)
+		cartGroup.GET("/", controllers.ViewCart)
+		cartGroup.DELETE("/", controllers.RemoveFromCart)             // By product_id in the body
+		cartGroup.DELETE("/item/:id", controllers.RemoveCartItemByID) // By cart line ID
+		cartGroup.PUT("/update-qty", controllers.UpdateCartQuantity)
+		cartGroup.POST("/coupon", controllers.ApplyCartCoupon)    // Apply a coupon code
+		cartGroup.DELETE("/coupon", controllers.RemoveCartCoupon) // Remove the applied coupon
+	}
 
+	// Guest cart for visitors who have not signed in; keyed by the X-Guest-Token header
+	// and merged into the user's cart on login or OTP verification
+	guest := r.Group("/api/guest-cart")
+	{
+		guest.POST("/", controllers.AddToGuestCart)
+		guest.GET("/", controllers.ViewGuestCart)
+		guest.PUT("/update-qty", controllers.UpdateGuestCartQuantity)
+		guest.DELETE("/:productId", controllers.RemoveFromGuestCart)
+	}
 
+	// Checkout (also served at POST /api/orders/); retries with the same
+	// Idempotency-Key get the first order back instead of a second one
+	r.POST("/api/checkout", middlewares.AuthMiddleware(), middlewares.IdempotencyMiddleware(), controllers.Checkout)
+}
@@ -15,6 +15,12 @@ func ConsultationRoutes(router *gin.Engine) {
 		consultation.POST("/feedback", controllers.SubmitConsultationFeedback)
 	}
 
+	// 🛠️ Admin-only Consultation Management Routes
+	adminConsultation := router.Group("/admin/consultation").Use(middlewares.AdminMiddleware())
+	{
+		adminConsultation.PUT("/complete/:id", controllers.AdminCompleteConsultation) // ✅ Opens it for feedback
+	}
+
 	// 🚁 Drone Service Routes (User)
 	drone := router.Group("/drone").Use(middlewares.AuthMiddleware())
 	{
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func CouponRoutes(router *gin.Engine) {
+	admin := router.Group("/admin")
+	admin.Use(middlewares.AdminMiddleware()) // 🔐 Only admins manage discounts
+	{
+		admin.GET("/coupons", controllers.GetCoupons)
+		admin.POST("/coupons", controllers.CreateCoupon)
+		admin.PUT("/coupons/:id", controllers.UpdateCoupon)
+		admin.DELETE("/coupons/:id", controllers.DeactivateCoupon)
+
+		admin.GET("/promotions", controllers.GetPromotions)
+		admin.POST("/promotions", controllers.CreatePromotion)    // e.g. buy 10 bags get 1 free
+		admin.DELETE("/promotions/:id", controllers.EndPromotion) // End a promotion early
+	}
+}
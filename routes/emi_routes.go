@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func EMIRoutes(router *gin.Engine) {
+	admin := router.Group("/admin/emi")
+	admin.Use(middlewares.AdminMiddleware()) // 🔐 Only admins manage EMI terms and collections
+	{
+		admin.GET("/configs", controllers.GetEMIConfigs)
+		admin.PUT("/configs", controllers.UpsertEMIConfig)                // Tenures and rate per category
+		admin.GET("/due", controllers.GetDueEMIInstallments)              // Installments due or overdue
+		admin.POST("/plans/:orderId/approve", controllers.ApproveEMIPlan) // Approve an application, with any down payment
+		admin.POST("/plans/:orderId/reject", controllers.RejectEMIPlan)   // Turn an application down
+		admin.POST("/plans/:orderId/pay", controllers.PayEMIInstallment)  // Record a collected installment
+	}
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func InventoryRoutes(router *gin.Engine) {
+	admin := router.Group("/admin")
+	admin.Use(middlewares.AdminMiddleware()) // 🔐 Only admins manage stock
+	{
+		admin.POST("/warehouses", controllers.CreateWarehouse)
+		admin.GET("/warehouses", controllers.GetWarehouses)
+
+		admin.POST("/inventory/adjust", controllers.AdjustStock)                    // Receive or correct stock
+		admin.GET("/inventory/movements", controllers.GetStockMovements)            // Stock ledger
+		admin.GET("/inventory/product/:productId", controllers.GetProductInventory) // Per-warehouse levels
+	}
+}
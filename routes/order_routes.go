@@ -11,24 +11,30 @@ func OrderRoutes(r *gin.Engine) {
 	orders.Use(middlewares.AuthMiddleware())
 	{
 		// Order endpoints
-		orders.POST("/", controllers.OrderCheckout)         // Place new order
+		// Place new order from the cart; a retry with the same Idempotency-Key gets the first order back
+		orders.POST("/", middlewares.IdempotencyMiddleware(), controllers.Checkout)
 		orders.GET("/", controllers.GetOrderHistory)        // User's order history
 		orders.GET("/:id", controllers.GetOrderByID)        // Get specific order by ID
+		orders.GET("/:id/timeline", controllers.GetOrderTimeline) // Status history of an order
+		// Cancel before shipping; releases stock, returns coins and refunds the payment
+		orders.POST("/:id/cancel", middlewares.IdempotencyMiddleware(), controllers.CancelOrder)
 
 		// Payment endpoints
-		orders.POST("/payment/initiate", controllers.InitiatePayment)  // Start payment
+		// Start payment; idempotent like checkout
+		orders.POST("/payment/initiate", middlewares.IdempotencyMiddleware(), controllers.InitiatePayment)
 		orders.POST("/payment/verify", controllers.VerifyPayment)      // Confirm payment
 		orders.GET("/payment/options", controllers.GetPaymentOptions)  // Available payment methods
 
 		// EMI endpoints
-		orders.POST("/emiplan/apply", controllers.ApplyEMIPlan)        // Apply for EMI
-		orders.GET("/emiplan/status", controllers.GetEMIStatus)        // EMI application status
+		orders.GET("/emiplan/options", controllers.GetEMIOptions)      // Tenures and monthly amounts for an order
+		orders.POST("/emiplan/apply", controllers.ApplyEMIPlan)        // Finance an order on EMI
+		orders.GET("/emiplan/status", controllers.GetEMIStatus)        // Plan with amortization schedule
+		orders.GET("/emiplan/next", controllers.GetNextEMIInstallment) // Next installment due
 
 		// Invoice endpoint
-		orders.GET("/invoice/:orderId", controllers.GetInvoice)        // Get invoice PDF link
+		orders.GET("/invoice/:orderId", controllers.GetInvoice)        // Download GST invoice PDF
 
 		// Delivery endpoints
-		orders.GET("/delivery/agent-status", controllers.GetDeliveryAgentStatus) // Track agent
-		orders.POST("/delivery/confirm", controllers.ConfirmDelivery)            // Confirm delivery
+		orders.GET("/delivery/agent-status", controllers.GetDeliveryAgentStatus) // Agent location, ETA, timeline and handover OTP
 	}
 }
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+func PaymentRoutes(router *gin.Engine) {
+	// Called by the payment gateway, authenticated by its signature header
+	router.POST("/payments/webhook", controllers.PaymentWebhook)
+}
@@ -9,6 +9,7 @@ func ProductRoutes(r *gin.Engine) {
 	r.GET("/products", controllers.GetAllProducts)
 	r.GET("/products/filters", controllers.GetProductFilters)
 	r.GET("/product/:id", controllers.GetProductByID)
+	r.GET("/product/:id/stock", controllers.GetProductStock)
 	r.GET("/categories", controllers.GetAllCategories)
 	r.GET("/category/:slug", controllers.GetCategoryProducts)
 }
@@ -10,7 +10,33 @@ func RefundRoutes(r *gin.Engine) {
 	refund := r.Group("/")
 	refund.Use(middlewares.AuthMiddleware())
 	{
-		refund.POST("/order/return", controllers.SubmitReturnRequest)     // Request product return
-		refund.POST("/refund/request", controllers.SubmitRefundRequest)   // Request refund
+		refund.POST("/order/return", controllers.SubmitReturnRequest) // Request product return
+		refund.GET("/order/returns", controllers.GetMyReturnRequests)
+		refund.GET("/order/returns/:id", controllers.GetMyReturnRequest) // Status, pickup, QC and refund
+
+		// Request refund; a retry with the same Idempotency-Key returns the first request
+		refund.POST("/refund/request", middlewares.IdempotencyMiddleware(), controllers.SubmitRefundRequest)
+		refund.GET("/refund/requests", controllers.GetMyRefundRequests)
+		refund.GET("/refund/requests/:id", controllers.GetMyRefundRequest)
+	}
+
+	// Return (RMA) lifecycle: approve → schedule pickup → picked up →
+	// quality check, which refunds goods that pass
+	admin := r.Group("/admin")
+	admin.Use(middlewares.AdminMiddleware())
+	{
+		admin.GET("/returns", controllers.AdminListReturnRequests) // ?status=pending for the approval queue
+		admin.POST("/returns/:id/approve", controllers.AdminApproveReturn)
+		admin.POST("/returns/:id/reject", controllers.AdminRejectReturn)
+		admin.POST("/returns/:id/pickup", controllers.AdminScheduleReturnPickup)
+		admin.POST("/returns/:id/picked-up", controllers.AdminMarkReturnPickedUp)
+		admin.POST("/returns/:id/quality-check", middlewares.IdempotencyMiddleware(), controllers.AdminReturnQualityCheck)
+
+		admin.GET("/refund-requests", controllers.AdminListRefundRequests)
+		admin.POST("/refund-requests/:id/approve", middlewares.IdempotencyMiddleware(), controllers.AdminApproveRefundRequest)
+		admin.POST("/refund-requests/:id/reject", controllers.AdminRejectRefundRequest)
+
+		admin.GET("/refunds", controllers.AdminListRefunds) // ?status=failed for refunds to retry
+		admin.POST("/refunds/:id/retry", middlewares.IdempotencyMiddleware(), controllers.AdminRetryRefund)
 	}
 }
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func ShipmentRoutes(router *gin.Engine) {
+	admin := router.Group("/admin")
+	admin.Use(middlewares.AdminMiddleware()) // 🔐 Only admins assign deliveries
+	{
+		admin.POST("/shipments", controllers.AssignShipment)                            // Hand a packed order to an agent
+		admin.GET("/shipments/:orderId/proof", controllers.GetDeliveryProof)            // Proof of delivery for disputes
+		admin.GET("/shipments/:orderId/proof/photo", controllers.GetDeliveryProofPhoto) // Doorstep photo
+	}
+
+	agent := router.Group("/agent")
+	agent.Use(middlewares.AuthMiddleware(), middlewares.RequireRole("agent")) // 🚚 Delivery agents only
+	{
+		agent.GET("/shipments", controllers.GetAgentShipments)                  // My open deliveries
+		agent.POST("/shipments/:id/location", controllers.PostShipmentLocation) // GPS ping
+		agent.POST("/shipments/:id/status", controllers.UpdateShipmentStatus)   // Picked up, out for delivery, ...
+		agent.POST("/shipments/:id/deliver", controllers.CompleteDelivery)      // Hand over with the farmer's OTP
+	}
+}
@@ -12,20 +12,30 @@ func SubscriptionRoutes(router *gin.Engine) {
 	authGroup.Use(middlewares.AuthMiddleware())
 	{
 		// Subscription routes
+		authGroup.GET("/subscription/plans", controllers.GetSubscriptionPlans)
 		authGroup.POST("/subscription/create", controllers.CreateSubscription)
+		authGroup.POST("/subscription/switch", controllers.SwitchSubscriptionPlan) // Prorated for the rest of the period
 		authGroup.POST("/subscription/pause", controllers.PauseSubscription)
 		authGroup.POST("/subscription/resume", controllers.ResumeSubscription)
+		authGroup.POST("/subscription/cancel", controllers.CancelSubscription)
 		authGroup.GET("/subscription/status", controllers.GetSubscriptionStatus)
+		authGroup.GET("/subscription/entitlements", controllers.GetSubscriptionEntitlements) // Remaining quota this period
+		authGroup.GET("/subscription/invoices", controllers.GetSubscriptionInvoices)
+		authGroup.POST("/subscription/invoices/:id/pay", controllers.PaySubscriptionInvoice)
+		authGroup.POST("/subscription/invoices/:id/verify", controllers.VerifySubscriptionPayment)
 
 		// Coins
 		authGroup.GET("/coins/balance", controllers.GetCoinsBalance)
+		authGroup.GET("/coins/history", controllers.GetCoinHistory) // ?page=1&limit=20
 
 		// Referral
+		authGroup.GET("/referral/code", controllers.GetMyReferralCode) // Own code to share
 		authGroup.POST("/referral/use", controllers.UseReferralCode)
-		authGroup.GET("/referral/stats", controllers.GetReferralStats)
+		authGroup.GET("/referral/stats", controllers.GetReferralStats) // Pending vs. earned rewards
 
 		// Rewards
 		authGroup.GET("/rewards/catalog", controllers.GetRewardsCatalog)
 		authGroup.POST("/rewards/redeem", controllers.RedeemReward)
+		authGroup.GET("/rewards/redemptions", controllers.GetMyRedemptions) // Fulfilment status and vouchers
 	}
 }
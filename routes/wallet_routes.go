@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func WalletRoutes(r *gin.Engine) {
+	wallet := r.Group("/wallet")
+	wallet.Use(middlewares.AuthMiddleware())
+	{
+		wallet.GET("", controllers.GetWallet)                    // Current balance
+		wallet.GET("/statement", controllers.GetWalletStatement) // ?page=1&limit=20, newest first
+	}
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewCartLine(t *testing.T) {
+	product := &models.Product{ID: primitive.NewObjectID(), Name: "DAP 50kg", Price: 1350, GSTRate: 5}
+	item := models.CartItem{ProductID: product.ID, Quantity: 4, PriceAtAdd: 1350}
+
+	line := models.NewCartLine(item, product, 10)
+	assert.Equal(t, "DAP 50kg", line.Name)
+	assert.Equal(t, 5400.0, line.LineTotal)
+	assert.True(t, line.InStock)
+	assert.False(t, line.PriceChanged)
+
+	item.PriceAtAdd = 1300
+	line = models.NewCartLine(item, product, 3)
+	assert.True(t, line.PriceChanged)
+	assert.False(t, line.InStock, "only 3 left for 4 in the cart")
+
+	line = models.NewCartLine(item, nil, 0)
+	assert.True(t, line.Unavailable)
+	assert.Zero(t, line.LineTotal)
+}
+
+// setupCartRouter serves the cart routes as the given farmer
+func setupCartRouter(userID primitive.ObjectID) *gin.Engine {
+	r := setupCheckoutRouter(userID)
+	r.GET("/cart", controllers.ViewCart)
+	r.DELETE("/cart", controllers.RemoveFromCart)
+	r.DELETE("/cart/item/:id", controllers.RemoveCartItemByID)
+	r.PUT("/cart/update-qty", controllers.UpdateCartQuantity)
+	return r
+}
+
+func viewCart(t *testing.T, r *gin.Engine) models.CartSummary {
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/cart", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var result struct {
+		Cart models.CartSummary `json:"cart"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	return result.Cart
+}
+
+func TestCartIsOwnerOnly(t *testing.T) {
+	productID, cleanup := stockedProduct(t, 10)
+	defer cleanup()
+
+	owner, intruder := primitive.NewObjectID(), primitive.NewObjectID()
+	ownerRouter, intruderRouter := setupCartRouter(owner), setupCartRouter(intruder)
+	ctx := context.Background()
+	defer config.DB.Collection("cart").DeleteMany(ctx, bson.M{"user_id": bson.M{"$in": []primitive.ObjectID{owner, intruder}}})
+
+	body, _ := json.Marshal(map[string]interface{}{"product_id": productID.Hex(), "quantity": 2})
+	resp := httptest.NewRecorder()
+	ownerRouter.ServeHTTP(resp, createJSONRequest("POST", "/cart/add", body))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var line models.CartItem
+	assert.NoError(t, config.DB.Collection("cart").FindOne(ctx, bson.M{"user_id": owner}).Decode(&line))
+
+	t.Run("Read", func(t *testing.T) {
+		assert.Empty(t, viewCart(t, intruderRouter).Items)
+	})
+
+	t.Run("Remove by line ID", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		intruderRouter.ServeHTTP(resp, httptest.NewRequest("DELETE", "/cart/item/"+line.ID.Hex(), nil))
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Remove by product", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"product_id": productID.Hex()})
+		resp := httptest.NewRecorder()
+		intruderRouter.ServeHTTP(resp, createJSONRequest("DELETE", "/cart", body))
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Update quantity", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{"product_id": productID.Hex(), "quantity": 9})
+		resp := httptest.NewRecorder()
+		intruderRouter.ServeHTTP(resp, createJSONRequest("PUT", "/cart/update-qty", body))
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("User in the body is ignored", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{"product_id": productID.Hex(), "quantity": 1, "user_id": owner.Hex()})
+		resp := httptest.NewRecorder()
+		intruderRouter.ServeHTTP(resp, createJSONRequest("POST", "/cart/add", body))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Len(t, viewCart(t, intruderRouter).Items, 1)
+	})
+
+	t.Run("Checkout", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		intruderRouter.ServeHTTP(resp, httptest.NewRequest("POST", "/checkout", nil))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var placed struct {
+			Order models.Order `json:"order"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &placed))
+		assert.Equal(t, intruder, placed.Order.UserID)
+		assert.Equal(t, 1, placed.Order.Items[0].Quantity)
+	})
+
+	// The owner's cart is untouched throughout
+	cart := viewCart(t, ownerRouter)
+	if assert.Len(t, cart.Items, 1) {
+		assert.Equal(t, line.ID, cart.Items[0].ID)
+		assert.Equal(t, 2, cart.Items[0].Quantity)
+	}
+}
+
+func TestCartNeedsSignIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.GET("/cart", controllers.ViewCart)
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/cart", nil))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoinRuleCoinsFor(t *testing.T) {
+	flat := models.CoinRule{Event: models.CoinEventReviewSubmitted, Coins: 10}
+	assert.Equal(t, 10, flat.CoinsFor(0))
+
+	perAmount := models.CoinRule{Event: models.CoinEventOrderPaid, Coins: 2, PerAmount: 100}
+	assert.Equal(t, 0, perAmount.CoinsFor(99.99), "only full steps count")
+	assert.Equal(t, 10, perAmount.CoinsFor(549))
+
+	perAmount.MaxPerEvent = 8
+	assert.Equal(t, 8, perAmount.CoinsFor(549))
+}
+
+func TestCoinRuleGrantable(t *testing.T) {
+	rule := models.CoinRule{Coins: 10, MaxPerUser: 25}
+	assert.Equal(t, 10, rule.Grantable(10, 0))
+	assert.Equal(t, 5, rule.Grantable(10, 20), "trimmed to the cap")
+	assert.Equal(t, 0, rule.Grantable(10, 30), "cap already exceeded")
+
+	uncapped := models.CoinRule{Coins: 10}
+	assert.Equal(t, 10, uncapped.Grantable(10, 1000))
+}
+
+func TestCoinRuleWindowAndExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	rule := models.CoinRule{}
+	assert.True(t, rule.CapWindowStart(now).IsZero(), "cap counts for all time")
+	assert.Nil(t, rule.ExpiresAt(now), "coins never expire")
+
+	rule = models.CoinRule{CapWindowDays: 30, ExpiryDays: 90}
+	assert.Equal(t, now.AddDate(0, 0, -30), rule.CapWindowStart(now))
+	assert.Equal(t, now.AddDate(0, 0, 90), *rule.ExpiresAt(now))
+}
+
+func TestIsCoinEvent(t *testing.T) {
+	assert.True(t, models.IsCoinEvent(models.CoinEventKYCApproved))
+	assert.False(t, models.IsCoinEvent("daily_login"))
+}
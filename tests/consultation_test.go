@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func setupConsultationRouter(userID primitive.ObjectID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controllers.InitConsultationCollection()
+
+	r := gin.Default()
+	r.PUT("/admin/consultation/complete/:id", controllers.AdminCompleteConsultation)
+	farmer := r.Group("/", func(c *gin.Context) { c.Set("user_id", userID) })
+	farmer.POST("/consultation/book", controllers.BookConsultation)
+	farmer.POST("/consultation/feedback", controllers.SubmitConsultationFeedback)
+	return r
+}
+
+func TestFeedbackNeedsOwnCompletedConsultation(t *testing.T) {
+	ctx := context.Background()
+	farmer := primitive.NewObjectID()
+	r := setupConsultationRouter(farmer)
+	defer config.DB.Collection("consultations").DeleteMany(ctx, bson.M{"user_id": farmer})
+	defer config.DB.Collection("consultation_feedback").DeleteMany(ctx, bson.M{"user_id": farmer})
+
+	call := func(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, createJSONRequest(method, path, data))
+		return resp
+	}
+
+	resp := call(r, "POST", "/consultation/book", map[string]string{"expert_id": "expert-1", "topic": "Leaf curl"})
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var booked struct {
+		ConsultationID primitive.ObjectID `json:"consultation_id"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &booked))
+	feedback := map[string]interface{}{"consultation_id": booked.ConsultationID.Hex(), "rating": 5}
+
+	assert.Equal(t, http.StatusConflict, call(r, "POST", "/consultation/feedback", feedback).Code, "not held yet")
+	assert.Equal(t, http.StatusNotFound, call(setupConsultationRouter(primitive.NewObjectID()), "POST", "/consultation/feedback", feedback).Code, "another farmer's")
+
+	assert.Equal(t, http.StatusOK, call(r, "PUT", "/admin/consultation/complete/"+booked.ConsultationID.Hex(), nil).Code)
+	assert.Equal(t, http.StatusOK, call(r, "POST", "/consultation/feedback", feedback).Code)
+	assert.Equal(t, http.StatusConflict, call(r, "POST", "/consultation/feedback", feedback).Code, "once per consultation")
+}
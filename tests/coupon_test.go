@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPromotionFreeUnits(t *testing.T) {
+	promo := models.Promotion{BuyQuantity: 10, FreeQuantity: 1}
+	assert.Equal(t, 0, promo.FreeUnits(10))
+	assert.Equal(t, 1, promo.FreeUnits(11))
+	assert.Equal(t, 2, promo.FreeUnits(25))
+}
+
+func TestEvaluateDiscounts(t *testing.T) {
+	now := time.Now()
+	urea := primitive.NewObjectID()
+	seeds := primitive.NewObjectID()
+	seedCategory := primitive.NewObjectID()
+	items := []models.OrderItem{
+		{ProductID: urea, Name: "Urea 45kg", UnitPrice: 300, Quantity: 11},
+		{ProductID: seeds, CategoryID: seedCategory, Name: "Hybrid seeds", UnitPrice: 500, Quantity: 2},
+	}
+	promos := []models.Promotion{{
+		ID: primitive.NewObjectID(), Name: "Kharif offer", ProductIDs: []primitive.ObjectID{urea},
+		BuyQuantity: 10, FreeQuantity: 1, Active: true,
+	}}
+
+	discounts, err := models.EvaluateDiscounts(items, promos, nil, now)
+	assert.NoError(t, err)
+	assert.Len(t, discounts, 1)
+	assert.Equal(t, 300.0, models.TotalDiscount(discounts))
+
+	// A seeds-only coupon works on the seeds line alone
+	coupon := &models.Coupon{
+		Code: "SEED10", Type: models.CouponPercentage, Value: 10, MaxDiscount: 80,
+		CategoryIDs: []primitive.ObjectID{seedCategory}, Active: true,
+	}
+	discounts, err = models.EvaluateDiscounts(items, promos, coupon, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 80.0, discounts[1].Amount, "10% of 1000 capped at 80")
+	assert.Equal(t, 380.0, models.TotalDiscount(discounts))
+
+	// A flat coupon on the urea applies after the free bag
+	flat := &models.Coupon{Code: "UREA5000", Type: models.CouponFlat, Value: 5000, ProductIDs: []primitive.ObjectID{urea}, Active: true}
+	discounts, err = models.EvaluateDiscounts(items, promos, flat, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3000.0, discounts[1].Amount, "never more than the eligible amount")
+}
+
+func TestCouponRejections(t *testing.T) {
+	now := time.Now()
+	items := []models.OrderItem{{ProductID: primitive.NewObjectID(), UnitPrice: 400, Quantity: 1}}
+	past := now.Add(-time.Hour)
+
+	cases := map[*models.Coupon]error{
+		{Type: models.CouponFlat, Value: 50}:                                                                          models.ErrCouponInactive,
+		{Type: models.CouponFlat, Value: 50, Active: true, ValidUntil: &past}:                                         models.ErrCouponExpired,
+		{Type: models.CouponFlat, Value: 50, Active: true, MinCartValue: 500}:                                         models.ErrCouponMinCartValue,
+		{Type: models.CouponFlat, Value: 50, Active: true, UsageLimit: 5, UsedCount: 5}:                               models.ErrCouponUsageLimit,
+		{Type: models.CouponFlat, Value: 50, Active: true, ProductIDs: []primitive.ObjectID{primitive.NewObjectID()}}: models.ErrCouponNotApplicable,
+	}
+	for coupon, want := range cases {
+		_, err := models.EvaluateDiscounts(items, nil, coupon, now)
+		assert.ErrorIs(t, err, want)
+		assert.True(t, models.IsCouponRejection(err))
+	}
+}
+
+func TestOrderTotalsWithDiscount(t *testing.T) {
+	order := models.Order{
+		Items:    []models.OrderItem{{UnitPrice: 1050, Quantity: 2, GSTRate: 5}},
+		Discount: 210,
+	}
+	order.CalculateTotals("Maharashtra")
+	assert.Equal(t, 2100.0, order.Subtotal)
+	assert.Equal(t, 1890.0, order.TotalAmount)
+	assert.Equal(t, 1800.0, order.TaxBreakdown.TaxableValue)
+	assert.Equal(t, 90.0, order.Tax)
+}
+
+func TestFullyDiscountedOrderIsPaid(t *testing.T) {
+	productID, cleanup := stockedProduct(t, 5)
+	defer cleanup()
+
+	ctx := context.Background()
+	coupon := models.Coupon{
+		ID:        primitive.NewObjectID(),
+		Code:      "FREE" + primitive.NewObjectID().Hex()[18:],
+		Type:      models.CouponPercentage,
+		Value:     100,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	config.DB.Collection("coupons").InsertOne(ctx, coupon)
+	defer config.DB.Collection("coupons").DeleteOne(ctx, bson.M{"_id": coupon.ID})
+	defer config.DB.Collection("coupon_redemptions").DeleteMany(ctx, bson.M{"coupon_id": coupon.ID})
+
+	userID := primitive.NewObjectID()
+	r := setupCheckoutRouter(userID)
+	r.POST("/cart/coupon", controllers.ApplyCartCoupon)
+	r.POST("/orders/payment", controllers.InitiatePayment)
+
+	body, _ := json.Marshal(map[string]interface{}{"product_id": productID.Hex(), "quantity": 1})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/cart/add", body))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	body, _ = json.Marshal(map[string]string{"code": coupon.Code})
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/cart/coupon", body))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("POST", "/checkout", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var placed struct {
+		Order models.Order `json:"order"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &placed))
+	assert.Zero(t, placed.Order.TotalAmount)
+	assert.Equal(t, models.OrderStatusPaid, placed.Order.Status)
+	assert.Equal(t, "covered", placed.Order.PaymentStatus)
+
+	// There is no ₹0 payment to start at the gateway
+	body, _ = json.Marshal(map[string]string{"orderId": placed.Order.ID.Hex(), "paymentGateway": "UPI"})
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/orders/payment", body))
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	payments, _ := config.DB.Collection("payments").CountDocuments(ctx, bson.M{"order_id": placed.Order.ID})
+	assert.Zero(t, payments)
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEMISchedule(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	plan := models.NewEMIPlan(primitive.NewObjectID(), primitive.NewObjectID(), 100000, 12, 12, start)
+
+	assert.Equal(t, 8884.88, plan.MonthlyInstallment)
+	assert.Len(t, plan.Installments, 12)
+
+	first := plan.Installments[0]
+	assert.Equal(t, 1000.0, first.Interest, "1% of the opening balance")
+	assert.Equal(t, 7884.88, first.Principal)
+	assert.Equal(t, time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC), first.DueDate)
+
+	principal, interest := 0.0, 0.0
+	for _, inst := range plan.Installments {
+		principal += inst.Principal
+		interest += inst.Interest
+		assert.Equal(t, models.InstallmentDue, inst.Status)
+	}
+	assert.Equal(t, 100000.0, models.RoundAmount(principal))
+	assert.Equal(t, plan.TotalInterest, models.RoundAmount(interest))
+	assert.Equal(t, 0.0, plan.Installments[11].Balance)
+	assert.Equal(t, models.RoundAmount(100000+interest), plan.TotalPayable)
+
+	next := plan.NextInstallment()
+	assert.Equal(t, 1, next.Number)
+	assert.True(t, next.IsOverdue(start.AddDate(0, 2, 0)))
+}
+
+func TestEMIScheduleZeroInterest(t *testing.T) {
+	plan := models.NewEMIPlan(primitive.NewObjectID(), primitive.NewObjectID(), 1000, 0, 3, time.Now())
+
+	assert.Equal(t, 333.33, plan.MonthlyInstallment)
+	assert.Equal(t, 333.34, plan.Installments[2].Amount, "last installment absorbs rounding")
+	assert.Equal(t, 1000.0, plan.TotalPayable)
+	assert.Equal(t, 0.0, plan.TotalInterest)
+}
+
+func TestEMIPlanAwaitsApproval(t *testing.T) {
+	plan := models.NewEMIPlan(primitive.NewObjectID(), primitive.NewObjectID(), 1000, 0, 3, time.Now())
+	assert.Equal(t, models.EMIPlanPendingApproval, plan.Status, "nothing is financed before the dealer approves")
+	assert.Equal(t, 0.0, plan.Collected())
+
+	plan.DownPayment = 200
+	plan.AmountPaid = 333.33
+	assert.Equal(t, 533.33, plan.Collected())
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntitlementCovers(t *testing.T) {
+	acres := models.PlanEntitlement{Service: models.EntitlementDroneAcres, Quota: 5}
+	assert.Equal(t, 3.0, acres.Covers(0, 3))
+	assert.Equal(t, 2.0, acres.Covers(3, 8), "covers only what is left")
+	assert.Zero(t, acres.Covers(5, 1), "quota used up")
+	assert.Zero(t, acres.Covers(6, 1), "never negative")
+	assert.Zero(t, acres.Covers(0, 0))
+
+	unlimited := models.PlanEntitlement{Service: models.EntitlementPrioritySupport}
+	assert.True(t, unlimited.Unlimited())
+	assert.Equal(t, 1.0, unlimited.Covers(100, 1))
+}
+
+func TestPlanEntitlement(t *testing.T) {
+	plan := models.SubscriptionPlan{Entitlements: []models.PlanEntitlement{
+		{Service: models.EntitlementConsultations, Quota: 3},
+	}}
+	e, ok := plan.Entitlement(models.EntitlementConsultations)
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, e.Quota)
+	_, ok = plan.Entitlement(models.EntitlementDroneAcres)
+	assert.False(t, ok)
+}
+
+func TestUsageOf(t *testing.T) {
+	report := models.UsageOf([]models.PlanEntitlement{
+		{Service: models.EntitlementConsultations, Quota: 3},
+		{Service: models.EntitlementDroneAcres, Quota: 5},
+		{Service: models.EntitlementPrioritySupport},
+	}, map[string]float64{
+		models.EntitlementConsultations:   1,
+		models.EntitlementDroneAcres:      7,
+		models.EntitlementPrioritySupport: 4,
+	})
+
+	assert.Len(t, report, 3)
+	assert.Equal(t, 2.0, *report[0].Remaining)
+	assert.Equal(t, 0.0, *report[1].Remaining, "never negative")
+	assert.Nil(t, report[2].Remaining, "unlimited")
+	assert.Equal(t, 4.0, report[2].Used)
+
+	assert.Empty(t, models.UsageOf(nil, nil))
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const guestCartTestEmail = "guestcart@example.com"
+
+func setupGuestCartRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controllers.InitAuthCollection()
+	controllers.InitGuestCartCollection()
+
+	r := gin.Default()
+	r.POST("/auth/signup", controllers.Signup)
+	r.POST("/auth/login", controllers.Login)
+	r.POST("/guest-cart", controllers.AddToGuestCart)
+	return r
+}
+
+// addToGuestCart adds quantity of a product to the cart of token, starting
+// a new cart when token is empty, and returns the cart's token
+func addToGuestCart(t *testing.T, r *gin.Engine, token string, productID primitive.ObjectID, quantity int) string {
+	body, _ := json.Marshal(map[string]interface{}{"product_id": productID.Hex(), "quantity": quantity})
+	req := createJSONRequest("POST", "/guest-cart", body)
+	if token != "" {
+		req.Header.Set(controllers.GuestTokenHeader, token)
+	}
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	return resp.Header().Get(controllers.GuestTokenHeader)
+}
+
+func loginWithGuestCart(t *testing.T, r *gin.Engine, token string) int {
+	body, _ := json.Marshal(map[string]string{"email": guestCartTestEmail, "password": "test1234"})
+	req := createJSONRequest("POST", "/auth/login", body)
+	req.Header.Set(controllers.GuestTokenHeader, token)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var result struct {
+		CartMerged int `json:"cartMerged"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	return result.CartMerged
+}
+
+func TestGuestCartMergesOnLogin(t *testing.T) {
+	r := setupGuestCartRouter()
+	ctx := context.Background()
+	users := config.DB.Collection("users")
+	users.DeleteMany(ctx, bson.M{"email": guestCartTestEmail})
+	defer users.DeleteMany(ctx, bson.M{"email": guestCartTestEmail})
+
+	body, _ := json.Marshal(map[string]string{
+		"name":     "Guest Cart",
+		"email":    guestCartTestEmail,
+		"password": "test1234",
+		"phone":    "9876500013",
+	})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/auth/signup", body))
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var user models.User
+	assert.NoError(t, users.FindOne(ctx, bson.M{"email": guestCartTestEmail}).Decode(&user))
+	defer config.DB.Collection("cart").DeleteMany(ctx, bson.M{"user_id": user.ID})
+
+	seeds, cleanupSeeds := stockedProduct(t, 10)
+	defer cleanupSeeds()
+	tools, cleanupTools := stockedProduct(t, 10)
+	defer cleanupTools()
+
+	// Seeds are already in the farmer's cart from another device
+	config.DB.Collection("cart").InsertOne(ctx, models.CartItem{
+		ID: primitive.NewObjectID(), UserID: user.ID, ProductID: seeds, Quantity: 1, CreatedAt: time.Now(),
+	})
+
+	token := addToGuestCart(t, r, "", seeds, 2)
+	addToGuestCart(t, r, token, tools, 1)
+
+	assert.Equal(t, 2, loginWithGuestCart(t, r, token))
+
+	var line models.CartItem
+	assert.NoError(t, config.DB.Collection("cart").FindOne(ctx, bson.M{"user_id": user.ID, "product_id": seeds}).Decode(&line))
+	assert.Equal(t, 3, line.Quantity)
+	assert.NoError(t, config.DB.Collection("cart").FindOne(ctx, bson.M{"user_id": user.ID, "product_id": tools}).Decode(&line))
+	assert.Equal(t, 1, line.Quantity)
+
+	left, _ := config.DB.Collection("guest_carts").CountDocuments(ctx, bson.M{"token": token})
+	assert.Zero(t, left)
+
+	// Signing in again with the same token adds nothing twice
+	assert.Equal(t, 0, loginWithGuestCart(t, r, token))
+	assert.NoError(t, config.DB.Collection("cart").FindOne(ctx, bson.M{"user_id": user.ID, "product_id": seeds}).Decode(&line))
+	assert.Equal(t, 3, line.Quantity)
+}
+
+func TestGuestCartExpiresAsAWhole(t *testing.T) {
+	r := setupGuestCartRouter()
+	ctx := context.Background()
+	guestCarts := config.DB.Collection("guest_carts")
+
+	seeds, cleanupSeeds := stockedProduct(t, 10)
+	defer cleanupSeeds()
+	tools, cleanupTools := stockedProduct(t, 10)
+	defer cleanupTools()
+
+	token := addToGuestCart(t, r, "", seeds, 1)
+	defer guestCarts.DeleteMany(ctx, bson.M{"token": token})
+	guestCarts.UpdateOne(ctx, bson.M{"token": token, "product_id": seeds},
+		bson.M{"$set": bson.M{"updated_at": time.Now().Add(-29 * 24 * time.Hour)}})
+
+	// Adding another product keeps the older line as long as the new one
+	addToGuestCart(t, r, token, tools, 1)
+
+	var line models.GuestCartItem
+	assert.NoError(t, guestCarts.FindOne(ctx, bson.M{"token": token, "product_id": seeds}).Decode(&line))
+	assert.WithinDuration(t, time.Now(), line.UpdatedAt, time.Minute)
+}
+
+func TestGuestCartExpiryIndex(t *testing.T) {
+	database.InitDatabase()
+
+	cursor, err := config.DB.Collection("guest_carts").Indexes().List(context.Background())
+	assert.NoError(t, err)
+	var indexes []bson.M
+	assert.NoError(t, cursor.All(context.Background(), &indexes))
+
+	var ttl interface{}
+	for _, index := range indexes {
+		if keys, ok := index["key"].(bson.M); ok && keys["updated_at"] != nil {
+			ttl = index["expireAfterSeconds"]
+		}
+	}
+	assert.EqualValues(t, models.GuestCartTTL.Seconds(), ttl)
+}
@@ -0,0 +1,21 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyRecordReplayable(t *testing.T) {
+	now := time.Now()
+	record := models.IdempotencyRecord{Status: models.IdempotencyCompleted, CreatedAt: now.Add(-time.Hour)}
+	assert.True(t, record.Replayable(now))
+
+	record.CreatedAt = now.Add(-models.IdempotencyWindow)
+	assert.False(t, record.Replayable(now), "window is over")
+
+	record = models.IdempotencyRecord{Status: models.IdempotencyInProgress, CreatedAt: now}
+	assert.False(t, record.Replayable(now), "nothing to replay yet")
+}
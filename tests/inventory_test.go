@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// setupCheckoutRouter serves the cart and checkout as the given farmer
+func setupCheckoutRouter(userID primitive.ObjectID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controllers.InitInventoryCollections()
+	controllers.InitCouponCollections()
+
+	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.POST("/cart/add", controllers.AddToCart)
+	r.POST("/checkout", controllers.Checkout)
+	return r
+}
+
+// stockedProduct inserts a product with onHand units in one warehouse;
+// onHand < 0 leaves it without inventory rows
+func stockedProduct(t *testing.T, onHand int) (primitive.ObjectID, func()) {
+	ctx := context.Background()
+	product := models.Product{ID: primitive.NewObjectID(), Name: "Test Seeds", Price: 100, InStock: true}
+	if _, err := config.DB.Collection("products").InsertOne(ctx, product); err != nil {
+		t.Fatalf("❌ Failed to insert test product: %v", err)
+	}
+	if onHand >= 0 {
+		_, err := config.DB.Collection("inventory").InsertOne(ctx, models.InventoryItem{
+			ProductID:   product.ID,
+			WarehouseID: primitive.NewObjectID(),
+			OnHand:      onHand,
+			UpdatedAt:   time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("❌ Failed to insert test inventory: %v", err)
+		}
+	}
+	return product.ID, func() {
+		config.DB.Collection("products").DeleteOne(ctx, bson.M{"_id": product.ID})
+		config.DB.Collection("inventory").DeleteMany(ctx, bson.M{"product_id": product.ID})
+		config.DB.Collection("stock_reservations").DeleteMany(ctx, bson.M{"product_id": product.ID})
+		config.DB.Collection("stock_movements").DeleteMany(ctx, bson.M{"product_id": product.ID})
+		config.DB.Collection("orders").DeleteMany(ctx, bson.M{"items.product_id": product.ID})
+	}
+}
+
+// checkoutOne adds one unit of the product to a farmer's cart and checks out
+func checkoutOne(t *testing.T, userID, productID primitive.ObjectID) *httptest.ResponseRecorder {
+	r := setupCheckoutRouter(userID)
+	body, _ := json.Marshal(map[string]interface{}{"product_id": productID.Hex(), "quantity": 1})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/cart/add", body))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("POST", "/checkout", nil))
+	return resp
+}
+
+func reservedStock(t *testing.T, productID primitive.ObjectID) int {
+	var row models.InventoryItem
+	err := config.DB.Collection("inventory").FindOne(context.Background(), bson.M{"product_id": productID}).Decode(&row)
+	if err != nil {
+		t.Fatalf("❌ Failed to read inventory: %v", err)
+	}
+	return row.Reserved
+}
+
+func TestCheckoutReservesStock(t *testing.T) {
+	productID, cleanup := stockedProduct(t, 1)
+	defer cleanup()
+
+	first := checkoutOne(t, primitive.NewObjectID(), productID)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, 1, reservedStock(t, productID))
+
+	// The last unit is held for the first order
+	second := checkoutOne(t, primitive.NewObjectID(), productID)
+	assert.Equal(t, http.StatusConflict, second.Code)
+	assert.Equal(t, 1, reservedStock(t, productID))
+}
+
+func TestUntrackedProductStillSells(t *testing.T) {
+	productID, cleanup := stockedProduct(t, -1)
+	defer cleanup()
+
+	resp := checkoutOne(t, primitive.NewObjectID(), productID)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var product models.Product
+	err := config.DB.Collection("products").FindOne(context.Background(), bson.M{"_id": productID}).Decode(&product)
+	assert.NoError(t, err)
+	assert.True(t, product.InStock)
+}
+
+func TestUnpaidOrderExpires(t *testing.T) {
+	productID, cleanup := stockedProduct(t, 1)
+	defer cleanup()
+
+	resp := checkoutOne(t, primitive.NewObjectID(), productID)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var placed struct {
+		Order models.Order `json:"order"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &placed))
+
+	ctx := context.Background()
+	orders := config.DB.Collection("orders")
+	orders.UpdateOne(ctx, bson.M{"_id": placed.Order.ID},
+		bson.M{"$set": bson.M{"created_at": time.Now().Add(-2 * models.DefaultPendingOrderTTL)}})
+
+	// One run of the job, then it stops with its context
+	jobs, stop := context.WithTimeout(ctx, 2*time.Second)
+	defer stop()
+	controllers.RunPendingOrderExpiryJob(jobs, time.Hour)
+
+	var order models.Order
+	assert.NoError(t, orders.FindOne(ctx, bson.M{"_id": placed.Order.ID}).Decode(&order))
+	assert.Equal(t, models.OrderStatusCancelled, order.Status)
+	assert.Equal(t, 0, reservedStock(t, productID))
+}
+
+func TestProductStockReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	controllers.InitInventoryCollections()
+	r := gin.Default()
+	r.GET("/product/:id/stock", controllers.GetProductStock)
+
+	stock := func(productID primitive.ObjectID) map[string]interface{} {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest("GET", "/product/"+productID.Hex()+"/stock", nil))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		return body
+	}
+
+	tracked, cleanupTracked := stockedProduct(t, 4)
+	defer cleanupTracked()
+	body := stock(tracked)
+	assert.Equal(t, true, body["tracked"])
+	assert.EqualValues(t, 4, body["available"])
+
+	// Sold on its in_stock flag at checkout, so not reported as 0 available
+	untracked, cleanupUntracked := stockedProduct(t, -1)
+	defer cleanupUntracked()
+	body = stock(untracked)
+	assert.Equal(t, false, body["tracked"])
+	assert.Nil(t, body["available"])
+	assert.Equal(t, true, body["in_stock"])
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/internal/invoice"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func invoiceTestOrder() models.Order {
+	order := models.Order{
+		ID:     primitive.NewObjectID(),
+		UserID: primitive.NewObjectID(),
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), Name: "Urea 45kg", HSNCode: "3102", GSTRate: 5, UnitPrice: 283.5, Quantity: 2},
+			{ProductID: primitive.NewObjectID(), Name: "Sprayer pump", HSNCode: "8424", GSTRate: 12, UnitPrice: 3360, Quantity: 1},
+		},
+	}
+	order.CalculateTotals("Maharashtra")
+	return order
+}
+
+func TestInvoiceIntraStateSplit(t *testing.T) {
+	seller := models.InvoiceParty{Name: "ShetiSeva", State: "Maharashtra", StateCode: "27"}
+	inv := models.NewInvoice(invoiceTestOrder(), "SS/24-25/000001", seller, models.InvoiceParty{Name: "Ramesh"})
+
+	assert.False(t, inv.InterState)
+	assert.Equal(t, "27", inv.PlaceOfSupply)
+
+	urea := inv.Items[0]
+	assert.Equal(t, 540.0, urea.TaxableValue)
+	assert.Equal(t, 13.5, urea.CGST)
+	assert.Equal(t, 13.5, urea.SGST)
+	assert.Equal(t, 0.0, urea.IGST)
+
+	assert.Equal(t, 3540.0, inv.TaxableValue)
+	assert.Equal(t, inv.Total, models.RoundAmount(inv.TaxableValue+inv.CGST+inv.SGST+inv.IGST))
+}
+
+func TestInvoiceInterStateSplit(t *testing.T) {
+	seller := models.InvoiceParty{Name: "ShetiSeva", State: "Maharashtra"}
+	buyer := models.InvoiceParty{Name: "Suresh", State: "Karnataka"}
+	inv := models.NewInvoice(invoiceTestOrder(), "SS/24-25/000002", seller, buyer)
+
+	assert.True(t, inv.InterState)
+	assert.Equal(t, "29", inv.PlaceOfSupply)
+	assert.Equal(t, 0.0, inv.CGST)
+	assert.Equal(t, 387.0, inv.IGST)
+}
+
+func TestInvoicePlaceOfSupplyByStateCode(t *testing.T) {
+	seller := models.InvoiceParty{Name: "ShetiSeva", State: "MH"}
+	buyer := models.InvoiceParty{Name: "Ramesh", State: "Maharashtra", StateCode: "27"}
+	inv := models.NewInvoice(invoiceTestOrder(), "SS/24-25/000004", seller, buyer)
+
+	assert.False(t, inv.InterState, "MH and Maharashtra are the same state")
+	assert.Equal(t, 0.0, inv.IGST)
+}
+
+func TestInvoiceNumbering(t *testing.T) {
+	assert.Equal(t, "24-25", models.FinancialYear(time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "25-26", models.FinancialYear(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)))
+
+	no := models.FormatInvoiceNumber("SS", "25-26", 42)
+	assert.Equal(t, "SS/25-26/000042", no)
+	assert.LessOrEqual(t, len(no), 16)
+}
+
+func TestInvoiceRenderPDF(t *testing.T) {
+	inv := models.NewInvoice(invoiceTestOrder(), "SS/24-25/000003", invoice.SellerFromEnv(), models.InvoiceParty{Name: "Ramesh (Nashik)"})
+	pdf := invoice.Render(inv)
+
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), "SS/24-25/000003")
+	assert.Contains(t, string(pdf), `Ramesh \(Nashik\)`)
+}
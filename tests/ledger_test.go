@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLedgerEntryBalanced(t *testing.T) {
+	userID := primitive.NewObjectID()
+	entry := models.NewLedgerEntry(models.LedgerKindWallet, "wallet:1", models.LedgerCurrencyINR, 149.999,
+		models.PlatformAccount(models.AccountRefundsPayable), models.UserAccount(models.AccountUserWallet, userID), "Refund")
+	assert.True(t, entry.Balanced())
+	assert.Equal(t, 150.0, entry.Postings[0].Debit)
+	assert.Equal(t, 150.0, entry.Postings[1].Credit)
+	assert.Equal(t, userID, *entry.Postings[1].UserID)
+
+	entry.Postings[1].Credit = 100
+	assert.False(t, entry.Balanced(), "debits and credits differ")
+
+	entry.Postings[1].Credit = 150
+	entry.Postings[1].Debit = 150
+	assert.False(t, entry.Balanced(), "a posting is either a debit or a credit")
+
+	entry.Postings = entry.Postings[:1]
+	assert.False(t, entry.Balanced(), "one-sided")
+}
+
+func TestLedgerCreditNormal(t *testing.T) {
+	assert.True(t, models.CreditNormal(models.AccountUserWallet))
+	assert.True(t, models.CreditNormal(models.AccountRefundsPayable))
+	assert.False(t, models.CreditNormal(models.AccountPaymentGateway))
+	assert.False(t, models.CreditNormal(models.AccountCoinPool))
+}
+
+func TestCompareUserBalances(t *testing.T) {
+	agrees, differs, ledgerOnly, balanceOnly := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	ledger := map[primitive.ObjectID]float64{agrees: 100, differs: 50, ledgerOnly: 20}
+	actual := map[primitive.ObjectID]float64{agrees: 100.001, differs: 45, balanceOnly: 5}
+
+	mismatches := models.CompareUserBalances(models.CheckWalletBalance, ledger, actual)
+	assert.Len(t, mismatches, 3)
+
+	byUser := map[primitive.ObjectID]models.ReconciliationMismatch{}
+	for _, m := range mismatches {
+		assert.Equal(t, models.CheckWalletBalance, m.Check)
+		byUser[*m.UserID] = m
+	}
+	assert.NotContains(t, byUser, agrees, "rounding is not a mismatch")
+	assert.Equal(t, 45.0, byUser[differs].Actual)
+	assert.Equal(t, 0.0, byUser[ledgerOnly].Actual)
+	assert.Equal(t, 0.0, byUser[balanceOnly].Ledger)
+}
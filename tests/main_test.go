@@ -6,11 +6,13 @@ import (
 
 	"github.com/ashishnagargoje0/backend/config"
 	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/database"
 )
 
 func TestMain(m *testing.M) {
 	// ✅ Connect to MongoDB before running any tests
 	config.ConnectMongoDB()
+	database.ConnectDB() // payments, refunds, invoices and the ledger
 
 	// ✅ Initialize all collections used in tests
 	controllers.InitCartCollection()
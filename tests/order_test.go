@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderCalculateTotals(t *testing.T) {
+	order := models.Order{
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), Name: "DAP 50kg", GSTRate: 5, UnitPrice: 1350, Quantity: 2},
+			{ProductID: primitive.NewObjectID(), Name: "Cotton seed", UnitPrice: 864.333, Quantity: 3},
+		},
+		Discount:      100,
+		PlaceOfSupply: "Maharashtra",
+	}
+
+	order.CalculateTotals("Maharashtra")
+
+	assert.Equal(t, 2700.0, order.Items[0].LineTotal)
+	assert.Equal(t, 2593.0, order.Items[1].LineTotal)
+	assert.Equal(t, 5293.0, order.Subtotal)
+	assert.Equal(t, 5193.0, order.TotalAmount, "prices include GST, so tax is not added on top")
+
+	// DAP carries 51.01 of the discount: 2648.99 incl. 5% GST
+	assert.Equal(t, 2522.85, order.Items[0].TaxableValue)
+	assert.Equal(t, 63.07, order.Items[0].CGST)
+	assert.Equal(t, 63.07, order.Items[0].SGST)
+	assert.Equal(t, 126.14, order.Tax)
+	assert.False(t, order.TaxBreakdown.InterState)
+
+	t.Run("Discount never makes total negative", func(t *testing.T) {
+		order := models.Order{
+			Items:    []models.OrderItem{{UnitPrice: 50, Quantity: 1}},
+			Discount: 80,
+		}
+		order.CalculateTotals("Maharashtra")
+		assert.Equal(t, 0.0, order.TotalAmount)
+	})
+}
+
+func TestOrderRedeemCoins(t *testing.T) {
+	order := models.Order{
+		Items:         []models.OrderItem{{Name: "Neem oil 1L", GSTRate: 18, UnitPrice: 450, Quantity: 1}},
+		Discount:      50,
+		PlaceOfSupply: "Maharashtra",
+	}
+
+	used := order.RedeemCoins(100, "Maharashtra")
+	assert.Equal(t, 100, used)
+	assert.Equal(t, 100, order.CoinsUsed)
+	assert.Equal(t, 150.0, order.Discount)
+	assert.Equal(t, 300.0, order.TotalAmount)
+	assert.Equal(t, models.DiscountCoins, order.Discounts[0].Kind)
+
+	t.Run("Only as many coins as the order is worth", func(t *testing.T) {
+		order := models.Order{Items: []models.OrderItem{{UnitPrice: 80.5, Quantity: 1}}}
+		assert.Equal(t, 80, order.RedeemCoins(500, "Maharashtra"))
+		assert.Equal(t, 0.5, order.TotalAmount)
+	})
+}
+
+func TestOrderStatusTransitions(t *testing.T) {
+	allowed := [][2]string{
+		{models.OrderStatusPending, models.OrderStatusPaid},
+		{models.OrderStatusPaid, models.OrderStatusPacked},
+		{models.OrderStatusPacked, models.OrderStatusShipped},
+		{models.OrderStatusShipped, models.OrderStatusDelivered},
+		{models.OrderStatusDelivered, models.OrderStatusReturned},
+		{models.OrderStatusPending, models.OrderStatusCancelled},
+		{models.OrderStatusPacked, models.OrderStatusCancelled},
+	}
+	for _, tr := range allowed {
+		assert.True(t, models.CanTransitionOrder(tr[0], tr[1]), "%s → %s should be allowed", tr[0], tr[1])
+	}
+
+	rejected := [][2]string{
+		{models.OrderStatusPending, models.OrderStatusDelivered},
+		{models.OrderStatusDelivered, models.OrderStatusPaid},
+		{models.OrderStatusShipped, models.OrderStatusCancelled},
+		{models.OrderStatusCancelled, models.OrderStatusPaid},
+		{models.OrderStatusReturned, models.OrderStatusDelivered},
+	}
+	for _, tr := range rejected {
+		assert.False(t, models.CanTransitionOrder(tr[0], tr[1]), "%s → %s should be rejected", tr[0], tr[1])
+	}
+
+	assert.ElementsMatch(t,
+		[]string{models.OrderStatusPending, models.OrderStatusPaid, models.OrderStatusPacked},
+		models.OrderStatusesBefore(models.OrderStatusCancelled))
+}
+
+func TestCustomerCancellation(t *testing.T) {
+	for _, status := range models.CustomerCancellableStatuses() {
+		assert.True(t, models.CanCustomerCancel(status), status)
+		assert.True(t, models.CanTransitionOrder(status, models.OrderStatusCancelled), status)
+	}
+	assert.False(t, models.CanCustomerCancel(models.OrderStatusShipped), "too late once shipped")
+	assert.False(t, models.CanCustomerCancel(models.OrderStatusCancelled))
+}
+
+func TestAdminCannotSkipPaymentDeliveryOrReturn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.PUT("/admin/orders/:id/status", controllers.AdminUpdateOrderStatus)
+
+	for _, status := range []string{models.OrderStatusPaid, models.OrderStatusDelivered, models.OrderStatusReturned} {
+		body, _ := json.Marshal(map[string]string{"status": status})
+		req := httptest.NewRequest("PUT", "/admin/orders/"+primitive.NewObjectID().Hex()+"/status", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusConflict, resp.Code, status)
+	}
+}
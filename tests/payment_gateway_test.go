@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/internal/payment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRazorpaySignature(t *testing.T) {
+	g := payment.NewRazorpayGateway("rzp_test_key", "test_secret", "webhook_secret")
+
+	valid := "9c75a526af51e0d9072720c827b95b7d8dc872815a0cb1ab9d2e5047b53b9eb9"
+	assert.True(t, g.VerifySignature("order_IluGWxBm9U8zJ8", "pay_IluH1rVZ0n8bDE", valid))
+	assert.False(t, g.VerifySignature("order_IluGWxBm9U8zJ8", "pay_other", valid))
+	assert.False(t, g.VerifySignature("order_IluGWxBm9U8zJ8", "pay_IluH1rVZ0n8bDE", "not-hex"))
+}
+
+func TestMockGatewayFlow(t *testing.T) {
+	ctx := context.Background()
+	g := payment.NewMockGateway("mock_secret")
+
+	intent, err := g.CreateIntent(ctx, "order-1", 1499.50)
+	assert.NoError(t, err)
+	assert.Equal(t, "mock", intent.Provider)
+	assert.Equal(t, 1499.50, intent.Amount)
+
+	sig := g.Sign(intent.ProviderOrderID, "pay_1")
+	assert.True(t, g.VerifySignature(intent.ProviderOrderID, "pay_1", sig))
+	assert.False(t, g.VerifySignature(intent.ProviderOrderID, "pay_2", sig))
+
+	_, err = g.Refund(ctx, "pay_1", 100)
+	assert.Error(t, err, "refund before capture must fail")
+
+	assert.NoError(t, g.Capture(ctx, "pay_1", 1499.50))
+	assert.ErrorIs(t, g.Capture(ctx, "pay_1", 1499.50), payment.ErrAlreadyCaptured, "double capture must be reported")
+
+	refund, err := g.Refund(ctx, "pay_1", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, refund.Amount)
+
+	_, err = g.Refund(ctx, "pay_1", 500)
+	assert.Error(t, err, "refunds cannot exceed the captured amount")
+}
+
+func TestGatewayFromEnv(t *testing.T) {
+	t.Setenv("PAYMENT_PROVIDER", "mock")
+	assert.Equal(t, "mock", payment.NewGatewayFromEnv().Name())
+
+	t.Setenv("PAYMENT_PROVIDER", "razorpay")
+	t.Setenv("RAZORPAY_KEY_ID", "rzp_test_key")
+	t.Setenv("RAZORPAY_KEY_SECRET", "test_secret")
+	assert.Equal(t, "razorpay", payment.NewGatewayFromEnv().Name())
+}
+
+func TestRazorpayWebhook(t *testing.T) {
+	g := payment.NewRazorpayGateway("rzp_test_key", "test_secret", "webhook_secret")
+	body := []byte(`{"event":"refund.processed","payload":{"refund":{"entity":{"id":"rfnd_1","payment_id":"pay_1","amount":25050}}}}`)
+
+	header := http.Header{}
+	header.Set("X-Razorpay-Event-Id", "evt_1")
+	header.Set("X-Razorpay-Signature", payment.SignHMAC("webhook_secret", string(body)))
+
+	event, err := g.ParseWebhook(body, header)
+	assert.NoError(t, err)
+	assert.Equal(t, "evt_1", event.ID)
+	assert.Equal(t, payment.EventPaymentRefunded, event.Type)
+	assert.Equal(t, "rfnd_1", event.ProviderRefundID)
+	assert.Equal(t, "pay_1", event.ProviderPaymentID)
+	assert.Equal(t, 250.50, event.Amount)
+
+	header.Set("X-Razorpay-Signature", payment.SignHMAC("other_secret", string(body)))
+	_, err = g.ParseWebhook(body, header)
+	assert.ErrorIs(t, err, payment.ErrInvalidSignature)
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/ashishnagargoje0/backend/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGenerateReferralCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := utils.GenerateReferralCode()
+		assert.NoError(t, err)
+		assert.Len(t, code, 8)
+		assert.False(t, strings.ContainsAny(code, "01IO"), "no look-alike characters")
+		assert.Equal(t, strings.ToUpper(code), code)
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 95, "codes are random")
+}
+
+// referee inserts a farmer with the given phone number, verified by OTP
+// or not, and returns it with a cleanup
+func referee(t *testing.T, phone string, verified bool) (primitive.ObjectID, func()) {
+	ctx := context.Background()
+	user := models.User{ID: primitive.NewObjectID(), Phone: phone, IsVerified: verified, Role: "user"}
+	if _, err := config.DB.Collection("users").InsertOne(ctx, user); err != nil {
+		t.Fatalf("❌ Failed to insert test user: %v", err)
+	}
+	return user.ID, func() { config.DB.Collection("users").DeleteOne(ctx, bson.M{"_id": user.ID}) }
+}
+
+// useReferral applies code as userID from the given client address
+func useReferral(userID primitive.ObjectID, code, clientIP string) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.POST("/referral/use", controllers.UseReferralCode)
+
+	// The device the app claims to be is not taken into account
+	body, _ := json.Marshal(map[string]string{"referral_code": code, "device_id": primitive.NewObjectID().Hex()})
+	req := createJSONRequest("POST", "/referral/use", body)
+	req.RemoteAddr = clientIP + ":40000"
+	req.Header.Set("User-Agent", "ShetiSeva/2.1 (Android 13)")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+// testReferralCode inserts a referral code and returns it with a cleanup
+func testReferralCode() (models.ReferralCode, func()) {
+	ctx := context.Background()
+	code := models.ReferralCode{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Code: "T" + strings.ToUpper(primitive.NewObjectID().Hex()[17:]), CreatedAt: time.Now()}
+	config.DB.Collection("referrals").InsertOne(ctx, code)
+	return code, func() {
+		config.DB.Collection("referrals").DeleteOne(ctx, bson.M{"_id": code.ID})
+		config.DB.Collection("referral_uses").DeleteMany(ctx, bson.M{"referral_code": code.Code})
+	}
+}
+
+func TestReferralDeviceIsSeenByServer(t *testing.T) {
+	code, cleanup := testReferralCode()
+	defer cleanup()
+	first, cleanupFirst := referee(t, "9876500001", true)
+	defer cleanupFirst()
+	second, cleanupSecond := referee(t, "9876500002", true)
+	defer cleanupSecond()
+	third, cleanupThird := referee(t, "9876500003", true)
+	defer cleanupThird()
+
+	assert.Equal(t, http.StatusOK, useReferral(first, code.Code, "203.0.113.7"))
+	assert.Equal(t, http.StatusForbidden, useReferral(second, code.Code, "203.0.113.7"))
+	assert.Equal(t, http.StatusOK, useReferral(third, code.Code, "198.51.100.23"))
+}
+
+func TestReferralNeedsOwnVerifiedPhone(t *testing.T) {
+	code, cleanup := testReferralCode()
+	defer cleanup()
+	first, cleanupFirst := referee(t, "9876500011", true)
+	defer cleanupFirst()
+	samePhone, cleanupSame := referee(t, "+91 98765 00011", true)
+	defer cleanupSame()
+	unverified, cleanupUnverified := referee(t, "9876500012", false)
+	defer cleanupUnverified()
+
+	assert.Equal(t, http.StatusOK, useReferral(first, code.Code, "203.0.113.17"))
+	assert.Equal(t, http.StatusForbidden, useReferral(samePhone, code.Code, "198.51.100.17"), "same number, another device")
+	assert.Equal(t, http.StatusForbidden, useReferral(unverified, code.Code, "192.0.2.17"))
+}
+
+// qualifiedReferral inserts a referral held against an order in status,
+// delivered deliveredAgo ago
+func qualifiedReferral(t *testing.T, status string, deliveredAgo time.Duration) (primitive.ObjectID, func()) {
+	ctx := context.Background()
+	delivered := time.Now().Add(-deliveredAgo)
+	order := models.Order{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Status: status, DeliveredAt: &delivered, CreatedAt: time.Now()}
+	use := models.ReferralUse{
+		ID:            primitive.NewObjectID(),
+		UserID:        order.UserID,
+		ReferrerID:    primitive.NewObjectID(),
+		ReferralCode:  "TESTCODE",
+		Status:        models.ReferralQualified,
+		ReferrerCoins: 50,
+		RefereeCoins:  25,
+		OrderID:       &order.ID,
+		UsedAt:        time.Now(),
+	}
+	if _, err := config.DB.Collection("orders").InsertOne(ctx, order); err != nil {
+		t.Fatalf("❌ Failed to insert test order: %v", err)
+	}
+	config.DB.Collection("referral_uses").InsertOne(ctx, use)
+	return use.ID, func() {
+		config.DB.Collection("orders").DeleteOne(ctx, bson.M{"_id": order.ID})
+		config.DB.Collection("referral_uses").DeleteOne(ctx, bson.M{"_id": use.ID})
+		config.DB.Collection("coin_earnings").DeleteMany(ctx, bson.M{"subject": use.ID.Hex()})
+	}
+}
+
+func referralStatusAfterJob(t *testing.T, useID primitive.ObjectID) string {
+	jobs, stop := context.WithTimeout(context.Background(), 2*time.Second)
+	defer stop()
+	controllers.RunReferralRewardJob(jobs, time.Hour)
+
+	var use models.ReferralUse
+	if err := config.DB.Collection("referral_uses").FindOne(context.Background(), bson.M{"_id": useID}).Decode(&use); err != nil {
+		t.Fatalf("❌ Failed to read referral: %v", err)
+	}
+	return use.Status
+}
+
+func TestReferralRewardWaitsForReturnWindow(t *testing.T) {
+	controllers.InitReturnRefundCollections()
+
+	recent, cleanupRecent := qualifiedReferral(t, models.OrderStatusDelivered, 24*time.Hour)
+	defer cleanupRecent()
+	kept, cleanupKept := qualifiedReferral(t, models.OrderStatusDelivered, models.DefaultReturnWindow+24*time.Hour)
+	defer cleanupKept()
+	cancelled, cleanupCancelled := qualifiedReferral(t, models.OrderStatusCancelled, 0)
+	defer cleanupCancelled()
+
+	assert.Equal(t, models.ReferralQualified, referralStatusAfterJob(t, recent), "still returnable")
+	assert.Equal(t, models.ReferralRewarded, referralStatusAfterJob(t, kept))
+	assert.Equal(t, models.ReferralRejected, referralStatusAfterJob(t, cancelled))
+}
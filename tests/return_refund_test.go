@@ -0,0 +1,480 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/internal/payment"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReturnWindowOpen(t *testing.T) {
+	now := time.Now()
+	delivered := now.Add(-6 * 24 * time.Hour)
+	assert.True(t, models.ReturnWindowOpen(&delivered, models.DefaultReturnWindow, now))
+
+	delivered = now.Add(-8 * 24 * time.Hour)
+	assert.False(t, models.ReturnWindowOpen(&delivered, models.DefaultReturnWindow, now))
+	assert.False(t, models.ReturnWindowOpen(nil, models.DefaultReturnWindow, now), "not delivered yet")
+}
+
+func TestReturnAmount(t *testing.T) {
+	sprayer := primitive.NewObjectID()
+	order := models.Order{
+		Items: []models.OrderItem{
+			{ProductID: sprayer, Name: "Knapsack sprayer", UnitPrice: 2000, Quantity: 1},
+			{ProductID: primitive.NewObjectID(), Name: "Neem oil 1L", UnitPrice: 500, Quantity: 4},
+		},
+		Discount: 400,
+	}
+	order.CalculateTotals("Maharashtra")
+
+	assert.Equal(t, 3600.0, models.ReturnAmount(order, nil), "whole order")
+	assert.Equal(t, 1800.0, models.ReturnAmount(order, []models.ReturnItem{{ProductID: sprayer, Quantity: 1}}),
+		"half the order value, less half the discount")
+}
+
+func TestReturnLifecycle(t *testing.T) {
+	assert.ElementsMatch(t, []string{models.ReturnStatusPending}, models.ReturnStatusesBefore(models.ReturnStatusApproved))
+	assert.ElementsMatch(t, []string{models.ReturnStatusApproved, models.ReturnStatusPickupScheduled},
+		models.ReturnStatusesBefore(models.ReturnStatusPickupScheduled), "pickups can be rescheduled")
+	assert.ElementsMatch(t, []string{models.ReturnStatusPickedUp}, models.ReturnStatusesBefore(models.ReturnStatusQCPassed))
+	assert.Empty(t, models.ReturnStatusesBefore(models.ReturnStatusPending))
+}
+
+func setupRefundRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controllers.InitEMICollections()
+
+	r := gin.Default()
+	r.POST("/admin/refund/initiate", controllers.InitiateRefund)
+	return r
+}
+
+// paidOrder inserts a paid order of total and returns it with a cleanup
+func paidOrder(t *testing.T, total float64, paymentID *primitive.ObjectID) (models.Order, func()) {
+	ctx := context.Background()
+	order := models.Order{
+		ID:          primitive.NewObjectID(),
+		UserID:      primitive.NewObjectID(),
+		TotalAmount: total,
+		Status:      models.OrderStatusPaid,
+		PaymentID:   paymentID,
+		CreatedAt:   time.Now(),
+	}
+	if _, err := config.DB.Collection("orders").InsertOne(ctx, order); err != nil {
+		t.Fatalf("❌ Failed to insert test order: %v", err)
+	}
+	return order, func() {
+		config.DB.Collection("orders").DeleteOne(ctx, bson.M{"_id": order.ID})
+		config.DB.Collection("refunds").DeleteMany(ctx, bson.M{"order_id": order.ID})
+		config.DB.Collection("wallets").DeleteOne(ctx, bson.M{"_id": order.UserID})
+	}
+}
+
+func refundToWallet(r *gin.Engine, orderID primitive.ObjectID, amount float64) int {
+	body, _ := json.Marshal(map[string]interface{}{
+		"order_id": orderID.Hex(),
+		"reason":   "Damaged in transit",
+		"amount":   amount,
+		"method":   models.RefundToWallet,
+	})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/admin/refund/initiate", body))
+	return resp.Code
+}
+
+func TestRefundCappedAtEMICollected(t *testing.T) {
+	r := setupRefundRouter()
+	order, cleanup := paidOrder(t, 1000, nil)
+	defer cleanup()
+
+	ctx := context.Background()
+	plan := models.EMIPlan{
+		ID:          primitive.NewObjectID(),
+		OrderID:     order.ID,
+		UserID:      order.UserID,
+		DownPayment: 200,
+		AmountPaid:  100,
+		Status:      models.EMIPlanActive,
+	}
+	config.DB.Collection("emi_plans").InsertOne(ctx, plan)
+	defer config.DB.Collection("emi_plans").DeleteOne(ctx, bson.M{"_id": plan.ID})
+
+	// Only ₹300 of the ₹1000 order has been paid so far
+	assert.Equal(t, http.StatusBadRequest, refundToWallet(r, order.ID, 500))
+	assert.Equal(t, http.StatusOK, refundToWallet(r, order.ID, 250))
+	assert.Equal(t, http.StatusBadRequest, refundToWallet(r, order.ID, 100), "₹50 left, not cut down to it")
+	assert.Equal(t, http.StatusOK, refundToWallet(r, order.ID, 50))
+	assert.Equal(t, http.StatusConflict, refundToWallet(r, order.ID, 1))
+
+	var saved models.Order
+	assert.NoError(t, config.DB.Collection("orders").FindOne(ctx, bson.M{"_id": order.ID}).Decode(&saved))
+	assert.Equal(t, 300.0, saved.RefundedTotal)
+}
+
+func TestUnpaidOrderIsNotRefunded(t *testing.T) {
+	r := setupRefundRouter()
+	order, cleanup := paidOrder(t, 1000, nil)
+	defer cleanup()
+
+	assert.Equal(t, http.StatusConflict, refundToWallet(r, order.ID, 100))
+}
+
+func TestParallelRefundsStayWithinPayment(t *testing.T) {
+	r := setupRefundRouter()
+	ctx := context.Background()
+	pay := models.Payment{
+		ID:        primitive.NewObjectID(),
+		Provider:  models.WalletProvider,
+		Amount:    1000,
+		Status:    models.PaymentStatusCaptured,
+		CreatedAt: time.Now(),
+	}
+	order, cleanup := paidOrder(t, 1000, &pay.ID)
+	defer cleanup()
+	pay.OrderID, pay.UserID = order.ID, order.UserID
+	config.DB.Collection("payments").InsertOne(ctx, pay)
+	defer config.DB.Collection("payments").DeleteOne(ctx, bson.M{"_id": pay.ID})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- refundToWallet(r, order.ID, 200)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	refunded := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			refunded++
+		}
+	}
+	assert.Equal(t, 5, refunded)
+
+	count, _ := config.DB.Collection("refunds").CountDocuments(ctx, bson.M{"order_id": order.ID})
+	assert.EqualValues(t, 5, count)
+}
+
+// gatewayPayment records a checkout attempt on the order through gateway g
+func gatewayPayment(t *testing.T, g *payment.MockGateway, order models.Order, amount float64) models.Payment {
+	pay := models.Payment{
+		ID:              primitive.NewObjectID(),
+		OrderID:         order.ID,
+		UserID:          order.UserID,
+		Method:          "UPI",
+		Provider:        g.Name(),
+		ProviderOrderID: "mock_order_" + primitive.NewObjectID().Hex(),
+		Amount:          amount,
+		Currency:        "INR",
+		Status:          models.PaymentStatusCreated,
+		CreatedAt:       time.Now(),
+	}
+	if _, err := config.DB.Collection("payments").InsertOne(context.Background(), pay); err != nil {
+		t.Fatalf("❌ Failed to insert test payment: %v", err)
+	}
+	return pay
+}
+
+// verifyPayment completes the checkout of pay as its farmer would
+func verifyPayment(g *payment.MockGateway, pay models.Payment, providerPaymentID string) int {
+	return postVerify(pay, map[string]string{
+		"orderId":           pay.OrderID.Hex(),
+		"paymentId":         pay.ID.Hex(),
+		"providerPaymentId": providerPaymentID,
+		"signature":         g.Sign(pay.ProviderOrderID, providerPaymentID),
+	})
+}
+
+// reportFailure says, as the app would, that the checkout of pay failed
+func reportFailure(pay models.Payment) int {
+	return postVerify(pay, map[string]string{
+		"orderId":   pay.OrderID.Hex(),
+		"paymentId": pay.ID.Hex(),
+		"status":    "failed",
+	})
+}
+
+func postVerify(pay models.Payment, input map[string]string) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", pay.UserID) })
+	r.POST("/orders/payment/verify", controllers.VerifyPayment)
+
+	body, _ := json.Marshal(input)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/orders/payment/verify", body))
+	return resp.Code
+}
+
+// pendingOrder inserts an order of total awaiting payment, with a cleanup
+func pendingOrder(t *testing.T, total float64) (models.Order, func()) {
+	ctx := context.Background()
+	order := models.Order{
+		ID:          primitive.NewObjectID(),
+		UserID:      primitive.NewObjectID(),
+		TotalAmount: total,
+		Status:      models.OrderStatusPending,
+		CreatedAt:   time.Now(),
+	}
+	if _, err := config.DB.Collection("orders").InsertOne(ctx, order); err != nil {
+		t.Fatalf("❌ Failed to insert test order: %v", err)
+	}
+	return order, func() {
+		config.DB.Collection("orders").DeleteOne(ctx, bson.M{"_id": order.ID})
+		config.DB.Collection("payments").DeleteMany(ctx, bson.M{"order_id": order.ID})
+		config.DB.Collection("refunds").DeleteMany(ctx, bson.M{"order_id": order.ID})
+	}
+}
+
+func orderStatus(t *testing.T, orderID primitive.ObjectID) string {
+	var order models.Order
+	assert.NoError(t, config.DB.Collection("orders").FindOne(context.Background(), bson.M{"_id": orderID}).Decode(&order))
+	return order.Status
+}
+
+func TestSecondCaptureIsRefunded(t *testing.T) {
+	ctx := context.Background()
+	g := payment.NewMockGateway("mock_secret")
+	controllers.SetPaymentGateway(g)
+
+	first := primitive.NewObjectID()
+	order, cleanup := paidOrder(t, 500, &first)
+	defer cleanup()
+	defer config.DB.Collection("payments").DeleteMany(ctx, bson.M{"order_id": order.ID})
+
+	// The farmer paid again from a second checkout of the same order
+	second := gatewayPayment(t, g, order, 500)
+	assert.Equal(t, http.StatusConflict, verifyPayment(g, second, "pay_second"))
+
+	var refund models.Refund
+	assert.NoError(t, config.DB.Collection("refunds").FindOne(ctx, bson.M{"payment_id": second.ID}).Decode(&refund))
+	assert.True(t, refund.Unapplied)
+	assert.Equal(t, 500.0, refund.Amount)
+}
+
+func TestReportedFailureIsCheckedWithGateway(t *testing.T) {
+	g := payment.NewMockGateway("mock_secret")
+	controllers.SetPaymentGateway(g)
+	order, cleanup := pendingOrder(t, 500)
+	defer cleanup()
+
+	// The app says the checkout failed, but a retry inside it took the money
+	pay := gatewayPayment(t, g, order, 500)
+	g.Pay(pay.ProviderOrderID, "pay_declined", 500, payment.PaymentFailed)
+	g.Pay(pay.ProviderOrderID, "pay_retried", 500, payment.PaymentAuthorized)
+
+	assert.Equal(t, http.StatusOK, reportFailure(pay))
+	assert.Equal(t, models.OrderStatusPaid, orderStatus(t, order.ID))
+
+	// Nothing taken: the attempt fails and the order waits for another
+	other, cleanupOther := pendingOrder(t, 500)
+	defer cleanupOther()
+	assert.Equal(t, http.StatusBadRequest, reportFailure(gatewayPayment(t, g, other, 500)))
+	assert.Equal(t, models.OrderStatusPending, orderStatus(t, other.ID))
+}
+
+func TestCaptureAfterFailedTryIsSettled(t *testing.T) {
+	ctx := context.Background()
+	g := payment.NewMockGateway("mock_secret")
+	controllers.SetPaymentGateway(g)
+
+	order, cleanup := pendingOrder(t, 500)
+	defer cleanup()
+	pay := gatewayPayment(t, g, order, 500)
+	assert.Equal(t, http.StatusBadRequest, reportFailure(pay))
+
+	// A later try on the same checkout still pays for the order
+	assert.Equal(t, http.StatusOK, verifyPayment(g, pay, "pay_later"))
+	assert.Equal(t, models.OrderStatusPaid, orderStatus(t, order.ID))
+
+	// One that arrives after the order expired is sent back
+	expired, cleanupExpired := pendingOrder(t, 500)
+	defer cleanupExpired()
+	late := gatewayPayment(t, g, expired, 500)
+	assert.Equal(t, http.StatusBadRequest, reportFailure(late))
+	config.DB.Collection("orders").UpdateOne(ctx, bson.M{"_id": expired.ID},
+		bson.M{"$set": bson.M{"status": models.OrderStatusCancelled}})
+
+	assert.Equal(t, http.StatusConflict, verifyPayment(g, late, "pay_late"))
+	var refund models.Refund
+	assert.NoError(t, config.DB.Collection("refunds").FindOne(ctx, bson.M{"payment_id": late.ID}).Decode(&refund))
+	assert.Equal(t, 500.0, refund.Amount)
+}
+
+func TestUnappliedSubscriptionPaymentIsRefunded(t *testing.T) {
+	ctx := context.Background()
+	g := payment.NewMockGateway("mock_secret")
+	controllers.SetPaymentGateway(g)
+
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name          string
+		subscription  string
+		invoice       string
+		invoicePaidBy *primitive.ObjectID
+	}{
+		{"invoice voided", models.SubscriptionPastDue, models.SubscriptionInvoiceVoid, nil},
+		{"invoice paid from the wallet", models.SubscriptionActive, models.SubscriptionInvoicePaid, ptrID(primitive.NewObjectID())},
+		{"subscription cancelled", models.SubscriptionCancelled, models.SubscriptionInvoiceOpen, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			sub := models.Subscription{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Status: tc.subscription, CreatedAt: now}
+			inv := models.SubscriptionInvoice{
+				ID:             primitive.NewObjectID(),
+				SubscriptionID: sub.ID,
+				UserID:         sub.UserID,
+				Kind:           models.SubscriptionInvoiceRenewal,
+				Amount:         299,
+				PeriodStart:    now,
+				PeriodEnd:      now.AddDate(0, 1, 0),
+				Status:         tc.invoice,
+				PaymentID:      tc.invoicePaidBy,
+				CreatedAt:      now,
+			}
+			pay := models.Payment{
+				ID:                    primitive.NewObjectID(),
+				SubscriptionInvoiceID: &inv.ID,
+				UserID:                sub.UserID,
+				Method:                "UPI",
+				Provider:              g.Name(),
+				ProviderOrderID:       "mock_order_" + primitive.NewObjectID().Hex(),
+				Amount:                299,
+				Currency:              "INR",
+				Status:                models.PaymentStatusCreated,
+				CreatedAt:             now,
+			}
+			config.DB.Collection("subscriptions").InsertOne(ctx, sub)
+			config.DB.Collection("subscription_invoices").InsertOne(ctx, inv)
+			config.DB.Collection("payments").InsertOne(ctx, pay)
+			defer func() {
+				config.DB.Collection("subscriptions").DeleteOne(ctx, bson.M{"_id": sub.ID})
+				config.DB.Collection("subscription_invoices").DeleteOne(ctx, bson.M{"_id": inv.ID})
+				config.DB.Collection("payments").DeleteOne(ctx, bson.M{"_id": pay.ID})
+				config.DB.Collection("refunds").DeleteMany(ctx, bson.M{"payment_id": pay.ID})
+			}()
+
+			r := gin.Default()
+			r.Use(func(c *gin.Context) { c.Set("user_id", sub.UserID) })
+			r.POST("/subscription/invoices/:id/verify", controllers.VerifySubscriptionPayment)
+			body, _ := json.Marshal(map[string]string{
+				"payment_id":          pay.ID.Hex(),
+				"provider_payment_id": "pay_sub",
+				"signature":           g.Sign(pay.ProviderOrderID, "pay_sub"),
+			})
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, createJSONRequest("POST", "/subscription/invoices/"+inv.ID.Hex()+"/verify", body))
+			assert.Equal(t, http.StatusConflict, resp.Code)
+
+			var refund models.Refund
+			assert.NoError(t, config.DB.Collection("refunds").FindOne(ctx, bson.M{"payment_id": pay.ID}).Decode(&refund))
+			assert.Equal(t, 299.0, refund.Amount)
+			assert.True(t, refund.Unapplied)
+		})
+	}
+}
+
+func ptrID(id primitive.ObjectID) *primitive.ObjectID { return &id }
+
+func TestUnissuedRefundGoesBackToPending(t *testing.T) {
+	ctx := context.Background()
+	controllers.InitReturnRefundCollections()
+	order, cleanup := paidOrder(t, 500, nil) // nothing captured to refund to
+	defer cleanup()
+
+	req := models.RefundRequest{
+		ID:        primitive.NewObjectID(),
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		Amount:    200,
+		Reason:    "Missing item",
+		Method:    models.RefundToOriginal,
+		Status:    models.RefundRequestPending,
+		History:   []models.RMAEvent{},
+		CreatedAt: time.Now(),
+	}
+	config.DB.Collection("refund_requests").InsertOne(ctx, req)
+	defer config.DB.Collection("refund_requests").DeleteOne(ctx, bson.M{"_id": req.ID})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/admin/refund-requests/:id/approve", controllers.AdminApproveRefundRequest)
+	approve := func(body string) int {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, createJSONRequest("POST", "/admin/refund-requests/"+req.ID.Hex()+"/approve", []byte(body)))
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusConflict, approve(""))
+	var stored models.RefundRequest
+	assert.NoError(t, config.DB.Collection("refund_requests").FindOne(ctx, bson.M{"_id": req.ID}).Decode(&stored))
+	assert.Equal(t, models.RefundRequestPending, stored.Status, "the request can be approved again")
+
+	assert.Equal(t, http.StatusOK, approve(`{"method":"wallet"}`))
+}
+
+func TestReturnPassingQualityCheckIsRestocked(t *testing.T) {
+	ctx := context.Background()
+	controllers.InitInventoryCollections()
+	controllers.InitReturnRefundCollections()
+	productID, cleanupProduct := stockedProduct(t, 3)
+	defer cleanupProduct()
+
+	order, cleanup := paidOrder(t, 200, nil)
+	defer cleanup()
+	var row models.InventoryItem
+	config.DB.Collection("inventory").FindOne(ctx, bson.M{"product_id": productID}).Decode(&row)
+	config.DB.Collection("stock_reservations").InsertOne(ctx, models.StockReservation{
+		ID:          primitive.NewObjectID(),
+		OrderID:     order.ID,
+		ProductID:   productID,
+		WarehouseID: row.WarehouseID,
+		Quantity:    2,
+		Status:      "dispatched",
+	})
+
+	ret := models.ReturnRequest{
+		ID:           primitive.NewObjectID(),
+		OrderID:      order.ID,
+		UserID:       order.UserID,
+		Reason:       "Damaged",
+		RefundMethod: models.RefundToWallet,
+		RefundAmount: 200,
+		Status:       models.ReturnStatusPickedUp,
+		History:      []models.RMAEvent{},
+		CreatedAt:    time.Now(),
+	}
+	config.DB.Collection("return_requests").InsertOne(ctx, ret)
+	defer func() {
+		config.DB.Collection("return_requests").DeleteOne(ctx, bson.M{"_id": ret.ID})
+		config.DB.Collection("refund_requests").DeleteMany(ctx, bson.M{"order_id": order.ID})
+	}()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/admin/returns/:id/quality-check", controllers.AdminReturnQualityCheck)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/admin/returns/"+ret.ID.Hex()+"/quality-check", []byte(`{"passed":true}`)))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	config.DB.Collection("inventory").FindOne(ctx, bson.M{"product_id": productID}).Decode(&row)
+	assert.Equal(t, 5, row.OnHand)
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// reviewCoins submits a review of productID as userID and returns the coins it earned
+func reviewCoins(t *testing.T, userID, productID primitive.ObjectID) int {
+	gin.SetMode(gin.TestMode)
+	controllers.InitReviewCollection()
+	controllers.InitOrderCollection()
+
+	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.POST("/review/submit", controllers.SubmitReview)
+
+	body, _ := json.Marshal(map[string]interface{}{"productId": productID.Hex(), "rating": 4})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/review/submit", body))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var out struct {
+		Coins int `json:"coins_earned"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &out)
+	return out.Coins
+}
+
+func TestReviewCoinsNeedDeliveredPurchase(t *testing.T) {
+	ctx := context.Background()
+	farmer, productID := primitive.NewObjectID(), primitive.NewObjectID()
+	defer config.DB.Collection("reviews").DeleteMany(ctx, bson.M{"userId": farmer})
+	defer config.DB.Collection("coin_earnings").DeleteMany(ctx, bson.M{"user_id": farmer})
+
+	assert.Zero(t, reviewCoins(t, farmer, productID), "never bought")
+
+	order := models.Order{
+		ID:        primitive.NewObjectID(),
+		UserID:    farmer,
+		Items:     []models.OrderItem{{ProductID: productID, Quantity: 1, UnitPrice: 100}},
+		Status:    models.OrderStatusShipped,
+		CreatedAt: time.Now(),
+	}
+	config.DB.Collection("orders").InsertOne(ctx, order)
+	defer config.DB.Collection("orders").DeleteOne(ctx, bson.M{"_id": order.ID})
+	assert.Zero(t, reviewCoins(t, farmer, productID), "not delivered yet")
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/ashishnagargoje0/backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewardStock(t *testing.T) {
+	none, some := 0, 3
+	assert.True(t, models.Reward{}.InStock(), "no stock limit")
+	assert.True(t, models.Reward{Stock: &some}.InStock())
+	assert.False(t, models.Reward{Stock: &none}.InStock())
+}
+
+func TestRewardIsDigital(t *testing.T) {
+	assert.True(t, models.Reward{Type: models.RewardDigital}.IsDigital())
+	assert.False(t, models.Reward{Type: models.RewardPhysical}.IsDigital())
+	assert.False(t, models.Reward{}.IsDigital(), "legacy rewards are physical")
+}
+
+func TestRedemptionStatusesBefore(t *testing.T) {
+	assert.ElementsMatch(t, []string{models.RedemptionRequested}, models.RedemptionStatusesBefore(models.RedemptionDispatched))
+	assert.ElementsMatch(t, []string{models.RedemptionRequested}, models.RedemptionStatusesBefore(models.RedemptionVoucherIssued))
+	assert.ElementsMatch(t, []string{models.RedemptionDispatched}, models.RedemptionStatusesBefore(models.RedemptionDelivered))
+	assert.ElementsMatch(t, []string{models.RedemptionRequested, models.RedemptionDispatched},
+		models.RedemptionStatusesBefore(models.RedemptionFailed))
+	assert.Empty(t, models.RedemptionStatusesBefore(models.RedemptionRequested))
+}
+
+func TestGenerateVoucherCode(t *testing.T) {
+	format := regexp.MustCompile(`^[A-Z2-9]{4}-[A-Z2-9]{4}-[A-Z2-9]{4}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := utils.GenerateVoucherCode()
+		assert.NoError(t, err)
+		assert.Regexp(t, format, code)
+		seen[code] = true
+	}
+	assert.Len(t, seen, 100, "codes are random")
+}
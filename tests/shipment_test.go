@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/controllers"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShipmentTransitions(t *testing.T) {
+	assert.True(t, models.CanTransitionShipment(models.ShipmentAssigned, models.ShipmentPickedUp))
+	assert.True(t, models.CanTransitionShipment(models.ShipmentOutForDelivery, models.ShipmentDelivered))
+	assert.True(t, models.CanTransitionShipment(models.ShipmentFailed, models.ShipmentOutForDelivery), "failed attempts can go out again")
+
+	assert.False(t, models.CanTransitionShipment(models.ShipmentAssigned, models.ShipmentDelivered))
+	assert.False(t, models.CanTransitionShipment(models.ShipmentDelivered, models.ShipmentFailed))
+
+	assert.ElementsMatch(t, []string{models.ShipmentInTransit, models.ShipmentFailed, models.ShipmentPickedUp},
+		models.ShipmentStatusesBefore(models.ShipmentOutForDelivery))
+	assert.Empty(t, models.ShipmentStatusesBefore(models.ShipmentAssigned))
+}
+
+func TestEstimateETA(t *testing.T) {
+	pune := models.GeoPoint{Lat: 18.5204, Lng: 73.8567}
+	baramati := models.GeoPoint{Lat: 18.1514, Lng: 74.5815}
+
+	dist := pune.DistanceKm(baramati)
+	assert.InDelta(t, 86, dist, 2)
+
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	eta := models.EstimateETA(pune, baramati, now)
+	assert.InDelta(t, dist/25*60, eta.Sub(now).Minutes(), 1)
+}
+
+// setupAgentRouter serves the delivery agent's shipment routes as agentID
+func setupAgentRouter(agentID primitive.ObjectID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controllers.InitShipmentCollections()
+
+	r := gin.Default()
+	r.Use(func(c *gin.Context) { c.Set("user_id", agentID) })
+	r.POST("/agent/shipments/:id/status", controllers.UpdateShipmentStatus)
+	r.POST("/agent/shipments/:id/deliver", controllers.CompleteDelivery)
+	return r
+}
+
+// outForDelivery inserts a shipment that agentID is out delivering
+func outForDelivery(t *testing.T, agentID primitive.ObjectID, otp string) (primitive.ObjectID, func()) {
+	ctx := context.Background()
+	shipment := models.Shipment{
+		ID:          primitive.NewObjectID(),
+		OrderID:     primitive.NewObjectID(),
+		AgentID:     agentID,
+		Status:      models.ShipmentOutForDelivery,
+		DeliveryOTP: otp,
+		Events:      []models.ShipmentEvent{},
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if _, err := config.DB.Collection("shipments").InsertOne(ctx, shipment); err != nil {
+		t.Fatalf("❌ Failed to insert test shipment: %v", err)
+	}
+	return shipment.ID, func() {
+		config.DB.Collection("shipments").DeleteOne(ctx, bson.M{"_id": shipment.ID})
+	}
+}
+
+func deliverWithOTP(r *gin.Engine, shipmentID primitive.ObjectID, otp string) int {
+	form := url.Values{"otp": {otp}}
+	req := httptest.NewRequest("POST", "/agent/shipments/"+shipmentID.Hex()+"/deliver", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+func loadShipment(t *testing.T, shipmentID primitive.ObjectID) models.Shipment {
+	var shipment models.Shipment
+	if err := config.DB.Collection("shipments").FindOne(context.Background(), bson.M{"_id": shipmentID}).Decode(&shipment); err != nil {
+		t.Fatalf("❌ Failed to read shipment: %v", err)
+	}
+	return shipment
+}
+
+func TestDeliveryOTPIsSixDigits(t *testing.T) {
+	agentID := primitive.NewObjectID()
+	r := setupAgentRouter(agentID)
+	shipmentID, cleanup := outForDelivery(t, agentID, "")
+	defer cleanup()
+	config.DB.Collection("shipments").UpdateOne(context.Background(), bson.M{"_id": shipmentID},
+		bson.M{"$set": bson.M{"status": models.ShipmentFailed}})
+
+	body, _ := json.Marshal(map[string]string{"status": models.ShipmentOutForDelivery})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, createJSONRequest("POST", "/agent/shipments/"+shipmentID.Hex()+"/status", body))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	assert.Regexp(t, `^[0-9]{6}$`, loadShipment(t, shipmentID).DeliveryOTP)
+}
+
+func TestParallelOTPGuessesStopAtLimit(t *testing.T) {
+	agentID := primitive.NewObjectID()
+	r := setupAgentRouter(agentID)
+	shipmentID, cleanup := outForDelivery(t, agentID, "482913")
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- deliverWithOTP(r, shipmentID, "000000")
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	wrong := 0
+	for code := range codes {
+		if code == http.StatusUnauthorized {
+			wrong++
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, code)
+		}
+	}
+	assert.Equal(t, 5, wrong, "only five guesses are checked per attempt")
+	assert.Equal(t, 5, loadShipment(t, shipmentID).OTPAttempts)
+
+	// Out of tries, even the right OTP waits for a fresh attempt
+	assert.Equal(t, http.StatusTooManyRequests, deliverWithOTP(r, shipmentID, "482913"))
+}
+
+func TestOTPTriesSurviveNewAttempt(t *testing.T) {
+	agentID := primitive.NewObjectID()
+	r := setupAgentRouter(agentID)
+	shipmentID, cleanup := outForDelivery(t, agentID, "")
+	defer cleanup()
+
+	// Three delivery attempts of five wrong guesses each
+	for attempt := 0; attempt < 3; attempt++ {
+		for _, status := range []string{models.ShipmentFailed, models.ShipmentOutForDelivery} {
+			body, _ := json.Marshal(map[string]string{"status": status})
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, createJSONRequest("POST", "/agent/shipments/"+shipmentID.Hex()+"/status", body))
+			assert.Equal(t, http.StatusOK, resp.Code)
+		}
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusUnauthorized, deliverWithOTP(r, shipmentID, "bad"))
+		}
+	}
+
+	// A fresh attempt resets its own count but not the shipment's
+	for _, status := range []string{models.ShipmentFailed, models.ShipmentOutForDelivery} {
+		body, _ := json.Marshal(map[string]string{"status": status})
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, createJSONRequest("POST", "/agent/shipments/"+shipmentID.Hex()+"/status", body))
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+	shipment := loadShipment(t, shipmentID)
+	assert.Equal(t, 0, shipment.OTPAttempts)
+	assert.Equal(t, 15, shipment.OTPTries)
+	assert.Equal(t, http.StatusTooManyRequests, deliverWithOTP(r, shipmentID, shipment.DeliveryOTP))
+}
+
+func TestRightOTPDelivers(t *testing.T) {
+	agentID := primitive.NewObjectID()
+	r := setupAgentRouter(agentID)
+	shipmentID, cleanup := outForDelivery(t, agentID, "482913")
+	defer cleanup()
+
+	assert.Equal(t, http.StatusUnauthorized, deliverWithOTP(r, shipmentID, "482914"))
+	assert.Equal(t, http.StatusOK, deliverWithOTP(r, shipmentID, "482913"))
+
+	shipment := loadShipment(t, shipmentID)
+	assert.Equal(t, models.ShipmentDelivered, shipment.Status)
+	assert.Empty(t, shipment.DeliveryOTP)
+	// Nor can another agent, whatever the OTP
+	assert.Equal(t, http.StatusNotFound, deliverWithOTP(setupAgentRouter(primitive.NewObjectID()), shipmentID, "482913"))
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodEnd(t *testing.T) {
+	start := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC), models.PeriodEnd(start, models.IntervalMonthly))
+	assert.Equal(t, time.Date(2025, 4, 15, 0, 0, 0, 0, time.UTC), models.PeriodEnd(start, models.IntervalQuarterly))
+	assert.Equal(t, time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), models.PeriodEnd(start, models.IntervalYearly))
+	assert.Equal(t, models.PeriodEnd(start, models.IntervalMonthly), models.PeriodEnd(start, ""), "monthly by default")
+}
+
+func TestPlanGracePeriod(t *testing.T) {
+	assert.Equal(t, 3*24*time.Hour, models.SubscriptionPlan{GraceDays: 3}.GracePeriod())
+	assert.Equal(t, models.DefaultGraceDays*24*time.Hour, models.SubscriptionPlan{}.GracePeriod())
+}
+
+func TestProrateSwitch(t *testing.T) {
+	start := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	end := models.PeriodEnd(start, models.IntervalMonthly) // 30 days
+	half := start.Add(15 * 24 * time.Hour)
+
+	// Upgrading halfway through pays half the difference
+	assert.InDelta(t, 150, models.ProrateSwitch(300, models.IntervalMonthly, 600, models.IntervalMonthly, start, end, half), 0.01)
+	// Downgrading comes out negative
+	assert.InDelta(t, -150, models.ProrateSwitch(600, models.IntervalMonthly, 300, models.IntervalMonthly, start, end, half), 0.01)
+	// Nothing is owed once the period is over
+	assert.Zero(t, models.ProrateSwitch(300, models.IntervalMonthly, 600, models.IntervalMonthly, start, end, end))
+	// A switch before the period starts costs the whole difference
+	assert.InDelta(t, 300, models.ProrateSwitch(300, models.IntervalMonthly, 600, models.IntervalMonthly, start, end, start.Add(-time.Hour)), 0.01)
+
+	// A yearly plan is charged at its daily rate
+	yearly := models.ProrateSwitch(300, models.IntervalMonthly, 3650, models.IntervalYearly, start, end, half)
+	assert.InDelta(t, 3650.0/365*15-150, yearly, 0.01)
+}
+
+func TestProrationInvoiceLapses(t *testing.T) {
+	end := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	proration := models.SubscriptionInvoice{Kind: models.SubscriptionInvoiceProration, PeriodEnd: end}
+	assert.False(t, proration.Lapsed(end.Add(-time.Hour)))
+	assert.True(t, proration.Lapsed(end))
+
+	// A renewal stays payable through the grace period
+	renewal := models.SubscriptionInvoice{Kind: models.SubscriptionInvoiceRenewal, PeriodEnd: end}
+	assert.False(t, renewal.Lapsed(end.Add(time.Hour)))
+}
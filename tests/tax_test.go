@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsInterState(t *testing.T) {
+	assert.False(t, models.IsInterState("Maharashtra", "maharashtra "))
+	assert.False(t, models.IsInterState("27", "MH"), "states are compared by GST code")
+	assert.False(t, models.IsInterState("Maharashtra", "27"))
+	assert.False(t, models.IsInterState("27", ""), "unknown buyer state is taxed as local")
+	assert.False(t, models.IsInterState("27", "Atlantis"))
+	assert.True(t, models.IsInterState("27", "Gujarat"))
+	assert.True(t, models.IsInterState("MH", "KA"))
+}
+
+func TestGSTStateCode(t *testing.T) {
+	assert.Equal(t, "27", models.GSTStateCode("Maharashtra"))
+	assert.Equal(t, "27", models.GSTStateCode(" mh "))
+	assert.Equal(t, "09", models.GSTStateCode("9"))
+	assert.Equal(t, "01", models.GSTStateCode("Jammu & Kashmir"))
+	assert.Equal(t, "21", models.GSTStateCode("Orissa"))
+	assert.Equal(t, "", models.GSTStateCode("Atlantis"))
+	assert.Equal(t, "Tamil Nadu", models.GSTStateName("33"))
+}
+
+func TestComputeTaxBySlab(t *testing.T) {
+	lines := []models.TaxLine{
+		{Rate: 5, Amount: 1050},   // fertilizer
+		{Rate: 0, Amount: 400},    // seeds are exempt
+		{Rate: 12, Amount: 11200}, // drip kit
+		{Rate: 5, Amount: 525},
+	}
+
+	perLine, local := models.ComputeTax(lines, 0, false)
+	assert.Equal(t, 1000.0, perLine[0].TaxableValue)
+	assert.Equal(t, 25.0, perLine[0].CGST)
+	assert.Equal(t, 25.0, perLine[0].SGST)
+	assert.Equal(t, 400.0, perLine[1].TaxableValue)
+	assert.Equal(t, 0.0, perLine[1].CGST)
+
+	assert.Len(t, local.Slabs, 3)
+	assert.Equal(t, models.TaxSlab{Rate: 5, TaxableValue: 1500, CGST: 37.5, SGST: 37.5}, local.Slabs[1])
+	assert.Equal(t, 10000.0, local.Slabs[2].TaxableValue)
+	assert.Equal(t, 1275.0, local.TotalTax)
+	assert.Equal(t, 11900.0, local.TaxableValue)
+
+	_, inter := models.ComputeTax(lines, 0, true)
+	assert.True(t, inter.InterState)
+	assert.Equal(t, 0.0, inter.CGST)
+	assert.Equal(t, 1275.0, inter.IGST)
+}
+
+func TestComputeTaxDiscountAllocation(t *testing.T) {
+	lines := []models.TaxLine{{Rate: 18, Amount: 100}, {Rate: 18, Amount: 200}}
+
+	_, b := models.ComputeTax(lines, 100, false)
+	// 200 left after discount, 18% inclusive
+	assert.Equal(t, 169.49, b.TaxableValue)
+	assert.Equal(t, 200.0, models.RoundAmount(b.TaxableValue+b.TotalTax))
+}
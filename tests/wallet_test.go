@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ashishnagargoje0/backend/config"
+	"github.com/ashishnagargoje0/backend/database"
+	"github.com/ashishnagargoje0/backend/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLegacyWalletCreditsMigrate(t *testing.T) {
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	walletTx := config.DB.Collection("wallet_transactions")
+	defer func() {
+		walletTx.DeleteMany(ctx, bson.M{"user_id": bson.M{"$in": bson.A{userID, userID.Hex()}}})
+		config.DB.Collection("wallets").DeleteOne(ctx, bson.M{"_id": userID})
+		config.DB.Collection("ledger_entries").DeleteMany(ctx, bson.M{"postings.user_id": userID})
+	}()
+
+	// Rows as the old manual credit handler wrote them
+	legacy := []interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "user_id": userID.Hex(), "amount": 100.0, "type": "Credit", "reason": "Goodwill", "created_at": time.Now().Add(-48 * time.Hour)},
+		bson.M{"_id": primitive.NewObjectID(), "user_id": userID.Hex(), "amount": 50.5, "type": "Credit", "reason": "Late delivery", "created_at": time.Now().Add(-24 * time.Hour)},
+	}
+	_, err := walletTx.InsertMany(ctx, legacy)
+	assert.NoError(t, err)
+
+	database.RunMigrations()
+	database.RunMigrations() // a second run changes nothing
+
+	var wallet models.Wallet
+	assert.NoError(t, config.DB.Collection("wallets").FindOne(ctx, bson.M{"_id": userID}).Decode(&wallet))
+	assert.Equal(t, 150.5, wallet.Balance)
+
+	cursor, err := walletTx.Find(ctx, bson.M{"user_id": userID})
+	assert.NoError(t, err)
+	var entries []models.WalletTransaction
+	assert.NoError(t, cursor.All(ctx, &entries))
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, models.WalletSourceManual, entries[0].Source)
+		assert.ElementsMatch(t, []float64{100, 150.5}, []float64{entries[0].BalanceAfter, entries[1].BalanceAfter})
+	}
+
+	postings, err := config.DB.Collection("ledger_entries").CountDocuments(ctx, bson.M{
+		"kind":             models.LedgerKindWallet,
+		"postings.user_id": userID,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, postings)
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// Letters and digits that cannot be mistaken for each other when read out
+// (no 0/O or 1/I)
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func randomCode(length int) (string, error) {
+	code := make([]byte, length)
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// GenerateReferralCode returns a random 8-character referral code
+func GenerateReferralCode() (string, error) {
+	return randomCode(8)
+}
+
+// GenerateVoucherCode returns a random voucher code like ABCD-EFGH-JKLM
+func GenerateVoucherCode() (string, error) {
+	code, err := randomCode(12)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{code[:4], code[4:8], code[8:]}, "-"), nil
+}